@@ -0,0 +1,146 @@
+package apikeys
+
+import (
+	"ecommerce-api/tokens"
+	"ecommerce-api/utils"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// APIKeyController handles HTTP requests for users managing their API keys
+type APIKeyController struct {
+	apiKeyService *APIKeyService
+}
+
+// NewAPIKeyController initializes a new APIKeyController
+func NewAPIKeyController(apiKeyService *APIKeyService) *APIKeyController {
+	return &APIKeyController{apiKeyService: apiKeyService}
+}
+
+// userID reads the authenticated user's ID from the context, sending an error response if it is missing or malformed.
+func userID(ctx *gin.Context) (uint, bool) {
+	userIDStr, exists := ctx.Get("userID")
+	if !exists {
+		utils.NewAPIResponse(http.StatusUnauthorized, "Unauthorized", nil, "User ID not found in context").Send(ctx)
+		return 0, false
+	}
+
+	id, err := strconv.ParseUint(userIDStr.(string), 10, 32)
+	if err != nil {
+		utils.NewAPIResponse(http.StatusBadRequest, "Invalid User ID", nil, "User ID conversion failed").Send(ctx)
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// CreateKey godoc
+// @Summary      Create an API key
+// @Description  Creates a named API key that acts as the authenticated user within the given scopes: products:read, products:write, orders:read, orders:write.
+// @Description  The key is only returned in this response. Send it in the X-API-Key header or as "Authorization: ApiKey <key>".
+// @Tags         api-keys
+// @Accept       json
+// @Produce      json
+// @Param        input  body      CreateAPIKeyDTO  true  "Name, scopes and optional expiry"
+// @Success      201    {object}  utils.APIResponse{data=CreatedAPIKey}
+// @Failure      400    {object}  utils.APIResponse
+// @Failure      401    {object}  utils.APIResponse
+// @Failure      409    {object}  utils.APIResponse
+// @Failure      500    {object}  utils.APIResponse
+// @Security     BearerAuth
+// @Router       /users/me/api-keys [post]
+func (c *APIKeyController) CreateKey(ctx *gin.Context) {
+	userID, ok := userID(ctx)
+	if !ok {
+		return
+	}
+
+	var input CreateAPIKeyDTO
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		utils.NewAPIResponse(http.StatusBadRequest, "Invalid input", nil, err.Error()).Send(ctx)
+		return
+	}
+
+	claims, _ := ctx.Get("tokenClaims")
+	accessToken, _ := claims.(*tokens.Claims)
+	mfa := accessToken != nil && accessToken.HasMFA()
+
+	key, err := c.apiKeyService.CreateKey(userID, mfa, ctx.ClientIP(), input)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrInvalidExpiry):
+			utils.NewAPIResponse(http.StatusBadRequest, "Invalid expiry", nil, err.Error()).Send(ctx)
+		case errors.Is(err, ErrTooManyKeys):
+			utils.NewAPIResponse(http.StatusConflict, "Too many API keys", nil, err.Error()).Send(ctx)
+		default:
+			utils.NewAPIResponse(http.StatusInternalServerError, "Failed to create API key", nil, err.Error()).Send(ctx)
+		}
+		return
+	}
+
+	utils.NewAPIResponse(http.StatusCreated, "API key created successfully", key, "").Send(ctx)
+}
+
+// ListKeys godoc
+// @Summary      List API keys
+// @Description  Lists the authenticated user's API keys, newest first. The keys themselves are never shown again, only their prefixes.
+// @Tags         api-keys
+// @Produce      json
+// @Success      200  {object}  utils.APIResponse{data=[]models.APIKey}
+// @Failure      401  {object}  utils.APIResponse
+// @Failure      500  {object}  utils.APIResponse
+// @Security     BearerAuth
+// @Router       /users/me/api-keys [get]
+func (c *APIKeyController) ListKeys(ctx *gin.Context) {
+	userID, ok := userID(ctx)
+	if !ok {
+		return
+	}
+
+	keys, err := c.apiKeyService.ListKeys(userID)
+	if err != nil {
+		utils.NewAPIResponse(http.StatusInternalServerError, "Failed to retrieve API keys", nil, err.Error()).Send(ctx)
+		return
+	}
+
+	utils.NewAPIResponse(http.StatusOK, "API keys retrieved successfully", keys, "").Send(ctx)
+}
+
+// RevokeKey godoc
+// @Summary      Revoke an API key
+// @Description  Revokes one of the authenticated user's API keys. Requests with the key are rejected from then on.
+// @Tags         api-keys
+// @Produce      json
+// @Param        id   path      string  true  "API key ID"
+// @Success      200  {object}  utils.APIResponse
+// @Failure      400  {object}  utils.APIResponse
+// @Failure      401  {object}  utils.APIResponse
+// @Failure      404  {object}  utils.APIResponse
+// @Failure      500  {object}  utils.APIResponse
+// @Security     BearerAuth
+// @Router       /users/me/api-keys/{id} [delete]
+func (c *APIKeyController) RevokeKey(ctx *gin.Context) {
+	userID, ok := userID(ctx)
+	if !ok {
+		return
+	}
+
+	keyID, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
+	if err != nil {
+		utils.NewAPIResponse(http.StatusBadRequest, "Invalid API key ID", nil, err.Error()).Send(ctx)
+		return
+	}
+
+	if err := c.apiKeyService.RevokeKey(userID, uint(keyID), ctx.ClientIP()); err != nil {
+		if errors.Is(err, ErrAPIKeyNotFound) {
+			utils.NewAPIResponse(http.StatusNotFound, "API key not found", nil, err.Error()).Send(ctx)
+		} else {
+			utils.NewAPIResponse(http.StatusInternalServerError, "Failed to revoke API key", nil, err.Error()).Send(ctx)
+		}
+		return
+	}
+
+	utils.NewAPIResponse(http.StatusOK, "API key revoked successfully", nil, "").Send(ctx)
+}
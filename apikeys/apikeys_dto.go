@@ -0,0 +1,20 @@
+package apikeys
+
+import (
+	"time"
+
+	"ecommerce-api/models"
+)
+
+type CreateAPIKeyDTO struct {
+	Name   string               `json:"name" binding:"required,max=100"`
+	Scopes []models.APIKeyScope `json:"scopes" binding:"required,min=1,dive,apiKeyScope"`
+	// ExpiresAt is optional; keys without it stay valid until they are revoked.
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// CreatedAPIKey is returned once, when a key is created. Key is the only copy of the secret.
+type CreatedAPIKey struct {
+	models.APIKey
+	Key string `json:"key"`
+}
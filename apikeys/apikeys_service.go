@@ -0,0 +1,214 @@
+package apikeys
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"ecommerce-api/audit"
+	"ecommerce-api/models"
+	"ecommerce-api/utils"
+
+	"gorm.io/gorm"
+)
+
+// KeyPrefix starts every API key, so that leaked keys are easy to recognise and search for.
+const KeyPrefix = "ek_"
+
+const (
+	// maxKeysPerUser limits the active keys of a user.
+	maxKeysPerUser = 20
+	// lastUsedResolution is how stale a key's last-used timestamp may get before a request updates it,
+	// so that busy integrations do not write on every request.
+	lastUsedResolution = time.Minute
+)
+
+var (
+	ErrAPIKeyNotFound = errors.New("API key not found")
+	ErrTooManyKeys    = errors.New("too many active API keys")
+	ErrInvalidExpiry  = errors.New("expiry must be in the future")
+)
+
+// APIKeyService manages the API keys of users
+type APIKeyService struct {
+	db *gorm.DB
+}
+
+// NewAPIKeyService initializes APIKeyService with database connection
+func NewAPIKeyService(db *gorm.DB) *APIKeyService {
+	return &APIKeyService{db: db}
+}
+
+// CreateKey creates an API key for the user. The key has the form ek_<prefix>_<secret> and is only
+// returned here; afterwards it is identified by its prefix.
+//
+// Parameters:
+// - userID: The unique identifier of the user the key acts as.
+// - mfa: Whether the user passed a second factor in the login that creates the key.
+// - ip: The IP address of the user, for the audit log.
+// - input: The key's name, scopes and optional expiry.
+//
+// Returns:
+// - The created key, including the secret.
+// - ErrInvalidExpiry if the expiry is not in the future.
+// - ErrTooManyKeys if the user already has the maximum number of active keys.
+// - An error if any database operation fails.
+func (s *APIKeyService) CreateKey(userID uint, mfa bool, ip string, input CreateAPIKeyDTO) (*CreatedAPIKey, error) {
+	if input.ExpiresAt != nil && !input.ExpiresAt.After(time.Now()) {
+		return nil, ErrInvalidExpiry
+	}
+
+	key, prefix, err := generateKey()
+	if err != nil {
+		return nil, errors.New("failed to generate API key")
+	}
+
+	scopes := models.ScopeList{}
+	for _, scope := range models.APIKeyScopes() {
+		for _, requested := range input.Scopes {
+			if requested == scope {
+				scopes = append(scopes, scope)
+				break
+			}
+		}
+	}
+
+	record := models.APIKey{
+		UserID:    userID,
+		Name:      strings.TrimSpace(input.Name),
+		Prefix:    prefix,
+		KeyHash:   utils.HashToken(key),
+		Scopes:    scopes,
+		MFA:       mfa,
+		ExpiresAt: input.ExpiresAt,
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		// Locking the user serialises concurrent creations, so the limit cannot be exceeded.
+		if err := tx.Exec("SELECT 1 FROM users WHERE id = ? FOR UPDATE", userID).Error; err != nil {
+			return errors.New("failed to lock user: " + err.Error())
+		}
+
+		var active int64
+		if err := tx.Model(&models.APIKey{}).Where("user_id = ? AND revoked_at IS NULL", userID).Count(&active).Error; err != nil {
+			return errors.New("failed to count API keys: " + err.Error())
+		}
+		if active >= maxKeysPerUser {
+			return ErrTooManyKeys
+		}
+
+		if err := tx.Create(&record).Error; err != nil {
+			return errors.New("failed to store API key: " + err.Error())
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	audit.Record(s.db, models.AuditLog{Event: models.AuditAPIKeyCreated, UserID: &userID, IP: ip, Details: fmt.Sprintf("API key %d (%s)", record.ID, record.Prefix)})
+	return &CreatedAPIKey{APIKey: record, Key: key}, nil
+}
+
+// ListKeys returns the API keys of the user, newest first, including revoked and expired ones.
+func (s *APIKeyService) ListKeys(userID uint) ([]models.APIKey, error) {
+	keys := []models.APIKey{}
+	if err := s.db.Where("user_id = ?", userID).Order("created_at DESC, id DESC").Find(&keys).Error; err != nil {
+		return nil, errors.New("failed to retrieve API keys: " + err.Error())
+	}
+	return keys, nil
+}
+
+// RevokeKey revokes one of the user's API keys. Requests with the key are rejected immediately.
+//
+// Returns:
+// - ErrAPIKeyNotFound if the user has no such key or it was already revoked.
+// - An error if any database operation fails.
+func (s *APIKeyService) RevokeKey(userID, keyID uint, ip string) error {
+	result := s.db.Model(&models.APIKey{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", keyID, userID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return errors.New("failed to revoke API key: " + result.Error.Error())
+	}
+	if result.RowsAffected == 0 {
+		return ErrAPIKeyNotFound
+	}
+
+	audit.Record(s.db, models.AuditLog{Event: models.AuditAPIKeyRevoked, UserID: &userID, IP: ip, Details: fmt.Sprintf("API key %d", keyID)})
+	return nil
+}
+
+// RevokeAll revokes every active API key of the user within tx, for callers that take an account away
+// from whoever held it.
+func RevokeAll(tx *gorm.DB, userID uint) error {
+	if err := tx.Model(&models.APIKey{}).Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now()).Error; err != nil {
+		return errors.New("failed to revoke API keys: " + err.Error())
+	}
+	return nil
+}
+
+// Authenticate looks up the API key presented with a request.
+//
+// Returns:
+// - The key if it is valid, after updating its last-used timestamp.
+// - utils.ErrInvalidToken if the key is unknown, revoked or expired, or its user was deleted.
+// - utils.ErrAccountSuspended if its user is suspended.
+// - An error if any database operation fails.
+func Authenticate(db *gorm.DB, key string) (*models.APIKey, error) {
+	if !strings.HasPrefix(key, KeyPrefix) {
+		return nil, utils.ErrInvalidToken
+	}
+
+	var record models.APIKey
+	if err := db.Where("key_hash = ?", utils.HashToken(key)).Take(&record).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, utils.ErrInvalidToken
+		}
+		return nil, errors.New("failed to retrieve API key: " + err.Error())
+	}
+
+	now := time.Now()
+	if record.RevokedAt != nil || (record.ExpiresAt != nil && !record.ExpiresAt.After(now)) {
+		return nil, utils.ErrInvalidToken
+	}
+
+	var user models.User
+	if err := db.Select("id", "suspended_at").Take(&user, record.UserID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, utils.ErrInvalidToken
+		}
+		return nil, errors.New("failed to retrieve user: " + err.Error())
+	}
+	if user.SuspendedAt != nil {
+		return nil, utils.ErrAccountSuspended
+	}
+
+	if record.LastUsedAt == nil || now.Sub(*record.LastUsedAt) >= lastUsedResolution {
+		if err := db.Model(&record).Update("last_used_at", now).Error; err != nil {
+			// The request is still authenticated; the timestamp is informational.
+			log.Printf("failed to update last use of API key %d: %v", record.ID, err)
+		}
+	}
+	return &record, nil
+}
+
+// generateKey returns a new API key and the prefix that identifies it.
+func generateKey() (key, prefix string, err error) {
+	id := make([]byte, 4)
+	if _, err := rand.Read(id); err != nil {
+		return "", "", err
+	}
+	secret, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return "", "", err
+	}
+
+	prefix = KeyPrefix + hex.EncodeToString(id)
+	return prefix + "_" + secret, prefix, nil
+}
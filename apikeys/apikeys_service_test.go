@@ -0,0 +1,164 @@
+package apikeys
+
+import (
+	"database/sql/driver"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"ecommerce-api/internal/testdb"
+	"ecommerce-api/models"
+	"ecommerce-api/utils"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func newMockAPIKeyService(t *testing.T) (*APIKeyService, sqlmock.Sqlmock) {
+	gormDB, mock := testdb.New(t)
+	return NewAPIKeyService(gormDB), mock
+}
+
+var keyQuery = regexp.QuoteMeta(`SELECT * FROM "api_keys" WHERE key_hash = $1 LIMIT $2`)
+
+// TestCreateKey verifies that only a hash of the key is stored and that duplicate scopes are dropped.
+func TestCreateKey(t *testing.T) {
+	service, mock := newMockAPIKeyService(t)
+
+	var storedHash string
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`SELECT 1 FROM users WHERE id = $1 FOR UPDATE`)).
+		WithArgs(7).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM "api_keys" WHERE user_id = $1 AND revoked_at IS NULL`)).
+		WithArgs(7).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "api_keys" ("user_id","name","prefix","key_hash","scopes","mfa","expires_at","last_used_at","revoked_at","created_at") VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10) RETURNING "id"`)).
+		WithArgs(7, "ERP", sqlmock.AnyArg(), hashArg{&storedHash}, "products:read,orders:write", false, nil, nil, nil, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "audit_logs"`)).
+		WithArgs("api_key_created", 7, nil, "203.0.113.7", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectCommit()
+
+	created, err := service.CreateKey(7, false, "203.0.113.7", CreateAPIKeyDTO{
+		Name:   " ERP ",
+		Scopes: []models.APIKeyScope{models.ScopeOrdersWrite, models.ScopeProductsRead, models.ScopeOrdersWrite},
+	})
+
+	if assert.NoError(t, err) {
+		assert.True(t, strings.HasPrefix(created.Key, created.Prefix+"_"))
+		assert.Len(t, created.Prefix, len(KeyPrefix)+8)
+		assert.Equal(t, utils.HashToken(created.Key), storedHash)
+		assert.NotContains(t, storedHash, created.Key)
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// hashArg captures the key hash passed to the database.
+type hashArg struct {
+	value *string
+}
+
+func (a hashArg) Match(v driver.Value) bool {
+	s, ok := v.(string)
+	*a.value = s
+	return ok
+}
+
+func TestCreateKeyRejectsPastExpiry(t *testing.T) {
+	service, mock := newMockAPIKeyService(t)
+
+	past := time.Now().Add(-time.Hour)
+	_, err := service.CreateKey(7, false, "", CreateAPIKeyDTO{Name: "ERP", Scopes: []models.APIKeyScope{models.ScopeOrdersRead}, ExpiresAt: &past})
+
+	assert.ErrorIs(t, err, ErrInvalidExpiry)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAuthenticate(t *testing.T) {
+	key := "ek_0a1b2c3d_secret"
+	userQuery := regexp.QuoteMeta(`SELECT "id","suspended_at" FROM "users" WHERE "users"."id" = $1 AND "users"."deleted_at" IS NULL LIMIT $2`)
+	columns := []string{"id", "user_id", "scopes", "expires_at", "last_used_at", "revoked_at"}
+
+	t.Run("Valid Key", func(t *testing.T) {
+		service, mock := newMockAPIKeyService(t)
+		mock.ExpectQuery(keyQuery).WithArgs(utils.HashToken(key), 1).
+			WillReturnRows(sqlmock.NewRows(columns).AddRow(3, 7, "products:read", nil, nil, nil))
+		mock.ExpectQuery(userQuery).WithArgs(7, 1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "suspended_at"}).AddRow(7, nil))
+		mock.ExpectBegin()
+		mock.ExpectExec(regexp.QuoteMeta(`UPDATE "api_keys" SET "last_used_at"=$1 WHERE "id" = $2`)).
+			WithArgs(sqlmock.AnyArg(), 3).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		record, err := Authenticate(service.db, key)
+
+		if assert.NoError(t, err) {
+			assert.Equal(t, uint(7), record.UserID)
+			assert.Equal(t, models.ScopeList{models.ScopeProductsRead}, record.Scopes)
+		}
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Recently Used Key", func(t *testing.T) {
+		service, mock := newMockAPIKeyService(t)
+		mock.ExpectQuery(keyQuery).WithArgs(utils.HashToken(key), 1).
+			WillReturnRows(sqlmock.NewRows(columns).AddRow(3, 7, "products:read", nil, time.Now().Add(-time.Second), nil))
+		mock.ExpectQuery(userQuery).WithArgs(7, 1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "suspended_at"}).AddRow(7, nil))
+
+		_, err := Authenticate(service.db, key)
+
+		assert.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Revoked Key", func(t *testing.T) {
+		service, mock := newMockAPIKeyService(t)
+		mock.ExpectQuery(keyQuery).WithArgs(utils.HashToken(key), 1).
+			WillReturnRows(sqlmock.NewRows(columns).AddRow(3, 7, "products:read", nil, nil, time.Now()))
+
+		_, err := Authenticate(service.db, key)
+
+		assert.ErrorIs(t, err, utils.ErrInvalidToken)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Expired Key", func(t *testing.T) {
+		service, mock := newMockAPIKeyService(t)
+		mock.ExpectQuery(keyQuery).WithArgs(utils.HashToken(key), 1).
+			WillReturnRows(sqlmock.NewRows(columns).AddRow(3, 7, "products:read", time.Now().Add(-time.Minute), nil, nil))
+
+		_, err := Authenticate(service.db, key)
+
+		assert.ErrorIs(t, err, utils.ErrInvalidToken)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Suspended User", func(t *testing.T) {
+		service, mock := newMockAPIKeyService(t)
+		mock.ExpectQuery(keyQuery).WithArgs(utils.HashToken(key), 1).
+			WillReturnRows(sqlmock.NewRows(columns).AddRow(3, 7, "products:read", nil, nil, nil))
+		mock.ExpectQuery(userQuery).WithArgs(7, 1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "suspended_at"}).AddRow(7, time.Now()))
+
+		_, err := Authenticate(service.db, key)
+
+		assert.ErrorIs(t, err, utils.ErrAccountSuspended)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Not An API Key", func(t *testing.T) {
+		service, mock := newMockAPIKeyService(t)
+
+		_, err := Authenticate(service.db, "eyJhbGciOi")
+
+		assert.ErrorIs(t, err, utils.ErrInvalidToken)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
@@ -0,0 +1,17 @@
+package audit
+
+import (
+	"log"
+
+	"ecommerce-api/models"
+
+	"gorm.io/gorm"
+)
+
+// Record appends an entry to the audit log. Failing to write the entry must not fail the operation
+// being audited, so errors are logged rather than returned.
+func Record(db *gorm.DB, entry models.AuditLog) {
+	if err := db.Create(&entry).Error; err != nil {
+		log.Printf("failed to record audit event %s: %v", entry.Event, err)
+	}
+}
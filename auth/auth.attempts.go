@@ -0,0 +1,282 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"ecommerce-api/audit"
+	"ecommerce-api/models"
+	"ecommerce-api/utils"
+)
+
+// Attempts is the failed login state of an account or client IP.
+type Attempts struct {
+	// Failures counts consecutive failed logins.
+	Failures int
+	// BlockedUntil is the time before which further attempts are refused.
+	BlockedUntil time.Time
+}
+
+// AttemptStore keeps failed login counters. Counters are shared by every process that serves logins,
+// so production deployments with several instances need a shared implementation such as Redis;
+// MemoryAttemptStore is enough for a single instance and for tests.
+type AttemptStore interface {
+	// Get returns the attempts recorded for key, or zero Attempts if there are none.
+	Get(key string) (Attempts, error)
+	// Fail records a failed attempt for key, blocks it until blockedUntil and returns the new number
+	// of failures. The record is forgotten once ttl passes without another failure.
+	Fail(key string, blockedUntil func(failures int) time.Time, ttl time.Duration) (int, error)
+	// Reset forgets the attempts recorded for key.
+	Reset(key string) error
+}
+
+// LockoutPolicy decides how long an account or IP is blocked after failed logins.
+//
+// The first FreeAttempts failures are not delayed. Each further failure doubles the delay, starting
+// at BaseDelay, until MaxAttempts failures lock the key out for LockoutDuration. Failures are
+// remembered for Window after the last one, so a key that fails again after its lockout ends is
+// locked out again straight away.
+type LockoutPolicy struct {
+	FreeAttempts    int
+	BaseDelay       time.Duration
+	MaxAttempts     int
+	LockoutDuration time.Duration
+	Window          time.Duration
+}
+
+// Delay returns how long to block further attempts after the given number of consecutive failures.
+func (p LockoutPolicy) Delay(failures int) time.Duration {
+	if p.MaxAttempts > 0 && failures >= p.MaxAttempts {
+		return p.LockoutDuration
+	}
+	if failures <= p.FreeAttempts {
+		return 0
+	}
+
+	delay := p.BaseDelay
+	for i := p.FreeAttempts + 1; i < failures && delay < p.LockoutDuration; i++ {
+		delay *= 2
+	}
+	if delay > p.LockoutDuration {
+		return p.LockoutDuration
+	}
+	return delay
+}
+
+// LockedOut reports whether the number of failures reached the lockout threshold.
+func (p LockoutPolicy) LockedOut(failures int) bool {
+	return p.MaxAttempts > 0 && failures >= p.MaxAttempts
+}
+
+// ThrottledError is returned by Login and VerifyMFA while an account or client IP is blocked after failed logins.
+type ThrottledError struct {
+	RetryAfter time.Duration
+}
+
+func (e *ThrottledError) Error() string {
+	return fmt.Sprintf("too many failed login attempts, retry in %s", e.RetryAfter.Round(time.Second))
+}
+
+// loginKeys returns the attempt store keys for an email address and a client IP.
+func loginKeys(email, ip string) (account, client string) {
+	return "login:account:" + strings.ToLower(strings.TrimSpace(email)), "login:ip:" + ip
+}
+
+// checkLoginThrottle returns a ThrottledError if the account or the client IP is blocked.
+func (s *AuthService) checkLoginThrottle(accountKey, ipKey string) error {
+	now := time.Now()
+	var wait time.Duration
+	for _, key := range []string{accountKey, ipKey} {
+		attempts, err := s.attempts.Get(key)
+		if err != nil {
+			return errors.New("failed to read login attempts: " + err.Error())
+		}
+		if remaining := attempts.BlockedUntil.Sub(now); remaining > wait {
+			wait = remaining
+		}
+	}
+
+	if wait > 0 {
+		return &ThrottledError{RetryAfter: wait}
+	}
+	return nil
+}
+
+// recordFailedLogin counts a failed login against the account and the client IP, and records a
+// lockout in the audit log when one begins. userID is nil when no user has the email.
+func (s *AuthService) recordFailedLogin(email string, userID *uint, client ClientInfo) {
+	accountKey, ipKey := loginKeys(email, client.IP)
+	limits := []struct {
+		key     string
+		policy  LockoutPolicy
+		subject string
+	}{
+		{accountKey, s.settings.AccountLockout, "account " + email},
+		{ipKey, s.settings.IPLockout, "ip " + client.IP},
+	}
+
+	now := time.Now()
+	for _, limit := range limits {
+		policy := limit.policy
+		failures, err := s.attempts.Fail(limit.key, func(failures int) time.Time {
+			return now.Add(policy.Delay(failures))
+		}, policy.Window)
+		if err != nil {
+			log.Printf("failed to record failed login for %s: %v", limit.subject, err)
+			continue
+		}
+
+		// Attempts are refused while a key is locked out, so reaching the limit here always starts a new lockout.
+		if policy.LockedOut(failures) {
+			audit.Record(s.db, models.AuditLog{
+				Event:   models.AuditLoginLocked,
+				UserID:  userID,
+				IP:      client.IP,
+				Details: fmt.Sprintf("%s locked out for %s after %d failed logins", limit.subject, policy.LockoutDuration, failures),
+			})
+		}
+	}
+}
+
+// clearFailedLogins forgets the failed logins of an account after it proves its identity, and records
+// the end of a lockout in the audit log. Failures from the client IP are kept, so that logging in to
+// one account does not grant more guesses against others.
+func (s *AuthService) clearFailedLogins(email string, userID uint, client ClientInfo, reason string) {
+	accountKey, _ := loginKeys(email, client.IP)
+	attempts, err := s.attempts.Get(accountKey)
+	if err != nil {
+		log.Printf("failed to read failed logins of user %d: %v", userID, err)
+		return
+	}
+	if attempts.Failures == 0 {
+		return
+	}
+
+	if err := s.attempts.Reset(accountKey); err != nil {
+		log.Printf("failed to reset failed logins of user %d: %v", userID, err)
+		return
+	}
+	if s.settings.AccountLockout.LockedOut(attempts.Failures) {
+		audit.Record(s.db, models.AuditLog{
+			Event:   models.AuditLoginUnlocked,
+			UserID:  &userID,
+			IP:      client.IP,
+			Details: reason,
+		})
+	}
+}
+
+var (
+	dummyPasswordHash     string
+	dummyPasswordHashOnce sync.Once
+)
+
+// compareDummyPassword spends as long as checking a real password, so that responses for unknown
+// emails cannot be told apart by timing.
+func compareDummyPassword(password string) {
+	dummyPasswordHashOnce.Do(func() {
+		dummyPasswordHash, _ = utils.HashPassword("not a real password")
+	})
+	utils.ComparePasswords(password, dummyPasswordHash)
+}
+
+// MemoryAttemptStore is an AttemptStore that keeps counters in process memory.
+type MemoryAttemptStore struct {
+	mu      sync.Mutex
+	entries map[string]*memoryAttempt
+	now     func() time.Time
+}
+
+// memoryAttemptPruneSize is the number of entries above which expired entries are swept before adding
+// another, so counters for clients that never come back do not accumulate.
+const memoryAttemptPruneSize = 10000
+
+type memoryAttempt struct {
+	Attempts
+	expiresAt time.Time
+}
+
+// NewMemoryAttemptStore creates an empty MemoryAttemptStore.
+func NewMemoryAttemptStore() *MemoryAttemptStore {
+	return &MemoryAttemptStore{entries: make(map[string]*memoryAttempt), now: time.Now}
+}
+
+var (
+	defaultAttempts     *MemoryAttemptStore
+	defaultAttemptsOnce sync.Once
+)
+
+// DefaultAttemptStore returns the process-wide MemoryAttemptStore, creating it on first use. Every
+// AuthService of the process must use it, or failures counted by one would not lock out the other.
+func DefaultAttemptStore() *MemoryAttemptStore {
+	defaultAttemptsOnce.Do(func() {
+		defaultAttempts = NewMemoryAttemptStore()
+	})
+	return defaultAttempts
+}
+
+func (s *MemoryAttemptStore) Get(key string) (Attempts, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if entry := s.entry(key); entry != nil {
+		return entry.Attempts, nil
+	}
+	return Attempts{}, nil
+}
+
+func (s *MemoryAttemptStore) Fail(key string, blockedUntil func(failures int) time.Time, ttl time.Duration) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry := s.entry(key)
+	if entry == nil {
+		if len(s.entries) >= memoryAttemptPruneSize {
+			s.prune()
+		}
+		entry = &memoryAttempt{}
+		s.entries[key] = entry
+	}
+	entry.Failures++
+	entry.BlockedUntil = blockedUntil(entry.Failures)
+	entry.expiresAt = s.now().Add(ttl)
+	if entry.BlockedUntil.After(entry.expiresAt) {
+		entry.expiresAt = entry.BlockedUntil
+	}
+	return entry.Failures, nil
+}
+
+func (s *MemoryAttemptStore) Reset(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.entries, key)
+	return nil
+}
+
+// entry returns the live entry for key, dropping it if it has expired. The caller must hold s.mu.
+func (s *MemoryAttemptStore) entry(key string) *memoryAttempt {
+	entry, exists := s.entries[key]
+	if !exists {
+		return nil
+	}
+	if !s.now().Before(entry.expiresAt) {
+		delete(s.entries, key)
+		return nil
+	}
+	return entry
+}
+
+// prune drops every expired entry. The caller must hold s.mu.
+func (s *MemoryAttemptStore) prune() {
+	now := s.now()
+	for key, entry := range s.entries {
+		if !now.Before(entry.expiresAt) {
+			delete(s.entries, key)
+		}
+	}
+}
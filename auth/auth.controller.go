@@ -2,9 +2,14 @@ package auth
 
 import (
 	"ecommerce-api/models"
+	"ecommerce-api/tokens"
 	"ecommerce-api/utils"
 	"encoding/json"
+	"errors"
+	"io"
+	"math"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
@@ -24,12 +29,11 @@ func NewAuthController(authService *AuthService) *AuthController {
 
 // Register godoc
 // @Summary      Register a new user
-// @Description  Registers a new user with email and password, with optional admin privileges
+// @Description  Registers a new customer with email and password and emails a link to verify the address
 // @Tags         auth
 // @Accept       json
 // @Produce      json
 // @Param        input  body      RegisterDTO   true  "User registration details"
-// @Param        admin  query     bool          false "Set to true to register user as admin"
 // @Success      200    {object}  utils.APIResponse
 // @Failure      400    {object}  utils.APIResponse
 // @Failure      500    {object}  utils.APIResponse
@@ -57,13 +61,8 @@ func (c *AuthController) Register(ctx *gin.Context) {
 		return
 	}
 
-    isAdmin := false
-    if adminQuery := ctx.Query("admin"); adminQuery == "true" {
-        isAdmin = true
-    }
-
     // Register the user using the auth service
-    if err := c.authService.Register(&userDTO, isAdmin); err != nil {
+    if err := c.authService.Register(&userDTO); err != nil {
         if err == utils.ErrUserExists {
             utils.NewAPIResponse(http.StatusBadRequest, "User with email already exists", nil, err.Error()).Send(ctx)
         } else {
@@ -79,15 +78,17 @@ func (c *AuthController) Register(ctx *gin.Context) {
 
 // Login godoc
 // @Summary      Login a user
-// @Description  Authenticates a user and returns a JWT token
+// @Description  Authenticates a user and returns a short-lived access token and a refresh token. Repeated failures are delayed and eventually lock the account or client IP out for a while. Users with two-factor authentication enabled receive an MFA challenge instead, to be completed at /auth/mfa/verify.
 // @Tags         auth
 // @Accept       json
 // @Produce      json
 // @Param        input  body      LoginDTO   true  "User login credentials"
-// @Success      200    {object}  utils.APIResponse{data=string} "JWT Token"
+// @Success      200    {object}  utils.APIResponse{data=TokenPair}
+// @Success      202    {object}  utils.APIResponse{data=MFAChallenge}
 // @Failure      400    {object}  utils.APIResponse
 // @Failure      401    {object}  utils.APIResponse
-// @Failure      404    {object}  utils.APIResponse
+// @Failure      403    {object}  utils.APIResponse
+// @Failure      429    {object}  utils.APIResponse
 // @Failure      500    {object}  utils.APIResponse
 // @Router       /auth/login [post]
 func (c *AuthController) Login(ctx *gin.Context) {
@@ -103,18 +104,506 @@ func (c *AuthController) Login(ctx *gin.Context) {
 		return
 	}
 
-	token, err := c.authService.Login(input.Email, input.Password)
+	pair, challenge, err := c.authService.Login(input.Email, input.Password, clientInfo(ctx))
 	if err != nil {
-		switch err {
-		case utils.ErrUserNotFound:
-			utils.NewAPIResponse(http.StatusNotFound, "User not found", nil, "").Send(ctx)
-		case utils.ErrInvalidCredentials:
-			utils.NewAPIResponse(http.StatusUnauthorized, "Invalid credentials", nil, "").Send(ctx)
+		var throttled *ThrottledError
+		switch {
+		case errors.As(err, &throttled):
+			ctx.Header("Retry-After", strconv.Itoa(int(math.Ceil(throttled.RetryAfter.Seconds()))))
+			utils.NewAPIResponse(http.StatusTooManyRequests, "Too many failed login attempts", nil, err.Error()).Send(ctx)
+		case errors.Is(err, utils.ErrInvalidCredentials):
+			utils.NewAPIResponse(http.StatusUnauthorized, "Invalid email or password", nil, "").Send(ctx)
+		case errors.Is(err, utils.ErrAccountSuspended):
+			utils.NewAPIResponse(http.StatusForbidden, "Account suspended", nil, err.Error()).Send(ctx)
 		default:
 			utils.NewAPIResponse(http.StatusInternalServerError, "Failed to generate token", nil, "").Send(ctx)
 		}
 		return
 	}
 
-	utils.NewAPIResponse(http.StatusOK, "Login successful", gin.H{"token": token}, "").Send(ctx)
+	if challenge != nil {
+		utils.NewAPIResponse(http.StatusAccepted, "MFA required", challenge, "").Send(ctx)
+		return
+	}
+
+	utils.NewAPIResponse(http.StatusOK, "Login successful", pair, "").Send(ctx)
+}
+
+// Refresh godoc
+// @Summary      Refresh an access token
+// @Description  Exchanges a refresh token for a new access token and refresh token. The presented refresh token can only be used once; reusing it revokes every token descended from the same login.
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        input  body      RefreshTokenDTO  true  "Refresh token"
+// @Success      200    {object}  utils.APIResponse{data=TokenPair}
+// @Failure      400    {object}  utils.APIResponse
+// @Failure      401    {object}  utils.APIResponse
+// @Failure      403    {object}  utils.APIResponse
+// @Failure      500    {object}  utils.APIResponse
+// @Router       /auth/refresh [post]
+func (c *AuthController) Refresh(ctx *gin.Context) {
+	var input RefreshTokenDTO
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		utils.NewAPIResponse(http.StatusBadRequest, "Invalid input", nil, err.Error()).Send(ctx)
+		return
+	}
+
+	pair, err := c.authService.Refresh(input.RefreshToken, clientInfo(ctx))
+	if err != nil {
+		switch {
+		case errors.Is(err, utils.ErrInvalidToken):
+			utils.NewAPIResponse(http.StatusUnauthorized, "Invalid refresh token", nil, err.Error()).Send(ctx)
+		case errors.Is(err, utils.ErrAccountSuspended):
+			utils.NewAPIResponse(http.StatusForbidden, "Account suspended", nil, err.Error()).Send(ctx)
+		default:
+			utils.NewAPIResponse(http.StatusInternalServerError, "Failed to refresh token", nil, err.Error()).Send(ctx)
+		}
+		return
+	}
+
+	utils.NewAPIResponse(http.StatusOK, "Token refreshed successfully", pair, "").Send(ctx)
+}
+
+// Logout godoc
+// @Summary      Log out
+// @Description  Revokes the access token used for the request. Pass the refresh token to end the session on this device, or all_devices to end every session of the user.
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        input  body      LogoutDTO  false  "Sessions to end"
+// @Success      200    {object}  utils.APIResponse
+// @Failure      400    {object}  utils.APIResponse
+// @Failure      401    {object}  utils.APIResponse
+// @Failure      500    {object}  utils.APIResponse
+// @Security     BearerAuth
+// @Router       /auth/logout [post]
+func (c *AuthController) Logout(ctx *gin.Context) {
+	// The body is optional; an empty request only revokes the access token.
+	var input LogoutDTO
+	if err := ctx.ShouldBindJSON(&input); err != nil && !errors.Is(err, io.EOF) {
+		utils.NewAPIResponse(http.StatusBadRequest, "Invalid input", nil, err.Error()).Send(ctx)
+		return
+	}
+
+	value, exists := ctx.Get("tokenClaims")
+	claims, ok := value.(*tokens.Claims)
+	if !exists || !ok {
+		utils.NewAPIResponse(http.StatusUnauthorized, "Unauthorized", nil, "Token claims not found in context").Send(ctx)
+		return
+	}
+
+	userID, err := claims.UserID()
+	if err != nil {
+		utils.NewAPIResponse(http.StatusBadRequest, "Invalid User ID", nil, "User ID conversion failed").Send(ctx)
+		return
+	}
+
+	if err := c.authService.Logout(userID, claims, input); err != nil {
+		if errors.Is(err, utils.ErrInvalidToken) {
+			utils.NewAPIResponse(http.StatusBadRequest, "Invalid refresh token", nil, err.Error()).Send(ctx)
+		} else {
+			utils.NewAPIResponse(http.StatusInternalServerError, "Failed to log out", nil, err.Error()).Send(ctx)
+		}
+		return
+	}
+
+	utils.NewAPIResponse(http.StatusOK, "Logged out successfully", nil, "").Send(ctx)
+}
+
+// ForgotPassword godoc
+// @Summary      Request a password reset
+// @Description  Emails a single-use password reset link to the user. The response is the same whether or not the email is registered.
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        input  body      ForgotPasswordDTO  true  "Account email"
+// @Success      202    {object}  utils.APIResponse
+// @Failure      400    {object}  utils.APIResponse
+// @Failure      500    {object}  utils.APIResponse
+// @Router       /auth/password/forgot [post]
+func (c *AuthController) ForgotPassword(ctx *gin.Context) {
+	var input ForgotPasswordDTO
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		utils.NewAPIResponse(http.StatusBadRequest, "Invalid input", nil, err.Error()).Send(ctx)
+		return
+	}
+
+	if err := c.authService.ForgotPassword(input.Email); err != nil {
+		utils.NewAPIResponse(http.StatusInternalServerError, "Failed to send password reset email", nil, err.Error()).Send(ctx)
+		return
+	}
+
+	utils.NewAPIResponse(http.StatusAccepted, "If the email is registered, a password reset link has been sent", nil, "").Send(ctx)
+}
+
+// ResetPassword godoc
+// @Summary      Reset a password
+// @Description  Sets a new password with the token from a password reset email. The token can be used once, and every session of the user is ended.
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        input  body      ResetPasswordDTO  true  "Reset token and new password"
+// @Success      200    {object}  utils.APIResponse
+// @Failure      400    {object}  utils.APIResponse
+// @Failure      500    {object}  utils.APIResponse
+// @Router       /auth/password/reset [post]
+func (c *AuthController) ResetPassword(ctx *gin.Context) {
+	var input ResetPasswordDTO
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		utils.NewAPIResponse(http.StatusBadRequest, "Invalid input", nil, err.Error()).Send(ctx)
+		return
+	}
+
+	if err := c.authService.ResetPassword(input.Token, input.Password); err != nil {
+		switch {
+		case errors.Is(err, ErrWeakPassword):
+			utils.NewAPIResponse(http.StatusBadRequest, "Validation error", nil, err.Error()).Send(ctx)
+		case errors.Is(err, utils.ErrInvalidToken):
+			utils.NewAPIResponse(http.StatusBadRequest, "Invalid or expired reset token", nil, err.Error()).Send(ctx)
+		default:
+			utils.NewAPIResponse(http.StatusInternalServerError, "Failed to reset password", nil, err.Error()).Send(ctx)
+		}
+		return
+	}
+
+	utils.NewAPIResponse(http.StatusOK, "Password reset successfully", nil, "").Send(ctx)
+}
+
+// VerifyEmail godoc
+// @Summary      Verify an email address
+// @Description  Confirms the user's email address with the token from the verification email.
+// @Tags         auth
+// @Produce      json
+// @Param        token  query     string  true  "Verification token"
+// @Success      200    {object}  utils.APIResponse
+// @Failure      400    {object}  utils.APIResponse
+// @Failure      500    {object}  utils.APIResponse
+// @Router       /auth/verify [get]
+func (c *AuthController) VerifyEmail(ctx *gin.Context) {
+	token := ctx.Query("token")
+	if token == "" {
+		utils.NewAPIResponse(http.StatusBadRequest, "Invalid input", nil, "token is required").Send(ctx)
+		return
+	}
+
+	if err := c.authService.VerifyEmail(token); err != nil {
+		if errors.Is(err, utils.ErrInvalidToken) {
+			utils.NewAPIResponse(http.StatusBadRequest, "Invalid or expired verification token", nil, err.Error()).Send(ctx)
+		} else {
+			utils.NewAPIResponse(http.StatusInternalServerError, "Failed to verify email", nil, err.Error()).Send(ctx)
+		}
+		return
+	}
+
+	utils.NewAPIResponse(http.StatusOK, "Email verified successfully", nil, "").Send(ctx)
+}
+
+// ResendVerification godoc
+// @Summary      Resend the verification email
+// @Description  Emails the authenticated user a new verification link. Earlier links stop working.
+// @Tags         auth
+// @Produce      json
+// @Success      202  {object}  utils.APIResponse
+// @Failure      401  {object}  utils.APIResponse
+// @Failure      409  {object}  utils.APIResponse
+// @Failure      500  {object}  utils.APIResponse
+// @Security     BearerAuth
+// @Router       /auth/verify/resend [post]
+func (c *AuthController) ResendVerification(ctx *gin.Context) {
+	userIDStr, exists := ctx.Get("userID")
+	if !exists {
+		utils.NewAPIResponse(http.StatusUnauthorized, "Unauthorized", nil, "User ID not found in context").Send(ctx)
+		return
+	}
+
+	userID, err := strconv.ParseUint(userIDStr.(string), 10, 32)
+	if err != nil {
+		utils.NewAPIResponse(http.StatusBadRequest, "Invalid User ID", nil, "User ID conversion failed").Send(ctx)
+		return
+	}
+
+	if err := c.authService.ResendVerification(uint(userID)); err != nil {
+		switch {
+		case errors.Is(err, ErrAlreadyVerified):
+			utils.NewAPIResponse(http.StatusConflict, "Email already verified", nil, err.Error()).Send(ctx)
+		case errors.Is(err, utils.ErrUserNotFound):
+			utils.NewAPIResponse(http.StatusUnauthorized, "Unauthorized", nil, err.Error()).Send(ctx)
+		default:
+			utils.NewAPIResponse(http.StatusInternalServerError, "Failed to send verification email", nil, err.Error()).Send(ctx)
+		}
+		return
+	}
+
+	utils.NewAPIResponse(http.StatusAccepted, "Verification email sent", nil, "").Send(ctx)
+}
+
+// EnrollMFA godoc
+// @Summary      Start two-factor authentication setup
+// @Description  Generates a TOTP secret for the authenticated user. Show provisioning_uri as a QR code, then call /auth/mfa/confirm with a code from the authenticator app.
+// @Tags         auth
+// @Produce      json
+// @Success      200  {object}  utils.APIResponse{data=MFAEnrollment}
+// @Failure      401  {object}  utils.APIResponse
+// @Failure      409  {object}  utils.APIResponse
+// @Failure      500  {object}  utils.APIResponse
+// @Security     BearerAuth
+// @Router       /auth/mfa/enroll [post]
+func (c *AuthController) EnrollMFA(ctx *gin.Context) {
+	userIDStr, exists := ctx.Get("userID")
+	if !exists {
+		utils.NewAPIResponse(http.StatusUnauthorized, "Unauthorized", nil, "User ID not found in context").Send(ctx)
+		return
+	}
+
+	userID, err := strconv.ParseUint(userIDStr.(string), 10, 32)
+	if err != nil {
+		utils.NewAPIResponse(http.StatusBadRequest, "Invalid User ID", nil, "User ID conversion failed").Send(ctx)
+		return
+	}
+
+	enrollment, err := c.authService.EnrollMFA(uint(userID))
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrMFAAlreadyEnabled):
+			utils.NewAPIResponse(http.StatusConflict, "Two-factor authentication already enabled", nil, err.Error()).Send(ctx)
+		case errors.Is(err, utils.ErrUserNotFound):
+			utils.NewAPIResponse(http.StatusUnauthorized, "Unauthorized", nil, err.Error()).Send(ctx)
+		default:
+			utils.NewAPIResponse(http.StatusInternalServerError, "Failed to start two-factor authentication setup", nil, err.Error()).Send(ctx)
+		}
+		return
+	}
+
+	utils.NewAPIResponse(http.StatusOK, "Scan the provisioning URI with an authenticator app", enrollment, "").Send(ctx)
+}
+
+// ConfirmMFA godoc
+// @Summary      Enable two-factor authentication
+// @Description  Confirms the authenticator app with a current code and enables two-factor authentication. Returns recovery codes, which are only shown once.
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        input  body      MFACodeDTO  true  "Code from the authenticator app"
+// @Success      200    {object}  utils.APIResponse{data=[]string}
+// @Failure      400    {object}  utils.APIResponse
+// @Failure      401    {object}  utils.APIResponse
+// @Failure      409    {object}  utils.APIResponse
+// @Failure      500    {object}  utils.APIResponse
+// @Security     BearerAuth
+// @Router       /auth/mfa/confirm [post]
+func (c *AuthController) ConfirmMFA(ctx *gin.Context) {
+	userIDStr, exists := ctx.Get("userID")
+	if !exists {
+		utils.NewAPIResponse(http.StatusUnauthorized, "Unauthorized", nil, "User ID not found in context").Send(ctx)
+		return
+	}
+
+	userID, err := strconv.ParseUint(userIDStr.(string), 10, 32)
+	if err != nil {
+		utils.NewAPIResponse(http.StatusBadRequest, "Invalid User ID", nil, "User ID conversion failed").Send(ctx)
+		return
+	}
+
+	var input MFACodeDTO
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		utils.NewAPIResponse(http.StatusBadRequest, "Invalid input", nil, err.Error()).Send(ctx)
+		return
+	}
+
+	codes, err := c.authService.ConfirmMFA(uint(userID), input.Code)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrInvalidMFACode), errors.Is(err, ErrMFANotEnrolled):
+			utils.NewAPIResponse(http.StatusBadRequest, "Failed to enable two-factor authentication", nil, err.Error()).Send(ctx)
+		case errors.Is(err, ErrMFAAlreadyEnabled):
+			utils.NewAPIResponse(http.StatusConflict, "Two-factor authentication already enabled", nil, err.Error()).Send(ctx)
+		default:
+			utils.NewAPIResponse(http.StatusInternalServerError, "Failed to enable two-factor authentication", nil, err.Error()).Send(ctx)
+		}
+		return
+	}
+
+	utils.NewAPIResponse(http.StatusOK, "Two-factor authentication enabled", codes, "").Send(ctx)
+}
+
+// DisableMFA godoc
+// @Summary      Disable two-factor authentication
+// @Description  Removes the authenticator and recovery codes of the authenticated user. Requires a current code or an unused recovery code.
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        input  body      MFACodeDTO  true  "Code from the authenticator app or a recovery code"
+// @Success      200    {object}  utils.APIResponse
+// @Failure      400    {object}  utils.APIResponse
+// @Failure      401    {object}  utils.APIResponse
+// @Failure      500    {object}  utils.APIResponse
+// @Security     BearerAuth
+// @Router       /auth/mfa/disable [post]
+func (c *AuthController) DisableMFA(ctx *gin.Context) {
+	userIDStr, exists := ctx.Get("userID")
+	if !exists {
+		utils.NewAPIResponse(http.StatusUnauthorized, "Unauthorized", nil, "User ID not found in context").Send(ctx)
+		return
+	}
+
+	userID, err := strconv.ParseUint(userIDStr.(string), 10, 32)
+	if err != nil {
+		utils.NewAPIResponse(http.StatusBadRequest, "Invalid User ID", nil, "User ID conversion failed").Send(ctx)
+		return
+	}
+
+	var input MFACodeDTO
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		utils.NewAPIResponse(http.StatusBadRequest, "Invalid input", nil, err.Error()).Send(ctx)
+		return
+	}
+
+	if err := c.authService.DisableMFA(uint(userID), input.Code); err != nil {
+		switch {
+		case errors.Is(err, ErrInvalidMFACode), errors.Is(err, ErrMFANotEnrolled):
+			utils.NewAPIResponse(http.StatusBadRequest, "Failed to disable two-factor authentication", nil, err.Error()).Send(ctx)
+		default:
+			utils.NewAPIResponse(http.StatusInternalServerError, "Failed to disable two-factor authentication", nil, err.Error()).Send(ctx)
+		}
+		return
+	}
+
+	utils.NewAPIResponse(http.StatusOK, "Two-factor authentication disabled", nil, "").Send(ctx)
+}
+
+// VerifyMFA godoc
+// @Summary      Complete a two-factor login
+// @Description  Exchanges the MFA challenge returned by /auth/login and a code from the authenticator app, or a recovery code, for an access token and a refresh token. A challenge allows a single attempt, and wrong codes count as failed logins.
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        input  body      VerifyMFADTO  true  "MFA challenge and code"
+// @Success      200    {object}  utils.APIResponse{data=TokenPair}
+// @Failure      400    {object}  utils.APIResponse
+// @Failure      401    {object}  utils.APIResponse
+// @Failure      403    {object}  utils.APIResponse
+// @Failure      429    {object}  utils.APIResponse
+// @Failure      500    {object}  utils.APIResponse
+// @Router       /auth/mfa/verify [post]
+func (c *AuthController) VerifyMFA(ctx *gin.Context) {
+	var input VerifyMFADTO
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		utils.NewAPIResponse(http.StatusBadRequest, "Invalid input", nil, err.Error()).Send(ctx)
+		return
+	}
+
+	pair, err := c.authService.VerifyMFA(input.MFAToken, input.Code, clientInfo(ctx))
+	if err != nil {
+		var throttled *ThrottledError
+		switch {
+		case errors.As(err, &throttled):
+			ctx.Header("Retry-After", strconv.Itoa(int(math.Ceil(throttled.RetryAfter.Seconds()))))
+			utils.NewAPIResponse(http.StatusTooManyRequests, "Too many failed login attempts", nil, err.Error()).Send(ctx)
+		case errors.Is(err, utils.ErrInvalidToken), errors.Is(err, ErrInvalidMFACode), errors.Is(err, ErrMFANotEnrolled):
+			utils.NewAPIResponse(http.StatusUnauthorized, "Invalid or expired MFA challenge or code", nil, err.Error()).Send(ctx)
+		case errors.Is(err, utils.ErrAccountSuspended):
+			utils.NewAPIResponse(http.StatusForbidden, "Account suspended", nil, err.Error()).Send(ctx)
+		default:
+			utils.NewAPIResponse(http.StatusInternalServerError, "Failed to verify code", nil, err.Error()).Send(ctx)
+		}
+		return
+	}
+
+	utils.NewAPIResponse(http.StatusOK, "Login successful", pair, "").Send(ctx)
+}
+
+// OIDCProviders godoc
+// @Summary      List OpenID Connect providers
+// @Description  Lists the names of the identity providers users can sign in with
+// @Tags         auth
+// @Produce      json
+// @Success      200  {object}  utils.APIResponse{data=[]string}
+// @Router       /auth/oidc/providers [get]
+func (c *AuthController) OIDCProviders(ctx *gin.Context) {
+	utils.NewAPIResponse(http.StatusOK, "Identity providers retrieved successfully", c.authService.OIDCProviders(), "").Send(ctx)
+}
+
+// StartOIDCLogin godoc
+// @Summary      Start a login with an OpenID Connect provider
+// @Description  Starts an authorization code login with PKCE. Send the user to authorization_url; the provider redirects them to the configured callback page with a code and state. Check that the state matches before posting both to /auth/oidc/{provider}/callback.
+// @Tags         auth
+// @Produce      json
+// @Param        provider  path      string  true  "Provider name"
+// @Success      200       {object}  utils.APIResponse{data=OIDCLogin}
+// @Failure      404       {object}  utils.APIResponse
+// @Failure      500       {object}  utils.APIResponse
+// @Failure      502       {object}  utils.APIResponse
+// @Router       /auth/oidc/{provider}/start [post]
+func (c *AuthController) StartOIDCLogin(ctx *gin.Context) {
+	login, err := c.authService.StartOIDCLogin(ctx.Param("provider"))
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrUnknownProvider):
+			utils.NewAPIResponse(http.StatusNotFound, "Unknown identity provider", nil, err.Error()).Send(ctx)
+		case errors.Is(err, ErrProviderUnavailable):
+			utils.NewAPIResponse(http.StatusBadGateway, "Identity provider unavailable", nil, err.Error()).Send(ctx)
+		default:
+			utils.NewAPIResponse(http.StatusInternalServerError, "Failed to start login", nil, err.Error()).Send(ctx)
+		}
+		return
+	}
+
+	utils.NewAPIResponse(http.StatusOK, "Login started", login, "").Send(ctx)
+}
+
+// CompleteOIDCLogin godoc
+// @Summary      Complete a login with an OpenID Connect provider
+// @Description  Exchanges the code the provider returned for an access token and a refresh token. The identity signs in the user it is linked to; otherwise it is linked to the user with the email address the provider verified, or a new customer account is created. Users with two-factor authentication get an MFA challenge instead, with status 202.
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        provider  path      string           true  "Provider name"
+// @Param        input     body      OIDCCallbackDTO  true  "Code and state from the provider"
+// @Success      200       {object}  utils.APIResponse{data=TokenPair}
+// @Success      202       {object}  utils.APIResponse{data=MFAChallenge}
+// @Failure      400       {object}  utils.APIResponse
+// @Failure      401       {object}  utils.APIResponse
+// @Failure      403       {object}  utils.APIResponse
+// @Failure      404       {object}  utils.APIResponse
+// @Failure      500       {object}  utils.APIResponse
+// @Failure      502       {object}  utils.APIResponse
+// @Router       /auth/oidc/{provider}/callback [post]
+func (c *AuthController) CompleteOIDCLogin(ctx *gin.Context) {
+	var input OIDCCallbackDTO
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		utils.NewAPIResponse(http.StatusBadRequest, "Invalid input", nil, err.Error()).Send(ctx)
+		return
+	}
+
+	pair, challenge, err := c.authService.CompleteOIDCLogin(ctx.Param("provider"), input.Code, input.State, clientInfo(ctx))
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrUnknownProvider):
+			utils.NewAPIResponse(http.StatusNotFound, "Unknown identity provider", nil, err.Error()).Send(ctx)
+		case errors.Is(err, ErrInvalidOIDCState), errors.Is(err, ErrOIDCLoginFailed):
+			utils.NewAPIResponse(http.StatusUnauthorized, "Login failed", nil, err.Error()).Send(ctx)
+		case errors.Is(err, ErrOIDCEmailNotVerified):
+			utils.NewAPIResponse(http.StatusForbidden, "Email address not verified", nil, err.Error()).Send(ctx)
+		case errors.Is(err, utils.ErrAccountSuspended):
+			utils.NewAPIResponse(http.StatusForbidden, "Account suspended", nil, err.Error()).Send(ctx)
+		case errors.Is(err, ErrProviderUnavailable):
+			utils.NewAPIResponse(http.StatusBadGateway, "Identity provider unavailable", nil, err.Error()).Send(ctx)
+		default:
+			utils.NewAPIResponse(http.StatusInternalServerError, "Failed to complete login", nil, err.Error()).Send(ctx)
+		}
+		return
+	}
+
+	if challenge != nil {
+		utils.NewAPIResponse(http.StatusAccepted, "MFA required", challenge, "").Send(ctx)
+		return
+	}
+
+	utils.NewAPIResponse(http.StatusOK, "Login successful", pair, "").Send(ctx)
+}
+
+// clientInfo describes the client making the request, for recording on refresh tokens.
+func clientInfo(ctx *gin.Context) ClientInfo {
+	return ClientInfo{UserAgent: ctx.Request.UserAgent(), IP: ctx.ClientIP()}
 }
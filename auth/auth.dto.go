@@ -9,4 +9,75 @@ type RegisterDTO struct {
     Email    string `json:"email" binding:"required,email"`
     Password string `json:"password" binding:"required,password"`
     Name     string `json:"name" binding:"required,gt=0"`        
-}
\ No newline at end of file
+}
+
+type RefreshTokenDTO struct {
+    RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// LogoutDTO selects which sessions to end. Without a refresh token only the current access token is revoked.
+type LogoutDTO struct {
+    RefreshToken string `json:"refresh_token"`
+    AllDevices   bool   `json:"all_devices"`
+}
+
+// TokenPair is returned by login and refresh. ExpiresIn is the access token lifetime in seconds.
+type TokenPair struct {
+    AccessToken  string `json:"access_token"`
+    RefreshToken string `json:"refresh_token"`
+    TokenType    string `json:"token_type"`
+    ExpiresIn    int64  `json:"expires_in"`
+}
+
+// ClientInfo identifies the client a refresh token is issued to.
+type ClientInfo struct {
+    UserAgent string
+    IP        string
+}
+
+type ForgotPasswordDTO struct {
+    Email string `json:"email" binding:"required,email"`
+}
+
+type ResetPasswordDTO struct {
+    Token    string `json:"token" binding:"required"`
+    Password string `json:"password" binding:"required"`
+}
+
+// MFAChallenge is returned by login instead of a TokenPair when the user must enter a TOTP code.
+// MFAToken is exchanged for a TokenPair at /auth/mfa/verify within ExpiresIn seconds.
+type MFAChallenge struct {
+    MFARequired bool   `json:"mfa_required"`
+    MFAToken    string `json:"mfa_token"`
+    ExpiresIn   int64  `json:"expires_in"`
+}
+
+// MFAEnrollment holds a new TOTP secret. ProvisioningURI is meant to be rendered as a QR code.
+type MFAEnrollment struct {
+    Secret          string `json:"secret"`
+    ProvisioningURI string `json:"provisioning_uri"`
+}
+
+type MFACodeDTO struct {
+    Code string `json:"code" binding:"required"`
+}
+
+type VerifyMFADTO struct {
+    MFAToken string `json:"mfa_token" binding:"required"`
+    Code     string `json:"code" binding:"required"`
+}
+
+// OIDCLogin starts a login with an OpenID Connect provider. The client sends the user to
+// AuthorizationURL, then checks that the provider returns the same State before completing the
+// login at /auth/oidc/{provider}/callback within ExpiresIn seconds.
+type OIDCLogin struct {
+    AuthorizationURL string `json:"authorization_url"`
+    State            string `json:"state"`
+    ExpiresIn        int64  `json:"expires_in"`
+}
+
+// OIDCCallbackDTO carries the code and state the provider redirected the user back with.
+type OIDCCallbackDTO struct {
+    Code  string `json:"code" binding:"required"`
+    State string `json:"state" binding:"required"`
+}
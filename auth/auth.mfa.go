@@ -0,0 +1,315 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"ecommerce-api/models"
+	"ecommerce-api/utils"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrMFANotEnrolled is returned when confirming or disabling MFA for a user without an authenticator.
+	ErrMFANotEnrolled = errors.New("two-factor authentication is not set up")
+	// ErrMFAAlreadyEnabled is returned when enrolling a user whose authenticator is already confirmed.
+	ErrMFAAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	// ErrInvalidMFACode is returned when a TOTP or recovery code is wrong, expired or already used.
+	ErrInvalidMFACode = errors.New("invalid authentication code")
+)
+
+// mfaChallengeTTL is how long the user has to enter a code after a password login.
+const mfaChallengeTTL = 5 * time.Minute
+
+// recoveryCodeCount is the number of recovery codes generated when MFA is confirmed.
+const recoveryCodeCount = 10
+
+// EnrollMFA starts TOTP enrolment by generating a new secret for the user. The authenticator does not
+// protect logins until ConfirmMFA is called with a code from it. Enrolling again before confirming
+// replaces the secret.
+//
+// Parameters:
+// - userID: The ID of the authenticated user.
+//
+// Returns:
+// - The secret and the provisioning URI to show as a QR code.
+// - ErrMFAAlreadyEnabled if the user already has a confirmed authenticator.
+// - An error if any database operation fails.
+func (s *AuthService) EnrollMFA(userID uint) (*MFAEnrollment, error) {
+	var user models.User
+	if err := s.db.Take(&user, userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, utils.ErrUserNotFound
+		}
+		return nil, errors.New("database error: " + err.Error())
+	}
+
+	enrolled, err := s.mfaEnrolled(userID)
+	if err != nil {
+		return nil, err
+	}
+	if enrolled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	secret, err := generateTOTPSecret()
+	if err != nil {
+		return nil, errors.New("failed to generate secret")
+	}
+
+	factor := models.MFAFactor{UserID: userID, Secret: secret}
+	if err := s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"secret", "last_used_step", "updated_at"}),
+	}).Create(&factor).Error; err != nil {
+		return nil, errors.New("failed to store secret: " + err.Error())
+	}
+
+	return &MFAEnrollment{
+		Secret:          secret,
+		ProvisioningURI: totpProvisioningURI(s.settings.MFAIssuer, user.Email, secret),
+	}, nil
+}
+
+// ConfirmMFA enables MFA once the user proves their authenticator app works, and returns a fresh set
+// of recovery codes. The codes are only shown this once; only their hashes are stored.
+//
+// Parameters:
+// - userID: The ID of the authenticated user.
+// - code: The current code from the authenticator app.
+//
+// Returns:
+// - The recovery codes.
+// - ErrMFANotEnrolled if EnrollMFA was not called first, or ErrMFAAlreadyEnabled if MFA is already on.
+// - ErrInvalidMFACode if the code is wrong.
+// - An error if any database operation fails.
+func (s *AuthService) ConfirmMFA(userID uint, code string) ([]string, error) {
+	var codes []string
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		factor, err := lockMFAFactor(tx, userID)
+		if err != nil {
+			return err
+		}
+		if factor.ConfirmedAt != nil {
+			return ErrMFAAlreadyEnabled
+		}
+
+		step, ok := validateTOTP(factor.Secret, normalizeCode(code), time.Now(), factor.LastUsedStep)
+		if !ok {
+			return ErrInvalidMFACode
+		}
+
+		if err := tx.Model(factor).Updates(map[string]interface{}{
+			"confirmed_at":   time.Now(),
+			"last_used_step": step,
+		}).Error; err != nil {
+			return errors.New("failed to enable two-factor authentication: " + err.Error())
+		}
+
+		codes, err = replaceRecoveryCodes(tx, userID)
+		return err
+	})
+	return codes, err
+}
+
+// DisableMFA removes the user's authenticator and recovery codes. A current TOTP code or an unused
+// recovery code is required, so a stolen access token alone cannot turn MFA off.
+//
+// Parameters:
+// - userID: The ID of the authenticated user.
+// - code: A code from the authenticator app or a recovery code.
+//
+// Returns:
+// - ErrMFANotEnrolled if the user has no authenticator.
+// - ErrInvalidMFACode if the code is wrong.
+// - An error if any database operation fails.
+func (s *AuthService) DisableMFA(userID uint, code string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := verifyFactorCode(tx, userID, code); err != nil {
+			return err
+		}
+		return deleteMFA(tx, userID)
+	})
+}
+
+// VerifyMFA completes a login that returned an MFA challenge.
+//
+// The challenge token is consumed even if the code is wrong, so each password login allows a single
+// guess and the client has to log in again to retry. Wrong codes count as failed logins of the
+// account and client IP, and a locked out account or IP cannot complete the login.
+//
+// Parameters:
+// - mfaToken: The challenge token returned by Login.
+// - code: A code from the authenticator app or a recovery code.
+// - client: The user agent and IP address the refresh token is issued to.
+//
+// Returns:
+// - A TokenPair whose access token records that a second factor was used.
+// - utils.ErrInvalidToken if the challenge token is unknown, expired or already used.
+// - A *ThrottledError if the account or client IP is blocked after failed logins.
+// - ErrInvalidMFACode if the code is wrong.
+// - An error if any database operation fails.
+func (s *AuthService) VerifyMFA(mfaToken, code string, client ClientInfo) (*TokenPair, error) {
+	var challenge *models.UserToken
+	if err := s.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		challenge, err = redeemUserToken(tx, mfaToken, models.UserTokenMFAChallenge)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+
+	var user models.User
+	if err := s.db.Take(&user, challenge.UserID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, utils.ErrInvalidToken
+		}
+		return nil, errors.New("database error: " + err.Error())
+	}
+
+	accountKey, ipKey := loginKeys(user.Email, client.IP)
+	if err := s.checkLoginThrottle(accountKey, ipKey); err != nil {
+		return nil, err
+	}
+
+	var pair *TokenPair
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := verifyFactorCode(tx, user.ID, code); err != nil {
+			return err
+		}
+
+		var err error
+		pair, err = s.startSession(tx, user, client, true)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, ErrInvalidMFACode) {
+			s.recordFailedLogin(user.Email, &user.ID, client)
+		}
+		return nil, err
+	}
+
+	s.clearFailedLogins(user.Email, user.ID, client, "successful login")
+	return pair, nil
+}
+
+// mfaEnrolled reports whether the user has a confirmed authenticator.
+func (s *AuthService) mfaEnrolled(userID uint) (bool, error) {
+	var count int64
+	if err := s.db.Model(&models.MFAFactor{}).
+		Where("user_id = ? AND confirmed_at IS NOT NULL", userID).
+		Count(&count).Error; err != nil {
+		return false, errors.New("database error: " + err.Error())
+	}
+	return count > 0, nil
+}
+
+// issueMFAChallenge stores a short-lived challenge token that VerifyMFA exchanges for a token pair.
+func (s *AuthService) issueMFAChallenge(userID uint) (*MFAChallenge, error) {
+	var token string
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		token, err = issueUserToken(tx, userID, models.UserTokenMFAChallenge, mfaChallengeTTL)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &MFAChallenge{
+		MFARequired: true,
+		MFAToken:    token,
+		ExpiresIn:   int64(mfaChallengeTTL.Seconds()),
+	}, nil
+}
+
+// lockMFAFactor loads the user's authenticator for update.
+func lockMFAFactor(tx *gorm.DB, userID uint) (*models.MFAFactor, error) {
+	var factor models.MFAFactor
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("user_id = ?", userID).Take(&factor).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrMFANotEnrolled
+		}
+		return nil, errors.New("failed to retrieve authenticator: " + err.Error())
+	}
+	return &factor, nil
+}
+
+// verifyFactorCode checks a TOTP code, or failing that a recovery code, against the user's confirmed
+// authenticator. An accepted TOTP code cannot be replayed and an accepted recovery code is used up.
+func verifyFactorCode(tx *gorm.DB, userID uint, code string) error {
+	factor, err := lockMFAFactor(tx, userID)
+	if err != nil {
+		return err
+	}
+	if factor.ConfirmedAt == nil {
+		return ErrMFANotEnrolled
+	}
+
+	code = normalizeCode(code)
+	if step, ok := validateTOTP(factor.Secret, code, time.Now(), factor.LastUsedStep); ok {
+		if err := tx.Model(factor).Update("last_used_step", step).Error; err != nil {
+			return errors.New("failed to record code: " + err.Error())
+		}
+		return nil
+	}
+
+	result := tx.Model(&models.MFARecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, utils.HashToken(code)).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return errors.New("failed to redeem recovery code: " + result.Error.Error())
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvalidMFACode
+	}
+	return nil
+}
+
+// deleteMFA removes the user's authenticator and recovery codes.
+func deleteMFA(tx *gorm.DB, userID uint) error {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.MFARecoveryCode{}).Error; err != nil {
+		return errors.New("failed to delete recovery codes: " + err.Error())
+	}
+	if err := tx.Where("user_id = ?", userID).Delete(&models.MFAFactor{}).Error; err != nil {
+		return errors.New("failed to disable two-factor authentication: " + err.Error())
+	}
+	return nil
+}
+
+// replaceRecoveryCodes deletes the user's recovery codes and stores new ones. The codes are returned
+// grouped for readability; the separators are ignored when a code is entered.
+func replaceRecoveryCodes(tx *gorm.DB, userID uint) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.MFARecoveryCode{}).Error; err != nil {
+		return nil, errors.New("failed to delete recovery codes: " + err.Error())
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	records := make([]models.MFARecoveryCode, recoveryCodeCount)
+	for i := range codes {
+		raw := make([]byte, 8)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, errors.New("failed to generate recovery codes")
+		}
+		code := strings.ToUpper(hex.EncodeToString(raw))
+		codes[i] = code[0:4] + "-" + code[4:8] + "-" + code[8:12] + "-" + code[12:16]
+		records[i] = models.MFARecoveryCode{UserID: userID, CodeHash: utils.HashToken(code)}
+	}
+
+	if err := tx.Create(&records).Error; err != nil {
+		return nil, errors.New("failed to store recovery codes: " + err.Error())
+	}
+	return codes, nil
+}
+
+// normalizeCode strips whitespace and dashes and upper-cases the code, so recovery codes can be typed
+// as shown or without separators.
+func normalizeCode(code string) string {
+	return strings.ToUpper(strings.NewReplacer(" ", "", "-", "").Replace(code))
+}
@@ -0,0 +1,325 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"ecommerce-api/apikeys"
+	"ecommerce-api/audit"
+	"ecommerce-api/middleware"
+	"ecommerce-api/models"
+	"ecommerce-api/oidc"
+	"ecommerce-api/utils"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrUnknownProvider is returned for a login with a provider that is not configured.
+	ErrUnknownProvider = errors.New("unknown identity provider")
+	// ErrInvalidOIDCState is returned when a callback does not belong to a pending login, for example
+	// because it was already completed or has expired.
+	ErrInvalidOIDCState = errors.New("login attempt is unknown or expired")
+	// ErrOIDCLoginFailed is returned when the provider rejects the authorization code or its ID token
+	// does not verify.
+	ErrOIDCLoginFailed = errors.New("identity provider login failed")
+	// ErrProviderUnavailable is returned when a provider cannot be reached or serves unusable metadata.
+	ErrProviderUnavailable = errors.New("identity provider is unavailable")
+	// ErrOIDCEmailNotVerified is returned when an identity that is not linked yet comes without an email
+	// address the provider has verified, so it can neither be linked nor given an account.
+	ErrOIDCEmailNotVerified = errors.New("identity provider did not return a verified email address")
+)
+
+const (
+	// oidcLoginTTL is how long the user has to sign in at the provider.
+	oidcLoginTTL = 10 * time.Minute
+	// oidcRequestTimeout bounds each round trip to a provider.
+	oidcRequestTimeout = 10 * time.Second
+)
+
+// OIDCProviders returns the names of the configured OpenID Connect providers, sorted.
+func (s *AuthService) OIDCProviders() []string {
+	names := make([]string, 0, len(s.settings.OIDCProviders))
+	for name := range s.settings.OIDCProviders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// StartOIDCLogin begins a login with an OpenID Connect provider using the authorization code flow with
+// PKCE. The state, nonce and code verifier are kept on the server; only the state leaves it, in the
+// authorization URL.
+//
+// Parameters:
+// - providerName: The name the provider is configured under.
+//
+// Returns:
+// - The URL of the provider's login page and the state the provider will send back.
+// - ErrUnknownProvider if no provider has the name.
+// - ErrProviderUnavailable if the provider cannot be reached.
+// - An error if the login cannot be stored.
+func (s *AuthService) StartOIDCLogin(providerName string) (*OIDCLogin, error) {
+	provider, ok := s.settings.OIDCProviders[providerName]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+
+	req, err := oidc.NewAuthRequest()
+	if err != nil {
+		return nil, errors.New("failed to generate login state")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), oidcRequestTimeout)
+	defer cancel()
+	authURL, err := provider.AuthCodeURL(ctx, req)
+	if err != nil {
+		return nil, oidcError(err)
+	}
+
+	now := time.Now()
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		// Abandoned logins are only needed until they expire.
+		if err := tx.Where("expires_at < ?", now).Delete(&models.OIDCLoginState{}).Error; err != nil {
+			return errors.New("failed to purge expired logins: " + err.Error())
+		}
+
+		login := models.OIDCLoginState{
+			Provider:     providerName,
+			StateHash:    utils.HashToken(req.State),
+			Nonce:        req.Nonce,
+			CodeVerifier: req.CodeVerifier,
+			ExpiresAt:    now.Add(oidcLoginTTL),
+		}
+		if err := tx.Create(&login).Error; err != nil {
+			return errors.New("failed to store login state: " + err.Error())
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &OIDCLogin{
+		AuthorizationURL: authURL,
+		State:            req.State,
+		ExpiresIn:        int64(oidcLoginTTL.Seconds()),
+	}, nil
+}
+
+// CompleteOIDCLogin finishes a login started by StartOIDCLogin once the provider has sent the user
+// back with an authorization code. The code is exchanged for an ID token, which must verify against
+// the provider's keys and carry the nonce of the login.
+//
+// The provider's identity is then mapped to a user:
+//   - An identity that was linked before signs in its user.
+//   - Otherwise the provider must have verified the email address. A user with that address is linked
+//     to the identity. If that user never verified the address themselves, whoever registered it
+//     could not prove they own it, so its password is cleared and its sessions are ended.
+//   - Otherwise a verified customer account is created for the identity, without a password.
+//
+// Parameters:
+// - providerName: The name the provider is configured under.
+// - code: The authorization code the provider sent back.
+// - state: The state the provider sent back.
+// - client: The user agent and IP address the refresh token is issued to.
+//
+// Returns:
+// - A TokenPair, or an MFAChallenge if the user has a confirmed authenticator.
+// - ErrUnknownProvider if no provider has the name.
+// - ErrInvalidOIDCState if the state does not belong to a pending login with the provider.
+// - ErrOIDCLoginFailed if the provider rejects the code or returns an invalid ID token.
+// - ErrOIDCEmailNotVerified if a new identity comes without a verified email address.
+// - ErrProviderUnavailable if the provider cannot be reached.
+// - utils.ErrAccountSuspended if the user is suspended.
+// - An error if any database operation fails.
+func (s *AuthService) CompleteOIDCLogin(providerName, code, state string, client ClientInfo) (*TokenPair, *MFAChallenge, error) {
+	provider, ok := s.settings.OIDCProviders[providerName]
+	if !ok {
+		return nil, nil, ErrUnknownProvider
+	}
+
+	login, err := s.redeemOIDCState(providerName, state)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), oidcRequestTimeout)
+	defer cancel()
+	rawIDToken, err := provider.Exchange(ctx, code, login.CodeVerifier)
+	if err != nil {
+		return nil, nil, oidcError(err)
+	}
+	idToken, err := provider.VerifyIDToken(ctx, rawIDToken, login.Nonce)
+	if err != nil {
+		return nil, nil, oidcError(err)
+	}
+
+	user, err := s.linkOIDCIdentity(providerName, idToken, client.IP)
+	if err != nil {
+		return nil, nil, err
+	}
+	if user.SuspendedAt != nil {
+		return nil, nil, utils.ErrAccountSuspended
+	}
+
+	enrolled, err := s.mfaEnrolled(user.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if enrolled {
+		challenge, err := s.issueMFAChallenge(user.ID)
+		return nil, challenge, err
+	}
+
+	pair, err := s.startSession(s.db, *user, client, false)
+	return pair, nil, err
+}
+
+// redeemOIDCState consumes the pending login with the state. A state can only be redeemed once,
+// whether or not the login then succeeds.
+func (s *AuthService) redeemOIDCState(providerName, state string) (*models.OIDCLoginState, error) {
+	var login models.OIDCLoginState
+	result := s.db.Clauses(clause.Returning{}).Where("state_hash = ?", utils.HashToken(state)).Delete(&login)
+	if result.Error != nil {
+		return nil, errors.New("failed to retrieve login state: " + result.Error.Error())
+	}
+	if result.RowsAffected == 0 || login.Provider != providerName || !login.ExpiresAt.After(time.Now()) {
+		return nil, ErrInvalidOIDCState
+	}
+	return &login, nil
+}
+
+// linkOIDCIdentity returns the user the provider's identity signs in, linking or creating one as
+// described on CompleteOIDCLogin.
+func (s *AuthService) linkOIDCIdentity(providerName string, idToken *oidc.IDToken, ip string) (*models.User, error) {
+	var user models.User
+	linked, claimed := false, false
+	now := time.Now()
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var identity models.UserIdentity
+		err := tx.Where("provider = ? AND subject = ?", providerName, idToken.Subject).Take(&identity).Error
+		switch {
+		case err == nil:
+			err = tx.Take(&user, identity.UserID).Error
+			if err == nil {
+				if err := tx.Model(&identity).Update("last_login_at", now).Error; err != nil {
+					return errors.New("failed to update identity: " + err.Error())
+				}
+				return nil
+			}
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				return errors.New("failed to retrieve user: " + err.Error())
+			}
+			// The user deleted their account, so the identity is free to sign up again.
+			if err := tx.Delete(&identity).Error; err != nil {
+				return errors.New("failed to remove identity: " + err.Error())
+			}
+		case !errors.Is(err, gorm.ErrRecordNotFound):
+			return errors.New("failed to retrieve identity: " + err.Error())
+		}
+
+		if idToken.Email == "" || !idToken.EmailVerified {
+			return ErrOIDCEmailNotVerified
+		}
+
+		err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("email = ?", idToken.Email).Take(&user).Error
+		switch {
+		case err == nil:
+			if user.VerifiedAt == nil {
+				if err := claimUnverifiedUser(tx, &user, now); err != nil {
+					return err
+				}
+				claimed = true
+			}
+			linked = true
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			user = models.User{
+				Email:      idToken.Email,
+				Name:       oidcDisplayName(idToken),
+				VerifiedAt: &now,
+				Roles:      []models.UserRole{{Role: models.RoleCustomer}},
+			}
+			if err := tx.Create(&user).Error; err != nil {
+				return errors.New("failed to create user: " + err.Error())
+			}
+		default:
+			return errors.New("failed to retrieve user: " + err.Error())
+		}
+
+		identity = models.UserIdentity{
+			UserID:      user.ID,
+			Provider:    providerName,
+			Subject:     idToken.Subject,
+			Email:       idToken.Email,
+			LastLoginAt: &now,
+		}
+		if err := tx.Create(&identity).Error; err != nil {
+			return errors.New("failed to link identity: " + err.Error())
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if claimed {
+		middleware.ForgetUser(user.ID)
+	}
+	if linked {
+		audit.Record(s.db, models.AuditLog{Event: models.AuditIdentityLinked, UserID: &user.ID, IP: ip, Details: "provider " + providerName})
+	}
+	return &user, nil
+}
+
+// claimUnverifiedUser hands an account whose email address was never verified to the identity that
+// has proven it owns the address. Whoever registered the account may not have, so the password they
+// chose is cleared, their sessions are ended, their API keys are revoked and the authenticator they
+// enrolled is removed; the owner can set a password with a reset link.
+func claimUnverifiedUser(tx *gorm.DB, user *models.User, now time.Time) error {
+	if err := tx.Model(user).Updates(map[string]interface{}{
+		"password":      "",
+		"verified_at":   now,
+		"token_version": gorm.Expr("token_version + 1"),
+	}).Error; err != nil {
+		return errors.New("failed to verify user: " + err.Error())
+	}
+	if err := revokeRefreshTokens(tx.Where("user_id = ?", user.ID), now); err != nil {
+		return err
+	}
+	if err := apikeys.RevokeAll(tx, user.ID); err != nil {
+		return err
+	}
+	if err := deleteMFA(tx, user.ID); err != nil {
+		return err
+	}
+
+	user.Password = ""
+	user.VerifiedAt = &now
+	user.TokenVersion++
+	return nil
+}
+
+// oidcDisplayName returns the name for an account created from an identity, falling back to the
+// local part of its email address.
+func oidcDisplayName(idToken *oidc.IDToken) string {
+	if name := strings.TrimSpace(idToken.Name); name != "" {
+		return name
+	}
+	return strings.SplitN(idToken.Email, "@", 2)[0]
+}
+
+// oidcError reports a rejected code or ID token as ErrOIDCLoginFailed, and any other failure of the
+// provider as ErrProviderUnavailable.
+func oidcError(err error) error {
+	if errors.Is(err, oidc.ErrExchangeFailed) || errors.Is(err, oidc.ErrInvalidIDToken) {
+		return fmt.Errorf("%w: %v", ErrOIDCLoginFailed, err)
+	}
+	return fmt.Errorf("%w: %v", ErrProviderUnavailable, err)
+}
@@ -0,0 +1,163 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"ecommerce-api/mailer"
+	"ecommerce-api/middleware"
+	"ecommerce-api/models"
+	"ecommerce-api/utils"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrWeakPassword is returned when a new password does not satisfy models.ValidatePassword.
+var ErrWeakPassword = errors.New("password does not meet the requirements")
+
+// ForgotPassword emails the user a link to reset their password.
+//
+// Requesting a new link invalidates any earlier unused link. To avoid revealing which emails are
+// registered, the function returns nil when no user has the email.
+//
+// Parameters:
+// - email: The email the user registered with.
+//
+// Returns:
+// - An error if the token cannot be stored or the email cannot be sent.
+func (s *AuthService) ForgotPassword(email string) error {
+	var user models.User
+	if err := s.db.Where("email = ?", email).Take(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return errors.New("database error: " + err.Error())
+	}
+
+	var token string
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		token, err = issueUserToken(tx, user.ID, models.UserTokenPasswordReset, s.settings.PasswordResetTTL)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	link := s.settings.AppURL + "/reset-password?token=" + url.QueryEscape(token)
+	return s.mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\nWe received a request to reset your password. Use the link below to choose a new one:\n\n%s\n\n"+
+			"The link expires in %s and can only be used once. If you did not ask for this, you can ignore this email.\n",
+			user.Name, link, s.settings.PasswordResetTTL),
+	})
+}
+
+// ResetPassword sets a new password using a token sent by ForgotPassword.
+//
+// The token is consumed, so it cannot be used again. Because the reset may follow a compromise, every
+// session of the user is ended: the token version is incremented and all refresh tokens are revoked.
+// A lockout after failed logins is lifted.
+//
+// Parameters:
+// - token: The reset token from the emailed link.
+// - password: The new password, which must satisfy models.ValidatePassword.
+//
+// Returns:
+// - An error wrapping ErrWeakPassword if the password is rejected.
+// - utils.ErrInvalidToken if the token is unknown, expired or already used.
+// - An error if any database operation fails.
+func (s *AuthService) ResetPassword(token, password string) error {
+	if valid, message := models.ValidatePassword(password); !valid {
+		return fmt.Errorf("%w: %s", ErrWeakPassword, message)
+	}
+
+	hashedPassword, err := utils.HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	var userID uint
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		record, err := redeemUserToken(tx, token, models.UserTokenPasswordReset)
+		if err != nil {
+			return err
+		}
+		userID = record.UserID
+
+		if err := tx.Model(&models.User{}).Where("id = ?", record.UserID).Updates(map[string]interface{}{
+			"password":      hashedPassword,
+			"token_version": gorm.Expr("token_version + 1"),
+		}).Error; err != nil {
+			return errors.New("failed to update password: " + err.Error())
+		}
+
+		return revokeRefreshTokens(tx.Where("user_id = ?", record.UserID), time.Now())
+	})
+	if err != nil {
+		return err
+	}
+	middleware.ForgetUser(userID)
+
+	// Proving access to the mailbox ends a lockout, so the user can log in with the new password straight away.
+	var user models.User
+	if err := s.db.Select("id", "email").Take(&user, userID).Error; err == nil {
+		s.clearFailedLogins(user.Email, user.ID, ClientInfo{}, "password reset")
+	}
+	return nil
+}
+
+// issueUserToken stores a new single-use token for the user and returns it. Earlier unused tokens
+// with the same purpose are invalidated, so only the latest emailed link works.
+func issueUserToken(tx *gorm.DB, userID uint, purpose models.UserTokenPurpose, ttl time.Duration) (string, error) {
+	now := time.Now()
+	if err := tx.Model(&models.UserToken{}).
+		Where("user_id = ? AND purpose = ? AND used_at IS NULL", userID, purpose).
+		Update("used_at", now).Error; err != nil {
+		return "", errors.New("failed to invalidate previous tokens: " + err.Error())
+	}
+
+	token, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return "", errors.New("failed to generate token")
+	}
+
+	record := models.UserToken{
+		UserID:    userID,
+		Purpose:   purpose,
+		TokenHash: utils.HashToken(token),
+		ExpiresAt: now.Add(ttl),
+	}
+	if err := tx.Create(&record).Error; err != nil {
+		return "", errors.New("failed to store token: " + err.Error())
+	}
+	return token, nil
+}
+
+// redeemUserToken marks a token as used and returns it. It returns utils.ErrInvalidToken if the token
+// does not exist, has another purpose, has expired or was already used.
+func redeemUserToken(tx *gorm.DB, token string, purpose models.UserTokenPurpose) (*models.UserToken, error) {
+	var record models.UserToken
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("token_hash = ? AND purpose = ?", utils.HashToken(token), purpose).
+		Take(&record).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, utils.ErrInvalidToken
+		}
+		return nil, errors.New("failed to retrieve token: " + err.Error())
+	}
+
+	now := time.Now()
+	if record.UsedAt != nil || !record.ExpiresAt.After(now) {
+		return nil, utils.ErrInvalidToken
+	}
+
+	if err := tx.Model(&record).Update("used_at", now).Error; err != nil {
+		return nil, errors.New("failed to redeem token: " + err.Error())
+	}
+	return &record, nil
+}
@@ -3,25 +3,99 @@ package auth
 
 import (
 	"errors"
+	"log"
+	"net/http"
+	"strings"
 	"time"
-	"strconv"
 
+	"ecommerce-api/config"
+	"ecommerce-api/mailer"
+	"ecommerce-api/middleware"
 	"ecommerce-api/models"
+	"ecommerce-api/oidc"
+	"ecommerce-api/tokens"
 	"ecommerce-api/utils"
 
-	"github.com/golang-jwt/jwt/v4"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
-// AuthService struct holds the database connection and JWT secret for auth operations
+// Settings holds the configurable lifetimes and links used by AuthService
+type Settings struct {
+	RefreshTokenTTL      time.Duration
+	PasswordResetTTL     time.Duration
+	EmailVerificationTTL time.Duration
+	// AppURL is the storefront's base URL, used to build the password reset link.
+	AppURL string
+	// APIURL is the public base URL of this API, used to build the email verification link.
+	APIURL string
+	// MFAIssuer names this service in authenticator apps.
+	MFAIssuer string
+	// AccountLockout and IPLockout throttle failed logins per email address and per client IP.
+	AccountLockout LockoutPolicy
+	IPLockout      LockoutPolicy
+	// OIDCProviders are the OpenID Connect providers users can sign in with, by name.
+	OIDCProviders map[string]*oidc.Provider
+}
+
+// SettingsFromConfig reads the auth settings from the application configuration
+func SettingsFromConfig(appConfig *config.AppConfig) Settings {
+	return Settings{
+		RefreshTokenTTL:      appConfig.REFRESH_TOKEN_TTL,
+		PasswordResetTTL:     appConfig.PASSWORD_RESET_TTL,
+		EmailVerificationTTL: appConfig.EMAIL_VERIFICATION_TTL,
+		AppURL:               strings.TrimSuffix(appConfig.APP_URL, "/"),
+		APIURL:               strings.TrimSuffix(appConfig.API_URL, "/"),
+		MFAIssuer:            appConfig.MFA_ISSUER,
+		AccountLockout: LockoutPolicy{
+			FreeAttempts:    3,
+			BaseDelay:       time.Second,
+			MaxAttempts:     appConfig.LOGIN_MAX_ATTEMPTS,
+			LockoutDuration: appConfig.LOGIN_LOCKOUT_DURATION,
+			Window:          24 * time.Hour,
+		},
+		// Many users can share an IP behind a NAT, so IPs get more attempts before any delay.
+		IPLockout: LockoutPolicy{
+			FreeAttempts:    20,
+			BaseDelay:       time.Second,
+			MaxAttempts:     appConfig.LOGIN_IP_MAX_ATTEMPTS,
+			LockoutDuration: appConfig.LOGIN_LOCKOUT_DURATION,
+			Window:          time.Hour,
+		},
+		OIDCProviders: oidcProvidersFromConfig(appConfig.OIDC_PROVIDERS),
+	}
+}
+
+// oidcProvidersFromConfig creates clients for the configured OpenID Connect providers. They contact
+// their providers on first use, so an unreachable provider does not keep the API from starting.
+func oidcProvidersFromConfig(configs []config.OIDCProvider) map[string]*oidc.Provider {
+	client := &http.Client{Timeout: oidcRequestTimeout}
+	providers := make(map[string]*oidc.Provider, len(configs))
+	for _, provider := range configs {
+		providers[provider.Name] = oidc.NewProvider(oidc.Config{
+			Name:         provider.Name,
+			Issuer:       provider.Issuer,
+			ClientID:     provider.ClientID,
+			ClientSecret: provider.ClientSecret,
+			RedirectURL:  provider.RedirectURL,
+			Scopes:       provider.Scopes,
+		}, client)
+	}
+	return providers
+}
+
+// AuthService struct holds the database connection, token manager, mailer and failed login counters for auth operations
 type AuthService struct {
-	jwtSecret string
-	db        *gorm.DB
+	tokens   *tokens.Manager
+	mailer   mailer.Mailer
+	attempts AttemptStore
+	settings Settings
+	db       *gorm.DB
 }
 
-// NewAuthService initializes AuthService with jwtSecret and database connection
-func NewAuthService(jwtSecret string, db *gorm.DB) *AuthService {
-	return &AuthService{jwtSecret: jwtSecret, db: db}
+// NewAuthService initializes AuthService with the access token manager, mailer, failed login store, settings and database connection
+func NewAuthService(tokenManager *tokens.Manager, mail mailer.Mailer, attempts AttemptStore, settings Settings, db *gorm.DB) *AuthService {
+	return &AuthService{tokens: tokenManager, mailer: mail, attempts: attempts, settings: settings, db: db}
 }
 
 // Register creates a new user with a hashed password.
@@ -31,9 +105,12 @@ func NewAuthService(jwtSecret string, db *gorm.DB) *AuthService {
 // the error. Otherwise, it sets the hashed password in the User struct.
 //
 // The function then uses a database transaction to ensure atomicity. It creates a new user record
-// in the database using the provided User struct. If the creation process fails, it returns an error
-// with a descriptive message. If the creation is successful, it returns nil.
-func (s *AuthService) Register(userDTO *RegisterDTO, isAdmin bool) error {
+// with the customer role in the database using the provided User struct. If the creation process fails,
+// it returns an error with a descriptive message. If the creation is successful, it returns nil.
+//
+// Staff roles can only be assigned afterwards by a super admin. The account starts unverified and a
+// verification link is emailed to it; a failure to send the email is logged but does not fail registration.
+func (s *AuthService) Register(userDTO *RegisterDTO) error {
 	hashedPassword, err := utils.HashPassword(userDTO.Password)
 	if err != nil {
 		return err
@@ -49,15 +126,24 @@ func (s *AuthService) Register(userDTO *RegisterDTO, isAdmin bool) error {
 		Email:    userDTO.Email,
 		Name:     userDTO.Name,
 		Password: hashedPassword,
-		IsAdmin:  isAdmin,
+		Roles:    []models.UserRole{{Role: models.RoleCustomer}},
 	}
 
-	return s.db.Transaction(func(tx *gorm.DB) error {
+	err = s.db.Transaction(func(tx *gorm.DB) error {
 		if err := tx.Create(&user).Error; err != nil {
 			return errors.New("failed to create user: " + err.Error())
 		}
 		return nil
 	})
+	if err != nil {
+		return err
+	}
+
+	if err := s.sendVerificationEmail(user); err != nil {
+		// The account exists either way, and the user can ask for another email.
+		log.Printf("failed to send verification email to user %d: %v", user.ID, err)
+	}
+	return nil
 }
 
 
@@ -66,41 +152,260 @@ func (s *AuthService) Register(userDTO *RegisterDTO, isAdmin bool) error {
 // Login attempts to authenticate a user with the provided email and password.
 // It retrieves the user from the database using the provided email.
 // If the user is found, it checks if the provided password matches the stored hashed password.
-// If the credentials are valid, it generates a JWT token using the user's ID as the subject.
-// The token is valid for 24 hours.
+// If the credentials are valid, it issues a short-lived access token and starts a new refresh token family.
+// Users with a confirmed authenticator get an MFA challenge instead, which VerifyMFA exchanges for tokens.
+//
+// Failed logins are counted per email address and per client IP. After a few failures further attempts
+// are delayed, doubling with every failure, until the account or IP is locked out for a while.
+// An unknown email and a wrong password return the same error, so accounts cannot be enumerated.
+// For users with MFA the failures are only cleared once VerifyMFA accepts the second factor.
 //
 // Parameters:
 // - email: The email of the user attempting to authenticate.
 // - password: The password provided by the user.
+// - client: The user agent and IP address the refresh token is issued to.
 //
 // Returns:
-// - A string representing the JWT token if the authentication is successful.
-// - An error if the authentication fails or encounters any database or token generation errors.
-func (s *AuthService) Login(email, password string) (string, error) {
+// - A TokenPair holding the access and refresh tokens if the authentication is complete.
+// - An MFAChallenge instead of the TokenPair if the user must still enter a TOTP code.
+// - A *ThrottledError if the account or client IP is blocked after failed logins.
+// - utils.ErrInvalidCredentials if no user has the email or the password is wrong.
+// - utils.ErrAccountSuspended if the password is right but an admin suspended the account.
+// - An error if the authentication encounters any database or token generation errors.
+func (s *AuthService) Login(email, password string, client ClientInfo) (*TokenPair, *MFAChallenge, error) {
+	accountKey, ipKey := loginKeys(email, client.IP)
+	if err := s.checkLoginThrottle(accountKey, ipKey); err != nil {
+		return nil, nil, err
+	}
+
 	var user models.User
 	// Find user by email
 	if err := s.db.Where("email = ?", email).First(&user).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return "", utils.ErrUserNotFound
+			compareDummyPassword(password)
+			s.recordFailedLogin(email, nil, client)
+			return nil, nil, utils.ErrInvalidCredentials
 		}
-		return "", errors.New("database error: " + err.Error())
+		return nil, nil, errors.New("database error: " + err.Error())
 	}
 
 	// Check if the provided password matches the stored hashed password
 	if err := utils.ComparePasswords(password, user.Password); err != nil {
-		return "", utils.ErrInvalidCredentials
+		s.recordFailedLogin(email, &user.ID, client)
+		return nil, nil, utils.ErrInvalidCredentials
+	}
+	if user.SuspendedAt != nil {
+		return nil, nil, utils.ErrAccountSuspended
+	}
+
+	enrolled, err := s.mfaEnrolled(user.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if enrolled {
+		challenge, err := s.issueMFAChallenge(user.ID)
+		return nil, challenge, err
 	}
 
-	// Generate JWT token using the user's ID as the subject
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
-		Subject:   strconv.FormatUint(uint64(user.ID), 10),
-		ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
+	s.clearFailedLogins(email, user.ID, client, "successful login")
+	pair, err := s.startSession(s.db, user, client, false)
+	return pair, nil, err
+}
+
+// startSession issues a token pair that begins a new refresh token family.
+func (s *AuthService) startSession(tx *gorm.DB, user models.User, client ClientInfo, mfa bool) (*TokenPair, error) {
+	familyID, err := utils.GenerateRandomToken(16)
+	if err != nil {
+		return nil, errors.New("failed to generate token")
+	}
+
+	pair, _, err := s.issueTokenPair(tx, user, familyID, client, mfa)
+	return pair, err
+}
+
+// Refresh exchanges a refresh token for a new token pair.
+//
+// The presented token is revoked and replaced by a new refresh token in the same family. If the token
+// was already revoked, it has been used before, which means it was stolen or replayed: every token in
+// its family is revoked so that neither the thief nor the legitimate client can keep refreshing.
+//
+// Parameters:
+// - refreshToken: The refresh token issued by Login or a previous Refresh.
+// - client: The user agent and IP address the new refresh token is issued to.
+//
+// Returns:
+// - A new TokenPair if the refresh token is valid.
+// - utils.ErrInvalidToken if the token is unknown, expired, revoked or belongs to a deleted user.
+// - utils.ErrAccountSuspended if the user was suspended.
+func (s *AuthService) Refresh(refreshToken string, client ClientInfo) (*TokenPair, error) {
+	var pair *TokenPair
+	reused := false
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var current models.RefreshToken
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ?", utils.HashToken(refreshToken)).
+			Take(&current).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return utils.ErrInvalidToken
+			}
+			return errors.New("failed to retrieve refresh token: " + err.Error())
+		}
+
+		now := time.Now()
+		if current.RevokedAt != nil {
+			// The family must stay revoked, so this transaction commits and the error is returned afterwards.
+			reused = true
+			return revokeRefreshTokens(tx.Where("family_id = ?", current.FamilyID), now)
+		}
+		if !current.ExpiresAt.After(now) {
+			return utils.ErrInvalidToken
+		}
+
+		var user models.User
+		if err := tx.Take(&user, current.UserID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return utils.ErrInvalidToken
+			}
+			return errors.New("failed to retrieve user: " + err.Error())
+		}
+
+		issued, replacement, err := s.issueTokenPair(tx, user, current.FamilyID, client, current.MFA)
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Model(&current).Updates(map[string]interface{}{"revoked_at": now, "replaced_by_id": replacement.ID}).Error; err != nil {
+			return errors.New("failed to rotate refresh token: " + err.Error())
+		}
+		pair = issued
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if reused {
+		return nil, utils.ErrInvalidToken
+	}
+	return pair, nil
+}
+
+// Logout revokes the access token that made the request, along with refresh tokens.
+//
+// Parameters:
+//   - userID: The ID of the authenticated user.
+//   - accessToken: The claims of the access token used for the request. Its jti is revoked until it expires.
+//   - input: The refresh token of the current device, or AllDevices to end every session of the user.
+//     With AllDevices the user's token version is incremented, which revokes every access token issued
+//     so far, and all of the user's refresh tokens are revoked.
+//
+// Returns:
+// - utils.ErrInvalidToken if a refresh token is given that does not belong to the user.
+// - An error if any database operation fails.
+func (s *AuthService) Logout(userID uint, accessToken *tokens.Claims, input LogoutDTO) error {
+	now := time.Now()
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		revoked := models.RevokedToken{JTI: accessToken.ID, ExpiresAt: accessToken.ExpiresAt.Time}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&revoked).Error; err != nil {
+			return errors.New("failed to revoke access token: " + err.Error())
+		}
+		// Revoked access tokens are only needed until they expire.
+		if err := tx.Where("expires_at < ?", now).Delete(&models.RevokedToken{}).Error; err != nil {
+			return errors.New("failed to purge revoked tokens: " + err.Error())
+		}
+
+		if input.AllDevices {
+			if err := tx.Model(&models.User{}).Where("id = ?", userID).
+				Update("token_version", gorm.Expr("token_version + 1")).Error; err != nil {
+				return errors.New("failed to revoke access tokens: " + err.Error())
+			}
+			return revokeRefreshTokens(tx.Where("user_id = ?", userID), now)
+		}
+
+		if input.RefreshToken == "" {
+			return nil
+		}
+
+		var current models.RefreshToken
+		if err := tx.Where("token_hash = ? AND user_id = ?", utils.HashToken(input.RefreshToken), userID).
+			Take(&current).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return utils.ErrInvalidToken
+			}
+			return errors.New("failed to retrieve refresh token: " + err.Error())
+		}
+		return revokeRefreshTokens(tx.Where("family_id = ?", current.FamilyID), now)
 	})
-	tokenString, err := token.SignedString([]byte(s.jwtSecret))
 	if err != nil {
-		return "", errors.New("failed to generate token")
+		return err
 	}
 
-	return tokenString, nil
+	middleware.ForgetToken(accessToken.ID)
+	if input.AllDevices {
+		middleware.ForgetUser(userID)
+	}
+	return nil
 }
 
+// issueTokenPair signs an access token for the user and stores a new refresh token in the given family.
+// mfa records whether the login passed a second factor. Suspended users get utils.ErrAccountSuspended.
+func (s *AuthService) issueTokenPair(tx *gorm.DB, user models.User, familyID string, client ClientInfo, mfa bool) (*TokenPair, *models.RefreshToken, error) {
+	if user.SuspendedAt != nil {
+		return nil, nil, utils.ErrAccountSuspended
+	}
+
+	methods := []string{tokens.MethodPassword}
+	if mfa {
+		methods = append(methods, tokens.MethodOTP)
+	}
+
+	var roles []models.Role
+	if err := tx.Model(&models.UserRole{}).Where("user_id = ?", user.ID).Order("role").Pluck("role", &roles).Error; err != nil {
+		return nil, nil, errors.New("failed to retrieve user roles: " + err.Error())
+	}
+
+	accessToken, _, err := s.tokens.Issue(tokens.Subject{
+		UserID:        user.ID,
+		TokenVersion:  user.TokenVersion,
+		Roles:         roles,
+		EmailVerified: user.VerifiedAt != nil,
+	}, methods)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	refreshToken, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return nil, nil, errors.New("failed to generate token")
+	}
+
+	record := models.RefreshToken{
+		UserID:    user.ID,
+		FamilyID:  familyID,
+		TokenHash: utils.HashToken(refreshToken),
+		ExpiresAt: time.Now().Add(s.settings.RefreshTokenTTL),
+		UserAgent: client.UserAgent,
+		IP:        client.IP,
+		MFA:       mfa,
+	}
+	if err := tx.Create(&record).Error; err != nil {
+		return nil, nil, errors.New("failed to store refresh token: " + err.Error())
+	}
+
+	pair := &TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(s.tokens.TTL().Seconds()),
+	}
+	return pair, &record, nil
+}
+
+// revokeRefreshTokens revokes the not yet revoked refresh tokens matched by query.
+func revokeRefreshTokens(query *gorm.DB, now time.Time) error {
+	if err := query.Model(&models.RefreshToken{}).Where("revoked_at IS NULL").Update("revoked_at", now).Error; err != nil {
+		return errors.New("failed to revoke refresh tokens: " + err.Error())
+	}
+	return nil
+}
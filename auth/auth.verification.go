@@ -0,0 +1,86 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"ecommerce-api/mailer"
+	"ecommerce-api/models"
+	"ecommerce-api/utils"
+
+	"gorm.io/gorm"
+)
+
+// ErrAlreadyVerified is returned when a verification email is requested for a verified account.
+var ErrAlreadyVerified = errors.New("email address is already verified")
+
+// VerifyEmail marks the user's email as verified using a token sent by Register or ResendVerification.
+//
+// Parameters:
+// - token: The verification token from the emailed link.
+//
+// Returns:
+// - utils.ErrInvalidToken if the token is unknown, expired or already used.
+// - An error if any database operation fails.
+func (s *AuthService) VerifyEmail(token string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		record, err := redeemUserToken(tx, token, models.UserTokenEmailVerification)
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Model(&models.User{}).Where("id = ? AND verified_at IS NULL", record.UserID).
+			Update("verified_at", time.Now()).Error; err != nil {
+			return errors.New("failed to verify email: " + err.Error())
+		}
+		return nil
+	})
+}
+
+// ResendVerification emails the user a new verification link. Earlier links stop working.
+//
+// Parameters:
+// - userID: The ID of the authenticated user.
+//
+// Returns:
+// - utils.ErrUserNotFound if the user does not exist.
+// - ErrAlreadyVerified if the email is already verified.
+// - An error if the token cannot be stored or the email cannot be sent.
+func (s *AuthService) ResendVerification(userID uint) error {
+	var user models.User
+	if err := s.db.Take(&user, userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return utils.ErrUserNotFound
+		}
+		return errors.New("database error: " + err.Error())
+	}
+
+	if user.VerifiedAt != nil {
+		return ErrAlreadyVerified
+	}
+	return s.sendVerificationEmail(user)
+}
+
+// sendVerificationEmail stores a new verification token for the user and emails the link to verify it.
+func (s *AuthService) sendVerificationEmail(user models.User) error {
+	var token string
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		token, err = issueUserToken(tx, user.ID, models.UserTokenEmailVerification, s.settings.EmailVerificationTTL)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	link := s.settings.APIURL + "/api/v1/auth/verify?token=" + url.QueryEscape(token)
+	return s.mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Hi %s,\n\nPlease confirm your email address by opening the link below:\n\n%s\n\n"+
+			"The link expires in %s. If you did not create an account, you can ignore this email.\n",
+			user.Name, link, s.settings.EmailVerificationTTL),
+	})
+}
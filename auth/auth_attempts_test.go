@@ -0,0 +1,103 @@
+package auth
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"ecommerce-api/utils"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLockoutPolicyDelay(t *testing.T) {
+	policy := LockoutPolicy{FreeAttempts: 3, BaseDelay: time.Second, MaxAttempts: 10, LockoutDuration: 15 * time.Minute}
+
+	expected := map[int]time.Duration{
+		1:  0,
+		3:  0,
+		4:  time.Second,
+		5:  2 * time.Second,
+		6:  4 * time.Second,
+		9:  32 * time.Second,
+		10: 15 * time.Minute,
+		12: 15 * time.Minute,
+	}
+	for failures, delay := range expected {
+		assert.Equal(t, delay, policy.Delay(failures), "after %d failures", failures)
+	}
+
+	assert.False(t, policy.LockedOut(9))
+	assert.True(t, policy.LockedOut(10))
+}
+
+func TestMemoryAttemptStore(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	store := NewMemoryAttemptStore()
+	store.now = func() time.Time { return now }
+
+	blockFor := func(failures int) time.Time { return now.Add(time.Duration(failures) * time.Minute) }
+	store.Fail("key", blockFor, time.Hour)
+	failures, _ := store.Fail("key", blockFor, time.Hour)
+	assert.Equal(t, 2, failures)
+
+	attempts, _ := store.Get("key")
+	assert.Equal(t, Attempts{Failures: 2, BlockedUntil: now.Add(2 * time.Minute)}, attempts)
+
+	now = now.Add(time.Hour)
+	attempts, _ = store.Get("key")
+	assert.Zero(t, attempts.Failures, "counters expire after the window")
+
+	store.Fail("key", blockFor, time.Hour)
+	store.Reset("key")
+	attempts, _ = store.Get("key")
+	assert.Zero(t, attempts.Failures)
+}
+
+// TestLoginLocksOutAccount verifies that unknown emails get the same error as wrong passwords, that
+// failures lock the email out and that the lockout is audited.
+func TestLoginLocksOutAccount(t *testing.T) {
+	service, mock := newMockAuthService(t)
+	service.settings.AccountLockout = LockoutPolicy{FreeAttempts: 1, BaseDelay: time.Second, MaxAttempts: 2, LockoutDuration: time.Minute, Window: time.Hour}
+	client := ClientInfo{IP: "203.0.113.7"}
+
+	userQuery := regexp.QuoteMeta(`SELECT * FROM "users" WHERE email = $1 AND "users"."deleted_at" IS NULL ORDER BY "users"."id" LIMIT $2`)
+
+	mock.ExpectQuery(userQuery).WithArgs("nobody@example.com", 1).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	_, _, err := service.Login("nobody@example.com", "guess", client)
+	assert.ErrorIs(t, err, utils.ErrInvalidCredentials)
+
+	mock.ExpectQuery(userQuery).WithArgs("nobody@example.com", 1).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "audit_logs"`)).
+		WithArgs("login_locked", nil, nil, "203.0.113.7", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectCommit()
+	_, _, err = service.Login("nobody@example.com", "guess", client)
+	assert.ErrorIs(t, err, utils.ErrInvalidCredentials)
+
+	_, _, err = service.Login("Nobody@Example.com", "guess", client)
+	var throttled *ThrottledError
+	if assert.ErrorAs(t, err, &throttled) {
+		assert.InDelta(t, time.Minute.Seconds(), throttled.RetryAfter.Seconds(), 1)
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestLoginRejectsSuspendedUser verifies that a suspended user cannot log in even with the right password.
+func TestLoginRejectsSuspendedUser(t *testing.T) {
+	service, mock := newMockAuthService(t)
+	hash, _ := utils.HashPassword("Secret-123")
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "users" WHERE email = $1 AND "users"."deleted_at" IS NULL ORDER BY "users"."id" LIMIT $2`)).
+		WithArgs("jane@example.com", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email", "password", "suspended_at"}).AddRow(7, "jane@example.com", hash, time.Now()))
+
+	pair, challenge, err := service.Login("jane@example.com", "Secret-123", ClientInfo{IP: "203.0.113.7"})
+
+	assert.ErrorIs(t, err, utils.ErrAccountSuspended)
+	assert.Nil(t, pair)
+	assert.Nil(t, challenge)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
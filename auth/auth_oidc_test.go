@@ -0,0 +1,203 @@
+package auth
+
+import (
+	"database/sql/driver"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+
+	"ecommerce-api/oidc"
+	"ecommerce-api/oidc/oidctest"
+	"ecommerce-api/utils"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+// newMockOIDCService returns an AuthService whose "test" provider is a mock OpenID provider.
+func newMockOIDCService(t *testing.T) (*AuthService, sqlmock.Sqlmock, *oidctest.Server) {
+	service, mock := newMockAuthService(t)
+
+	server := oidctest.NewServer("shop", "s3cret")
+	t.Cleanup(server.Close)
+	service.settings.OIDCProviders = map[string]*oidc.Provider{
+		"test": oidc.NewProvider(oidc.Config{
+			Name:         "test",
+			Issuer:       server.URL,
+			ClientID:     "shop",
+			ClientSecret: "s3cret",
+			RedirectURL:  "https://shop.example.com/auth/oidc/test/callback",
+		}, server.Client()),
+	}
+	return service, mock, server
+}
+
+// capture records the value passed to the database.
+type capture struct {
+	value *string
+}
+
+func (c capture) Match(v driver.Value) bool {
+	s, ok := v.(string)
+	*c.value = s
+	return ok
+}
+
+// expectOIDCLogin expects a login to be started and returns the nonce and code verifier it stores,
+// once StartOIDCLogin has run.
+func expectOIDCLogin(mock sqlmock.Sqlmock) (stateHash, nonce, verifier *string) {
+	stateHash, nonce, verifier = new(string), new(string), new(string)
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM "oidc_login_states" WHERE expires_at < $1`)).
+		WithArgs(sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "oidc_login_states" ("provider","state_hash","nonce","code_verifier","expires_at","created_at") VALUES ($1,$2,$3,$4,$5,$6) RETURNING "id"`)).
+		WithArgs("test", capture{stateHash}, capture{nonce}, capture{verifier}, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectCommit()
+	return stateHash, nonce, verifier
+}
+
+// expectStateRedeemed expects the pending login to be consumed.
+func expectStateRedeemed(mock sqlmock.Sqlmock, state string, nonce, verifier *string) {
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`DELETE FROM "oidc_login_states" WHERE state_hash = $1 RETURNING *`)).
+		WithArgs(utils.HashToken(state)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "provider", "nonce", "code_verifier", "expires_at"}).
+			AddRow(1, "test", *nonce, *verifier, time.Now().Add(time.Minute)))
+	mock.ExpectCommit()
+}
+
+var identityQuery = regexp.QuoteMeta(`SELECT * FROM "user_identities" WHERE provider = $1 AND subject = $2 LIMIT $3`)
+
+// TestOIDCLoginClaimsUnverifiedAccount runs a login against the mock provider for an email address
+// that was registered but never verified. The identity is linked, the password chosen at registration
+// is cleared, earlier sessions end, API keys are revoked and the authenticator is removed, so the
+// login is not sent to a second factor the owner does not have.
+func TestOIDCLoginClaimsUnverifiedAccount(t *testing.T) {
+	service, mock, server := newMockOIDCService(t)
+
+	stateHash, nonce, verifier := expectOIDCLogin(mock)
+	login, err := service.StartOIDCLogin("test")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, utils.HashToken(login.State), *stateHash)
+	authURL, _ := url.Parse(login.AuthorizationURL)
+	assert.Equal(t, oidc.CodeChallenge(*verifier), authURL.Query().Get("code_challenge"))
+
+	code, state, err := server.Authorize(login.AuthorizationURL)
+	assert.NoError(t, err)
+	assert.Equal(t, login.State, state)
+
+	expectStateRedeemed(mock, state, nonce, verifier)
+	mock.ExpectBegin()
+	mock.ExpectQuery(identityQuery).WithArgs("test", "1234567890", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "users" WHERE email = $1 AND "users"."deleted_at" IS NULL LIMIT $2 FOR UPDATE`)).
+		WithArgs("jane@example.com", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email", "password", "verified_at", "token_version"}).
+			AddRow(7, "jane@example.com", "$2a$10$squatter", nil, 2))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "users" SET "password"=$1,"token_version"=token_version + 1,"verified_at"=$2,"updated_at"=$3 WHERE "users"."deleted_at" IS NULL AND "id" = $4`)).
+		WithArgs("", sqlmock.AnyArg(), sqlmock.AnyArg(), 7).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "refresh_tokens" SET "revoked_at"=$1 WHERE user_id = $2 AND revoked_at IS NULL`)).
+		WithArgs(sqlmock.AnyArg(), 7).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "api_keys" SET "revoked_at"=$1 WHERE user_id = $2 AND revoked_at IS NULL`)).
+		WithArgs(sqlmock.AnyArg(), 7).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM "mfa_recovery_codes" WHERE user_id = $1`)).
+		WithArgs(7).
+		WillReturnResult(sqlmock.NewResult(0, 10))
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM "mfa_factors" WHERE user_id = $1`)).
+		WithArgs(7).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "user_identities" ("user_id","provider","subject","email","last_login_at","created_at") VALUES ($1,$2,$3,$4,$5,$6) RETURNING "id"`)).
+		WithArgs(7, "test", "1234567890", "jane@example.com", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "audit_logs"`)).
+		WithArgs("identity_linked", 7, nil, "203.0.113.7", "provider test", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectCommit()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM "mfa_factors" WHERE user_id = $1 AND confirmed_at IS NOT NULL`)).
+		WithArgs(7).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT "role" FROM "user_roles" WHERE user_id = $1 ORDER BY role`)).
+		WithArgs(7).
+		WillReturnRows(sqlmock.NewRows([]string{"role"}).AddRow("customer"))
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "refresh_tokens"`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectCommit()
+
+	pair, challenge, err := service.CompleteOIDCLogin("test", code, state, ClientInfo{IP: "203.0.113.7"})
+
+	if assert.NoError(t, err) && assert.NotNil(t, pair) {
+		assert.Nil(t, challenge)
+		claims, err := service.tokens.Parse(pair.AccessToken)
+		if assert.NoError(t, err) {
+			assert.Equal(t, "7", claims.Subject)
+			// The token must carry the version after the bump, or it would be rejected.
+			assert.Equal(t, uint(3), claims.TokenVersion)
+			assert.True(t, claims.EmailVerified)
+		}
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestOIDCLoginRequiresVerifiedEmail verifies that an identity whose email address the provider did
+// not verify is neither linked nor given an account.
+func TestOIDCLoginRequiresVerifiedEmail(t *testing.T) {
+	service, mock, server := newMockOIDCService(t)
+	server.SetUser(oidctest.User{Subject: "42", Email: "jane@example.com", EmailVerified: false})
+
+	_, nonce, verifier := expectOIDCLogin(mock)
+	login, err := service.StartOIDCLogin("test")
+	if !assert.NoError(t, err) {
+		return
+	}
+	code, state, err := server.Authorize(login.AuthorizationURL)
+	assert.NoError(t, err)
+
+	expectStateRedeemed(mock, state, nonce, verifier)
+	mock.ExpectBegin()
+	mock.ExpectQuery(identityQuery).WithArgs("test", "42", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectRollback()
+
+	_, _, err = service.CompleteOIDCLogin("test", code, state, ClientInfo{})
+
+	assert.ErrorIs(t, err, ErrOIDCEmailNotVerified)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestCompleteOIDCLoginRejectsUnknownState verifies that a callback is only accepted for a pending
+// login, so a state cannot be replayed.
+func TestCompleteOIDCLoginRejectsUnknownState(t *testing.T) {
+	service, mock, _ := newMockOIDCService(t)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`DELETE FROM "oidc_login_states" WHERE state_hash = $1 RETURNING *`)).
+		WithArgs(utils.HashToken("replayed")).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectCommit()
+
+	_, _, err := service.CompleteOIDCLogin("test", "code", "replayed", ClientInfo{})
+
+	assert.ErrorIs(t, err, ErrInvalidOIDCState)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOIDCUnknownProvider(t *testing.T) {
+	service, mock, _ := newMockOIDCService(t)
+
+	_, err := service.StartOIDCLogin("elsewhere")
+
+	assert.ErrorIs(t, err, ErrUnknownProvider)
+	assert.Equal(t, []string{"test"}, service.OIDCProviders())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,226 @@
+package auth
+
+import (
+	"ecommerce-api/internal/testdb"
+	"ecommerce-api/mailer"
+	"ecommerce-api/tokens"
+	"ecommerce-api/utils"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func newMockAuthService(t *testing.T) (*AuthService, sqlmock.Sqlmock) {
+	gormDB, mock := testdb.New(t)
+
+	settings := Settings{RefreshTokenTTL: time.Hour, PasswordResetTTL: time.Hour, AppURL: "https://shop.example.com"}
+	return NewAuthService(tokens.NewManager("secret", time.Minute), mailer.NewFileMailer(t.TempDir(), "shop@example.com"), NewMemoryAttemptStore(), settings, gormDB), mock
+}
+
+// TestRefreshReusedToken verifies that presenting a rotated refresh token revokes its whole family
+// and that the revocation is committed even though the refresh fails.
+func TestRefreshReusedToken(t *testing.T) {
+	service, mock := newMockAuthService(t)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "refresh_tokens" WHERE token_hash = $1 LIMIT $2 FOR UPDATE`)).
+		WithArgs(utils.HashToken("stolen"), 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "family_id", "expires_at", "revoked_at"}).
+			AddRow(1, 7, "family", time.Now().Add(time.Hour), time.Now().Add(-time.Minute)))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "refresh_tokens" SET "revoked_at"=$1 WHERE family_id = $2 AND revoked_at IS NULL`)).
+		WithArgs(sqlmock.AnyArg(), "family").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	pair, err := service.Refresh("stolen", ClientInfo{})
+
+	assert.Nil(t, pair)
+	assert.ErrorIs(t, err, utils.ErrInvalidToken)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRefreshExpiredToken(t *testing.T) {
+	service, mock := newMockAuthService(t)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "refresh_tokens" WHERE token_hash = $1 LIMIT $2 FOR UPDATE`)).
+		WithArgs(utils.HashToken("old"), 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "family_id", "expires_at"}).
+			AddRow(1, 7, "family", time.Now().Add(-time.Minute)))
+	mock.ExpectRollback()
+
+	_, err := service.Refresh("old", ClientInfo{})
+
+	assert.ErrorIs(t, err, utils.ErrInvalidToken)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// recordingMailer keeps sent messages in memory.
+type recordingMailer struct {
+	messages []mailer.Message
+}
+
+func (m *recordingMailer) Send(msg mailer.Message) error {
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+func TestForgotPasswordSendsResetLink(t *testing.T) {
+	service, mock := newMockAuthService(t)
+	mail := &recordingMailer{}
+	service.mailer = mail
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "users" WHERE email = $1 AND "users"."deleted_at" IS NULL LIMIT $2`)).
+		WithArgs("jane@example.com", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email", "name"}).AddRow(7, "jane@example.com", "Jane"))
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "user_tokens" SET "used_at"=$1 WHERE user_id = $2 AND purpose = $3 AND used_at IS NULL`)).
+		WithArgs(sqlmock.AnyArg(), 7, "password_reset").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "user_tokens"`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectCommit()
+
+	assert.NoError(t, service.ForgotPassword("jane@example.com"))
+	if assert.Len(t, mail.messages, 1) {
+		assert.Equal(t, "jane@example.com", mail.messages[0].To)
+		assert.Contains(t, mail.messages[0].Body, "https://shop.example.com/reset-password?token=")
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestForgotPasswordUnknownEmail(t *testing.T) {
+	service, mock := newMockAuthService(t)
+	mail := &recordingMailer{}
+	service.mailer = mail
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "users" WHERE email = $1`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	assert.NoError(t, service.ForgotPassword("nobody@example.com"))
+	assert.Empty(t, mail.messages)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestResetPasswordRejectsUsedToken(t *testing.T) {
+	service, mock := newMockAuthService(t)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "user_tokens" WHERE token_hash = $1 AND purpose = $2 LIMIT $3 FOR UPDATE`)).
+		WithArgs(utils.HashToken("used"), "password_reset", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "expires_at", "used_at"}).
+			AddRow(1, 7, time.Now().Add(time.Hour), time.Now().Add(-time.Minute)))
+	mock.ExpectRollback()
+
+	err := service.ResetPassword("used", "N3w-password!")
+
+	assert.ErrorIs(t, err, utils.ErrInvalidToken)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestResetPasswordRejectsWeakPassword(t *testing.T) {
+	service, mock := newMockAuthService(t)
+
+	err := service.ResetPassword("token", "short")
+
+	assert.ErrorIs(t, err, ErrWeakPassword)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestVerifyEmail(t *testing.T) {
+	service, mock := newMockAuthService(t)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "user_tokens" WHERE token_hash = $1 AND purpose = $2 LIMIT $3 FOR UPDATE`)).
+		WithArgs(utils.HashToken("verify-me"), "email_verification", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "purpose", "expires_at"}).
+			AddRow(3, 7, "email_verification", time.Now().Add(time.Hour)))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "user_tokens" SET "used_at"=$1 WHERE "id" = $2`)).
+		WithArgs(sqlmock.AnyArg(), 3).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "users" SET "verified_at"=$1,"updated_at"=$2 WHERE (id = $3 AND verified_at IS NULL) AND "users"."deleted_at" IS NULL`)).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), 7).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	assert.NoError(t, service.VerifyEmail("verify-me"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestVerifyMFAConsumesChallenge verifies that a wrong code still uses up the challenge, so each
+// password login allows a single guess.
+func TestVerifyMFAConsumesChallenge(t *testing.T) {
+	service, mock := newMockAuthService(t)
+
+	expectMFAChallenge(mock, "challenge")
+	expectWrongMFACode(mock)
+
+	pair, err := service.VerifyMFA("challenge", "wrong-code", ClientInfo{})
+
+	assert.Nil(t, pair)
+	assert.ErrorIs(t, err, ErrInvalidMFACode)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestVerifyMFALocksOutAccount verifies that wrong codes count as failed logins, so that logging in
+// again for a new challenge does not give unlimited guesses at the second factor.
+func TestVerifyMFALocksOutAccount(t *testing.T) {
+	service, mock := newMockAuthService(t)
+	service.settings.AccountLockout = LockoutPolicy{FreeAttempts: 2, BaseDelay: time.Second, MaxAttempts: 2, LockoutDuration: time.Minute, Window: time.Hour}
+	client := ClientInfo{IP: "203.0.113.7"}
+
+	expectMFAChallenge(mock, "first")
+	expectWrongMFACode(mock)
+	_, err := service.VerifyMFA("first", "wrong-code", client)
+	assert.ErrorIs(t, err, ErrInvalidMFACode)
+
+	expectMFAChallenge(mock, "second")
+	expectWrongMFACode(mock)
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "audit_logs"`)).
+		WithArgs("login_locked", 7, nil, "203.0.113.7", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectCommit()
+	_, err = service.VerifyMFA("second", "wrong-code", client)
+	assert.ErrorIs(t, err, ErrInvalidMFACode)
+
+	expectMFAChallenge(mock, "third")
+	_, err = service.VerifyMFA("third", "123456", client)
+	var throttled *ThrottledError
+	if assert.ErrorAs(t, err, &throttled) {
+		assert.InDelta(t, time.Minute.Seconds(), throttled.RetryAfter.Seconds(), 1)
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// expectMFAChallenge expects the challenge token to be redeemed for user 7 and the user to be loaded.
+func expectMFAChallenge(mock sqlmock.Sqlmock, token string) {
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "user_tokens" WHERE token_hash = $1 AND purpose = $2 LIMIT $3 FOR UPDATE`)).
+		WithArgs(utils.HashToken(token), "mfa_challenge", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "purpose", "expires_at"}).
+			AddRow(4, 7, "mfa_challenge", time.Now().Add(time.Minute)))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "user_tokens" SET "used_at"=$1 WHERE "id" = $2`)).
+		WithArgs(sqlmock.AnyArg(), 4).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "users" WHERE "users"."id" = $1 AND "users"."deleted_at" IS NULL LIMIT $2`)).
+		WithArgs(7, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email"}).AddRow(7, "jane@example.com"))
+}
+
+// expectWrongMFACode expects a code that is neither a current TOTP code nor a recovery code of user 7.
+func expectWrongMFACode(mock sqlmock.Sqlmock) {
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "mfa_factors" WHERE user_id = $1 LIMIT $2 FOR UPDATE`)).
+		WithArgs(7, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "secret", "confirmed_at", "last_used_step"}).
+			AddRow(7, "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ", time.Now(), 0))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "mfa_recovery_codes" SET "used_at"=$1 WHERE user_id = $2 AND code_hash = $3 AND used_at IS NULL`)).
+		WithArgs(sqlmock.AnyArg(), 7, utils.HashToken("WRONGCODE")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+}
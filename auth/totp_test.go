@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestHOTPVectors checks the SHA-1 test vectors from RFC 6238, Appendix B.
+func TestHOTPVectors(t *testing.T) {
+	key := []byte("12345678901234567890")
+	vectors := []struct {
+		unix int64
+		code string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+
+	for _, v := range vectors {
+		assert.Equal(t, v.code, hotp(key, uint64(totpStep(time.Unix(v.unix, 0))), 8), "time %d", v.unix)
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	secret := totpEncoding.EncodeToString([]byte("12345678901234567890"))
+	now := time.Unix(1111111111, 0)
+	key := []byte("12345678901234567890")
+	code := hotp(key, uint64(totpStep(now)), totpDigits)
+
+	step, ok := validateTOTP(secret, code, now, 0)
+	assert.True(t, ok)
+	assert.Equal(t, totpStep(now), step)
+
+	_, ok = validateTOTP(secret, code, now.Add(totpPeriod), 0)
+	assert.True(t, ok, "code from the previous period is accepted")
+
+	_, ok = validateTOTP(secret, code, now.Add(3*totpPeriod), 0)
+	assert.False(t, ok, "code from three periods ago is rejected")
+
+	_, ok = validateTOTP(secret, code, now, step)
+	assert.False(t, ok, "a code cannot be used twice")
+
+	_, ok = validateTOTP(secret, "12345", now, 0)
+	assert.False(t, ok)
+}
+
+func TestTOTPProvisioningURI(t *testing.T) {
+	secret, err := generateTOTPSecret()
+	assert.NoError(t, err)
+	assert.Len(t, secret, 32)
+
+	uri := totpProvisioningURI("Shop API", "jane@example.com", secret)
+	assert.True(t, strings.HasPrefix(uri, "otpauth://totp/Shop%20API:jane@example.com?"))
+	assert.Contains(t, uri, "secret="+secret)
+	assert.Contains(t, uri, "issuer=Shop+API")
+}
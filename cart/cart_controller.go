@@ -0,0 +1,258 @@
+package cart
+
+import (
+	"ecommerce-api/orders"
+	"ecommerce-api/utils"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// CartController handles HTTP requests for the shopping cart
+type CartController struct {
+	cartService *CartService
+}
+
+// NewCartController initializes a new CartController
+func NewCartController(cartService *CartService) *CartController {
+	return &CartController{cartService: cartService}
+}
+
+// userID reads the authenticated user's ID from the context, sending an error response if it is missing or malformed.
+func userID(ctx *gin.Context) (uint, bool) {
+	userIDStr, exists := ctx.Get("userID")
+	if !exists {
+		utils.NewAPIResponse(http.StatusUnauthorized, "Unauthorized", nil, "User ID not found in context").Send(ctx)
+		return 0, false
+	}
+
+	id, err := strconv.ParseUint(userIDStr.(string), 10, 32)
+	if err != nil {
+		utils.NewAPIResponse(http.StatusBadRequest, "Invalid User ID", nil, "User ID conversion failed").Send(ctx)
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// GetCart godoc
+// @Summary      Get the cart
+// @Description  Returns the user's cart with current prices, stock availability warnings and a subtotal. A cart priced in several currencies has a warning and no subtotal
+// @Tags         cart
+// @Produce      json
+// @Success      200  {object}  utils.APIResponse{data=CartView}
+// @Failure      500  {object}  utils.APIResponse
+// @Security     BearerAuth
+// @Router       /cart [get]
+func (c *CartController) GetCart(ctx *gin.Context) {
+	userID, ok := userID(ctx)
+	if !ok {
+		return
+	}
+
+	cart, err := c.cartService.GetCart(userID)
+	if err != nil {
+		utils.NewAPIResponse(http.StatusInternalServerError, "Failed to retrieve cart", nil, err.Error()).Send(ctx)
+		return
+	}
+
+	utils.NewAPIResponse(http.StatusOK, "Cart retrieved successfully", cart, "").Send(ctx)
+}
+
+// AddItem godoc
+// @Summary      Add a product to the cart
+// @Description  Adds a variant of a product to the user's cart. The variant may be omitted for a product with a single variant.
+// @Description  Adding a variant that is already in the cart increases its quantity.
+// @Tags         cart
+// @Accept       json
+// @Produce      json
+// @Param        item  body      AddCartItemDTO  true  "Product and quantity"
+// @Success      200   {object}  utils.APIResponse{data=CartView}
+// @Failure      400   {object}  utils.APIResponse
+// @Failure      404   {object}  utils.APIResponse
+// @Failure      500   {object}  utils.APIResponse
+// @Security     BearerAuth
+// @Router       /cart/items [post]
+func (c *CartController) AddItem(ctx *gin.Context) {
+	var input AddCartItemDTO
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		utils.NewAPIResponse(http.StatusBadRequest, "Invalid input", nil, err.Error()).Send(ctx)
+		return
+	}
+
+	userID, ok := userID(ctx)
+	if !ok {
+		return
+	}
+
+	if err := c.cartService.AddItem(userID, input); err != nil {
+		switch {
+		case errors.Is(err, ErrProductNotFound):
+			utils.NewAPIResponse(http.StatusNotFound, "Product not found", nil, "").Send(ctx)
+		case errors.Is(err, ErrVariantNotFound):
+			utils.NewAPIResponse(http.StatusNotFound, "Variant not found", nil, "").Send(ctx)
+		case errors.Is(err, orders.ErrVariantRequired):
+			utils.NewAPIResponse(http.StatusBadRequest, "Invalid input", nil, err.Error()).Send(ctx)
+		default:
+			utils.NewAPIResponse(http.StatusInternalServerError, "Failed to add item to cart", nil, err.Error()).Send(ctx)
+		}
+		return
+	}
+
+	c.sendCart(ctx, userID, "Item added to cart")
+}
+
+// UpdateItem godoc
+// @Summary      Change a cart item's quantity
+// @Description  Sets the quantity of a product that is already in the user's cart. variant_id selects the variant when the cart holds several of the product.
+// @Tags         cart
+// @Accept       json
+// @Produce      json
+// @Param        productID  path      string             true  "Product ID"
+// @Param        variant_id query     int                false "Variant ID"
+// @Param        item       body      UpdateCartItemDTO  true  "New quantity"
+// @Success      200        {object}  utils.APIResponse{data=CartView}
+// @Failure      400        {object}  utils.APIResponse
+// @Failure      404        {object}  utils.APIResponse
+// @Failure      500        {object}  utils.APIResponse
+// @Security     BearerAuth
+// @Router       /cart/items/{productID} [patch]
+func (c *CartController) UpdateItem(ctx *gin.Context) {
+	productID, err := strconv.ParseUint(ctx.Param("productID"), 10, 32)
+	if err != nil {
+		utils.NewAPIResponse(http.StatusBadRequest, "Invalid product ID", nil, err.Error()).Send(ctx)
+		return
+	}
+
+	var query CartItemQuery
+	if err := ctx.ShouldBindQuery(&query); err != nil {
+		utils.NewAPIResponse(http.StatusBadRequest, "Invalid query", nil, err.Error()).Send(ctx)
+		return
+	}
+
+	var input UpdateCartItemDTO
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		utils.NewAPIResponse(http.StatusBadRequest, "Invalid input", nil, err.Error()).Send(ctx)
+		return
+	}
+
+	userID, ok := userID(ctx)
+	if !ok {
+		return
+	}
+
+	if err := c.cartService.UpdateItem(userID, uint(productID), query.VariantID, input.Quantity); err != nil {
+		if errors.Is(err, ErrCartItemNotFound) {
+			utils.NewAPIResponse(http.StatusNotFound, "Product is not in the cart", nil, "").Send(ctx)
+		} else if errors.Is(err, orders.ErrVariantRequired) {
+			utils.NewAPIResponse(http.StatusBadRequest, "Invalid query", nil, err.Error()).Send(ctx)
+		} else {
+			utils.NewAPIResponse(http.StatusInternalServerError, "Failed to update cart item", nil, err.Error()).Send(ctx)
+		}
+		return
+	}
+
+	c.sendCart(ctx, userID, "Cart item updated")
+}
+
+// RemoveItem godoc
+// @Summary      Remove a product from the cart
+// @Description  variant_id selects the variant when the cart holds several of the product.
+// @Tags         cart
+// @Produce      json
+// @Param        productID  path      string  true  "Product ID"
+// @Param        variant_id query     int     false "Variant ID"
+// @Success      200        {object}  utils.APIResponse{data=CartView}
+// @Failure      400        {object}  utils.APIResponse
+// @Failure      404        {object}  utils.APIResponse
+// @Failure      500        {object}  utils.APIResponse
+// @Security     BearerAuth
+// @Router       /cart/items/{productID} [delete]
+func (c *CartController) RemoveItem(ctx *gin.Context) {
+	productID, err := strconv.ParseUint(ctx.Param("productID"), 10, 32)
+	if err != nil {
+		utils.NewAPIResponse(http.StatusBadRequest, "Invalid product ID", nil, err.Error()).Send(ctx)
+		return
+	}
+
+	var query CartItemQuery
+	if err := ctx.ShouldBindQuery(&query); err != nil {
+		utils.NewAPIResponse(http.StatusBadRequest, "Invalid query", nil, err.Error()).Send(ctx)
+		return
+	}
+
+	userID, ok := userID(ctx)
+	if !ok {
+		return
+	}
+
+	if err := c.cartService.RemoveItem(userID, uint(productID), query.VariantID); err != nil {
+		if errors.Is(err, ErrCartItemNotFound) {
+			utils.NewAPIResponse(http.StatusNotFound, "Product is not in the cart", nil, "").Send(ctx)
+		} else if errors.Is(err, orders.ErrVariantRequired) {
+			utils.NewAPIResponse(http.StatusBadRequest, "Invalid query", nil, err.Error()).Send(ctx)
+		} else {
+			utils.NewAPIResponse(http.StatusInternalServerError, "Failed to remove cart item", nil, err.Error()).Send(ctx)
+		}
+		return
+	}
+
+	c.sendCart(ctx, userID, "Item removed from cart")
+}
+
+// Checkout godoc
+// @Summary      Check out the cart
+// @Description  Places an order for everything in the user's cart and empties the cart
+// @Tags         cart
+// @Produce      json
+// @Success      201  {object}  utils.APIResponse{data=models.Order}
+// @Failure      400  {object}  utils.APIResponse
+// @Failure      403  {object}  utils.APIResponse
+// @Failure      404  {object}  utils.APIResponse
+// @Failure      409  {object}  utils.APIResponse{data=[]orders.StockShortage}
+// @Failure      500  {object}  utils.APIResponse
+// @Security     BearerAuth
+// @Router       /cart/checkout [post]
+func (c *CartController) Checkout(ctx *gin.Context) {
+	userID, ok := userID(ctx)
+	if !ok {
+		return
+	}
+
+	order, err := c.cartService.Checkout(userID)
+	if err != nil {
+		var stockErr *orders.InsufficientStockError
+		switch {
+		case errors.Is(err, ErrCartEmpty):
+			utils.NewAPIResponse(http.StatusBadRequest, "Cart is empty", nil, "").Send(ctx)
+		case errors.As(err, &stockErr):
+			utils.NewAPIResponse(http.StatusConflict, "Insufficient stock", stockErr.Lines, stockErr.Error()).Send(ctx)
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			utils.NewAPIResponse(http.StatusNotFound, "One or more products do not exist", nil, "").Send(ctx)
+		case errors.Is(err, orders.ErrMixedCurrency):
+			utils.NewAPIResponse(http.StatusBadRequest, "Products must share a currency", nil, err.Error()).Send(ctx)
+		case errors.Is(err, orders.ErrVariantRequired):
+			utils.NewAPIResponse(http.StatusBadRequest, "A variant must be chosen", nil, err.Error()).Send(ctx)
+		case errors.Is(err, orders.ErrEmailNotVerified):
+			utils.NewAPIResponse(http.StatusForbidden, "Email not verified", nil, err.Error()).Send(ctx)
+		default:
+			utils.NewAPIResponse(http.StatusInternalServerError, "Failed to place order", nil, err.Error()).Send(ctx)
+		}
+		return
+	}
+
+	utils.NewAPIResponse(http.StatusCreated, "Order placed successfully", order, "").Send(ctx)
+}
+
+// sendCart responds with the user's updated cart after a change.
+func (c *CartController) sendCart(ctx *gin.Context, userID uint, message string) {
+	cart, err := c.cartService.GetCart(userID)
+	if err != nil {
+		utils.NewAPIResponse(http.StatusInternalServerError, "Failed to retrieve cart", nil, err.Error()).Send(ctx)
+		return
+	}
+
+	utils.NewAPIResponse(http.StatusOK, message, cart, "").Send(ctx)
+}
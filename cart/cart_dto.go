@@ -0,0 +1,44 @@
+package cart
+
+// AddCartItemDTO adds a variant of a product to the cart. VariantID may be omitted for a product with a single variant.
+type AddCartItemDTO struct {
+	ProductID uint `json:"productID" binding:"required,gt=0"`
+	VariantID uint `json:"variantID" binding:"omitempty,gt=0"`
+	Quantity  int  `json:"quantity" binding:"required,gte=1"`
+}
+
+type UpdateCartItemDTO struct {
+	Quantity int `json:"quantity" binding:"required,gte=1"`
+}
+
+// CartItemQuery selects the variant of a product in the cart. It may be omitted when the cart holds
+// a single variant of the product.
+type CartItemQuery struct {
+	VariantID uint `form:"variant_id"`
+}
+
+// CartLine is a cart item priced at the variant's current price.
+// Warning is set when the line cannot be checked out as it is.
+type CartLine struct {
+	ProductID    uint   `json:"product_id"`
+	VariantID    uint   `json:"variant_id"`
+	ProductName  string `json:"product_name"`
+	SKU          string `json:"sku,omitempty"`
+	VariantTitle string `json:"variant_title,omitempty"`
+	UnitPrice    int64  `json:"unit_price"`
+	Currency     string `json:"currency"`
+	Quantity     int    `json:"quantity"`
+	LineTotal    int64  `json:"line_total"`
+	Available    int    `json:"available"`
+	Warning      string `json:"warning,omitempty"`
+}
+
+// CartView is a user's cart with live prices and stock availability.
+// Warning is set, and Currency and Subtotal are left empty, when the lines are priced in different
+// currencies, as such a cart cannot be checked out.
+type CartView struct {
+	Items    []CartLine `json:"items"`
+	Currency string     `json:"currency,omitempty"`
+	Subtotal int64      `json:"subtotal"`
+	Warning  string     `json:"warning,omitempty"`
+}
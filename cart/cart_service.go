@@ -0,0 +1,248 @@
+package cart
+
+import (
+	"ecommerce-api/models"
+	"ecommerce-api/orders"
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrProductNotFound  = errors.New("product not found")
+	ErrVariantNotFound  = errors.New("variant not found")
+	ErrCartItemNotFound = errors.New("cart item not found")
+	ErrCartEmpty        = errors.New("cart is empty")
+)
+
+// CartService manages users' shopping carts
+type CartService struct {
+	db *gorm.DB
+}
+
+// NewCartService initializes CartService with database connection
+func NewCartService(db *gorm.DB) *CartService {
+	return &CartService{db: db}
+}
+
+// AddItem adds a variant of a product to the user's cart. If the variant is already in the cart, the
+// quantity is added to the existing line instead of creating a second one.
+//
+// The function returns ErrProductNotFound if the product does not exist or is in the trash,
+// ErrVariantNotFound if the variant is not one of the product's, and orders.ErrVariantRequired if the
+// variant is omitted for a product with several. Stock is not checked here; GetCart warns about lines
+// that exceed the available stock and Checkout rejects them.
+func (s *CartService) AddItem(userID uint, input AddCartItemDTO) error {
+	// Deleted products keep their variants, so the product itself is looked up first.
+	if err := s.db.Select("id").First(&models.Product{}, input.ProductID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrProductNotFound
+		}
+		return errors.New("failed to retrieve product: " + err.Error())
+	}
+
+	query := s.db.Select("id").Where("product_id = ?", input.ProductID)
+	if input.VariantID != 0 {
+		query = query.Where("id = ?", input.VariantID)
+	}
+	var variants []models.ProductVariant
+	if err := query.Order("id").Limit(2).Find(&variants).Error; err != nil {
+		return errors.New("failed to retrieve product: " + err.Error())
+	}
+	switch {
+	case len(variants) == 0 && input.VariantID != 0:
+		return ErrVariantNotFound
+	case len(variants) == 0:
+		return ErrProductNotFound
+	case len(variants) > 1:
+		return orders.ErrVariantRequired
+	}
+
+	item := models.CartItem{UserID: userID, ProductID: input.ProductID, VariantID: variants[0].ID, Quantity: input.Quantity}
+	err := s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "variant_id"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{"quantity": gorm.Expr("cart_items.quantity + EXCLUDED.quantity"), "updated_at": gorm.Expr("EXCLUDED.updated_at")}),
+	}).Create(&item).Error
+	if err != nil {
+		return errors.New("failed to add item to cart: " + err.Error())
+	}
+	return nil
+}
+
+// UpdateItem sets the quantity of a product variant already in the user's cart. The variant may be
+// omitted (zero) when the cart holds a single variant of the product.
+// It returns ErrCartItemNotFound if the product is not in the cart, and orders.ErrVariantRequired if
+// the variant is omitted but the cart holds several variants of the product.
+func (s *CartService) UpdateItem(userID, productID, variantID uint, quantity int) error {
+	item, err := s.findItem(userID, productID, variantID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.db.Model(item).Update("quantity", quantity).Error; err != nil {
+		return errors.New("failed to update cart item: " + err.Error())
+	}
+	return nil
+}
+
+// RemoveItem removes a product variant from the user's cart. The variant may be omitted (zero) when the
+// cart holds a single variant of the product.
+// It returns ErrCartItemNotFound if the product is not in the cart, and orders.ErrVariantRequired if
+// the variant is omitted but the cart holds several variants of the product.
+func (s *CartService) RemoveItem(userID, productID, variantID uint) error {
+	item, err := s.findItem(userID, productID, variantID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.db.Delete(item).Error; err != nil {
+		return errors.New("failed to remove cart item: " + err.Error())
+	}
+	return nil
+}
+
+// findItem returns the user's cart line for a variant of a product, or for the product's only line when
+// variantID is zero.
+func (s *CartService) findItem(userID, productID, variantID uint) (*models.CartItem, error) {
+	query := s.db.Where("user_id = ? AND product_id = ?", userID, productID)
+	if variantID != 0 {
+		query = query.Where("variant_id = ?", variantID)
+	}
+
+	var items []models.CartItem
+	if err := query.Limit(2).Find(&items).Error; err != nil {
+		return nil, errors.New("failed to retrieve cart item: " + err.Error())
+	}
+	switch len(items) {
+	case 0:
+		return nil, ErrCartItemNotFound
+	case 1:
+		return &items[0], nil
+	default:
+		return nil, orders.ErrVariantRequired
+	}
+}
+
+// GetCart returns the user's cart priced with the variants' current prices.
+//
+// Each line reports the variant's stock currently available and carries a warning when the product or
+// variant no longer exists, is out of stock or has fewer units than the line asks for. Lines for
+// products or variants that no longer exist are not counted in the subtotal. Like an order, a cart must
+// be priced in a single currency: if its lines are not, the cart carries a warning and has no subtotal.
+func (s *CartService) GetCart(userID uint) (*CartView, error) {
+	var items []models.CartItem
+	if err := s.db.Where("user_id = ?", userID).Order("created_at, id").Find(&items).Error; err != nil {
+		return nil, errors.New("failed to retrieve cart: " + err.Error())
+	}
+
+	productIDs := make([]uint, len(items))
+	variantIDs := make([]uint, len(items))
+	for i, item := range items {
+		productIDs[i] = item.ProductID
+		variantIDs[i] = item.VariantID
+	}
+
+	var products []models.Product
+	var variants []models.ProductVariant
+	if len(productIDs) > 0 {
+		if err := s.db.Where("id IN ?", productIDs).Find(&products).Error; err != nil {
+			return nil, errors.New("failed to retrieve cart products: " + err.Error())
+		}
+		if err := s.db.Where("id IN ?", variantIDs).Find(&variants).Error; err != nil {
+			return nil, errors.New("failed to retrieve cart products: " + err.Error())
+		}
+	}
+	byID := make(map[uint]models.Product, len(products))
+	for _, product := range products {
+		byID[product.ID] = product
+	}
+	variantsByID := make(map[uint]models.ProductVariant, len(variants))
+	for _, variant := range variants {
+		variantsByID[variant.ID] = variant
+	}
+
+	view := &CartView{Items: make([]CartLine, len(items))}
+	mixedCurrencies := false
+	for i, item := range items {
+		line := CartLine{ProductID: item.ProductID, VariantID: item.VariantID, Quantity: item.Quantity}
+
+		product, exists := byID[item.ProductID]
+		variant, variantExists := variantsByID[item.VariantID]
+		if !exists || !variantExists {
+			line.Warning = "product is no longer available"
+			view.Items[i] = line
+			continue
+		}
+
+		line.ProductName = product.Name
+		if variant.SKU != nil {
+			line.SKU = *variant.SKU
+		}
+		line.VariantTitle = variant.Title
+		line.UnitPrice = variant.UnitPrice(product)
+		line.Currency = product.Currency
+		line.LineTotal = line.UnitPrice * int64(item.Quantity)
+		line.Available = variant.Stock
+		switch {
+		case variant.Stock <= 0:
+			line.Warning = "product is out of stock"
+		case item.Quantity > variant.Stock:
+			line.Warning = fmt.Sprintf("only %d left in stock", variant.Stock)
+		}
+
+		if view.Currency == "" {
+			view.Currency = product.Currency
+		} else if view.Currency != product.Currency {
+			mixedCurrencies = true
+		}
+		view.Subtotal += line.LineTotal
+		view.Items[i] = line
+	}
+
+	if mixedCurrencies {
+		view.Currency = ""
+		view.Subtotal = 0
+		view.Warning = orders.ErrMixedCurrency.Error()
+	}
+	return view, nil
+}
+
+// Checkout places an order for everything in the user's cart through OrderService.PlaceOrder and
+// empties the cart. Both happen in one transaction, so the cart is only cleared if the order is placed.
+//
+// The function returns ErrCartEmpty if the cart has no items. Errors from PlaceOrder, such as
+// *orders.InsufficientStockError, are returned unchanged.
+func (s *CartService) Checkout(userID uint) (*models.Order, error) {
+	var order *models.Order
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var items []models.CartItem
+		if err := tx.Where("user_id = ?", userID).Order("created_at, id").Find(&items).Error; err != nil {
+			return errors.New("failed to retrieve cart: " + err.Error())
+		}
+		if len(items) == 0 {
+			return ErrCartEmpty
+		}
+
+		lines := make([]orders.ProductOrder, len(items))
+		for i, item := range items {
+			lines[i] = orders.ProductOrder{ProductID: item.ProductID, VariantID: item.VariantID, Quantity: item.Quantity}
+		}
+
+		placed, err := orders.NewOrderService(tx).PlaceOrder(userID, lines)
+		if err != nil {
+			return err
+		}
+		order = placed
+
+		if err := tx.Where("user_id = ?", userID).Delete(&models.CartItem{}).Error; err != nil {
+			return errors.New("failed to clear cart: " + err.Error())
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return order, nil
+}
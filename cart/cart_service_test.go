@@ -0,0 +1,117 @@
+package cart
+
+import (
+	"regexp"
+	"testing"
+
+	"ecommerce-api/internal/testdb"
+	"ecommerce-api/orders"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func newMockCartService(t *testing.T) (*CartService, sqlmock.Sqlmock) {
+	gormDB, mock := testdb.New(t)
+	return NewCartService(gormDB), mock
+}
+
+func TestAddItemRejectsDeletedProduct(t *testing.T) {
+	service, mock := newMockCartService(t)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT "id" FROM "products" WHERE "products"."id" = $1 AND "products"."deleted_at" IS NULL ORDER BY "products"."id" LIMIT $2`)).
+		WithArgs(10, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	err := service.AddItem(7, AddCartItemDTO{ProductID: 10, Quantity: 1})
+
+	assert.ErrorIs(t, err, ErrProductNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetCartWarnings(t *testing.T) {
+	service, mock := newMockCartService(t)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "cart_items" WHERE user_id = $1 ORDER BY created_at, id`)).
+		WithArgs(7).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "product_id", "variant_id", "quantity"}).
+			AddRow(1, 7, 10, 100, 2).
+			AddRow(2, 7, 11, 110, 5).
+			AddRow(3, 7, 12, 120, 1).
+			AddRow(4, 7, 13, 130, 1))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "products" WHERE id IN ($1,$2,$3,$4)`)).
+		WithArgs(10, 11, 12, 13).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "price", "currency", "stock"}).
+			AddRow(10, "Mug", 1500, "USD", 10).
+			AddRow(11, "Cap", 1800, "USD", 3).
+			AddRow(12, "Pen", 300, "USD", 0))
+	// The cap's variant overrides the product's price.
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "product_variants" WHERE id IN ($1,$2,$3,$4)`)).
+		WithArgs(100, 110, 120, 130).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "product_id", "sku", "title", "price", "stock"}).
+			AddRow(100, 10, nil, "", nil, 10).
+			AddRow(110, 11, "CAP-L", "L", 2000, 3).
+			AddRow(120, 12, nil, "", nil, 0))
+
+	cart, err := service.GetCart(7)
+
+	assert.NoError(t, err)
+	if assert.Len(t, cart.Items, 4) {
+		assert.Empty(t, cart.Items[0].Warning)
+		assert.Equal(t, int64(3000), cart.Items[0].LineTotal)
+		assert.Equal(t, "only 3 left in stock", cart.Items[1].Warning)
+		assert.Equal(t, "CAP-L", cart.Items[1].SKU)
+		assert.Equal(t, int64(2000), cart.Items[1].UnitPrice)
+		assert.Equal(t, "product is out of stock", cart.Items[2].Warning)
+		assert.Equal(t, "product is no longer available", cart.Items[3].Warning)
+	}
+	assert.Equal(t, "USD", cart.Currency)
+	assert.Equal(t, int64(3000+10000+300), cart.Subtotal)
+	assert.Empty(t, cart.Warning)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	// A cart priced in several currencies cannot be checked out, so it has no subtotal.
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "cart_items" WHERE user_id = $1 ORDER BY created_at, id`)).
+		WithArgs(8).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "product_id", "variant_id", "quantity"}).
+			AddRow(5, 8, 10, 100, 1).
+			AddRow(6, 8, 14, 140, 1))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "products" WHERE id IN ($1,$2)`)).
+		WithArgs(10, 14).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "price", "currency", "stock"}).
+			AddRow(10, "Mug", 1500, "USD", 10).
+			AddRow(14, "Scarf", 2500, "EUR", 4))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "product_variants" WHERE id IN ($1,$2)`)).
+		WithArgs(100, 140).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "product_id", "sku", "title", "price", "stock"}).
+			AddRow(100, 10, nil, "", nil, 10).
+			AddRow(140, 14, nil, "", nil, 4))
+
+	cart, err = service.GetCart(8)
+
+	assert.NoError(t, err)
+	if assert.Len(t, cart.Items, 2) {
+		assert.Equal(t, "USD", cart.Items[0].Currency)
+		assert.Equal(t, "EUR", cart.Items[1].Currency)
+	}
+	assert.Empty(t, cart.Currency)
+	assert.Zero(t, cart.Subtotal)
+	assert.Equal(t, orders.ErrMixedCurrency.Error(), cart.Warning)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCheckoutEmptyCart(t *testing.T) {
+	service, mock := newMockCartService(t)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "cart_items" WHERE user_id = $1 ORDER BY created_at, id`)).
+		WithArgs(7).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "product_id", "quantity"}))
+	mock.ExpectRollback()
+
+	order, err := service.Checkout(7)
+
+	assert.Nil(t, order)
+	assert.ErrorIs(t, err, ErrCartEmpty)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
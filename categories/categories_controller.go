@@ -0,0 +1,236 @@
+package categories
+
+import (
+	"ecommerce-api/utils"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CategoryController handles HTTP requests for categories
+type CategoryController struct {
+	categoryService *CategoryService
+}
+
+// NewCategoryController initializes a new CategoryController
+func NewCategoryController(categoryService *CategoryService) *CategoryController {
+	return &CategoryController{categoryService: categoryService}
+}
+
+// ListCategories godoc
+// @Summary      List categories
+// @Description  Lists every category as a flat list, ordered by position and name. Use parent_id to rebuild the hierarchy, or GET /categories/tree.
+// @Tags         categories
+// @Produce      json
+// @Success      200  {object}  utils.APIResponse{data=[]models.Category}
+// @Failure      500  {object}  utils.APIResponse
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Router       /categories [get]
+func (c *CategoryController) ListCategories(ctx *gin.Context) {
+	categories, err := c.categoryService.ListCategories()
+	if err != nil {
+		utils.NewAPIResponse(http.StatusInternalServerError, "Failed to retrieve categories", nil, err.Error()).Send(ctx)
+		return
+	}
+
+	utils.NewAPIResponse(http.StatusOK, "Categories retrieved successfully", categories, "").Send(ctx)
+}
+
+// GetCategoryTree godoc
+// @Summary      Get the category tree
+// @Description  Returns the top-level categories with their subcategories nested under children. Each category counts the products
+// @Description  assigned to it directly (product_count) and the distinct products in it or any subcategory (total_product_count).
+// @Tags         categories
+// @Produce      json
+// @Success      200  {object}  utils.APIResponse{data=[]CategoryNode}
+// @Failure      500  {object}  utils.APIResponse
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Router       /categories/tree [get]
+func (c *CategoryController) GetCategoryTree(ctx *gin.Context) {
+	tree, err := c.categoryService.Tree()
+	if err != nil {
+		utils.NewAPIResponse(http.StatusInternalServerError, "Failed to retrieve categories", nil, err.Error()).Send(ctx)
+		return
+	}
+
+	utils.NewAPIResponse(http.StatusOK, "Categories retrieved successfully", tree, "").Send(ctx)
+}
+
+// GetCategory godoc
+// @Summary      Get a category
+// @Description  Retrieve a category by ID or slug
+// @Tags         categories
+// @Produce      json
+// @Param        id   path      string  true  "Category ID or slug"
+// @Success      200  {object}  utils.APIResponse{data=models.Category}
+// @Failure      404  {object}  utils.APIResponse
+// @Failure      500  {object}  utils.APIResponse
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Router       /categories/{id} [get]
+func (c *CategoryController) GetCategory(ctx *gin.Context) {
+	category, err := c.categoryService.GetCategory(ctx.Param("id"))
+	if err != nil {
+		sendCategoryError(ctx, "Failed to retrieve category", err)
+		return
+	}
+
+	utils.NewAPIResponse(http.StatusOK, "Category retrieved successfully", category, "").Send(ctx)
+}
+
+// CreateCategory godoc
+// @Summary      Create a category
+// @Description  Requires the products:write permission. Without a slug, one is derived from the name. Without a parent_id the category is at the top level.
+// @Tags         categories
+// @Accept       json
+// @Produce      json
+// @Param        category  body      CategoryDTO  true  "Category details"
+// @Success      201       {object}  utils.APIResponse{data=models.Category}
+// @Failure      400       {object}  utils.APIResponse
+// @Failure      409       {object}  utils.APIResponse
+// @Failure      500       {object}  utils.APIResponse
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Router       /categories [post]
+func (c *CategoryController) CreateCategory(ctx *gin.Context) {
+	var input CategoryDTO
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		utils.NewAPIResponse(http.StatusBadRequest, "Invalid input", nil, err.Error()).Send(ctx)
+		return
+	}
+
+	category, err := c.categoryService.CreateCategory(input)
+	if err != nil {
+		sendCategoryError(ctx, "Failed to create category", err)
+		return
+	}
+
+	utils.NewAPIResponse(http.StatusCreated, "Category created successfully", category, "").Send(ctx)
+}
+
+// UpdateCategory godoc
+// @Summary      Update a category
+// @Description  Requires the products:write permission. Replaces the category's fields; without a slug the current one is kept.
+// @Description  Changing parent_id moves the category with its subcategories, but not below itself.
+// @Tags         categories
+// @Accept       json
+// @Produce      json
+// @Param        id        path      int          true  "Category ID"
+// @Param        category  body      CategoryDTO  true  "Category details"
+// @Success      200       {object}  utils.APIResponse{data=models.Category}
+// @Failure      400       {object}  utils.APIResponse
+// @Failure      404       {object}  utils.APIResponse
+// @Failure      409       {object}  utils.APIResponse
+// @Failure      500       {object}  utils.APIResponse
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Router       /categories/{id} [put]
+func (c *CategoryController) UpdateCategory(ctx *gin.Context) {
+	id, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
+	if err != nil {
+		utils.NewAPIResponse(http.StatusBadRequest, "Invalid category ID", nil, err.Error()).Send(ctx)
+		return
+	}
+
+	var input CategoryDTO
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		utils.NewAPIResponse(http.StatusBadRequest, "Invalid input", nil, err.Error()).Send(ctx)
+		return
+	}
+
+	category, err := c.categoryService.UpdateCategory(uint(id), input)
+	if err != nil {
+		sendCategoryError(ctx, "Failed to update category", err)
+		return
+	}
+
+	utils.NewAPIResponse(http.StatusOK, "Category updated successfully", category, "").Send(ctx)
+}
+
+// DeleteCategory godoc
+// @Summary      Delete a category
+// @Description  Requires the products:write permission. Its products are removed from the category but not deleted.
+// @Description  A category with subcategories cannot be deleted.
+// @Tags         categories
+// @Produce      json
+// @Param        id   path      int  true  "Category ID"
+// @Success      200  {object}  utils.APIResponse
+// @Failure      400  {object}  utils.APIResponse
+// @Failure      404  {object}  utils.APIResponse
+// @Failure      409  {object}  utils.APIResponse
+// @Failure      500  {object}  utils.APIResponse
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Router       /categories/{id} [delete]
+func (c *CategoryController) DeleteCategory(ctx *gin.Context) {
+	id, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
+	if err != nil {
+		utils.NewAPIResponse(http.StatusBadRequest, "Invalid category ID", nil, err.Error()).Send(ctx)
+		return
+	}
+
+	if err := c.categoryService.DeleteCategory(uint(id)); err != nil {
+		sendCategoryError(ctx, "Failed to delete category", err)
+		return
+	}
+
+	utils.NewAPIResponse(http.StatusOK, "Category deleted successfully", nil, "").Send(ctx)
+}
+
+// SetProductCategories godoc
+// @Summary      Set a product's categories
+// @Description  Requires the products:write permission. Replaces the categories the product is in; an empty list removes it from all of them.
+// @Tags         categories
+// @Accept       json
+// @Produce      json
+// @Param        id          path      int                      true  "Product ID"
+// @Param        categories  body      SetProductCategoriesDTO  true  "Category IDs"
+// @Success      200         {object}  utils.APIResponse{data=[]models.Category}
+// @Failure      400         {object}  utils.APIResponse
+// @Failure      404         {object}  utils.APIResponse
+// @Failure      500         {object}  utils.APIResponse
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Router       /products/{id}/categories [put]
+func (c *CategoryController) SetProductCategories(ctx *gin.Context) {
+	productID, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
+	if err != nil {
+		utils.NewAPIResponse(http.StatusBadRequest, "Invalid product ID", nil, err.Error()).Send(ctx)
+		return
+	}
+
+	var input SetProductCategoriesDTO
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		utils.NewAPIResponse(http.StatusBadRequest, "Invalid input", nil, err.Error()).Send(ctx)
+		return
+	}
+
+	categories, err := c.categoryService.SetProductCategories(uint(productID), input.CategoryIDs)
+	if err != nil {
+		sendCategoryError(ctx, "Failed to update product categories", err)
+		return
+	}
+
+	utils.NewAPIResponse(http.StatusOK, "Product categories updated successfully", categories, "").Send(ctx)
+}
+
+// sendCategoryError responds with the status matching a CategoryService error, and a 500 with the
+// message for any other error.
+func sendCategoryError(ctx *gin.Context, message string, err error) {
+	switch {
+	case errors.Is(err, ErrCategoryNotFound):
+		utils.NewAPIResponse(http.StatusNotFound, "Category not found", nil, "").Send(ctx)
+	case errors.Is(err, ErrProductNotFound):
+		utils.NewAPIResponse(http.StatusNotFound, "Product not found", nil, "").Send(ctx)
+	case errors.Is(err, ErrParentNotFound), errors.Is(err, ErrInvalidSlug):
+		utils.NewAPIResponse(http.StatusBadRequest, "Invalid input", nil, err.Error()).Send(ctx)
+	case errors.Is(err, ErrSlugTaken), errors.Is(err, ErrCategoryCycle), errors.Is(err, ErrCategoryHasChildren):
+		utils.NewAPIResponse(http.StatusConflict, message, nil, err.Error()).Send(ctx)
+	default:
+		utils.NewAPIResponse(http.StatusInternalServerError, message, nil, err.Error()).Send(ctx)
+	}
+}
@@ -0,0 +1,28 @@
+package categories
+
+import "ecommerce-api/models"
+
+// CategoryDTO is the body of creating or replacing a category. Without a slug, creating a category
+// derives one from the name and replacing it keeps the current slug, so storefront URLs stay stable.
+// Without a parent the category is at the top level.
+type CategoryDTO struct {
+	Name        string `json:"name" binding:"required,max=100"`
+	Slug        string `json:"slug" binding:"omitempty,max=120"`
+	ParentID    *uint  `json:"parent_id"`
+	Description string `json:"description" binding:"max=2000"`
+	Position    int    `json:"position"`
+}
+
+// CategoryNode is a category in the category tree. ProductCount counts the products assigned to the
+// category itself, and TotalProductCount the distinct products in it or any of its descendants.
+type CategoryNode struct {
+	models.Category
+	ProductCount      int64           `json:"product_count"`
+	TotalProductCount int64           `json:"total_product_count"`
+	Children          []*CategoryNode `json:"children"`
+}
+
+// SetProductCategoriesDTO replaces the categories of a product. An empty list removes it from all of them.
+type SetProductCategoriesDTO struct {
+	CategoryIDs []uint `json:"category_ids" binding:"required,max=50"`
+}
@@ -0,0 +1,376 @@
+package categories
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"ecommerce-api/models"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrCategoryNotFound    = errors.New("category not found")
+	ErrParentNotFound      = errors.New("parent category not found")
+	ErrProductNotFound     = errors.New("product not found")
+	ErrSlugTaken           = errors.New("slug is already in use")
+	ErrInvalidSlug         = errors.New("slug may only contain lowercase letters, digits and single hyphens")
+	ErrCategoryCycle       = errors.New("a category cannot be moved below itself")
+	ErrCategoryHasChildren = errors.New("category has subcategories")
+)
+
+var (
+	slugPattern   = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+	nonSlugLetter = regexp.MustCompile(`[^a-z0-9]+`)
+)
+
+// categoryOrder orders siblings for navigation.
+const categoryOrder = "position, name, id"
+
+// ancestorsQuery selects a category and all of its ancestors. UNION rather than UNION ALL stops the
+// recursion even if the hierarchy somehow contains a cycle.
+const ancestorsQuery = `WITH RECURSIVE ancestors AS (
+	SELECT id, parent_id FROM categories WHERE id = ?
+	UNION
+	SELECT c.id, c.parent_id FROM categories c JOIN ancestors a ON c.id = a.parent_id
+) SELECT id FROM ancestors`
+
+// productCountsQuery counts, for every category, the products assigned to it directly and the distinct
+// products in its subtree.
+const productCountsQuery = `WITH RECURSIVE subtree AS (
+	SELECT id AS root_id, id FROM categories
+	UNION
+	SELECT s.root_id, c.id FROM categories c JOIN subtree s ON c.parent_id = s.id
+)
+SELECT s.root_id AS category_id,
+	COUNT(DISTINCT pc.product_id) FILTER (WHERE s.id = s.root_id) AS product_count,
+	COUNT(DISTINCT pc.product_id) AS total_product_count
+FROM subtree s
+JOIN product_categories pc ON pc.category_id = s.id
+JOIN products p ON p.id = pc.product_id AND p.deleted_at IS NULL
+GROUP BY s.root_id`
+
+// CategoryService manages the category hierarchy and the assignment of products to categories
+type CategoryService struct {
+	db *gorm.DB
+}
+
+// NewCategoryService initializes CategoryService with database connection
+func NewCategoryService(db *gorm.DB) *CategoryService {
+	return &CategoryService{db: db}
+}
+
+// ListCategories returns every category as a flat list, in navigation order.
+func (s *CategoryService) ListCategories() ([]models.Category, error) {
+	categories := []models.Category{}
+	if err := s.db.Order(categoryOrder).Find(&categories).Error; err != nil {
+		return nil, errors.New("failed to retrieve categories: " + err.Error())
+	}
+	return categories, nil
+}
+
+// GetCategory retrieves a category by its numeric ID or its slug.
+//
+// Returns:
+// - ErrCategoryNotFound if no category has the ID or slug.
+// - An error if the database query fails.
+func (s *CategoryService) GetCategory(idOrSlug string) (*models.Category, error) {
+	query := s.db.Where("slug = ?", idOrSlug)
+	if id, err := strconv.ParseUint(idOrSlug, 10, 32); err == nil {
+		query = s.db.Where("id = ?", id)
+	}
+
+	var category models.Category
+	if err := query.Take(&category).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrCategoryNotFound
+		}
+		return nil, errors.New("failed to retrieve category: " + err.Error())
+	}
+	return &category, nil
+}
+
+// Tree returns the category hierarchy with the product counts of each category. Top-level categories
+// and the children of each category are in navigation order.
+func (s *CategoryService) Tree() ([]*CategoryNode, error) {
+	categories, err := s.ListCategories()
+	if err != nil {
+		return nil, err
+	}
+
+	var counts []struct {
+		CategoryID        uint
+		ProductCount      int64
+		TotalProductCount int64
+	}
+	if err := s.db.Raw(productCountsQuery).Scan(&counts).Error; err != nil {
+		return nil, errors.New("failed to count products: " + err.Error())
+	}
+
+	nodes := make(map[uint]*CategoryNode, len(categories))
+	for _, category := range categories {
+		nodes[category.ID] = &CategoryNode{Category: category, Children: []*CategoryNode{}}
+	}
+	for _, count := range counts {
+		if node, ok := nodes[count.CategoryID]; ok {
+			node.ProductCount = count.ProductCount
+			node.TotalProductCount = count.TotalProductCount
+		}
+	}
+
+	roots := []*CategoryNode{}
+	for _, category := range categories {
+		node := nodes[category.ID]
+		if category.ParentID != nil {
+			if parent, ok := nodes[*category.ParentID]; ok {
+				parent.Children = append(parent.Children, node)
+				continue
+			}
+		}
+		roots = append(roots, node)
+	}
+	return roots, nil
+}
+
+// CreateCategory creates a category.
+//
+// Returns:
+// - The created category.
+// - ErrInvalidSlug if the slug is malformed, or no slug can be derived from the name.
+// - ErrSlugTaken if another category has the slug.
+// - ErrParentNotFound if the parent does not exist.
+// - An error if any database operation fails.
+func (s *CategoryService) CreateCategory(input CategoryDTO) (*models.Category, error) {
+	category := models.Category{
+		ParentID:    input.ParentID,
+		Name:        strings.TrimSpace(input.Name),
+		Slug:        input.Slug,
+		Description: input.Description,
+		Position:    input.Position,
+	}
+	if category.Slug == "" {
+		category.Slug = Slugify(category.Name)
+	}
+	if !slugPattern.MatchString(category.Slug) {
+		return nil, ErrInvalidSlug
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := checkSlugFree(tx, category.Slug, 0); err != nil {
+			return err
+		}
+		if category.ParentID != nil {
+			if _, err := ancestorIDs(tx, *category.ParentID); err != nil {
+				return err
+			}
+		}
+		if err := tx.Create(&category).Error; err != nil {
+			return errors.New("failed to create category: " + err.Error())
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &category, nil
+}
+
+// UpdateCategory replaces the fields of a category. Changing the parent moves the category along with
+// its subcategories.
+//
+// Returns:
+// - The updated category.
+// - ErrCategoryNotFound if the category does not exist.
+// - ErrInvalidSlug or ErrSlugTaken if a new slug is malformed or in use.
+// - ErrParentNotFound if the new parent does not exist.
+// - ErrCategoryCycle if the new parent is the category itself or one of its descendants.
+// - An error if any database operation fails.
+func (s *CategoryService) UpdateCategory(id uint, input CategoryDTO) (*models.Category, error) {
+	if input.Slug != "" && !slugPattern.MatchString(input.Slug) {
+		return nil, ErrInvalidSlug
+	}
+
+	var category models.Category
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Take(&category, id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrCategoryNotFound
+			}
+			return errors.New("failed to retrieve category: " + err.Error())
+		}
+
+		slug := category.Slug
+		if input.Slug != "" && input.Slug != slug {
+			if err := checkSlugFree(tx, input.Slug, id); err != nil {
+				return err
+			}
+			slug = input.Slug
+		}
+
+		if input.ParentID != nil && !sameParent(category.ParentID, input.ParentID) {
+			// Moves are serialised, so that two concurrent moves cannot together form a cycle.
+			if err := tx.Exec("LOCK TABLE categories IN SHARE ROW EXCLUSIVE MODE").Error; err != nil {
+				return errors.New("failed to lock categories: " + err.Error())
+			}
+			ancestors, err := ancestorIDs(tx, *input.ParentID)
+			if err != nil {
+				return err
+			}
+			for _, ancestor := range ancestors {
+				if ancestor == id {
+					return ErrCategoryCycle
+				}
+			}
+		}
+
+		if err := tx.Model(&category).Updates(map[string]interface{}{
+			"parent_id":   input.ParentID,
+			"name":        strings.TrimSpace(input.Name),
+			"slug":        slug,
+			"description": input.Description,
+			"position":    input.Position,
+		}).Error; err != nil {
+			return errors.New("failed to update category: " + err.Error())
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &category, nil
+}
+
+// DeleteCategory deletes a category and removes its products from it. The products themselves remain.
+//
+// Returns:
+// - ErrCategoryNotFound if the category does not exist.
+// - ErrCategoryHasChildren if it has subcategories, which must be moved or deleted first.
+// - An error if any database operation fails.
+func (s *CategoryService) DeleteCategory(id uint) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var children int64
+		if err := tx.Model(&models.Category{}).Where("parent_id = ?", id).Count(&children).Error; err != nil {
+			return errors.New("failed to count subcategories: " + err.Error())
+		}
+		if children > 0 {
+			return ErrCategoryHasChildren
+		}
+
+		if err := tx.Where("category_id = ?", id).Delete(&models.ProductCategory{}).Error; err != nil {
+			return errors.New("failed to remove products from category: " + err.Error())
+		}
+		result := tx.Delete(&models.Category{}, id)
+		if result.Error != nil {
+			return errors.New("failed to delete category: " + result.Error.Error())
+		}
+		if result.RowsAffected == 0 {
+			return ErrCategoryNotFound
+		}
+		return nil
+	})
+}
+
+// SetProductCategories replaces the categories a product is assigned to.
+//
+// Returns:
+// - The product's categories in navigation order.
+// - ErrProductNotFound if the product does not exist.
+// - ErrCategoryNotFound if any of the categories does not exist.
+// - An error if any database operation fails.
+func (s *CategoryService) SetProductCategories(productID uint, categoryIDs []uint) ([]models.Category, error) {
+	ids := uniqueIDs(categoryIDs)
+	categories := []models.Category{}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var product models.Product
+		if err := tx.Select("id").Take(&product, productID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrProductNotFound
+			}
+			return errors.New("failed to retrieve product: " + err.Error())
+		}
+
+		if len(ids) > 0 {
+			if err := tx.Where("id IN ?", ids).Order(categoryOrder).Find(&categories).Error; err != nil {
+				return errors.New("failed to retrieve categories: " + err.Error())
+			}
+			if len(categories) != len(ids) {
+				return ErrCategoryNotFound
+			}
+		}
+
+		if err := tx.Where("product_id = ?", productID).Delete(&models.ProductCategory{}).Error; err != nil {
+			return errors.New("failed to remove product categories: " + err.Error())
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+
+		assignments := make([]models.ProductCategory, len(ids))
+		for i, id := range ids {
+			assignments[i] = models.ProductCategory{ProductID: productID, CategoryID: id}
+		}
+		if err := tx.Create(&assignments).Error; err != nil {
+			return errors.New("failed to assign categories: " + err.Error())
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return categories, nil
+}
+
+// Slugify derives a slug from a name: ASCII letters and digits are kept in lower case, and every run of
+// other characters becomes a single hyphen. Names without ASCII letters or digits give an empty slug.
+func Slugify(name string) string {
+	return strings.Trim(nonSlugLetter.ReplaceAllString(strings.ToLower(name), "-"), "-")
+}
+
+// checkSlugFree returns ErrSlugTaken if a category other than exceptID has the slug.
+func checkSlugFree(tx *gorm.DB, slug string, exceptID uint) error {
+	var count int64
+	if err := tx.Model(&models.Category{}).Where("slug = ? AND id <> ?", slug, exceptID).Count(&count).Error; err != nil {
+		return errors.New("failed to check slug: " + err.Error())
+	}
+	if count > 0 {
+		return ErrSlugTaken
+	}
+	return nil
+}
+
+// ancestorIDs returns the IDs of the category and its ancestors, or ErrParentNotFound if the category
+// does not exist. It is used to validate a new parent.
+func ancestorIDs(tx *gorm.DB, categoryID uint) ([]uint, error) {
+	var ids []uint
+	if err := tx.Raw(ancestorsQuery, categoryID).Scan(&ids).Error; err != nil {
+		return nil, errors.New("failed to retrieve parent categories: " + err.Error())
+	}
+	if len(ids) == 0 {
+		return nil, ErrParentNotFound
+	}
+	return ids, nil
+}
+
+// sameParent reports whether two optional parent IDs are equal.
+func sameParent(a, b *uint) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// uniqueIDs returns the IDs without duplicates, in their original order.
+func uniqueIDs(ids []uint) []uint {
+	seen := make(map[uint]bool, len(ids))
+	unique := []uint{}
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
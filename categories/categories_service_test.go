@@ -0,0 +1,127 @@
+package categories
+
+import (
+	"regexp"
+	"testing"
+
+	"ecommerce-api/internal/testdb"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func newMockCategoryService(t *testing.T) (*CategoryService, sqlmock.Sqlmock) {
+	gormDB, mock := testdb.New(t)
+	return NewCategoryService(gormDB), mock
+}
+
+func TestSlugify(t *testing.T) {
+	tests := map[string]string{
+		"Kitchen":           "kitchen",
+		"  Home & Garden ":  "home-garden",
+		"Tea -- Coffee!":    "tea-coffee",
+		"USB-C Cables (2m)": "usb-c-cables-2m",
+		"Café":              "caf",
+		"日本":                "",
+	}
+	for name, slug := range tests {
+		assert.Equal(t, slug, Slugify(name), name)
+	}
+}
+
+func TestCreateCategoryRejectsInvalidSlug(t *testing.T) {
+	service, mock := newMockCategoryService(t)
+
+	_, err := service.CreateCategory(CategoryDTO{Name: "Kitchen", Slug: "Kitchen_Stuff"})
+	assert.ErrorIs(t, err, ErrInvalidSlug)
+
+	// Without any ASCII letters or digits no slug can be derived from the name.
+	_, err = service.CreateCategory(CategoryDTO{Name: "日本"})
+	assert.ErrorIs(t, err, ErrInvalidSlug)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestUpdateCategoryRejectsCycle moves a category below its own grandchild.
+func TestUpdateCategoryRejectsCycle(t *testing.T) {
+	service, mock := newMockCategoryService(t)
+	grandchild := uint(3)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "categories" WHERE "categories"."id" = $1 LIMIT $2`)).
+		WithArgs(1, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "parent_id", "name", "slug"}).AddRow(1, nil, "Home", "home"))
+	mock.ExpectExec(regexp.QuoteMeta(`LOCK TABLE categories IN SHARE ROW EXCLUSIVE MODE`)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`WITH RECURSIVE ancestors AS`).
+		WithArgs(3).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3).AddRow(2).AddRow(1))
+	mock.ExpectRollback()
+
+	_, err := service.UpdateCategory(1, CategoryDTO{Name: "Home", ParentID: &grandchild})
+
+	assert.ErrorIs(t, err, ErrCategoryCycle)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpdateCategoryRejectsMissingParent(t *testing.T) {
+	service, mock := newMockCategoryService(t)
+	parent := uint(9)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "categories" WHERE "categories"."id" = $1 LIMIT $2`)).
+		WithArgs(1, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "parent_id", "name", "slug"}).AddRow(1, nil, "Home", "home"))
+	mock.ExpectExec(regexp.QuoteMeta(`LOCK TABLE categories IN SHARE ROW EXCLUSIVE MODE`)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`WITH RECURSIVE ancestors AS`).
+		WithArgs(9).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectRollback()
+
+	_, err := service.UpdateCategory(1, CategoryDTO{Name: "Home", ParentID: &parent})
+
+	assert.ErrorIs(t, err, ErrParentNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestTree builds the tree Home > Kitchen > Mugs, Home > Garden and Sale. Subcategories are nested in
+// the order they were listed and carry their own counts.
+func TestTree(t *testing.T) {
+	service, mock := newMockCategoryService(t)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "categories" ORDER BY position, name, id`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "parent_id", "name", "slug", "position"}).
+			AddRow(1, nil, "Home", "home", 0).
+			AddRow(4, 1, "Garden", "garden", 0).
+			AddRow(2, 1, "Kitchen", "kitchen", 1).
+			AddRow(3, 2, "Mugs", "mugs", 0).
+			AddRow(5, nil, "Sale", "sale", 1))
+	mock.ExpectQuery(`WITH RECURSIVE subtree AS`).
+		WillReturnRows(sqlmock.NewRows([]string{"category_id", "product_count", "total_product_count"}).
+			AddRow(1, 0, 6).
+			AddRow(2, 2, 5).
+			AddRow(3, 4, 4).
+			AddRow(4, 1, 1))
+
+	tree, err := service.Tree()
+
+	if assert.NoError(t, err) && assert.Len(t, tree, 2) {
+		home, sale := tree[0], tree[1]
+		assert.Equal(t, "home", home.Slug)
+		assert.Equal(t, int64(6), home.TotalProductCount)
+		if assert.Len(t, home.Children, 2) {
+			assert.Equal(t, "garden", home.Children[0].Slug)
+			kitchen := home.Children[1]
+			assert.Equal(t, int64(2), kitchen.ProductCount)
+			assert.Equal(t, int64(5), kitchen.TotalProductCount)
+			if assert.Len(t, kitchen.Children, 1) {
+				assert.Equal(t, int64(4), kitchen.Children[0].ProductCount)
+			}
+		}
+		assert.Equal(t, "sale", sale.Slug)
+		assert.Zero(t, sale.TotalProductCount)
+		assert.Empty(t, sale.Children)
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -1,7 +1,11 @@
 package config
 
 import (
+	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -9,8 +13,87 @@ import (
 type AppConfig struct {
 	DB_CONNECTION_STRING string
 	JWT_SECRET           string
-	PORT                 string
-	SWAGGER_SERVER_URL   string
+	// JWT_PRIVATE_KEY_FILE is a PEM file with the RSA or Ed25519 key that signs access tokens. When
+	// it is set, JWT_SECRET is not used. JWT_PUBLIC_KEY_FILES lists PEM files, separated by commas,
+	// of earlier keys whose tokens are still accepted after a rotation.
+	JWT_PRIVATE_KEY_FILE string
+	JWT_PUBLIC_KEY_FILES string
+	// JWT_ISSUER and JWT_AUDIENCE are written to and required in the iss and aud claims of access tokens.
+	JWT_ISSUER         string
+	JWT_AUDIENCE       string
+	PORT               string
+	// TRUSTED_PROXIES lists the IPs and CIDR ranges of the reverse proxies in front of the API, separated
+	// by commas. The client IP used for login throttling and the audit log is only read from
+	// X-Forwarded-For when the request comes from one of them; by default no proxy is trusted.
+	TRUSTED_PROXIES []string
+	SWAGGER_SERVER_URL string
+	ACCESS_TOKEN_TTL   time.Duration
+	// ACCESS_TOKEN_CHECK_INTERVAL is how long an access token that passed the revocation check is
+	// trusted before the database is consulted again.
+	ACCESS_TOKEN_CHECK_INTERVAL time.Duration
+	REFRESH_TOKEN_TTL           time.Duration
+	// BOOTSTRAP_SUPER_ADMIN_EMAIL names a registered, verified user to promote to super admin on start-up
+	// while no super admin exists.
+	BOOTSTRAP_SUPER_ADMIN_EMAIL string
+	// APP_URL is the storefront's base URL, used to build links in emails.
+	APP_URL string
+	// API_URL is the public base URL of this API, used to build the email verification link.
+	API_URL                string
+	PASSWORD_RESET_TTL     time.Duration
+	EMAIL_VERIFICATION_TTL time.Duration
+	// REQUIRE_VERIFIED_EMAIL blocks orders from users who have not verified their email.
+	REQUIRE_VERIFIED_EMAIL bool
+	MFA_ISSUER             string
+	// MFA_REQUIRED_FOR_ADMINS makes every staff permission require an access token from a login
+	// that passed a TOTP code.
+	MFA_REQUIRED_FOR_ADMINS bool
+	// LOGIN_MAX_ATTEMPTS is the number of consecutive failed logins after which an account is locked
+	// out for LOGIN_LOCKOUT_DURATION. LOGIN_IP_MAX_ATTEMPTS is the same limit for a client IP.
+	LOGIN_MAX_ATTEMPTS     int
+	LOGIN_IP_MAX_ATTEMPTS  int
+	LOGIN_LOCKOUT_DURATION time.Duration
+	// MAIL_DRIVER selects how email is delivered: "smtp", "file" or "log" (the default).
+	MAIL_DRIVER   string
+	MAIL_FROM     string
+	MAIL_DIR      string
+	SMTP_HOST     string
+	SMTP_PORT     string
+	SMTP_USERNAME string
+	SMTP_PASSWORD string
+	// OIDC_PROVIDERS lists the OpenID Connect providers users can sign in with, named in OIDC_PROVIDERS
+	// separated by commas, e.g. "google,okta". Each is configured with OIDC_<NAME>_ISSUER,
+	// OIDC_<NAME>_CLIENT_ID and OIDC_<NAME>_CLIENT_SECRET, and optionally OIDC_<NAME>_REDIRECT_URL and
+	// OIDC_<NAME>_SCOPES.
+	OIDC_PROVIDERS []OIDCProvider
+	// STORAGE_DRIVER selects where uploaded files are kept: "s3" or "local" (the default), which
+	// writes them to STORAGE_DIR. STORAGE_PUBLIC_URL is the base URL files are linked under; it
+	// defaults to API_URL + "/uploads" for local storage and to the bucket's URL for S3.
+	STORAGE_DRIVER     string
+	STORAGE_DIR        string
+	STORAGE_PUBLIC_URL string
+	// S3_ENDPOINT points at an S3-compatible object store such as MinIO; it defaults to AWS S3.
+	// S3_PATH_STYLE addresses the bucket in the path rather than the host name, as MinIO expects.
+	S3_ENDPOINT          string
+	S3_REGION            string
+	S3_BUCKET            string
+	S3_ACCESS_KEY_ID     string
+	S3_SECRET_ACCESS_KEY string
+	S3_PATH_STYLE        bool
+	// IMAGE_MAX_SIZE is the largest product image upload accepted, in bytes.
+	IMAGE_MAX_SIZE int
+}
+
+// OIDCProvider is the registration of this API with an OpenID Connect provider.
+type OIDCProvider struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is the storefront page the provider sends the user back to, which completes the
+	// login with the API. It defaults to APP_URL + "/auth/oidc/<name>/callback".
+	RedirectURL string
+	// Scopes are requested besides "openid". They default to "email profile".
+	Scopes []string
 }
 
 var CONFIG *AppConfig
@@ -18,11 +101,126 @@ var CONFIG *AppConfig
 func Config() *AppConfig {
 	godotenv.Load()
 	appConfig := &AppConfig{
-		DB_CONNECTION_STRING: os.Getenv("DB_CONNECTION_STRING"),
-		JWT_SECRET:           os.Getenv("JWT_SECRET"),
-		PORT:                 os.Getenv("PORT"),
-		SWAGGER_SERVER_URL:   os.Getenv("SWAGGER_SERVER_URL"),
+		DB_CONNECTION_STRING:        os.Getenv("DB_CONNECTION_STRING"),
+		JWT_SECRET:                  os.Getenv("JWT_SECRET"),
+		JWT_PRIVATE_KEY_FILE:        os.Getenv("JWT_PRIVATE_KEY_FILE"),
+		JWT_PUBLIC_KEY_FILES:        os.Getenv("JWT_PUBLIC_KEY_FILES"),
+		JWT_ISSUER:                  getEnv("JWT_ISSUER", getEnv("API_URL", "http://localhost"+os.Getenv("PORT"))),
+		JWT_AUDIENCE:                getEnv("JWT_AUDIENCE", "ecommerce-api"),
+		PORT:                        os.Getenv("PORT"),
+		TRUSTED_PROXIES:             getEnvList("TRUSTED_PROXIES"),
+		SWAGGER_SERVER_URL:          os.Getenv("SWAGGER_SERVER_URL"),
+		ACCESS_TOKEN_TTL:            getEnvDuration("ACCESS_TOKEN_TTL", 15*time.Minute),
+		ACCESS_TOKEN_CHECK_INTERVAL: getEnvDuration("ACCESS_TOKEN_CHECK_INTERVAL", 30*time.Second),
+		REFRESH_TOKEN_TTL:           getEnvDuration("REFRESH_TOKEN_TTL", 30*24*time.Hour),
+		BOOTSTRAP_SUPER_ADMIN_EMAIL: os.Getenv("BOOTSTRAP_SUPER_ADMIN_EMAIL"),
+		APP_URL:                     os.Getenv("APP_URL"),
+		API_URL:                     getEnv("API_URL", "http://localhost"+os.Getenv("PORT")),
+		PASSWORD_RESET_TTL:          getEnvDuration("PASSWORD_RESET_TTL", time.Hour),
+		EMAIL_VERIFICATION_TTL:      getEnvDuration("EMAIL_VERIFICATION_TTL", 48*time.Hour),
+		REQUIRE_VERIFIED_EMAIL:      getEnvBool("REQUIRE_VERIFIED_EMAIL", false),
+		MFA_ISSUER:                  getEnv("MFA_ISSUER", "ecommerce-api"),
+		MFA_REQUIRED_FOR_ADMINS:     getEnvBool("MFA_REQUIRED_FOR_ADMINS", false),
+		LOGIN_MAX_ATTEMPTS:          getEnvInt("LOGIN_MAX_ATTEMPTS", 10),
+		LOGIN_IP_MAX_ATTEMPTS:       getEnvInt("LOGIN_IP_MAX_ATTEMPTS", 100),
+		LOGIN_LOCKOUT_DURATION:      getEnvDuration("LOGIN_LOCKOUT_DURATION", 15*time.Minute),
+		MAIL_DRIVER:                 os.Getenv("MAIL_DRIVER"),
+		MAIL_FROM:                   getEnv("MAIL_FROM", "no-reply@localhost"),
+		MAIL_DIR:                    getEnv("MAIL_DIR", "mail"),
+		SMTP_HOST:                   os.Getenv("SMTP_HOST"),
+		SMTP_PORT:                   getEnv("SMTP_PORT", "587"),
+		SMTP_USERNAME:               os.Getenv("SMTP_USERNAME"),
+		SMTP_PASSWORD:               os.Getenv("SMTP_PASSWORD"),
+		STORAGE_DRIVER:              os.Getenv("STORAGE_DRIVER"),
+		STORAGE_DIR:                 getEnv("STORAGE_DIR", "uploads"),
+		STORAGE_PUBLIC_URL:          os.Getenv("STORAGE_PUBLIC_URL"),
+		S3_ENDPOINT:                 os.Getenv("S3_ENDPOINT"),
+		S3_REGION:                   getEnv("S3_REGION", "us-east-1"),
+		S3_BUCKET:                   os.Getenv("S3_BUCKET"),
+		S3_ACCESS_KEY_ID:            os.Getenv("S3_ACCESS_KEY_ID"),
+		S3_SECRET_ACCESS_KEY:        os.Getenv("S3_SECRET_ACCESS_KEY"),
+		S3_PATH_STYLE:               getEnvBool("S3_PATH_STYLE", false),
+		IMAGE_MAX_SIZE:              getEnvInt("IMAGE_MAX_SIZE", 5<<20),
 	}
+	appConfig.OIDC_PROVIDERS = getOIDCProviders(appConfig.APP_URL)
 	CONFIG = appConfig
 	return appConfig
 }
+
+// getEnv reads a variable from the environment, falling back to defaultValue when it is unset.
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+// getEnvList reads a comma-separated list from the environment, dropping empty entries. It returns
+// nil when the variable is unset.
+func getEnvList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// getEnvBool reads a boolean such as "true" or "1" from the environment, falling back to
+// defaultValue when the variable is unset or malformed.
+func getEnvBool(key string, defaultValue bool) bool {
+	value, err := strconv.ParseBool(os.Getenv(key))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+// getEnvInt reads a positive integer from the environment, falling back to defaultValue when the
+// variable is unset or malformed.
+func getEnvInt(key string, defaultValue int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil || value <= 0 {
+		return defaultValue
+	}
+	return value
+}
+
+// getEnvDuration reads a duration such as "15m" from the environment, falling back to
+// defaultValue when the variable is unset or malformed.
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	value, err := time.ParseDuration(os.Getenv(key))
+	if err != nil || value <= 0 {
+		return defaultValue
+	}
+	return value
+}
+
+// getOIDCProviders reads the providers named in OIDC_PROVIDERS. Providers without an issuer or
+// client ID are skipped.
+func getOIDCProviders(appURL string) []OIDCProvider {
+	var providers []OIDCProvider
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		provider := OIDCProvider{
+			Name:         name,
+			Issuer:       os.Getenv(prefix + "ISSUER"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:  getEnv(prefix+"REDIRECT_URL", strings.TrimSuffix(appURL, "/")+"/auth/oidc/"+name+"/callback"),
+			Scopes:       strings.Fields(getEnv(prefix+"SCOPES", "email profile")),
+		}
+		if provider.Issuer == "" || provider.ClientID == "" {
+			log.Printf("OIDC provider %q is missing %sISSUER or %sCLIENT_ID and is disabled", name, prefix, prefix)
+			continue
+		}
+		providers = append(providers, provider)
+	}
+	return providers
+}
@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"testing"
+	"time"
 
 	"github.com/joho/godotenv"
 	"github.com/stretchr/testify/assert"
@@ -13,6 +14,7 @@ func setTestEnvVariables() {
 	_ = os.Setenv("JWT_SECRET", "test_jwt_secret")
 	_ = os.Setenv("PORT", "8080")
 	_ = os.Setenv("SWAGGER_SERVER_URL", "http://localhost:8080")
+	_ = os.Setenv("ACCESS_TOKEN_TTL", "5m")
 }
 
 func clearTestEnvVariables() {
@@ -20,6 +22,7 @@ func clearTestEnvVariables() {
 	_ = os.Unsetenv("JWT_SECRET")
 	_ = os.Unsetenv("PORT")
 	_ = os.Unsetenv("SWAGGER_SERVER_URL")
+	_ = os.Unsetenv("ACCESS_TOKEN_TTL")
 }
 
 func TestConfig(t *testing.T) {
@@ -36,6 +39,36 @@ func TestConfig(t *testing.T) {
 	assert.Equal(t, "test_jwt_secret", appConfig.JWT_SECRET)
 	assert.Equal(t, "8080", appConfig.PORT)
 	assert.Equal(t, "http://localhost:8080", appConfig.SWAGGER_SERVER_URL)
+	assert.Equal(t, 5*time.Minute, appConfig.ACCESS_TOKEN_TTL)
+	assert.Equal(t, 30*24*time.Hour, appConfig.REFRESH_TOKEN_TTL)
+	assert.Nil(t, appConfig.TRUSTED_PROXIES)
 
 	assert.Equal(t, CONFIG, appConfig)
 }
+
+func TestTrustedProxies(t *testing.T) {
+	t.Setenv("TRUSTED_PROXIES", "10.0.0.0/8, 192.168.1.10,")
+
+	assert.Equal(t, []string{"10.0.0.0/8", "192.168.1.10"}, Config().TRUSTED_PROXIES)
+}
+
+func TestOIDCProviders(t *testing.T) {
+	t.Setenv("APP_URL", "https://shop.example.com/")
+	t.Setenv("OIDC_PROVIDERS", "Google, okta")
+	t.Setenv("OIDC_GOOGLE_ISSUER", "https://accounts.google.com")
+	t.Setenv("OIDC_GOOGLE_CLIENT_ID", "shop")
+	t.Setenv("OIDC_GOOGLE_CLIENT_SECRET", "s3cret")
+	// okta has no issuer and is skipped.
+	t.Setenv("OIDC_OKTA_CLIENT_ID", "shop")
+
+	appConfig := Config()
+
+	assert.Equal(t, []OIDCProvider{{
+		Name:         "google",
+		Issuer:       "https://accounts.google.com",
+		ClientID:     "shop",
+		ClientSecret: "s3cret",
+		RedirectURL:  "https://shop.example.com/auth/oidc/google/callback",
+		Scopes:       []string{"email", "profile"},
+	}}, appConfig.OIDC_PROVIDERS)
+}
@@ -0,0 +1,33 @@
+// Package testdb opens gorm databases backed by sqlmock for unit tests.
+package testdb
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// New returns a gorm database using the Postgres dialect on top of sqlmock, with logging silenced,
+// and the mock to set expectations on. The database is closed when the test ends.
+func New(t *testing.T) (*gorm.DB, sqlmock.Sqlmock) {
+	t.Helper()
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open sqlmock database: %s", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	gormDB, err := gorm.Open(postgres.New(postgres.Config{
+		Conn: db,
+	}), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("failed to initialize gorm with sqlmock: %s", err)
+	}
+	return gormDB, mock
+}
@@ -0,0 +1,123 @@
+package mailer
+
+import (
+	"ecommerce-api/config"
+	"fmt"
+	"io"
+	"log"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message is a plain-text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers email. Implementations must be safe for concurrent use.
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// New returns the Mailer selected by MAIL_DRIVER: "smtp", "file" or "log". Anything else, including an
+// empty value, falls back to logging messages, so a development setup needs no mail server.
+func New(appConfig *config.AppConfig) Mailer {
+	switch appConfig.MAIL_DRIVER {
+	case "smtp":
+		return NewSMTPMailer(appConfig.SMTP_HOST, appConfig.SMTP_PORT, appConfig.SMTP_USERNAME, appConfig.SMTP_PASSWORD, appConfig.MAIL_FROM)
+	case "file":
+		return NewFileMailer(appConfig.MAIL_DIR, appConfig.MAIL_FROM)
+	default:
+		return NewLogMailer(os.Stdout, appConfig.MAIL_FROM)
+	}
+}
+
+// SMTPMailer sends messages through an SMTP server, authenticating with PLAIN auth when a username is set.
+type SMTPMailer struct {
+	addr string
+	auth smtp.Auth
+	from string
+}
+
+// NewSMTPMailer creates an SMTPMailer for the server at host:port.
+func NewSMTPMailer(host, port, username, password, from string) *SMTPMailer {
+	var auth smtp.Auth
+	if username != "" {
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+	return &SMTPMailer{addr: host + ":" + port, auth: auth, from: from}
+}
+
+func (m *SMTPMailer) Send(msg Message) error {
+	if err := smtp.SendMail(m.addr, m.auth, m.from, []string{msg.To}, format(m.from, msg)); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	return nil
+}
+
+// LogMailer writes messages to a writer instead of delivering them.
+type LogMailer struct {
+	logger *log.Logger
+	from   string
+}
+
+// NewLogMailer creates a LogMailer that writes to w.
+func NewLogMailer(w io.Writer, from string) *LogMailer {
+	return &LogMailer{logger: log.New(w, "[mailer] ", log.LstdFlags), from: from}
+}
+
+func (m *LogMailer) Send(msg Message) error {
+	m.logger.Printf("email not delivered, MAIL_DRIVER is not set:\n%s", format(m.from, msg))
+	return nil
+}
+
+// FileMailer writes every message to its own .eml file in a directory, where tests and developers can read it.
+type FileMailer struct {
+	dir  string
+	from string
+	mu   sync.Mutex
+	seq  int
+}
+
+// NewFileMailer creates a FileMailer that writes into dir, creating it if needed.
+func NewFileMailer(dir, from string) *FileMailer {
+	return &FileMailer{dir: dir, from: from}
+}
+
+func (m *FileMailer) Send(msg Message) error {
+	m.mu.Lock()
+	m.seq++
+	name := fmt.Sprintf("%s-%03d.eml", time.Now().UTC().Format("20060102T150405.000000000"), m.seq)
+	m.mu.Unlock()
+
+	if err := os.MkdirAll(m.dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create mail directory: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(m.dir, name), format(m.from, msg), 0o600); err != nil {
+		return fmt.Errorf("failed to write email: %w", err)
+	}
+	return nil
+}
+
+// format renders msg as an RFC 5322 message. Header values are stripped of line breaks so that user
+// input cannot inject extra headers.
+func format(from string, msg Message) []byte {
+	clean := strings.NewReplacer("\r", "", "\n", "")
+
+	var b strings.Builder
+	b.WriteString("From: " + clean.Replace(from) + "\r\n")
+	b.WriteString("To: " + clean.Replace(msg.To) + "\r\n")
+	b.WriteString("Subject: " + clean.Replace(msg.Subject) + "\r\n")
+	b.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return []byte(b.String())
+}
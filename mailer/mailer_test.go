@@ -0,0 +1,40 @@
+package mailer
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileMailer(t *testing.T) {
+	dir := t.TempDir()
+	mailer := NewFileMailer(dir, "shop@example.com")
+
+	assert.NoError(t, mailer.Send(Message{To: "a@example.com", Subject: "Hello", Body: "line one\nline two"}))
+	assert.NoError(t, mailer.Send(Message{To: "b@example.com", Subject: "Again", Body: "second"}))
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	assert.NoError(t, err)
+	if assert.Len(t, files, 2) {
+		content, _ := os.ReadFile(files[0])
+		assert.Contains(t, string(content), "To: a@example.com\r\n")
+		assert.Contains(t, string(content), "Subject: Hello\r\n")
+		assert.Contains(t, string(content), "\r\n\r\nline one\r\nline two")
+	}
+}
+
+func TestFormatStripsHeaderInjection(t *testing.T) {
+	message := string(format("shop@example.com", Message{To: "a@example.com\r\nBcc: evil@example.com", Subject: "Hi"}))
+
+	assert.Contains(t, message, "To: a@example.comBcc: evil@example.com\r\n")
+	assert.NotContains(t, message, "\r\nBcc:")
+}
+
+func TestLogMailer(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NoError(t, NewLogMailer(&buf, "shop@example.com").Send(Message{To: "a@example.com", Subject: "Hi", Body: "body"}))
+	assert.Contains(t, buf.String(), "Subject: Hi")
+}
@@ -5,6 +5,8 @@ import (
 	"ecommerce-api/config"
 	"ecommerce-api/database"
 	"ecommerce-api/models"
+	"ecommerce-api/products"
+	"ecommerce-api/roles"
 	"ecommerce-api/routes"
 	"ecommerce-api/docs"
 	"log"
@@ -18,6 +20,7 @@ import (
 	"github.com/go-playground/validator/v10"
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
+	"gorm.io/gorm"
 )
 
 type Server struct {
@@ -35,6 +38,16 @@ func NewServer() (*Server, error) {
 		})
 
 		v.RegisterValidation("password", models.PasswordValidation)
+
+		v.RegisterValidation("role", func(fl validator.FieldLevel) bool {
+			role, ok := fl.Field().Interface().(models.Role)
+			return ok && role.IsValid() == nil
+		})
+
+		v.RegisterValidation("apiKeyScope", func(fl validator.FieldLevel) bool {
+			scope, ok := fl.Field().Interface().(models.APIKeyScope)
+			return ok && scope.IsValid() == nil
+		})
 	}
 
 	err := database.Connect()
@@ -59,6 +72,12 @@ func (server *Server) setupRouter() {
 	router.Use(gin.Logger())
 	router.Use(gin.Recovery())
 
+	// Only proxies we run may set X-Forwarded-For, or clients could pick the IP that logins are
+	// throttled and audited by.
+	if err := router.SetTrustedProxies(appConfig.TRUSTED_PROXIES); err != nil {
+		log.Fatal("Invalid TRUSTED_PROXIES:", err)
+	}
+
 	docs.SwaggerInfo.BasePath = "/api/v1"
     docs.SwaggerInfo.Host = appConfig.SWAGGER_SERVER_URL
 
@@ -66,18 +85,37 @@ func (server *Server) setupRouter() {
 	url := ginSwagger.URL( "http://" + appConfig.SWAGGER_SERVER_URL + "/swagger/doc.json")
     router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler, url))
 
+	routes.WellKnownSetUpRoute(&router.RouterGroup)
+
+	// Uploaded files kept on the local filesystem are served by the API itself.
+	if appConfig.STORAGE_DRIVER != "s3" {
+		router.Static("/uploads", appConfig.STORAGE_DIR)
+	}
+
 	// API routes
 	apiGroup := router.Group("/api/v1/")
 	apiGroup.GET("/", func(c *gin.Context) {
 		c.JSON(200, gin.H{"message": "Connected!"})
 	})
 
-	routes.AuthSetUpRoute(apiGroup, appConfig.JWT_SECRET, database.Database)
+	routes.AuthSetUpRoute(apiGroup, database.Database)
 
 	routes.ProductSetUpRoute(apiGroup, database.Database)
 
 	routes.OrderSetUpRoute(apiGroup, database.Database)
 
+	routes.CartSetUpRoute(apiGroup, database.Database)
+
+	routes.RoleSetUpRoute(apiGroup, database.Database)
+
+	routes.UserSetUpRoute(apiGroup, database.Database)
+
+	routes.APIKeySetUpRoute(apiGroup, database.Database)
+
+	routes.AdminUserSetUpRoute(apiGroup, database.Database)
+
+	routes.CategorySetUpRoute(apiGroup, database.Database)
+
 	server.router = router
 }
 
@@ -111,10 +149,115 @@ func (server *Server) Start(address string) error {
 
 func migrations() {
 	db := database.Database
-	err := db.AutoMigrate(&models.User{}, &models.Product{}, &models.Order{}, &models.OrderProduct{})
+
+	// Accounts created before email verification existed are treated as verified, so the
+	// REQUIRE_VERIFIED_EMAIL policy does not lock out existing customers.
+	verifyExistingUsers := db.Migrator().HasTable(&models.User{}) && !db.Migrator().HasColumn(&models.User{}, "verified_at")
+
+	// Products and categories are joined through ProductCategory, which carries the join table's indexes.
+	if err := db.SetupJoinTable(&models.Product{}, "Categories", &models.ProductCategory{}); err != nil {
+		panic("failed to set up product categories: " + err.Error())
+	}
+
+	err := db.AutoMigrate(&models.User{}, &models.Product{}, &models.Order{}, &models.OrderProduct{}, &models.OrderStatusEvent{}, &models.CartItem{}, &models.RefreshToken{}, &models.RevokedToken{}, &models.UserRole{}, &models.UserToken{}, &models.MFAFactor{}, &models.MFARecoveryCode{}, &models.AuditLog{}, &models.APIKey{}, &models.UserIdentity{}, &models.OIDCLoginState{}, &models.Category{}, &models.ProductCategory{}, &models.ProductOption{}, &models.ProductVariant{}, &models.ProductImage{}, &models.ImportJob{})
 	if err != nil {
 		panic("failed to auto migrate database: " + err.Error())
 	}
+
+	if err := products.MigrateSearch(db); err != nil {
+		panic("failed to migrate product search: " + err.Error())
+	}
+
+	if err := products.FailInterruptedImports(db); err != nil {
+		panic("failed to mark interrupted imports as failed: " + err.Error())
+	}
+
+	if err := backfillOrderSnapshots(db); err != nil {
+		panic("failed to backfill order snapshots: " + err.Error())
+	}
+
+	if err := backfillProductVariants(db); err != nil {
+		panic("failed to backfill product variants: " + err.Error())
+	}
+
+	// Cart items are unique per variant now, so a cart can hold several variants of a product.
+	if db.Migrator().HasIndex(&models.CartItem{}, "idx_cart_items_user_product") {
+		if err := db.Migrator().DropIndex(&models.CartItem{}, "idx_cart_items_user_product"); err != nil {
+			panic("failed to drop cart item index: " + err.Error())
+		}
+	}
+
+	if verifyExistingUsers {
+		if err := db.Exec(`UPDATE users SET verified_at = created_at WHERE verified_at IS NULL`).Error; err != nil {
+			panic("failed to mark existing users as verified: " + err.Error())
+		}
+	}
+
+	if err := roles.MigrateAdminFlag(db); err != nil {
+		panic("failed to migrate admin users to roles: " + err.Error())
+	}
+
+	if email := config.CONFIG.BOOTSTRAP_SUPER_ADMIN_EMAIL; email != "" {
+		granted, err := roles.Bootstrap(db, email)
+		if err != nil {
+			// The user may simply not have registered or verified their email yet, so the server still starts.
+			log.Printf("failed to bootstrap super admin %s: %v", email, err)
+		} else if granted {
+			log.Printf("granted the super_admin role to %s", email)
+		}
+	}
+}
+
+// backfillOrderSnapshots fills the price snapshot columns of orders placed before line items
+// captured them, using the product data as it is at migration time. Rows that already carry a
+// snapshot are left untouched, so it is safe to run on every start.
+func backfillOrderSnapshots(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(`UPDATE order_products
+			SET product_name = products.name,
+				unit_price = products.price,
+				currency = products.currency,
+				line_total = order_products.quantity * products.price
+			FROM products
+			WHERE products.id = order_products.product_id AND order_products.product_name IS NULL`).Error; err != nil {
+			return err
+		}
+
+		return tx.Exec(`UPDATE orders
+			SET subtotal = totals.subtotal, total = totals.subtotal, currency = totals.currency
+			FROM (
+				SELECT order_id, SUM(line_total) AS subtotal, MAX(currency) AS currency
+				FROM order_products
+				GROUP BY order_id
+			) AS totals
+			WHERE totals.order_id = orders.id AND orders.currency IS NULL`).Error
+	})
+}
+
+// backfillProductVariants gives every product without variants a single variant holding its stock, and
+// points the order lines and cart items created before variants existed at it. Only rows without a
+// variant are touched, so it is safe to run on every start.
+func backfillProductVariants(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(`INSERT INTO product_variants (product_id, options, stock, position, created_at, updated_at)
+			SELECT id, '{}', stock, 0, created_at, updated_at
+			FROM products
+			WHERE NOT EXISTS (SELECT 1 FROM product_variants WHERE product_variants.product_id = products.id)`).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Exec(`UPDATE order_products
+			SET variant_id = product_variants.id
+			FROM product_variants
+			WHERE product_variants.product_id = order_products.product_id AND order_products.variant_id IS NULL`).Error; err != nil {
+			return err
+		}
+
+		return tx.Exec(`UPDATE cart_items
+			SET variant_id = product_variants.id
+			FROM product_variants
+			WHERE product_variants.product_id = cart_items.product_id AND cart_items.variant_id IS NULL`).Error
+	})
 }
 
 // @ECOMMERCE-API
@@ -127,6 +270,10 @@ func migrations() {
 // @in header
 // @name Authorization
 
+// @securityDefinitions.apikey ApiKeyAuth
+// @in header
+// @name X-API-Key
+
 func main() {
 	appConfig := config.Config()
 
@@ -4,19 +4,34 @@ import (
 	"ecommerce-api/config"
 	"ecommerce-api/database"
 	"ecommerce-api/models"
+	"ecommerce-api/tokens"
 	"ecommerce-api/utils"
 	"errors"
 	"net/http"
 	"strconv"
-	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v4"
 	"gorm.io/gorm"
 )
 
+// AuthMiddleware authenticates requests with the access token in the Authorization header, with or
+// without a "Bearer " prefix. Besides the signature and expiry it rejects tokens whose jti was revoked
+// by a logout, tokens issued before the user's token version was last incremented and tokens of
+// suspended users.
+//
+// The revocation check needs the database, so a token that passed it is trusted for
+// ACCESS_TOKEN_CHECK_INTERVAL before it is checked again, unless ForgetToken or ForgetUser drop it
+// sooner. Everything else, including the user's roles, is read from the token's claims.
+//
+// Integrations can authenticate with an API key instead, sent in the X-API-Key header or as
+// "Authorization: ApiKey <key>". API keys are only accepted on routes guarded by RequireScope.
 func AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if key := apiKeyFromRequest(c); key != "" {
+			authenticateAPIKey(c, key)
+			return
+		}
+
 		tokenString := c.GetHeader("Authorization")
 		if tokenString == "" {
 			utils.NewErrorResponse(http.StatusUnauthorized, errors.New("Unauthorized")).SendError(c)
@@ -24,31 +39,79 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		jwtKey := []byte(config.CONFIG.JWT_SECRET)
-
-		token, err := jwt.ParseWithClaims(tokenString, &jwt.RegisteredClaims{}, func(token *jwt.Token) (interface{}, error) {
-			return jwtKey, nil
-		})
+		claims, err := tokens.Default().Parse(tokenString)
 		if err != nil {
 			utils.NewErrorResponse(http.StatusUnauthorized, err).SendError(c)
 			c.Abort()
 			return
 		}
 
-		claims, ok := token.Claims.(*jwt.RegisteredClaims)
-		if !ok || claims.Subject == "" || claims.ExpiresAt == nil || claims.ExpiresAt.Time.Before(time.Now()) {
+		userID, err := claims.UserID()
+		if err != nil {
 			utils.NewErrorResponse(http.StatusUnauthorized, errors.New("Unauthorized")).SendError(c)
 			c.Abort()
 			return
 		}
 
+		if err := checkRevocation(userID, claims); err != nil {
+			switch {
+			case errors.Is(err, utils.ErrInvalidToken):
+				utils.NewErrorResponse(http.StatusUnauthorized, err).SendError(c)
+			case errors.Is(err, utils.ErrAccountSuspended):
+				utils.NewErrorResponse(http.StatusForbidden, err).SendError(c)
+			default:
+				utils.NewAPIResponse(http.StatusInternalServerError, "Failed to verify token", nil, err.Error()).Send(c)
+			}
+			c.Abort()
+			return
+		}
+
 		c.Set("userID", claims.Subject)
+		c.Set("tokenClaims", claims)
 		c.Next()
 	}
 }
 
+// checkRevocation returns utils.ErrInvalidToken if the token's jti was revoked, its user no longer
+// exists or the user's token version has moved past the one in the token, and
+// utils.ErrAccountSuspended if the user is suspended.
+func checkRevocation(userID uint, claims *tokens.Claims) error {
+	cache := tokenChecks()
+	if cache.fresh(claims.ID) {
+		return nil
+	}
 
-func AdminMiddleware() gin.HandlerFunc {
+	var state struct {
+		TokenVersion uint
+		Revoked      bool
+		Suspended    bool
+	}
+	err := database.Database.Model(&models.User{}).
+		Select("token_version, EXISTS (SELECT 1 FROM revoked_tokens WHERE jti = ?) AS revoked, suspended_at IS NOT NULL AS suspended", claims.ID).
+		Where("id = ?", userID).
+		Take(&state).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return utils.ErrInvalidToken
+		}
+		return err
+	}
+
+	if state.Suspended {
+		return utils.ErrAccountSuspended
+	}
+	if state.Revoked || state.TokenVersion != claims.TokenVersion {
+		return utils.ErrInvalidToken
+	}
+
+	cache.remember(claims.ID, userID, claims.ExpiresAt.Time)
+	return nil
+}
+
+// RequirePermission only lets the request through if the authenticated user's roles grant every one
+// of the given permissions. When MFA_REQUIRED_FOR_ADMINS is enabled, the access token must also come
+// from a login that passed a second factor. It must run after AuthMiddleware.
+func RequirePermission(permissions ...models.Permission) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userID, exists := c.Get("userID")
 		if !exists {
@@ -57,20 +120,29 @@ func AdminMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		id, err := strconv.ParseUint(userID.(string), 10, 32)
-		if err != nil {
+		if _, err := strconv.ParseUint(userID.(string), 10, 32); err != nil {
 			utils.NewAPIResponse(http.StatusBadRequest, "Invalid User ID", nil, "User ID conversion failed").Send(c)
 			c.Abort()
 			return
 		}
 
-		var user models.User
-		if err := database.Database.Take(&user, "id = ? AND is_admin = ?", id, true).Error; err != nil {
-			if errors.Is(err, gorm.ErrRecordNotFound) {
-				utils.NewAPIResponse(http.StatusForbidden, "Admin privileges required", nil, "User does not have admin rights").Send(c)
-			} else {
-				utils.NewAPIResponse(http.StatusInternalServerError, "Failed to retrieve user", nil, err.Error()).Send(c)
+		roles, err := Roles(c)
+		if err != nil {
+			utils.NewAPIResponse(http.StatusInternalServerError, "Failed to retrieve user roles", nil, err.Error()).Send(c)
+			c.Abort()
+			return
+		}
+
+		for _, permission := range permissions {
+			if !models.HasPermission(roles, permission) {
+				utils.NewAPIResponse(http.StatusForbidden, "Insufficient permissions", nil, "Missing permission "+string(permission)).Send(c)
+				c.Abort()
+				return
 			}
+		}
+
+		if !mfaSatisfied(c) {
+			utils.NewAPIResponse(http.StatusForbidden, "MFA required", nil, "Log in with two-factor authentication to use this endpoint").Send(c)
 			c.Abort()
 			return
 		}
@@ -78,3 +150,65 @@ func AdminMiddleware() gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// HasPermission reports whether the authenticated user in the context holds the permission.
+// It is meant for handlers that serve both owners and staff and therefore cannot sit behind RequirePermission.
+// Like RequirePermission, it reports false for tokens without a second factor when MFA_REQUIRED_FOR_ADMINS is enabled.
+func HasPermission(c *gin.Context, permission models.Permission) (bool, error) {
+	roles, err := Roles(c)
+	if err != nil {
+		return false, err
+	}
+	return models.HasPermission(roles, permission) && mfaSatisfied(c), nil
+}
+
+// mfaSatisfied reports whether the access token in the context meets the MFA policy for permissioned endpoints.
+// API keys meet it if they were created from a login that passed a second factor.
+func mfaSatisfied(c *gin.Context) bool {
+	if config.CONFIG == nil || !config.CONFIG.MFA_REQUIRED_FOR_ADMINS {
+		return true
+	}
+	if key, ok := apiKey(c); ok {
+		return key.MFA
+	}
+	claims, exists := c.Get("tokenClaims")
+	if !exists {
+		return false
+	}
+	tokenClaims, ok := claims.(*tokens.Claims)
+	return ok && tokenClaims.HasMFA()
+}
+
+// Roles returns the roles of the authenticated user in the context. They come from the access token's
+// claims, which AuthMiddleware stops trusting once a role change bumps the user's token version.
+// Tokens issued before roles were added to the claims fall back to a database lookup, whose result
+// is kept in the context for later checks.
+func Roles(c *gin.Context) ([]models.Role, error) {
+	if cached, exists := c.Get("roles"); exists {
+		return cached.([]models.Role), nil
+	}
+
+	if value, exists := c.Get("tokenClaims"); exists {
+		if claims, ok := value.(*tokens.Claims); ok && len(claims.Roles) > 0 {
+			return claims.Roles, nil
+		}
+	}
+
+	userID, exists := c.Get("userID")
+	if !exists {
+		return nil, nil
+	}
+
+	id, err := strconv.ParseUint(userID.(string), 10, 32)
+	if err != nil {
+		return nil, nil
+	}
+
+	var roles []models.Role
+	if err := database.Database.Model(&models.UserRole{}).Where("user_id = ?", id).Pluck("role", &roles).Error; err != nil {
+		return nil, err
+	}
+
+	c.Set("roles", roles)
+	return roles, nil
+}
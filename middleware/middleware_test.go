@@ -3,16 +3,18 @@ package middleware
 import (
 	"ecommerce-api/config"
 	"ecommerce-api/database"
+	"ecommerce-api/models"
+	"ecommerce-api/tokens"
 	"errors"
 	"net/http"
 	"net/http/httptest"
+	"regexp"
 	"strconv"
 	"testing"
 	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v4"
 	"github.com/stretchr/testify/assert"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
@@ -27,46 +29,69 @@ func init() {
 	config.CONFIG.JWT_SECRET = "testsecret"
 }
 
-func generateTestJWT(userID string, expiration time.Duration) (string, error) {
+func generateTestJWT(userID uint, expiration time.Duration) (string, *tokens.Claims, error) {
 	if config.CONFIG == nil || config.CONFIG.JWT_SECRET == "" {
-		return "", errors.New("empty jwt secret")
+		return "", nil, errors.New("empty jwt secret")
 	}
 
-	claims := &jwt.RegisteredClaims{
-		Subject:   userID,
-		ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiration)),
-	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(config.CONFIG.JWT_SECRET))
+	return tokens.NewManager(config.CONFIG.JWT_SECRET, expiration).Issue(tokens.Subject{UserID: userID, TokenVersion: 1}, []string{tokens.MethodPassword})
 }
 
+func newMockDatabase(t *testing.T) sqlmock.Sqlmock {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open sqlmock database: %s", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	gormDB, err := gorm.Open(postgres.New(postgres.Config{
+		Conn: db,
+	}), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("failed to initialize gorm with sqlmock: %s", err)
+	}
+
+	database.Database = gormDB
+	tokenChecks().reset()
+	return mock
+}
 
-// Test AuthMiddleware with valid and invalid tokens
+// Test AuthMiddleware with valid, invalid and revoked tokens
 func TestAuthMiddleware(t *testing.T) {
+	revocationQuery := regexp.QuoteMeta(`SELECT token_version, EXISTS (SELECT 1 FROM revoked_tokens WHERE jti = $1) AS revoked, suspended_at IS NOT NULL AS suspended FROM "users" WHERE id = $2 AND "users"."deleted_at" IS NULL LIMIT $3`)
+
+	validToken, validClaims, _ := generateTestJWT(1, time.Hour)
+	expiredToken, _, _ := generateTestJWT(1, -time.Hour)
+
 	tests := []struct {
 		name           string
 		token          string
+		version        uint
+		revoked        bool
+		suspended      bool
+		checksDatabase bool
 		expectedStatus int
 	}{
-		{
-			name:           "Valid Token",
-			token:          func() string { token, _ := generateTestJWT("1", time.Hour); return token }(),
-			expectedStatus: http.StatusOK,
-		},
-		{
-			name:           "Expired Token",
-			token:          func() string { token, _ := generateTestJWT("1", -time.Hour); return token }(),
-			expectedStatus: http.StatusUnauthorized,
-		},
-		{
-			name:           "Missing Token",
-			token:          "",
-			expectedStatus: http.StatusUnauthorized,
-		},
+		{name: "Valid Token", token: validToken, version: 1, checksDatabase: true, expectedStatus: http.StatusOK},
+		{name: "Bearer Prefix", token: "Bearer " + validToken, version: 1, checksDatabase: true, expectedStatus: http.StatusOK},
+		{name: "Revoked Token", token: validToken, version: 1, revoked: true, checksDatabase: true, expectedStatus: http.StatusUnauthorized},
+		{name: "Stale Token Version", token: validToken, version: 2, checksDatabase: true, expectedStatus: http.StatusUnauthorized},
+		{name: "Suspended User", token: validToken, version: 1, suspended: true, checksDatabase: true, expectedStatus: http.StatusForbidden},
+		{name: "Expired Token", token: expiredToken, expectedStatus: http.StatusUnauthorized},
+		{name: "Missing Token", token: "", expectedStatus: http.StatusUnauthorized},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
+			mock := newMockDatabase(t)
+			if tt.checksDatabase {
+				mock.ExpectQuery(revocationQuery).
+					WithArgs(validClaims.ID, 1, 1).
+					WillReturnRows(sqlmock.NewRows([]string{"token_version", "revoked", "suspended"}).AddRow(tt.version, tt.revoked, tt.suspended))
+			}
+
 			router := gin.Default()
 			router.Use(AuthMiddleware())
 			router.GET("/test", func(c *gin.Context) {
@@ -81,56 +106,34 @@ func TestAuthMiddleware(t *testing.T) {
 
 			router.ServeHTTP(w, req)
 
-			assert.NotNil(t, w)
-			assert.NotNil(t, req)
-			assert.NotNil(t, router)
-			assert.NotNil(t, tt)
-
 			assert.Equal(t, tt.expectedStatus, w.Code)
+			assert.NoError(t, mock.ExpectationsWereMet())
 		})
 	}
 }
 
 
-func TestAdminMiddleware(t *testing.T) {
-	// Set up sqlmock
-	db, mock, err := sqlmock.New()
-	if err != nil {
-		t.Fatalf("failed to open sqlmock database: %s", err)
-	}
-	defer db.Close()
-
-	// Initialize GORM with sqlmock database
-	gormDB, err := gorm.Open(postgres.New(postgres.Config{
-		Conn: db,
-	}), &gorm.Config{
-		Logger: logger.Default.LogMode(logger.Silent),
-	})
-	if err != nil {
-		t.Fatalf("failed to initialize gorm with sqlmock: %s", err)
-	}
-
-	// Replace the global Database variable with our mock database
-	database.Database = gormDB
+func TestRequirePermission(t *testing.T) {
+	rolesQuery := regexp.QuoteMeta(`SELECT "role" FROM "user_roles" WHERE user_id = $1`)
 
-	// Test cases
 	tests := []struct {
 		name           string
 		userID         string
-		isAdmin        bool
+		roles          []models.Role
 		expectedStatus int
-		mockError      error
 	}{
-		{"User ID not found in context", "", false, http.StatusUnauthorized, nil},
-		{"Invalid User ID", "invalid-id", false, http.StatusBadRequest, nil},
-		{"User not found in database", "123", false, http.StatusForbidden, gorm.ErrRecordNotFound},
-		{"User without admin rights", "123", false, http.StatusForbidden, nil},
-		{"Admin User", "123", true, http.StatusOK, nil},
+		{"User ID not found in context", "", nil, http.StatusUnauthorized},
+		{"Invalid User ID", "invalid-id", nil, http.StatusBadRequest},
+		{"Customer", "123", []models.Role{models.RoleCustomer}, http.StatusForbidden},
+		{"Role without the permission", "123", []models.Role{models.RoleCustomer, models.RoleSupport}, http.StatusForbidden},
+		{"Role with the permission", "123", []models.Role{models.RoleCustomer, models.RoleCatalogManager}, http.StatusOK},
+		{"Super admin", "123", []models.Role{models.RoleSuperAdmin}, http.StatusOK},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			// Set up the test request and context
+			mock := newMockDatabase(t)
+
 			w := httptest.NewRecorder()
 			c, _ := gin.CreateTestContext(w)
 			c.Request, _ = http.NewRequest("GET", "/", nil)
@@ -138,38 +141,181 @@ func TestAdminMiddleware(t *testing.T) {
 				c.Set("userID", tt.userID)
 			}
 
-			// Mock database responses based on the test case
-			userIDInt, err := strconv.Atoi(tt.userID)
-			if tt.userID != "" && err == nil {
-				if tt.expectedStatus == http.StatusOK && tt.isAdmin {
-					// Admin user found
-					mock.ExpectQuery(`SELECT * FROM "users" WHERE id = $1 AND is_admin = $2`).
-						WithArgs(userIDInt, true).
-						WillReturnRows(sqlmock.NewRows([]string{"id", "is_admin"}).AddRow(userIDInt, true))
-				} else if tt.expectedStatus == http.StatusForbidden && !tt.isAdmin {
-					// Non-admin user found
-					mock.ExpectQuery(`SELECT * FROM "users" WHERE id = $1 AND is_admin = $2`).
-						WithArgs(userIDInt, true).
-						WillReturnRows(sqlmock.NewRows([]string{"id", "is_admin"}).AddRow(userIDInt, false))
-				} else if tt.mockError == gorm.ErrRecordNotFound {
-					// User not found
-					mock.ExpectQuery(`SELECT * FROM "users" WHERE id = $1 AND is_admin = $2`).
-						WithArgs(userIDInt, true).
-						WillReturnError(gorm.ErrRecordNotFound)
+			if userIDInt, err := strconv.Atoi(tt.userID); err == nil {
+				rows := sqlmock.NewRows([]string{"role"})
+				for _, role := range tt.roles {
+					rows.AddRow(string(role))
 				}
+				mock.ExpectQuery(rolesQuery).WithArgs(userIDInt).WillReturnRows(rows)
 			}
 
-			// Call the middleware
-			AdminMiddleware()(c)
+			RequirePermission(models.PermProductsWrite)(c)
 
-			// Assert the expected HTTP status code
+			// A request that passes the check has no response written yet, which the recorder reports as 200.
 			assert.Equal(t, tt.expectedStatus, w.Code)
+			assert.Equal(t, tt.expectedStatus != http.StatusOK, c.IsAborted())
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
 
-			// Ensure all expectations were met
-			if err := mock.ExpectationsWereMet(); err != nil {
-				t.Errorf("unfulfilled sqlmock expectations: %s", err)
+func TestRequirePermissionMFAPolicy(t *testing.T) {
+	config.CONFIG.MFA_REQUIRED_FOR_ADMINS = true
+	t.Cleanup(func() { config.CONFIG.MFA_REQUIRED_FOR_ADMINS = false })
+
+	tests := []struct {
+		name           string
+		methods        []string
+		expectedStatus int
+	}{
+		{"Password only", []string{tokens.MethodPassword}, http.StatusForbidden},
+		{"Password and TOTP", []string{tokens.MethodPassword, tokens.MethodOTP}, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, claims, err := tokens.NewManager(config.CONFIG.JWT_SECRET, time.Minute).Issue(tokens.Subject{UserID: 123, TokenVersion: 1}, tt.methods)
+			assert.NoError(t, err)
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest("GET", "/", nil)
+			c.Set("userID", "123")
+			c.Set("tokenClaims", claims)
+			c.Set("roles", []models.Role{models.RoleSuperAdmin})
+
+			RequirePermission(models.PermProductsWrite)(c)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			assert.Equal(t, tt.expectedStatus != http.StatusOK, c.IsAborted())
+		})
+	}
+}
+
+// TestAuthMiddlewareCachesChecks verifies that a token is only checked against the database once per
+// interval and that roles are read from its claims.
+func TestAuthMiddlewareCachesChecks(t *testing.T) {
+	mock := newMockDatabase(t)
+	token, claims, _ := tokens.NewManager(config.CONFIG.JWT_SECRET, time.Hour).
+		Issue(tokens.Subject{UserID: 1, TokenVersion: 1, Roles: []models.Role{models.RoleCustomer, models.RoleCatalogManager}}, nil)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT token_version, EXISTS (SELECT 1 FROM revoked_tokens WHERE jti = $1) AS revoked, suspended_at IS NOT NULL AS suspended FROM "users"`)).
+		WithArgs(claims.ID, 1, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"token_version", "revoked", "suspended"}).AddRow(1, false, false))
+
+	router := gin.Default()
+	router.Use(AuthMiddleware(), RequirePermission(models.PermProductsWrite))
+	router.GET("/test", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"message": "Success"})
+	})
+
+	for i := 0; i < 3; i++ {
+		req, _ := http.NewRequest(http.MethodGet, "/test", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestAuthMiddlewareForgetsRevokedTokens verifies that ForgetToken and ForgetUser make the next request
+// check the token against the database again, so that a revocation is not hidden by the cache.
+func TestAuthMiddlewareForgetsRevokedTokens(t *testing.T) {
+	revocationQuery := regexp.QuoteMeta(`SELECT token_version, EXISTS (SELECT 1 FROM revoked_tokens WHERE jti = $1) AS revoked, suspended_at IS NOT NULL AS suspended FROM "users"`)
+
+	tests := []struct {
+		name   string
+		forget func(claims *tokens.Claims)
+	}{
+		{"ForgetToken", func(claims *tokens.Claims) { ForgetToken(claims.ID) }},
+		{"ForgetUser", func(*tokens.Claims) { ForgetUser(1) }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := newMockDatabase(t)
+			token, claims, _ := generateTestJWT(1, time.Hour)
+
+			mock.ExpectQuery(revocationQuery).
+				WithArgs(claims.ID, 1, 1).
+				WillReturnRows(sqlmock.NewRows([]string{"token_version", "revoked", "suspended"}).AddRow(1, false, false))
+			mock.ExpectQuery(revocationQuery).
+				WithArgs(claims.ID, 1, 1).
+				WillReturnRows(sqlmock.NewRows([]string{"token_version", "revoked", "suspended"}).AddRow(1, true, false))
+
+			router := gin.Default()
+			router.Use(AuthMiddleware())
+			router.GET("/test", func(c *gin.Context) {
+				c.JSON(http.StatusOK, gin.H{"message": "Success"})
+			})
+			request := func() int {
+				req, _ := http.NewRequest(http.MethodGet, "/test", nil)
+				req.Header.Set("Authorization", "Bearer "+token)
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, req)
+				return w.Code
 			}
+
+			assert.Equal(t, http.StatusOK, request())
+			tt.forget(claims)
+			assert.Equal(t, http.StatusUnauthorized, request())
+			assert.NoError(t, mock.ExpectationsWereMet())
 		})
 	}
 }
 
+// TestAPIKeyScopes verifies that API keys are accepted with either header, only act as their user on
+// routes whose scope they hold, and are treated as unauthenticated on routes without a scope.
+func TestAPIKeyScopes(t *testing.T) {
+	key := "ek_0a1b2c3d_secret"
+
+	router := gin.Default()
+	router.Use(AuthMiddleware())
+	handler := func(c *gin.Context) {
+		userID, exists := c.Get("userID")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"message": "Unauthorized"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"user_id": userID})
+	}
+	router.GET("/read", RequireScope(models.ScopeProductsRead), handler)
+	router.GET("/write", RequireScope(models.ScopeProductsWrite), handler)
+	router.GET("/unscoped", handler)
+
+	tests := []struct {
+		name           string
+		path           string
+		header         string
+		value          string
+		expectedStatus int
+	}{
+		{"X-API-Key header", "/read", "X-API-Key", key, http.StatusOK},
+		{"ApiKey authorization", "/read", "Authorization", "ApiKey " + key, http.StatusOK},
+		{"Missing scope", "/write", "X-API-Key", key, http.StatusForbidden},
+		{"Route without scope", "/unscoped", "X-API-Key", key, http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := newMockDatabase(t)
+			mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "api_keys" WHERE key_hash = $1`)).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "scopes", "last_used_at"}).AddRow(3, 7, "products:read", time.Now()))
+			mock.ExpectQuery(regexp.QuoteMeta(`SELECT "id","suspended_at" FROM "users"`)).
+				WithArgs(7, 1).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "suspended_at"}).AddRow(7, nil))
+
+			req, _ := http.NewRequest(http.MethodGet, tt.path, nil)
+			req.Header.Set(tt.header, tt.value)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedStatus == http.StatusOK {
+				assert.Contains(t, w.Body.String(), `"user_id":"7"`)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
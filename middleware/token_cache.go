@@ -0,0 +1,127 @@
+package middleware
+
+import (
+	"ecommerce-api/config"
+	"sync"
+	"time"
+)
+
+// tokenCheckCache remembers access tokens that recently passed the revocation check, keyed by jti,
+// so that a client making many requests with one token does not query the database for each of them.
+// A token is checked again once its entry is older than the cache's interval. Revocations made by
+// this process drop the affected entries straight away through ForgetToken and ForgetUser, so the
+// interval only bounds how long a revocation made by another process takes to reach this one.
+type tokenCheckCache struct {
+	mu       sync.Mutex
+	interval time.Duration
+	entries  map[string]tokenCheck
+	now      func() time.Time
+}
+
+// tokenCheck is a token that passed the revocation check, trusted until validUntil.
+type tokenCheck struct {
+	userID     uint
+	validUntil time.Time
+}
+
+// tokenCheckCachePruneSize is the number of entries above which expired entries are swept before adding another.
+const tokenCheckCachePruneSize = 10000
+
+func newTokenCheckCache(interval time.Duration) *tokenCheckCache {
+	return &tokenCheckCache{interval: interval, entries: make(map[string]tokenCheck), now: time.Now}
+}
+
+// fresh reports whether the token passed the check less than the interval ago.
+func (c *tokenCheckCache) fresh(jti string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	check, exists := c.entries[jti]
+	if !exists {
+		return false
+	}
+	if !c.now().Before(check.validUntil) {
+		delete(c.entries, jti)
+		return false
+	}
+	return true
+}
+
+// remember records that the user's token passed the check. Entries never outlive the token itself.
+func (c *tokenCheckCache) remember(jti string, userID uint, expiresAt time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.entries) >= tokenCheckCachePruneSize {
+		now := c.now()
+		for key, check := range c.entries {
+			if !now.Before(check.validUntil) {
+				delete(c.entries, key)
+			}
+		}
+	}
+
+	validUntil := c.now().Add(c.interval)
+	if expiresAt.Before(validUntil) {
+		validUntil = expiresAt
+	}
+	c.entries[jti] = tokenCheck{userID: userID, validUntil: validUntil}
+}
+
+// forgetToken drops the token, so that it is checked again on its next use.
+func (c *tokenCheckCache) forgetToken(jti string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.entries, jti)
+}
+
+// forgetUser drops every token of the user, so that each is checked again on its next use.
+func (c *tokenCheckCache) forgetUser(userID uint) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key, check := range c.entries {
+		if check.userID == userID {
+			delete(c.entries, key)
+		}
+	}
+}
+
+// reset forgets every remembered token.
+func (c *tokenCheckCache) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries = make(map[string]tokenCheck)
+}
+
+var (
+	checkedTokens     *tokenCheckCache
+	checkedTokensOnce sync.Once
+)
+
+// tokenChecks returns the process-wide cache, sized from config.CONFIG on first use.
+func tokenChecks() *tokenCheckCache {
+	checkedTokensOnce.Do(func() {
+		interval := 30 * time.Second
+		if config.CONFIG != nil && config.CONFIG.ACCESS_TOKEN_CHECK_INTERVAL > 0 {
+			interval = config.CONFIG.ACCESS_TOKEN_CHECK_INTERVAL
+		}
+		checkedTokens = newTokenCheckCache(interval)
+	})
+	return checkedTokens
+}
+
+// ForgetToken makes AuthMiddleware check the access token with the given jti against the database on
+// its next use. Services call it after revoking the token, so that the revocation takes effect in this
+// process at once instead of after ACCESS_TOKEN_CHECK_INTERVAL.
+func ForgetToken(jti string) {
+	tokenChecks().forgetToken(jti)
+}
+
+// ForgetUser makes AuthMiddleware check every access token of the user against the database on its
+// next use. Services call it after bumping the user's token version or suspending them.
+func ForgetUser(userID uint) {
+	tokenChecks().forgetUser(userID)
+}
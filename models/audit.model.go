@@ -0,0 +1,38 @@
+package models
+
+import "time"
+
+// AuditEvent names a security-relevant event recorded in the audit log.
+type AuditEvent string
+
+const (
+	// AuditLoginLocked is recorded when repeated failed logins lock an account or client IP out.
+	AuditLoginLocked AuditEvent = "login_locked"
+	// AuditLoginUnlocked is recorded when a locked out account logs in successfully or resets its password.
+	AuditLoginUnlocked AuditEvent = "login_unlocked"
+	// AuditUserSuspended and AuditUserUnsuspended are recorded when an admin suspends or reinstates an account.
+	AuditUserSuspended   AuditEvent = "user_suspended"
+	AuditUserUnsuspended AuditEvent = "user_unsuspended"
+	// AuditUserLoggedOut is recorded when an admin ends every session of a user.
+	AuditUserLoggedOut AuditEvent = "user_logged_out"
+	// AuditRolesChanged is recorded when a super admin changes the roles of a user.
+	AuditRolesChanged AuditEvent = "roles_changed"
+	// AuditAPIKeyCreated and AuditAPIKeyRevoked are recorded when a user creates or revokes an API key.
+	AuditAPIKeyCreated AuditEvent = "api_key_created"
+	AuditAPIKeyRevoked AuditEvent = "api_key_revoked"
+	// AuditIdentityLinked is recorded when a login with an OpenID Connect provider is linked to an
+	// existing account by its verified email address.
+	AuditIdentityLinked AuditEvent = "identity_linked"
+)
+
+// AuditLog is an append-only record of a security-relevant event. UserID is the account the event is
+// about, if any, and ActorID the user who caused it when that is someone else.
+type AuditLog struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	Event     AuditEvent `json:"event" gorm:"size:64;index;not null"`
+	UserID    *uint      `json:"user_id,omitempty" gorm:"index"`
+	ActorID   *uint      `json:"actor_id,omitempty"`
+	IP        string     `json:"ip,omitempty"`
+	Details   string     `json:"details,omitempty"`
+	CreatedAt time.Time  `json:"created_at" gorm:"index"`
+}
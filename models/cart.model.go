@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// CartItem is a variant of a product in a user's shopping cart. Prices are not stored on the cart; they
+// are read from the variant whenever the cart is shown and frozen only when the cart is checked out.
+type CartItem struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	UserID    uint      `json:"user_id" gorm:"not null;uniqueIndex:idx_cart_items_user_variant"`
+	ProductID uint      `json:"product_id" gorm:"not null;index"`
+	VariantID uint      `json:"variant_id" gorm:"uniqueIndex:idx_cart_items_user_variant"`
+	Quantity  int       `json:"quantity"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
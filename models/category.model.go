@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// Category groups products for storefront navigation. Categories nest: a category with a ParentID is
+// a subcategory of that parent, and one without is at the top level. Siblings are ordered by Position,
+// then by name.
+type Category struct {
+	ID       uint   `json:"id" gorm:"primaryKey"`
+	ParentID *uint  `json:"parent_id" gorm:"index"`
+	Name     string `json:"name" gorm:"size:100;not null"`
+	// Slug identifies the category in storefront URLs and in the category filter of product listings.
+	Slug        string    `json:"slug" gorm:"size:120;uniqueIndex;not null"`
+	Description string    `json:"description"`
+	Position    int       `json:"position" gorm:"not null;default:0"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// ProductCategory assigns a product to a category. A product can be in any number of categories.
+type ProductCategory struct {
+	ProductID  uint `gorm:"primaryKey"`
+	CategoryID uint `gorm:"primaryKey;index"`
+}
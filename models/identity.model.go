@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+// UserIdentity links a user to their account at an OpenID Connect provider, which is identified there
+// by Subject. A user can sign in with every provider they are linked to.
+type UserIdentity struct {
+	ID       uint   `json:"id" gorm:"primaryKey"`
+	UserID   uint   `json:"user_id" gorm:"index;not null"`
+	Provider string `json:"provider" gorm:"size:64;not null;uniqueIndex:idx_user_identities_subject"`
+	Subject  string `json:"-" gorm:"size:255;not null;uniqueIndex:idx_user_identities_subject"`
+	// Email is the address the provider asserted when the identity was linked.
+	Email       string     `json:"email"`
+	LastLoginAt *time.Time `json:"last_login_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// OIDCLoginState is a login with an OpenID Connect provider that has been started but not completed.
+// The state handed to the provider is only stored as a hash; the nonce and PKCE code verifier must be
+// kept as they are to complete the login, and never leave the server.
+type OIDCLoginState struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	Provider     string    `json:"provider" gorm:"size:64;not null"`
+	StateHash    string    `json:"-" gorm:"uniqueIndex;not null"`
+	Nonce        string    `json:"-" gorm:"not null"`
+	CodeVerifier string    `json:"-" gorm:"not null"`
+	ExpiresAt    time.Time `json:"expires_at" gorm:"index;not null"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// TableName keeps gorm from splitting the acronym into "o_id_c_login_states".
+func (OIDCLoginState) TableName() string {
+	return "oidc_login_states"
+}
@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// ProductImage is an uploaded image of a product with its thumbnail. A product's images are shown in
+// Position order, and its primary image represents the product in listings. URL and ThumbnailURL are
+// taken from the blob store when the image is uploaded.
+type ProductImage struct {
+	ID        uint `json:"id" gorm:"primaryKey"`
+	ProductID uint `json:"product_id" gorm:"not null;index;uniqueIndex:idx_product_images_primary,where:is_primary"`
+	// Key and ThumbnailKey name the image and its thumbnail in the blob store.
+	Key          string    `json:"-" gorm:"size:255;not null"`
+	ThumbnailKey string    `json:"-" gorm:"size:255;not null"`
+	URL          string    `json:"url" gorm:"size:1024;not null"`
+	ThumbnailURL string    `json:"thumbnail_url" gorm:"size:1024;not null"`
+	ContentType  string    `json:"content_type" gorm:"size:50;not null"`
+	Size         int64     `json:"size"`
+	Width        int       `json:"width"`
+	Height       int       `json:"height"`
+	Position     int       `json:"position" gorm:"not null;default:0"`
+	IsPrimary    bool      `json:"is_primary" gorm:"not null;default:false"`
+	CreatedAt    time.Time `json:"created_at"`
+}
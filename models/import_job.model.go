@@ -0,0 +1,44 @@
+package models
+
+import "time"
+
+type ImportJobStatus string
+
+const (
+	ImportJobStatusPending   ImportJobStatus = "pending"
+	ImportJobStatusRunning   ImportJobStatus = "running"
+	ImportJobStatusCompleted ImportJobStatus = "completed"
+	ImportJobStatusFailed    ImportJobStatus = "failed"
+)
+
+// ImportJob is a bulk product import that runs in the background. A dry run validates every row and
+// counts the products it would create and update without changing the catalog. The rows that could
+// not be imported are kept in Errors, which is served as the job's error report.
+type ImportJob struct {
+	ID     uint            `json:"id" gorm:"primaryKey"`
+	UserID uint            `json:"user_id" gorm:"index"`
+	Format string          `json:"format" gorm:"size:10;not null"`
+	DryRun bool            `json:"dry_run"`
+	Status ImportJobStatus `json:"status" gorm:"size:20;not null;default:'pending'"`
+	// Message explains why a failed job stopped.
+	Message    string           `json:"message,omitempty"`
+	TotalRows  int              `json:"total_rows"`
+	Processed  int              `json:"processed"`
+	Created    int              `json:"created"`
+	Updated    int              `json:"updated"`
+	Failed     int              `json:"failed"`
+	Errors     []ImportRowError `json:"-" gorm:"type:jsonb;serializer:json"`
+	CreatedAt  time.Time        `json:"created_at"`
+	UpdatedAt  time.Time        `json:"updated_at"`
+	StartedAt  *time.Time       `json:"started_at"`
+	FinishedAt *time.Time       `json:"finished_at"`
+}
+
+// ImportRowError is a problem with one row of an import file. Row is the row's line in the file,
+// counting the CSV header, and Field is empty when the problem is not with a single field.
+type ImportRowError struct {
+	Row     int    `json:"row"`
+	SKU     string `json:"sku"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+// MFAFactor is a user's TOTP authenticator. It only protects logins once ConfirmedAt is set, which
+// happens when the user proves the authenticator app produces valid codes.
+//
+// The secret has to be stored in a recoverable form to compute codes, unlike passwords and tokens.
+type MFAFactor struct {
+	UserID      uint       `json:"user_id" gorm:"primaryKey"`
+	Secret      string     `json:"-" gorm:"not null"`
+	ConfirmedAt *time.Time `json:"confirmed_at,omitempty"`
+	// LastUsedStep is the TOTP period of the last accepted code. Codes from that period or earlier
+	// are rejected, so an intercepted code cannot be replayed.
+	LastUsedStep int64     `json:"-"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// MFARecoveryCode is a single-use code that stands in for a TOTP code when the authenticator is lost.
+// Only a hash of the code is stored.
+type MFARecoveryCode struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	UserID    uint       `json:"user_id" gorm:"index;not null"`
+	CodeHash  string     `json:"-" gorm:"uniqueIndex;not null"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
@@ -2,6 +2,8 @@ package models
 
 import (
 	"errors"
+	"fmt"
+	"strings"
 	"time"
 )
 
@@ -21,14 +23,27 @@ type Order struct {
 	UpdatedAt time.Time      `json:"updated_at"`
 	DeletedAt *time.Time     `json:"deleted_at" gorm:"index"`
 	UserID    uint           `json:"user_id"`
-	Products  []Product      `gorm:"many2many:order_products;" json:"products"`
+	Items     []OrderProduct `gorm:"foreignKey:OrderID" json:"items"`
 	Status    OrderStatus    `json:"status" gorm:"default:'pending'"`
+	Currency  string         `json:"currency" gorm:"size:3"`
+	Subtotal  int64          `json:"subtotal"`
+	Total     int64          `json:"total"`
 }
 
+// OrderProduct is a line item of an order for one variant of a product. The product's name, the
+// variant's SKU and title, the unit price and the currency are copied onto the line when the order is
+// placed, so later catalog edits never change a placed order.
 type OrderProduct struct {
-	OrderID   uint `json:"order_id"`
-	ProductID uint `json:"product_id"`
-	Quantity  int  `json:"quantity"`
+	OrderID      uint   `json:"order_id"`
+	ProductID    uint   `json:"product_id"`
+	VariantID    uint   `json:"variant_id" gorm:"index"`
+	ProductName  string `json:"product_name"`
+	SKU          string `json:"sku"`
+	VariantTitle string `json:"variant_title"`
+	UnitPrice    int64  `json:"unit_price"`
+	Currency     string `json:"currency" gorm:"size:3"`
+	Quantity     int    `json:"quantity"`
+	LineTotal    int64  `json:"line_total"`
 }
 
 
@@ -38,4 +53,55 @@ func (status OrderStatus) IsValid() error {
 		return nil
 	}
 	return errors.New("invalid order status")
-}
\ No newline at end of file
+}
+
+// orderTransitions is the order lifecycle. Each status maps to the statuses it may move to next;
+// delivered and cancelled are terminal, and an order can only be cancelled before it ships.
+var orderTransitions = map[OrderStatus][]OrderStatus{
+	OrderStatusPending:    {OrderStatusProcessing, OrderStatusCancelled},
+	OrderStatusProcessing: {OrderStatusShipped, OrderStatusCancelled},
+	OrderStatusShipped:    {OrderStatusDelivered},
+	OrderStatusDelivered:  {},
+	OrderStatusCancelled:  {},
+}
+
+// TransitionError reports an order status change that the lifecycle does not allow.
+type TransitionError struct {
+	From    OrderStatus   `json:"from"`
+	To      OrderStatus   `json:"to"`
+	Allowed []OrderStatus `json:"allowed"`
+}
+
+func (e *TransitionError) Error() string {
+	if len(e.Allowed) == 0 {
+		return fmt.Sprintf("cannot change order status from %s to %s: %s is a final status", e.From, e.To, e.From)
+	}
+	allowed := make([]string, len(e.Allowed))
+	for i, status := range e.Allowed {
+		allowed[i] = string(status)
+	}
+	return fmt.Sprintf("cannot change order status from %s to %s: allowed next statuses are %s", e.From, e.To, strings.Join(allowed, ", "))
+}
+
+// AllowedTransitions returns the statuses an order in this status may move to next.
+func (status OrderStatus) AllowedTransitions() []OrderStatus {
+	return append([]OrderStatus{}, orderTransitions[status]...)
+}
+
+// CanTransitionTo reports whether the lifecycle allows moving from this status to next.
+func (status OrderStatus) CanTransitionTo(next OrderStatus) bool {
+	for _, allowed := range orderTransitions[status] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateTransition returns a *TransitionError if the lifecycle does not allow moving from this status to next.
+func (status OrderStatus) ValidateTransition(next OrderStatus) error {
+	if status.CanTransitionTo(next) {
+		return nil
+	}
+	return &TransitionError{From: status, To: next, Allowed: status.AllowedTransitions()}
+}
@@ -0,0 +1,54 @@
+package models
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOrderStatusTransitions(t *testing.T) {
+	tests := []struct {
+		from    OrderStatus
+		to      OrderStatus
+		allowed bool
+	}{
+		{OrderStatusPending, OrderStatusProcessing, true},
+		{OrderStatusPending, OrderStatusCancelled, true},
+		{OrderStatusProcessing, OrderStatusShipped, true},
+		{OrderStatusProcessing, OrderStatusCancelled, true},
+		{OrderStatusShipped, OrderStatusDelivered, true},
+		{OrderStatusPending, OrderStatusShipped, false},
+		{OrderStatusShipped, OrderStatusCancelled, false},
+		{OrderStatusDelivered, OrderStatusPending, false},
+		{OrderStatusCancelled, OrderStatusShipped, false},
+		{OrderStatusPending, OrderStatusPending, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.from)+"->"+string(tt.to), func(t *testing.T) {
+			assert.Equal(t, tt.allowed, tt.from.CanTransitionTo(tt.to))
+
+			err := tt.from.ValidateTransition(tt.to)
+			if tt.allowed {
+				assert.NoError(t, err)
+				return
+			}
+
+			var transitionErr *TransitionError
+			if assert.True(t, errors.As(err, &transitionErr)) {
+				assert.Equal(t, tt.from, transitionErr.From)
+				assert.Equal(t, tt.to, transitionErr.To)
+				assert.Equal(t, tt.from.AllowedTransitions(), transitionErr.Allowed)
+			}
+		})
+	}
+}
+
+func TestTransitionErrorMessage(t *testing.T) {
+	err := OrderStatusShipped.ValidateTransition(OrderStatusCancelled)
+	assert.EqualError(t, err, "cannot change order status from shipped to cancelled: allowed next statuses are delivered")
+
+	err = OrderStatusDelivered.ValidateTransition(OrderStatusPending)
+	assert.EqualError(t, err, "cannot change order status from delivered to pending: delivered is a final status")
+}
@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// OrderStatusEvent is one entry in an order's status history. FromStatus is empty for the event
+// written when the order is placed.
+type OrderStatusEvent struct {
+	ID         uint        `json:"id" gorm:"primaryKey"`
+	OrderID    uint        `json:"order_id" gorm:"index;not null"`
+	FromStatus OrderStatus `json:"from_status,omitempty"`
+	ToStatus   OrderStatus `json:"to_status" gorm:"not null"`
+	ActorID    uint        `json:"actor_id"`
+	Reason     string      `json:"reason"`
+	CreatedAt  time.Time   `json:"created_at"`
+}
@@ -1,14 +1,27 @@
 package models
 
-import "time"
+import (
+	"time"
 
+	"gorm.io/gorm"
+)
+
+// Product is an item in the catalog. Price applies to every variant that does not override it, and
+// Stock is the total stock across the product's variants. Listings include only the primary image of
+// each product. Deleting a product only sets DeletedAt, which hides it from the catalog but keeps it
+// for the orders that reference it until it is restored or purged.
 type Product struct {
-	ID          uint       `json:"id" gorm:"primaryKey"`
-	Name        string     `json:"name"`
-	Description string     `json:"description"`
-	Price       int64      `json:"price"`
-	Stock       int        `json:"stock"`
-	CreatedAt   time.Time  `json:"created_at"`
-	UpdatedAt   time.Time  `json:"updated_at"`
-	DeletedAt   *time.Time `json:"deleted_at" gorm:"index"`
+	ID          uint             `json:"id" gorm:"primaryKey"`
+	Name        string           `json:"name"`
+	Description string           `json:"description"`
+	Price       int64            `json:"price"`
+	Currency    string           `json:"currency" gorm:"size:3;not null;default:'USD'"`
+	Stock       int              `json:"stock"`
+	CreatedAt   time.Time        `json:"created_at"`
+	UpdatedAt   time.Time        `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt   `json:"deleted_at" gorm:"index" swaggertype:"string" format:"date-time"`
+	Categories  []Category       `json:"categories,omitempty" gorm:"many2many:product_categories;constraint:OnDelete:CASCADE"`
+	Options     []ProductOption  `json:"options,omitempty" gorm:"constraint:OnDelete:CASCADE"`
+	Variants    []ProductVariant `json:"variants,omitempty" gorm:"constraint:OnDelete:CASCADE"`
+	Images      []ProductImage   `json:"images,omitempty" gorm:"constraint:OnDelete:CASCADE"`
 }
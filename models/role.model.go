@@ -0,0 +1,83 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+// Role is a named set of permissions. A user can hold several roles and gets the union of their permissions.
+type Role string
+
+const (
+	// RoleCustomer is given to every registered user. It grants no staff permissions; the cart and a
+	// user's own orders only require authentication.
+	RoleCustomer       Role = "customer"
+	RoleSupport        Role = "support"
+	RoleCatalogManager Role = "catalog_manager"
+	RoleFulfilment     Role = "fulfilment"
+	RoleSuperAdmin     Role = "super_admin"
+)
+
+// Permission is an action guarded by middleware.RequirePermission.
+type Permission string
+
+const (
+	PermProductsWrite Permission = "products:write"
+	// PermProductsPurge permanently deletes products from the trash. Only super admins hold it.
+	PermProductsPurge Permission = "products:purge"
+	PermOrdersRead    Permission = "orders:read"
+	PermOrdersStatus  Permission = "orders:status"
+	PermUsersRead     Permission = "users:read"
+	PermUsersManage   Permission = "users:manage"
+	PermRolesAssign   Permission = "roles:assign"
+)
+
+// AllPermissions lists every permission. A super admin holds all of them.
+var AllPermissions = []Permission{PermProductsWrite, PermProductsPurge, PermOrdersRead, PermOrdersStatus, PermUsersRead, PermUsersManage, PermRolesAssign}
+
+// rolePermissions maps each role to the permissions it grants.
+var rolePermissions = map[Role][]Permission{
+	RoleCustomer:       {},
+	RoleSupport:        {PermOrdersRead, PermUsersRead},
+	RoleCatalogManager: {PermProductsWrite},
+	RoleFulfilment:     {PermOrdersRead, PermOrdersStatus},
+	RoleSuperAdmin:     AllPermissions,
+}
+
+// UserRole assigns a role to a user. GrantedByID is the super admin who assigned it, or nil for roles
+// given at registration, by migration or by the bootstrap.
+type UserRole struct {
+	UserID      uint      `json:"user_id" gorm:"primaryKey"`
+	Role        Role      `json:"role" gorm:"primaryKey;size:32"`
+	GrantedByID *uint     `json:"granted_by_id,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+func (role Role) IsValid() error {
+	if _, ok := rolePermissions[role]; !ok {
+		return errors.New("invalid role")
+	}
+	return nil
+}
+
+// Permissions returns the permissions the role grants.
+func (role Role) Permissions() []Permission {
+	return rolePermissions[role]
+}
+
+// Roles lists every role in order of increasing privilege.
+func Roles() []Role {
+	return []Role{RoleCustomer, RoleSupport, RoleCatalogManager, RoleFulfilment, RoleSuperAdmin}
+}
+
+// HasPermission reports whether any of the roles grants the permission.
+func HasPermission(roles []Role, permission Permission) bool {
+	for _, role := range roles {
+		for _, granted := range rolePermissions[role] {
+			if granted == permission {
+				return true
+			}
+		}
+	}
+	return false
+}
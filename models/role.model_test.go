@@ -0,0 +1,37 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRolePermissions(t *testing.T) {
+	tests := []struct {
+		roles      []Role
+		permission Permission
+		granted    bool
+	}{
+		{[]Role{RoleCustomer}, PermProductsWrite, false},
+		{[]Role{RoleCustomer}, PermOrdersRead, false},
+		{[]Role{RoleSupport}, PermOrdersRead, true},
+		{[]Role{RoleSupport}, PermOrdersStatus, false},
+		{[]Role{RoleCatalogManager}, PermProductsWrite, true},
+		{[]Role{RoleCatalogManager}, PermProductsPurge, false},
+		{[]Role{RoleFulfilment}, PermOrdersStatus, true},
+		{[]Role{RoleFulfilment}, PermRolesAssign, false},
+		{[]Role{RoleCustomer, RoleCatalogManager}, PermProductsWrite, true},
+		{nil, PermProductsWrite, false},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.granted, HasPermission(tt.roles, tt.permission), "%v %s", tt.roles, tt.permission)
+	}
+
+	for _, permission := range AllPermissions {
+		assert.True(t, HasPermission([]Role{RoleSuperAdmin}, permission), permission)
+	}
+
+	assert.NoError(t, RoleSupport.IsValid())
+	assert.Error(t, Role("admin").IsValid())
+}
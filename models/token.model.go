@@ -0,0 +1,54 @@
+package models
+
+import "time"
+
+// RefreshToken is a long-lived token used to obtain new access tokens. Only a hash of the token is stored.
+//
+// Every refresh rotates the token: the presented token is revoked and replaced by a new one in the same
+// family. A family is the chain of tokens that descend from one login, so presenting a token that was
+// already rotated means it leaked, and the whole family is revoked.
+type RefreshToken struct {
+	ID           uint       `json:"id" gorm:"primaryKey"`
+	UserID       uint       `json:"user_id" gorm:"index;not null"`
+	FamilyID     string     `json:"family_id" gorm:"index;not null"`
+	TokenHash    string     `json:"-" gorm:"uniqueIndex;not null"`
+	ExpiresAt    time.Time  `json:"expires_at" gorm:"not null"`
+	RevokedAt    *time.Time `json:"revoked_at,omitempty"`
+	ReplacedByID *uint      `json:"replaced_by_id,omitempty"`
+	UserAgent    string     `json:"user_agent"`
+	IP           string     `json:"ip"`
+	// MFA records that the login starting the family passed a second factor, so refreshed
+	// access tokens keep saying so.
+	MFA       bool      `json:"mfa"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// RevokedToken records an access token that was revoked before it expired, identified by its jti claim.
+// Rows are only needed until the token would have expired anyway.
+type RevokedToken struct {
+	JTI       string    `json:"jti" gorm:"primaryKey"`
+	ExpiresAt time.Time `json:"expires_at" gorm:"index;not null"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// UserTokenPurpose says what a UserToken may be used for.
+type UserTokenPurpose string
+
+const (
+	UserTokenPasswordReset     UserTokenPurpose = "password_reset"
+	UserTokenEmailVerification UserTokenPurpose = "email_verification"
+	// UserTokenMFAChallenge is handed out by a password login that still needs a TOTP code.
+	UserTokenMFAChallenge UserTokenPurpose = "mfa_challenge"
+)
+
+// UserToken is a single-use token emailed to a user, such as a password reset link. Only a hash of the
+// token is stored, and UsedAt is set when it is redeemed.
+type UserToken struct {
+	ID        uint             `json:"id" gorm:"primaryKey"`
+	UserID    uint             `json:"user_id" gorm:"index;not null"`
+	Purpose   UserTokenPurpose `json:"purpose" gorm:"size:32;not null"`
+	TokenHash string           `json:"-" gorm:"uniqueIndex;not null"`
+	ExpiresAt time.Time        `json:"expires_at" gorm:"not null"`
+	UsedAt    *time.Time       `json:"used_at,omitempty"`
+	CreatedAt time.Time        `json:"created_at"`
+}
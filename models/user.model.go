@@ -4,6 +4,7 @@ import (
 	"github.com/go-playground/validator/v10"
 	"gorm.io/gorm"
 	"regexp"
+	"time"
 )
 
 type User struct {
@@ -11,7 +12,15 @@ type User struct {
 	Email    string `gorm:"unique" json:"email"`
 	Name     string `json:"name"`
 	Password string `json:"-"`
-	IsAdmin  bool   `json:"is_admin"`
+	Roles    []UserRole `gorm:"foreignKey:UserID" json:"roles,omitempty"`
+	// VerifiedAt is when the user confirmed their email address, or nil while it is unverified.
+	VerifiedAt *time.Time `json:"verified_at"`
+	// TokenVersion is embedded in every access token. Incrementing it revokes all tokens issued before.
+	TokenVersion uint `gorm:"not null;default:0" json:"-"`
+	// SuspendedAt is when an admin suspended the account, or nil while it is active. Suspended users
+	// cannot log in and their access tokens are rejected.
+	SuspendedAt      *time.Time `json:"suspended_at,omitempty"`
+	SuspensionReason string     `json:"suspension_reason,omitempty"`
 }
 
 
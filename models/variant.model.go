@@ -0,0 +1,52 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// ProductOption is an axis along which a product's variants differ, such as size or colour, with the
+// values it can take. Options are ordered by Position.
+type ProductOption struct {
+	ID        uint     `json:"id" gorm:"primaryKey"`
+	ProductID uint     `json:"product_id" gorm:"index;not null"`
+	Name      string   `json:"name" gorm:"size:50;not null"`
+	Values    []string `json:"values" gorm:"type:jsonb;serializer:json"`
+	Position  int      `json:"position" gorm:"not null;default:0"`
+}
+
+// ProductVariant is a sellable version of a product, with one value for each of the product's options.
+// Every product has at least one variant; a product without options has exactly one, which holds its
+// stock. Stock is kept per variant and the product's Stock is the total across its variants.
+type ProductVariant struct {
+	ID        uint    `json:"id" gorm:"primaryKey"`
+	ProductID uint    `json:"product_id" gorm:"index;not null"`
+	SKU       *string `json:"sku" gorm:"size:64;uniqueIndex"`
+	// Title is the variant's option values in option order, such as "M / Red". It is empty for the
+	// variant of a product without options.
+	Title   string            `json:"title" gorm:"size:200"`
+	Options map[string]string `json:"options" gorm:"type:jsonb;serializer:json"`
+	// Price overrides the product's price when set.
+	Price     *int64    `json:"price"`
+	Stock     int       `json:"stock"`
+	Position  int       `json:"position" gorm:"not null;default:0"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// UnitPrice returns the price of the variant, which is the product's price unless the variant overrides it.
+func (variant ProductVariant) UnitPrice(product Product) int64 {
+	if variant.Price != nil {
+		return *variant.Price
+	}
+	return product.Price
+}
+
+// VariantTitle joins a variant's option values in the order of the product's options.
+func VariantTitle(options []ProductOption, values map[string]string) string {
+	parts := make([]string, 0, len(options))
+	for _, option := range options {
+		parts = append(parts, values[option.Name])
+	}
+	return strings.Join(parts, " / ")
+}
@@ -0,0 +1,22 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVariantPricing(t *testing.T) {
+	product := Product{Price: 1500}
+	override := int64(1800)
+
+	assert.Equal(t, int64(1500), ProductVariant{}.UnitPrice(product))
+	assert.Equal(t, int64(1800), ProductVariant{Price: &override}.UnitPrice(product))
+}
+
+func TestVariantTitle(t *testing.T) {
+	options := []ProductOption{{Name: "Size"}, {Name: "Colour"}}
+
+	assert.Equal(t, "M / Red", VariantTitle(options, map[string]string{"Colour": "Red", "Size": "M"}))
+	assert.Equal(t, "", VariantTitle(nil, map[string]string{}))
+}
@@ -0,0 +1,221 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// keyRefreshInterval limits how often a token naming an unknown key makes the provider's keys be
+// fetched again, so that forged tokens cannot be used to flood the provider.
+const keyRefreshInterval = time.Minute
+
+// IDToken holds the claims of a verified ID token that the login flow uses.
+type IDToken struct {
+	jwt.RegisteredClaims
+	Nonce           string `json:"nonce"`
+	AuthorizedParty string `json:"azp,omitempty"`
+	Email           string `json:"email,omitempty"`
+	// EmailVerified is the provider's assertion that the user controls Email.
+	EmailVerified bool   `json:"email_verified,omitempty"`
+	Name          string `json:"name,omitempty"`
+}
+
+// VerifyIDToken checks the signature of an ID token against the provider's published keys, and
+// that it was issued by the provider to this client for the login attempt with the given nonce.
+//
+// Returns:
+// - The token's claims if it is valid.
+// - An error wrapping ErrInvalidIDToken if it is not.
+// - An error if the provider's keys cannot be fetched.
+func (p *Provider) VerifyIDToken(ctx context.Context, raw, nonce string) (*IDToken, error) {
+	meta, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var claims IDToken
+	parser := jwt.NewParser(jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodES256.Alg()}))
+	if _, err := parser.ParseWithClaims(raw, &claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.keys.lookup(ctx, p, meta.JWKSURI, kid, token.Method.Alg())
+	}); err != nil {
+		var fetchErr *keyFetchError
+		if errors.As(err, &fetchErr) {
+			return nil, fetchErr.err
+		}
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+
+	switch {
+	case claims.Issuer != meta.Issuer:
+		return nil, fmt.Errorf("%w: issued by %q", ErrInvalidIDToken, claims.Issuer)
+	case !claims.VerifyAudience(p.config.ClientID, true):
+		return nil, fmt.Errorf("%w: not issued to this client", ErrInvalidIDToken)
+	case claims.AuthorizedParty != "" && claims.AuthorizedParty != p.config.ClientID:
+		return nil, fmt.Errorf("%w: authorized party is %q", ErrInvalidIDToken, claims.AuthorizedParty)
+	case claims.ExpiresAt == nil:
+		return nil, fmt.Errorf("%w: no expiry", ErrInvalidIDToken)
+	case claims.Subject == "":
+		return nil, fmt.Errorf("%w: no subject", ErrInvalidIDToken)
+	case nonce == "" || subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1:
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidIDToken)
+	}
+	return &claims, nil
+}
+
+// keyFetchError marks a failure to fetch the provider's keys, as opposed to a bad token.
+type keyFetchError struct {
+	err error
+}
+
+func (e *keyFetchError) Error() string {
+	return e.err.Error()
+}
+
+// keySet caches a provider's signing keys by kid.
+type keySet struct {
+	mu        sync.Mutex
+	keys      map[string]publicKey
+	fetchedAt time.Time
+}
+
+// publicKey is a verification key along with the algorithm it is used with.
+type publicKey struct {
+	alg string
+	key crypto.PublicKey
+}
+
+// lookup returns the key with the kid for verifying a token signed with alg. A token without a kid
+// is accepted when the provider publishes a single key for its algorithm.
+func (s *keySet) lookup(ctx context.Context, p *Provider, jwksURI, kid, alg string) (crypto.PublicKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, ok := s.find(kid, alg)
+	if !ok && time.Since(s.fetchedAt) >= keyRefreshInterval {
+		var doc struct {
+			Keys []jwk `json:"keys"`
+		}
+		if err := p.getJSON(ctx, jwksURI, &doc); err != nil {
+			return nil, &keyFetchError{fmt.Errorf("failed to fetch keys of provider %s: %w", p.config.Name, err)}
+		}
+
+		s.keys = map[string]publicKey{}
+		for _, k := range doc.Keys {
+			if parsed, err := k.publicKey(); err == nil {
+				s.keys[k.Kid] = parsed
+			}
+		}
+		s.fetchedAt = time.Now()
+		key, ok = s.find(kid, alg)
+	}
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown signing key %q", ErrInvalidIDToken, kid)
+	}
+	return key.key, nil
+}
+
+// find looks a key up in the cache. It must be called with the lock held.
+func (s *keySet) find(kid, alg string) (publicKey, bool) {
+	if kid != "" {
+		key, ok := s.keys[kid]
+		return key, ok && key.alg == alg
+	}
+
+	var found []publicKey
+	for _, key := range s.keys {
+		if key.alg == alg {
+			found = append(found, key)
+		}
+	}
+	if len(found) != 1 {
+		return publicKey{}, false
+	}
+	return found[0], true
+}
+
+// jwk is a JSON Web Key as published in a provider's JWKS document (RFC 7517).
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	// RSA
+	N string `json:"n"`
+	E string `json:"e"`
+	// EC
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// publicKey decodes an RSA key for RS256 or a P-256 key for ES256. Encryption keys are skipped.
+func (k jwk) publicKey() (publicKey, error) {
+	if k.Use != "" && k.Use != "sig" {
+		return publicKey{}, errors.New("not a signing key")
+	}
+
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return publicKey{}, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil || !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return publicKey{}, errors.New("invalid RSA exponent")
+		}
+		if n.BitLen() < 2048 {
+			return publicKey{}, errors.New("RSA keys must be at least 2048 bits")
+		}
+		return publicKey{alg: jwt.SigningMethodRS256.Alg(), key: &rsa.PublicKey{N: n, E: int(e.Int64())}}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return publicKey{}, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return publicKey{}, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return publicKey{}, err
+		}
+		if x.BitLen() > 256 || y.BitLen() > 256 {
+			return publicKey{}, errors.New("point is not on the curve")
+		}
+		// crypto/ecdh rejects points that are not on the curve.
+		point := make([]byte, 65)
+		point[0] = 4
+		x.FillBytes(point[1:33])
+		y.FillBytes(point[33:])
+		if _, err := ecdh.P256().NewPublicKey(point); err != nil {
+			return publicKey{}, errors.New("point is not on the curve")
+		}
+		return publicKey{alg: jwt.SigningMethodES256.Alg(), key: &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}}, nil
+	default:
+		return publicKey{}, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+// decodeBigInt decodes a base64url encoded unsigned big-endian integer.
+func decodeBigInt(value string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil || len(data) == 0 {
+		return nil, errors.New("invalid key parameter")
+	}
+	return new(big.Int).SetBytes(data), nil
+}
@@ -0,0 +1,218 @@
+// Package oidc implements the client side of the OpenID Connect authorization code flow with PKCE:
+// provider discovery, the authorization URL, the code exchange and ID token verification.
+package oidc
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"ecommerce-api/utils"
+)
+
+var (
+	// ErrExchangeFailed is returned when the token endpoint rejects an authorization code.
+	ErrExchangeFailed = errors.New("authorization code exchange failed")
+	// ErrInvalidIDToken is returned when an ID token's signature or claims do not check out.
+	ErrInvalidIDToken = errors.New("invalid ID token")
+)
+
+// maxResponseSize bounds the documents read from a provider.
+const maxResponseSize = 1 << 20
+
+// Config is the registration of this API as a client of an OpenID provider.
+type Config struct {
+	// Name identifies the provider in URLs and in linked identities, e.g. "google".
+	Name string
+	// Issuer is the provider's issuer URL. The discovery document is read from
+	// Issuer + "/.well-known/openid-configuration".
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is the callback registered with the provider. It receives the code and state.
+	RedirectURL string
+	// Scopes are requested in addition to "openid".
+	Scopes []string
+}
+
+// metadata is the part of the discovery document the client uses.
+type metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Provider is a client of one OpenID provider. The discovery document is fetched on first use and
+// cached; the provider's signing keys are fetched again when a token names an unknown key.
+type Provider struct {
+	config Config
+	client *http.Client
+
+	mu       sync.Mutex
+	metadata *metadata
+	keys     *keySet
+}
+
+// NewProvider returns a client for the provider. Requests to the provider are made with client.
+func NewProvider(config Config, client *http.Client) *Provider {
+	config.Issuer = strings.TrimSuffix(config.Issuer, "/")
+	return &Provider{config: config, client: client, keys: &keySet{}}
+}
+
+// Name returns the name the provider is configured under.
+func (p *Provider) Name() string {
+	return p.config.Name
+}
+
+// AuthRequest holds the secrets of one login attempt. State ties the callback to the attempt, Nonce
+// ties the ID token to it, and CodeVerifier proves to the token endpoint that the code is redeemed by
+// the client that asked for it (PKCE, RFC 7636).
+type AuthRequest struct {
+	State        string
+	Nonce        string
+	CodeVerifier string
+}
+
+// NewAuthRequest generates the random values of a login attempt.
+func NewAuthRequest() (AuthRequest, error) {
+	var req AuthRequest
+	for _, value := range []*string{&req.State, &req.Nonce, &req.CodeVerifier} {
+		token, err := utils.GenerateRandomToken(32)
+		if err != nil {
+			return AuthRequest{}, err
+		}
+		*value = token
+	}
+	return req, nil
+}
+
+// CodeChallenge returns the S256 challenge for the code verifier.
+func CodeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// AuthCodeURL returns the URL of the provider's consent page for the login attempt.
+func (p *Provider) AuthCodeURL(ctx context.Context, req AuthRequest) (string, error) {
+	meta, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.config.ClientID},
+		"redirect_uri":          {p.config.RedirectURL},
+		"scope":                 {strings.Join(append([]string{"openid"}, p.config.Scopes...), " ")},
+		"state":                 {req.State},
+		"nonce":                 {req.Nonce},
+		"code_challenge":        {CodeChallenge(req.CodeVerifier)},
+		"code_challenge_method": {"S256"},
+	}
+
+	separator := "?"
+	if strings.Contains(meta.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return meta.AuthorizationEndpoint + separator + query.Encode(), nil
+}
+
+// Exchange redeems an authorization code at the token endpoint and returns the raw ID token.
+// The ID token must still be checked with VerifyIDToken.
+func (p *Provider) Exchange(ctx context.Context, code, codeVerifier string) (string, error) {
+	meta, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.config.RedirectURL},
+		"code_verifier": {codeVerifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, meta.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	// client_secret_basic requires the credentials to be form-encoded before they are joined.
+	req.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to reach token endpoint: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(&body); err != nil {
+		return "", fmt.Errorf("%w: unreadable response (status %d)", ErrExchangeFailed, resp.StatusCode)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%w: %s %s", ErrExchangeFailed, body.Error, body.ErrorDescription)
+	}
+	if body.IDToken == "" {
+		return "", fmt.Errorf("%w: no ID token in response", ErrExchangeFailed)
+	}
+	return body.IDToken, nil
+}
+
+// discover returns the provider's metadata, fetching it on first use.
+func (p *Provider) discover(ctx context.Context) (*metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.metadata != nil {
+		return p.metadata, nil
+	}
+
+	var meta metadata
+	if err := p.getJSON(ctx, p.config.Issuer+"/.well-known/openid-configuration", &meta); err != nil {
+		return nil, fmt.Errorf("failed to discover provider %s: %w", p.config.Name, err)
+	}
+	// The issuer in the document must be the one configured, or ID tokens could be accepted from
+	// whoever serves the document (OpenID Connect Discovery 1.0, section 4.3).
+	if strings.TrimSuffix(meta.Issuer, "/") != p.config.Issuer {
+		return nil, fmt.Errorf("provider %s: discovery document is for issuer %q", p.config.Name, meta.Issuer)
+	}
+	if meta.AuthorizationEndpoint == "" || meta.TokenEndpoint == "" || meta.JWKSURI == "" {
+		return nil, fmt.Errorf("provider %s: discovery document lacks required endpoints", p.config.Name)
+	}
+
+	p.metadata = &meta
+	return p.metadata, nil
+}
+
+// getJSON fetches a JSON document from the provider.
+func (p *Provider) getJSON(ctx context.Context, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: status %d", url, resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(v)
+}
@@ -0,0 +1,156 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"ecommerce-api/oidc/oidctest"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestProvider(t *testing.T) (*Provider, *oidctest.Server) {
+	server := oidctest.NewServer("shop", "s3cret")
+	t.Cleanup(server.Close)
+
+	provider := NewProvider(Config{
+		Name:         "test",
+		Issuer:       server.URL,
+		ClientID:     "shop",
+		ClientSecret: "s3cret",
+		RedirectURL:  "https://shop.example.com/auth/callback",
+		Scopes:       []string{"email", "profile"},
+	}, server.Client())
+	return provider, server
+}
+
+// TestAuthorizationCodeFlow runs a login against the mock provider, from the authorization URL to
+// the verified ID token.
+func TestAuthorizationCodeFlow(t *testing.T) {
+	provider, server := newTestProvider(t)
+	ctx := context.Background()
+
+	req, err := NewAuthRequest()
+	assert.NoError(t, err)
+
+	authURL, err := provider.AuthCodeURL(ctx, req)
+	if assert.NoError(t, err) {
+		parsed, _ := url.Parse(authURL)
+		assert.Equal(t, "openid email profile", parsed.Query().Get("scope"))
+		assert.Equal(t, CodeChallenge(req.CodeVerifier), parsed.Query().Get("code_challenge"))
+		assert.Empty(t, parsed.Query().Get("code_verifier"))
+	}
+
+	code, state, err := server.Authorize(authURL)
+	assert.NoError(t, err)
+	assert.Equal(t, req.State, state)
+
+	rawIDToken, err := provider.Exchange(ctx, code, req.CodeVerifier)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	idToken, err := provider.VerifyIDToken(ctx, rawIDToken, req.Nonce)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "1234567890", idToken.Subject)
+		assert.Equal(t, "jane@example.com", idToken.Email)
+		assert.True(t, idToken.EmailVerified)
+	}
+
+	// The code is single-use.
+	_, err = provider.Exchange(ctx, code, req.CodeVerifier)
+	assert.ErrorIs(t, err, ErrExchangeFailed)
+}
+
+func TestExchangeRequiresCodeVerifier(t *testing.T) {
+	provider, server := newTestProvider(t)
+	ctx := context.Background()
+
+	req, _ := NewAuthRequest()
+	authURL, _ := provider.AuthCodeURL(ctx, req)
+	code, _, err := server.Authorize(authURL)
+	assert.NoError(t, err)
+
+	_, err = provider.Exchange(ctx, code, "intercepted-without-verifier-0000000000000000")
+
+	assert.ErrorIs(t, err, ErrExchangeFailed)
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	user := oidctest.User{Subject: "42", Email: "jane@example.com", EmailVerified: true}
+
+	t.Run("Wrong Nonce", func(t *testing.T) {
+		provider, server := newTestProvider(t)
+		raw := server.SignIDToken(user, "other-login", time.Now().Add(time.Hour))
+
+		_, err := provider.VerifyIDToken(context.Background(), raw, "this-login")
+
+		assert.ErrorIs(t, err, ErrInvalidIDToken)
+	})
+
+	t.Run("Expired", func(t *testing.T) {
+		provider, server := newTestProvider(t)
+		raw := server.SignIDToken(user, "n", time.Now().Add(-time.Minute))
+
+		_, err := provider.VerifyIDToken(context.Background(), raw, "n")
+
+		assert.ErrorIs(t, err, ErrInvalidIDToken)
+	})
+
+	t.Run("Other Audience", func(t *testing.T) {
+		provider, server := newTestProvider(t)
+		server.ClientID = "another-client"
+		raw := server.SignIDToken(user, "n", time.Now().Add(time.Hour))
+
+		_, err := provider.VerifyIDToken(context.Background(), raw, "n")
+
+		assert.ErrorIs(t, err, ErrInvalidIDToken)
+	})
+
+	t.Run("Unknown Key", func(t *testing.T) {
+		provider, server := newTestProvider(t)
+		forger, _ := rsa.GenerateKey(rand.Reader, 2048)
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+			"iss": server.URL, "aud": "shop", "sub": "42", "nonce": "n", "exp": time.Now().Add(time.Hour).Unix(),
+		})
+		token.Header["kid"] = "forged"
+		raw, _ := token.SignedString(forger)
+
+		_, err := provider.VerifyIDToken(context.Background(), raw, "n")
+
+		assert.ErrorIs(t, err, ErrInvalidIDToken)
+	})
+
+	t.Run("Unsigned", func(t *testing.T) {
+		provider, server := newTestProvider(t)
+		token := jwt.NewWithClaims(jwt.SigningMethodNone, jwt.MapClaims{
+			"iss": server.URL, "aud": "shop", "sub": "42", "nonce": "n", "exp": time.Now().Add(time.Hour).Unix(),
+		})
+		raw, _ := token.SignedString(jwt.UnsafeAllowNoneSignatureType)
+
+		_, err := provider.VerifyIDToken(context.Background(), raw, "n")
+
+		assert.ErrorIs(t, err, ErrInvalidIDToken)
+	})
+}
+
+func TestDiscoveryRejectsIssuerMismatch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"issuer":"https://idp.example.com","authorization_endpoint":"https://idp.example.com/authorize","token_endpoint":"https://idp.example.com/token","jwks_uri":"https://idp.example.com/jwks"}`)
+	}))
+	defer server.Close()
+
+	provider := NewProvider(Config{Name: "test", Issuer: server.URL, ClientID: "shop"}, server.Client())
+
+	_, err := provider.AuthCodeURL(context.Background(), AuthRequest{})
+
+	assert.ErrorContains(t, err, "discovery document is for issuer")
+}
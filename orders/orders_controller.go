@@ -1,9 +1,11 @@
 package orders
 
 import (
+	"ecommerce-api/middleware"
 	"ecommerce-api/utils"
 	"ecommerce-api/models"
 	"errors"
+	"io"
 	"net/http"
 	"strconv"
 
@@ -26,16 +28,20 @@ func NewOrderController(orderService *OrderService) *OrderController {
 
 // PlaceOrder godoc
 // @Summary      Place an order
-// @Description  Allows a user to place an order for one or more products
+// @Description  Allows a user to place an order for one or more products. Each line names a variant (variantID), which may be omitted for a product
+// @Description  with a single variant. When REQUIRE_VERIFIED_EMAIL is enabled, the user must have verified their email.
 // @Tags         orders
 // @Accept       json
 // @Produce      json
 // @Param        products  body      PlaceOrderDTO   true  "List of products to order"
 // @Success      201       {object}  utils.APIResponse{data=models.Order}
 // @Failure      400       {object}  utils.APIResponse
+// @Failure      403       {object}  utils.APIResponse
 // @Failure      404       {object}  utils.APIResponse
+// @Failure      409       {object}  utils.APIResponse{data=[]StockShortage}
 // @Failure      500       {object}  utils.APIResponse
 // @Security     BearerAuth
+// @Security     ApiKeyAuth
 // @Router       /orders [post]
 func (c *OrderController) PlaceOrder(ctx *gin.Context) {
 	var input PlaceOrderDTO
@@ -55,9 +61,18 @@ func (c *OrderController) PlaceOrder(ctx *gin.Context) {
 	}
 	order, err := c.orderService.PlaceOrder(uint(userID), input.Products)
 	if err != nil {
+		var stockErr *InsufficientStockError
 		switch {
+		case errors.As(err, &stockErr):
+			utils.NewAPIResponse(http.StatusConflict, "Insufficient stock", stockErr.Lines, stockErr.Error()).Send(ctx)
 		case errors.Is(err, gorm.ErrRecordNotFound):
-			utils.NewAPIResponse(http.StatusNotFound, "One or more products do not exist", nil, "").Send(ctx)
+			utils.NewAPIResponse(http.StatusNotFound, "One or more products or variants do not exist", nil, "").Send(ctx)
+		case errors.Is(err, ErrMixedCurrency):
+			utils.NewAPIResponse(http.StatusBadRequest, "Products must share a currency", nil, err.Error()).Send(ctx)
+		case errors.Is(err, ErrVariantRequired):
+			utils.NewAPIResponse(http.StatusBadRequest, "A variant must be chosen", nil, err.Error()).Send(ctx)
+		case errors.Is(err, ErrEmailNotVerified):
+			utils.NewAPIResponse(http.StatusForbidden, "Email not verified", nil, err.Error()).Send(ctx)
 		default:
 			utils.NewAPIResponse(http.StatusInternalServerError, "Failed to place order", nil, err.Error()).Send(ctx)
 		}
@@ -69,12 +84,14 @@ func (c *OrderController) PlaceOrder(ctx *gin.Context) {
 
 // ListOrders godoc
 // @Summary      List user's orders
-// @Description  Allows a user to view their orders
+// @Description  Allows a user to view their orders, newest first, each with its line items and totals
 // @Tags         orders
 // @Produce      json
-// @Success      200  {object}  utils.APIResponse{data=[]models.Order}
+// @Success      200  {object}  utils.APIResponse{data=[]OrderDetail}
+// @Failure      404  {object}  utils.APIResponse
 // @Failure      500  {object}  utils.APIResponse
 // @Security     BearerAuth
+// @Security     ApiKeyAuth
 // @Router       /orders [get]
 func (c *OrderController) ListOrders(ctx *gin.Context) {
 	// Get user ID from context
@@ -101,15 +118,70 @@ func (c *OrderController) ListOrders(ctx *gin.Context) {
 	utils.NewAPIResponse(http.StatusOK, "Orders retrieved successfully", orders, "").Send(ctx)
 }
 
+// GetOrder godoc
+// @Summary      Get an order
+// @Description  Returns a single order with its line items and totals. Users can see their own orders; staff with the orders:read permission can see any order.
+// @Tags         orders
+// @Produce      json
+// @Param        id   path      string  true  "Order ID"
+// @Success      200  {object}  utils.APIResponse{data=OrderDetail}
+// @Failure      400  {object}  utils.APIResponse
+// @Failure      404  {object}  utils.APIResponse
+// @Failure      500  {object}  utils.APIResponse
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Router       /orders/{id} [get]
+func (c *OrderController) GetOrder(ctx *gin.Context) {
+	orderID, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
+	if err != nil {
+		utils.NewAPIResponse(http.StatusBadRequest, "Invalid order ID", nil, err.Error()).Send(ctx)
+		return
+	}
+
+	userIDStr, exists := ctx.Get("userID")
+	if !exists {
+		utils.NewAPIResponse(http.StatusUnauthorized, "Unauthorized", nil, "User ID not found in context").Send(ctx)
+		return
+	}
+
+	userID, err := strconv.ParseUint(userIDStr.(string), 10, 32)
+	if err != nil {
+		utils.NewAPIResponse(http.StatusBadRequest, "Invalid User ID", nil, "User ID conversion failed").Send(ctx)
+		return
+	}
+
+	canReadAll, err := middleware.HasPermission(ctx, models.PermOrdersRead)
+	if err != nil {
+		utils.NewAPIResponse(http.StatusInternalServerError, "Failed to retrieve user", nil, err.Error()).Send(ctx)
+		return
+	}
+
+	order, err := c.orderService.GetOrder(uint(orderID), uint(userID), canReadAll)
+	if err != nil {
+		if err.Error() == "order not found" {
+			utils.NewAPIResponse(http.StatusNotFound, "Order not found", nil, "").Send(ctx)
+		} else {
+			utils.NewAPIResponse(http.StatusInternalServerError, "Failed to retrieve order", nil, err.Error()).Send(ctx)
+		}
+		return
+	}
+
+	utils.NewAPIResponse(http.StatusOK, "Order retrieved successfully", order, "").Send(ctx)
+}
+
 // CancelOrder godoc
 // @Summary      Cancel an order
-// @Description  Allows a user to cancel a pending order
+// @Description  Allows a user to cancel an order that has not shipped yet
 // @Tags         orders
-// @Param        id   path      string  true  "Order ID"
+// @Accept       json
+// @Param        id      path      string          true   "Order ID"
+// @Param        reason  body      CancelOrderDTO  false  "Optional cancellation reason"
 // @Success      200  {object}  utils.APIResponse
 // @Failure      400  {object}  utils.APIResponse
 // @Failure      404  {object}  utils.APIResponse
+// @Failure      409  {object}  utils.APIResponse{data=models.TransitionError}
 // @Security     BearerAuth
+// @Security     ApiKeyAuth
 // @Router       /orders/{id}/cancel [put]
 func (c *OrderController) CancelOrder(ctx *gin.Context) {
 	orderID, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
@@ -130,13 +202,21 @@ func (c *OrderController) CancelOrder(ctx *gin.Context) {
 		return
 	}
 
-	err = c.orderService.CancelOrder(uint(orderID), uint(userID))
+	// The body is optional; an empty request cancels without a reason.
+	var input CancelOrderDTO
+	if err := ctx.ShouldBindJSON(&input); err != nil && !errors.Is(err, io.EOF) {
+		utils.NewAPIResponse(http.StatusBadRequest, "Invalid input", nil, err.Error()).Send(ctx)
+		return
+	}
+
+	err = c.orderService.CancelOrder(uint(orderID), uint(userID), input.Reason)
 	if err != nil {
-		switch err.Error() {
-		case "order not found":
+		var transitionErr *models.TransitionError
+		switch {
+		case err.Error() == "order not found":
 			utils.NewAPIResponse(http.StatusNotFound, "Order not found", nil, "").Send(ctx)
-		case "order is not eligible for cancellation":
-			utils.NewAPIResponse(http.StatusBadRequest, "Order cannot be canceled", nil, "Order status must be 'Pending' to cancel").Send(ctx)
+		case errors.As(err, &transitionErr):
+			utils.NewAPIResponse(http.StatusConflict, "Order cannot be canceled", transitionErr, transitionErr.Error()).Send(ctx)
 		default:
 			utils.NewAPIResponse(http.StatusInternalServerError, "Failed to cancel order", nil, err.Error()).Send(ctx)
 		}
@@ -149,20 +229,24 @@ func (c *OrderController) CancelOrder(ctx *gin.Context) {
 
 // UpdateOrderStatus godoc
 // @Summary      Update an order status
-// @Description  Admin only: Updates the status of an order. The valid statuses are:
+// @Description  Requires the orders:status permission. Updates the status of an order. The valid statuses are:
 //               - pending: The order is newly created and awaiting processing.
 //               - processing: The order is being processed.
 //               - shipped: The order has been shipped to the customer.
 //               - delivered: The order has been delivered to the customer.
 //               - cancelled: The order was cancelled and will not be fulfilled.
+//               Orders move pending -> processing -> shipped -> delivered, and can be cancelled only before they ship.
+//               Any other change is rejected with 409 and the list of allowed next statuses.
 // @Tags         orders
 // @Param        id      path      string               true  "Order ID"
 // @Param        status  body      UpdateOrderStatusDTO true  "New order status. Allowed values are 'pending', 'processing', 'shipped', 'delivered', 'cancelled'"
 // @Success      200     {object}  utils.APIResponse{data=models.Order}
 // @Failure      400     {object}  utils.APIResponse
 // @Failure      404     {object}  utils.APIResponse
+// @Failure      409     {object}  utils.APIResponse{data=models.TransitionError}
 // @Failure      500     {object}  utils.APIResponse
 // @Security     BearerAuth
+// @Security     ApiKeyAuth
 // @Router       /orders/{id}/status [put]
 
 func (c *OrderController) UpdateOrderStatus(ctx *gin.Context) {
@@ -186,9 +270,24 @@ func (c *OrderController) UpdateOrderStatus(ctx *gin.Context) {
 		return
 	}
 
-	order, err := c.orderService.UpdateOrderStatus(uint(orderID), input.Status)
+	userIDStr, exists := ctx.Get("userID")
+	if !exists {
+		utils.NewAPIResponse(http.StatusUnauthorized, "Unauthorized", nil, "User ID not found in context").Send(ctx)
+		return
+	}
+
+	userID, err := strconv.ParseUint(userIDStr.(string), 10, 32)
 	if err != nil {
-		if err.Error() == "order not found" {
+		utils.NewAPIResponse(http.StatusBadRequest, "Invalid User ID", nil, "User ID conversion failed").Send(ctx)
+		return
+	}
+
+	order, err := c.orderService.UpdateOrderStatus(uint(orderID), uint(userID), input.Status, input.Reason)
+	if err != nil {
+		var transitionErr *models.TransitionError
+		if errors.As(err, &transitionErr) {
+			utils.NewAPIResponse(http.StatusConflict, "Invalid order status transition", transitionErr, transitionErr.Error()).Send(ctx)
+		} else if err.Error() == "order not found" {
 			utils.NewAPIResponse(http.StatusNotFound, err.Error(), nil, "").Send(ctx)
 		} else {
 			utils.NewAPIResponse(http.StatusInternalServerError, "Failed to update order status", nil, err.Error()).Send(ctx)
@@ -198,3 +297,55 @@ func (c *OrderController) UpdateOrderStatus(ctx *gin.Context) {
 
 	utils.NewAPIResponse(http.StatusOK, "Order status updated successfully", order, "").Send(ctx)
 }
+
+// OrderHistory godoc
+// @Summary      Get an order's status history
+// @Description  Returns every status change of an order, oldest first, with the user who made it and the reason.
+// @Description  Available to the order's owner and to staff with the orders:read permission.
+// @Tags         orders
+// @Produce      json
+// @Param        id   path      string  true  "Order ID"
+// @Success      200  {object}  utils.APIResponse{data=[]models.OrderStatusEvent}
+// @Failure      400  {object}  utils.APIResponse
+// @Failure      404  {object}  utils.APIResponse
+// @Failure      500  {object}  utils.APIResponse
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Router       /orders/{id}/history [get]
+func (c *OrderController) OrderHistory(ctx *gin.Context) {
+	orderID, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
+	if err != nil {
+		utils.NewAPIResponse(http.StatusBadRequest, "Invalid order ID", nil, err.Error()).Send(ctx)
+		return
+	}
+
+	userIDStr, exists := ctx.Get("userID")
+	if !exists {
+		utils.NewAPIResponse(http.StatusUnauthorized, "Unauthorized", nil, "User ID not found in context").Send(ctx)
+		return
+	}
+
+	userID, err := strconv.ParseUint(userIDStr.(string), 10, 32)
+	if err != nil {
+		utils.NewAPIResponse(http.StatusBadRequest, "Invalid User ID", nil, "User ID conversion failed").Send(ctx)
+		return
+	}
+
+	canReadAll, err := middleware.HasPermission(ctx, models.PermOrdersRead)
+	if err != nil {
+		utils.NewAPIResponse(http.StatusInternalServerError, "Failed to retrieve user", nil, err.Error()).Send(ctx)
+		return
+	}
+
+	events, err := c.orderService.OrderHistory(uint(orderID), uint(userID), canReadAll)
+	if err != nil {
+		if err.Error() == "order not found" {
+			utils.NewAPIResponse(http.StatusNotFound, "Order not found", nil, "").Send(ctx)
+		} else {
+			utils.NewAPIResponse(http.StatusInternalServerError, "Failed to retrieve order history", nil, err.Error()).Send(ctx)
+		}
+		return
+	}
+
+	utils.NewAPIResponse(http.StatusOK, "Order history retrieved successfully", events, "").Send(ctx)
+}
@@ -2,26 +2,78 @@ package orders
 
 import (
 	"ecommerce-api/models"
+	"time"
 )
 
+// ProductOrder is a line of an order. VariantID may be omitted for a product with a single variant.
 type ProductOrder struct {
 	ProductID uint `json:"productID" binding:"required,gt=0"` 
+	VariantID uint `json:"variantID" binding:"omitempty,gt=0"`
 	Quantity  int  `json:"quantity" binding:"required,gte=1"`
 }
 
 type PlaceOrderDTO struct {
-	Products []ProductOrder `json:"products"`
+	Products []ProductOrder `json:"products" binding:"required,min=1,dive"`
 }
 
 type UpdateOrderStatusDTO struct {
 	Status models.OrderStatus `json:"status" binding:"required,orderStatus"`
+	Reason string             `json:"reason" binding:"max=500"`
 }
 
-type OrderSummary struct {
-	ID           uint    `json:"id"`
-	ProductName  string  `json:"product_name"`
-	Description  string  `json:"description"`
-	ProductPrice float64 `json:"product_price"`
-	Quantity     int     `json:"quantity"`
-	TotalPrice   float64 `json:"total_price"`
+type CancelOrderDTO struct {
+	Reason string `json:"reason" binding:"max=500"`
+}
+
+// OrderLine is a line item of an OrderDetail, priced as it was when the order was placed.
+type OrderLine struct {
+	ProductID    uint   `json:"product_id"`
+	VariantID    uint   `json:"variant_id"`
+	ProductName  string `json:"product_name"`
+	SKU          string `json:"sku"`
+	VariantTitle string `json:"variant_title"`
+	UnitPrice    int64  `json:"unit_price"`
+	Quantity     int    `json:"quantity"`
+	LineTotal    int64  `json:"line_total"`
+}
+
+// OrderDetail is an order as returned to clients, with its line items nested under it.
+type OrderDetail struct {
+	ID        uint               `json:"id"`
+	UserID    uint               `json:"user_id"`
+	Status    models.OrderStatus `json:"status"`
+	Currency  string             `json:"currency"`
+	Items     []OrderLine        `json:"items"`
+	Subtotal  int64              `json:"subtotal"`
+	Total     int64              `json:"total"`
+	CreatedAt time.Time          `json:"created_at"`
+	UpdatedAt time.Time          `json:"updated_at"`
+}
+
+func newOrderDetail(order models.Order) OrderDetail {
+	items := make([]OrderLine, len(order.Items))
+	for i, item := range order.Items {
+		items[i] = OrderLine{
+			ProductID:    item.ProductID,
+			VariantID:    item.VariantID,
+			ProductName:  item.ProductName,
+			SKU:          item.SKU,
+			VariantTitle: item.VariantTitle,
+			UnitPrice:    item.UnitPrice,
+			Quantity:     item.Quantity,
+			LineTotal:    item.LineTotal,
+		}
+	}
+
+	return OrderDetail{
+		ID:        order.ID,
+		UserID:    order.UserID,
+		Status:    order.Status,
+		Currency:  order.Currency,
+		Items:     items,
+		Subtotal:  order.Subtotal,
+		Total:     order.Total,
+		CreatedAt: order.CreatedAt,
+		UpdatedAt: order.UpdatedAt,
+	}
 }
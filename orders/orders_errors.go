@@ -0,0 +1,38 @@
+package orders
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrMixedCurrency is returned when an order contains products priced in different currencies.
+var ErrMixedCurrency = errors.New("all products in an order must be priced in the same currency")
+
+// ErrEmailNotVerified is returned when REQUIRE_VERIFIED_EMAIL is enabled and an unverified user places an order.
+var ErrEmailNotVerified = errors.New("email address must be verified before placing orders")
+
+// ErrVariantRequired is returned when an order line omits the variant of a product that has more than one.
+var ErrVariantRequired = errors.New("a variant must be chosen for a product with several variants")
+
+// StockShortage describes a single order line that cannot be fulfilled from current stock.
+type StockShortage struct {
+	ProductID uint `json:"product_id"`
+	VariantID uint `json:"variant_id"`
+	Requested int  `json:"requested"`
+	Available int  `json:"available"`
+}
+
+// InsufficientStockError is returned when one or more order lines ask for more units than are in stock.
+// Lines lists every offending line so clients can correct the whole order in one round trip.
+type InsufficientStockError struct {
+	Lines []StockShortage
+}
+
+func (e *InsufficientStockError) Error() string {
+	messages := make([]string, len(e.Lines))
+	for i, line := range e.Lines {
+		messages[i] = fmt.Sprintf("insufficient stock for product %d variant %d: requested %d, available %d", line.ProductID, line.VariantID, line.Requested, line.Available)
+	}
+	return strings.Join(messages, "; ")
+}
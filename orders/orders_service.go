@@ -1,153 +1,455 @@
 package orders
 
 import (
+	"ecommerce-api/config"
 	"ecommerce-api/models"
 	"errors"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type OrderService struct {
 	db *gorm.DB
+	// requireVerifiedEmail blocks orders from users who have not verified their email.
+	requireVerifiedEmail bool
 }
 
-func NewOrderService(db *gorm.DB) *OrderService { return &OrderService{db: db} }
+// NewOrderService initializes OrderService with database connection, applying the
+// REQUIRE_VERIFIED_EMAIL policy from the loaded configuration.
+func NewOrderService(db *gorm.DB) *OrderService {
+	return &OrderService{db: db, requireVerifiedEmail: config.CONFIG != nil && config.CONFIG.REQUIRE_VERIFIED_EMAIL}
+}
 
 // PlaceOrder creates a new order for the specified user and products.
 //
 // userID: The unique identifier of the user placing the order.
-// products: A slice of ProductOrder structs representing the products to be included in the order.
+// products: A slice of ProductOrder structs representing the product variants to be included in the order.
+// A line may omit the variant of a product that has a single variant.
 //
 // The function returns a pointer to the created Order struct and an error if any occurred during the process.
-// If the products in the order are not found or if there's an issue with the database, an error will be returned.
+// If the products or variants in the order are not found or if there's an issue with the database, an error will be returned.
+// If a line omits the variant of a product with several variants, ErrVariantRequired is returned.
+// If any line asks for more units than are in stock, an *InsufficientStockError listing every such line is returned.
+//
+// If the products are priced in different currencies, ErrMixedCurrency is returned.
+// If REQUIRE_VERIFIED_EMAIL is enabled and the user has not verified their email, ErrEmailNotVerified is returned.
 //
-// The function performs the following steps:
-// 1. Extracts the product IDs from the input products slice.
-// 2. Validates the products by querying the database for the specified product IDs.
-// 3. Creates a new Order struct with the provided user ID and a pending status.
-// 4. Inserts the new order into the database.
-// 5. Creates OrderProduct associations for each product in the order.
-// 6. Retrieves the created order with its associated products from the database.
+// The function performs the following steps inside a single database transaction:
+//  1. Merges repeated products and variants into one line per variant.
+//  2. Locks the affected product and variant rows, checks each line against the variant's stock and decrements it.
+//  3. Creates a new Order struct with the provided user ID, a pending status and the order totals.
+//  4. Creates OrderProduct associations for each variant, snapshotting the product name, SKU, variant title,
+//     unit price and currency.
+//  5. Records the initial pending status in the order's status history.
 //
-// If any error occurs during the process, the function returns nil for the Order pointer and an error describing the issue.
+// Finally it retrieves the created order with its associated products from the database.
+// If any error occurs during the process, the transaction is rolled back and the function returns nil
+// for the Order pointer and an error describing the issue.
 func (s *OrderService) PlaceOrder(userID uint, products []ProductOrder) (*models.Order, error) {
-	productIDs := make([]uint, len(products))
-	for i, item := range products {
-		productIDs[i] = item.ProductID
+	lines := mergeOrderLines(products)
+
+	var order models.Order
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if s.requireVerifiedEmail {
+			if err := checkEmailVerified(tx, userID); err != nil {
+				return err
+			}
+		}
+
+		reserved, err := reserveStock(tx, lines)
+		if err != nil {
+			return err
+		}
+
+		orderProducts := make([]models.OrderProduct, len(reserved))
+		var subtotal int64
+		for i, line := range reserved {
+			if line.product.Currency != reserved[0].product.Currency {
+				return ErrMixedCurrency
+			}
+			unitPrice := line.variant.UnitPrice(line.product)
+			orderProducts[i] = models.OrderProduct{
+				ProductID:    line.product.ID,
+				VariantID:    line.variant.ID,
+				ProductName:  line.product.Name,
+				VariantTitle: line.variant.Title,
+				UnitPrice:    unitPrice,
+				Currency:     line.product.Currency,
+				Quantity:     line.quantity,
+				LineTotal:    unitPrice * int64(line.quantity),
+			}
+			if line.variant.SKU != nil {
+				orderProducts[i].SKU = *line.variant.SKU
+			}
+			subtotal += orderProducts[i].LineTotal
+		}
+
+		order = models.Order{
+			UserID:   userID,
+			Status:   models.OrderStatusPending,
+			Currency: orderProducts[0].Currency,
+			Subtotal: subtotal,
+			// Nothing is charged on top of the goods yet, so the total is the subtotal.
+			Total: subtotal,
+		}
+		if err := tx.Create(&order).Error; err != nil {
+			return errors.New("failed to create order: " + err.Error())
+		}
+
+		for i := range orderProducts {
+			orderProducts[i].OrderID = order.ID
+		}
+
+		if err := tx.CreateInBatches(&orderProducts, len(orderProducts)).Error; err != nil {
+			return errors.New("failed to create order-product associations")
+		}
+
+		return recordStatusEvent(tx, order.ID, "", models.OrderStatusPending, userID, "order placed")
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.db.Preload("Items").First(&order, order.ID).Error; err != nil {
+		return nil, errors.New("failed to retrieve order with products")
+	}
+
+	return &order, nil
+}
+
+// mergeOrderLines collapses repeated product and variant IDs into a single line, keeping the order in
+// which each first appeared.
+func mergeOrderLines(products []ProductOrder) []ProductOrder {
+	type key struct{ productID, variantID uint }
+	index := make(map[key]int, len(products))
+	lines := make([]ProductOrder, 0, len(products))
+	for _, item := range products {
+		k := key{item.ProductID, item.VariantID}
+		if i, seen := index[k]; seen {
+			lines[i].Quantity += item.Quantity
+			continue
+		}
+		index[k] = len(lines)
+		lines = append(lines, item)
+	}
+	return lines
+}
+
+// checkEmailVerified returns ErrEmailNotVerified unless the user has verified their email.
+func checkEmailVerified(tx *gorm.DB, userID uint) error {
+	var user models.User
+	if err := tx.Select("id", "verified_at").Take(&user, userID).Error; err != nil {
+		return errors.New("failed to retrieve user: " + err.Error())
+	}
+	if user.VerifiedAt == nil {
+		return ErrEmailNotVerified
+	}
+	return nil
+}
+
+// reservedLine is an order line resolved to the locked product and variant it is for.
+type reservedLine struct {
+	product  models.Product
+	variant  models.ProductVariant
+	quantity int
+}
+
+// reserveStock locks the products and variants referenced by lines, decrements the variants' stock and
+// the products' total stock, and returns one line per variant in the order the variants first appear.
+//
+// Product rows are locked with SELECT ... FOR UPDATE in primary key order, then their variants, so
+// concurrent orders for the same products serialise instead of overselling or deadlocking. It must be
+// called inside a transaction.
+//
+// It returns gorm.ErrRecordNotFound if any product or variant does not exist, ErrVariantRequired if a
+// line omits the variant of a product with several, and an *InsufficientStockError if any variant has
+// less stock than ordered; in all cases no stock is changed.
+func reserveStock(tx *gorm.DB, lines []ProductOrder) ([]reservedLine, error) {
+	productIDs := make([]uint, 0, len(lines))
+	seen := make(map[uint]bool, len(lines))
+	for _, line := range lines {
+		if !seen[line.ProductID] {
+			seen[line.ProductID] = true
+			productIDs = append(productIDs, line.ProductID)
+		}
 	}
 
 	var dbProducts []models.Product
-	if err := s.db.Where("id IN ?", productIDs).Find(&dbProducts).Error; err != nil {
+	if err := tx.Clauses(clause.Locking{Strength: clause.LockingStrengthUpdate}).
+		Where("id IN ?", productIDs).
+		Order("id").
+		Find(&dbProducts).Error; err != nil {
 		return nil, errors.New("failed to validate products: " + err.Error())
 	}
 
-	if len(dbProducts) != len(products) {
+	if len(dbProducts) != len(productIDs) {
 		return nil, gorm.ErrRecordNotFound
 	}
 
-	order := models.Order{UserID: userID, Status: models.OrderStatusPending}
-	if err := s.db.Create(&order).Error; err != nil {
-		return nil, errors.New("failed to create order: " + err.Error())
+	byID := make(map[uint]models.Product, len(dbProducts))
+	for _, product := range dbProducts {
+		byID[product.ID] = product
+	}
+
+	var variants []models.ProductVariant
+	if err := tx.Clauses(clause.Locking{Strength: clause.LockingStrengthUpdate}).
+		Where("product_id IN ?", productIDs).
+		Order("id").
+		Find(&variants).Error; err != nil {
+		return nil, errors.New("failed to validate variants: " + err.Error())
 	}
 
-	orderProducts := make([]models.OrderProduct, len(products))
-	for i, item := range products {
-		orderProducts[i] = models.OrderProduct{
-			OrderID:   order.ID,
-			ProductID: item.ProductID,
-			Quantity:  item.Quantity,
+	variantsByID := make(map[uint]models.ProductVariant, len(variants))
+	variantsByProduct := make(map[uint][]models.ProductVariant, len(productIDs))
+	for _, variant := range variants {
+		variantsByID[variant.ID] = variant
+		variantsByProduct[variant.ProductID] = append(variantsByProduct[variant.ProductID], variant)
+	}
+
+	reserved := make([]reservedLine, 0, len(lines))
+	index := make(map[uint]int, len(lines))
+	for _, line := range lines {
+		variant, err := lineVariant(line, variantsByID, variantsByProduct)
+		if err != nil {
+			return nil, err
+		}
+		if i, seen := index[variant.ID]; seen {
+			reserved[i].quantity += line.Quantity
+			continue
 		}
+		index[variant.ID] = len(reserved)
+		reserved = append(reserved, reservedLine{product: byID[line.ProductID], variant: variant, quantity: line.Quantity})
 	}
 
-	if err := s.db.CreateInBatches(&orderProducts, len(orderProducts)).Error; err != nil {
-		return nil, errors.New("failed to create order-product associations")
+	var shortages []StockShortage
+	for _, line := range reserved {
+		if available := line.variant.Stock; line.quantity > available {
+			shortages = append(shortages, StockShortage{
+				ProductID: line.product.ID,
+				VariantID: line.variant.ID,
+				Requested: line.quantity,
+				Available: available,
+			})
+		}
+	}
+	if len(shortages) > 0 {
+		return nil, &InsufficientStockError{Lines: shortages}
 	}
 
-	if err := s.db.Preload("Products").First(&order, order.ID).Error; err != nil {
-		return nil, errors.New("failed to retrieve order with products")
+	for _, line := range reserved {
+		if err := tx.Model(&models.ProductVariant{}).
+			Where("id = ?", line.variant.ID).
+			UpdateColumn("stock", gorm.Expr("stock - ?", line.quantity)).Error; err != nil {
+			return nil, errors.New("failed to update variant stock: " + err.Error())
+		}
+		if err := tx.Model(&models.Product{}).
+			Where("id = ?", line.product.ID).
+			UpdateColumn("stock", gorm.Expr("stock - ?", line.quantity)).Error; err != nil {
+			return nil, errors.New("failed to update product stock: " + err.Error())
+		}
 	}
+	return reserved, nil
+}
 
-	return &order, nil
+// lineVariant returns the variant an order line is for. A line without a variant is for the product's
+// only variant.
+func lineVariant(line ProductOrder, byID map[uint]models.ProductVariant, byProduct map[uint][]models.ProductVariant) (models.ProductVariant, error) {
+	if line.VariantID != 0 {
+		variant, ok := byID[line.VariantID]
+		if !ok || variant.ProductID != line.ProductID {
+			return models.ProductVariant{}, gorm.ErrRecordNotFound
+		}
+		return variant, nil
+	}
+
+	switch variants := byProduct[line.ProductID]; len(variants) {
+	case 0:
+		return models.ProductVariant{}, gorm.ErrRecordNotFound
+	case 1:
+		return variants[0], nil
+	default:
+		return models.ProductVariant{}, ErrVariantRequired
+	}
 }
 
+// releaseStock returns the quantities held by an order's line items to the stock of their variants.
+// It must be called inside a transaction.
+func releaseStock(tx *gorm.DB, orderID uint) error {
+	lines, err := orderLines(tx, orderID)
+	if err != nil {
+		return err
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+
+	// Products are locked before their variants, as in reserveStock, so the two cannot deadlock. Deleted
+	// products get their stock back too, so it is right if they are restored.
+	productIDs := make([]uint, len(lines))
+	for i, line := range lines {
+		productIDs[i] = line.ProductID
+	}
+	var locked []models.Product
+	if err := tx.Unscoped().Clauses(clause.Locking{Strength: clause.LockingStrengthUpdate}).
+		Select("id").
+		Where("id IN ?", productIDs).
+		Order("id").
+		Find(&locked).Error; err != nil {
+		return errors.New("failed to lock products: " + err.Error())
+	}
 
-// ListOrders retrieves all orders for a specific user.
+	for _, line := range lines {
+		result := tx.Model(&models.ProductVariant{}).
+			Where("id = ?", line.VariantID).
+			UpdateColumn("stock", gorm.Expr("stock + ?", line.Quantity))
+		if result.Error != nil {
+			return errors.New("failed to restore variant stock: " + result.Error.Error())
+		}
+		// A variant deleted since the order was placed has no stock to return to.
+		if result.RowsAffected == 0 {
+			continue
+		}
+		if err := tx.Unscoped().Model(&models.Product{}).
+			Where("id = ?", line.ProductID).
+			UpdateColumn("stock", gorm.Expr("stock + ?", line.Quantity)).Error; err != nil {
+			return errors.New("failed to restore product stock: " + err.Error())
+		}
+	}
+	return nil
+}
+
+// orderLines loads an order's line items in the shape expected by releaseStock.
+func orderLines(tx *gorm.DB, orderID uint) ([]ProductOrder, error) {
+	var items []models.OrderProduct
+	if err := tx.Where("order_id = ?", orderID).Order("product_id, variant_id").Find(&items).Error; err != nil {
+		return nil, errors.New("failed to retrieve order products: " + err.Error())
+	}
+
+	lines := make([]ProductOrder, len(items))
+	for i, item := range items {
+		lines[i] = ProductOrder{ProductID: item.ProductID, VariantID: item.VariantID, Quantity: item.Quantity}
+	}
+	return lines, nil
+}
+
+// ListOrders retrieves all orders for a specific user, newest first.
 //
 // userID: The unique identifier of the user whose orders are to be retrieved.
 //
-// The function returns a slice of OrderSummary structs and an error if any occurred during the process.
+// The function returns a slice of OrderDetail structs and an error if any occurred during the process.
+// Each order carries its line items and totals as they were captured when the order was placed,
+// so later product edits do not change historical orders.
 // If no orders are found for the specified user, the function returns nil for the slice and gorm.ErrRecordNotFound.
 // If there's an issue with the database, an error will be returned.
-//
-// The function performs the following steps:
-// 1. Initializes an empty slice of OrderSummary structs.
-// 2. Executes a database query to retrieve order details, including product information and total prices.
-// 3. Checks for any errors during the query execution.
-// 4. If no errors occur, checks if any orders were found for the specified user.
-// 5. Returns the slice of OrderSummary structs and nil for the error if orders were found.
-// 6. Returns nil for the slice and gorm.ErrRecordNotFound if no orders were found.
-// 7. Returns nil for the slice and an error if any other database error occurs.
-func (s *OrderService) ListOrders(userID uint) ([]OrderSummary, error) {
-	var orderSummaries []OrderSummary
+func (s *OrderService) ListOrders(userID uint) ([]OrderDetail, error) {
+	var orders []models.Order
 	err := s.db.
-		Model(&models.Order{}).
-		Select("orders.id as id, products.name as product_name, products.description as description, products.price as product_price, order_products.quantity as quantity, sum(order_products.quantity * products.price) as total_price").
-		Joins("JOIN order_products ON orders.id = order_products.order_id").
-		Joins("JOIN products ON products.id = order_products.product_id").
-		Where("orders.user_id = ?", userID).
-		Group("orders.id, products.name, products.description, products.price, order_products.quantity").
-		Find(&orderSummaries).Error
+		Preload("Items", func(db *gorm.DB) *gorm.DB { return db.Order("product_id, variant_id") }).
+		Where("user_id = ?", userID).
+		Order("created_at DESC, id DESC").
+		Find(&orders).Error
 	if err != nil {
 		return nil, errors.New("failed to retrieve orders: " + err.Error())
 	}
-	if len(orderSummaries) == 0 {
+	if len(orders) == 0 {
 		return nil, gorm.ErrRecordNotFound
 	}
 
-	return orderSummaries, nil
+	details := make([]OrderDetail, len(orders))
+	for i, order := range orders {
+		details[i] = newOrderDetail(order)
+	}
+	return details, nil
 }
 
+// GetOrder retrieves a single order with its line items.
+//
+// Parameters:
+// - orderID: The unique identifier of the order to be retrieved.
+// - userID: The unique identifier of the user requesting the order.
+// - canReadAll: Whether the requesting user may see any order.
+//
+// Return:
+//   - A pointer to the OrderDetail if the order exists and is visible to the user.
+//   - An error with the message "order not found" if the order does not exist or belongs to another user
+//     and the requester may not read all orders.
+func (s *OrderService) GetOrder(orderID, userID uint, canReadAll bool) (*OrderDetail, error) {
+	var order models.Order
+	err := s.db.
+		Preload("Items", func(db *gorm.DB) *gorm.DB { return db.Order("product_id, variant_id") }).
+		First(&order, orderID).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("order not found")
+		}
+		return nil, errors.New("failed to retrieve order: " + err.Error())
+	}
+
+	if order.UserID != userID && !canReadAll {
+		return nil, errors.New("order not found")
+	}
+
+	detail := newOrderDetail(order)
+	return &detail, nil
+}
 
-// CancelOrder cancels a pending order if it belongs to the user.
+// CancelOrder cancels an order that has not shipped yet if it belongs to the user and returns its units to stock.
 //
 // Parameters:
 // - orderID: The unique identifier of the order to be cancelled.
 // - userID: The unique identifier of the user who is attempting to cancel the order.
+// - reason: An optional explanation recorded in the order's status history.
 //
 // Return:
 // - An error if any occurred during the cancellation process.
 //   - Returns nil if the order was successfully cancelled.
 //   - Returns an error with the message "order not found" if the order could not be found.
 //   - Returns an error with the message "failed to retrieve order: <error details>" if there was an issue retrieving the order from the database.
-//   - Returns an error with the message "order is not eligible for cancellation" if the order is not in a pending status.
+//   - Returns a *models.TransitionError if the order lifecycle does not allow cancelling the order in its current status.
 //   - Returns an error with the message "failed to cancel order: <error details>" if there was an issue updating the order status in the database.
-func (s *OrderService) CancelOrder(orderID, userID uint) error {
-	var order models.Order
+//
+// The order row is locked for the duration of the transaction so a concurrent cancellation cannot restock twice.
+func (s *OrderService) CancelOrder(orderID, userID uint, reason string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var order models.Order
 
-	if err := s.db.Where("id = ? AND user_id = ?", orderID, userID).First(&order).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return errors.New("order not found")
+		if err := tx.Clauses(clause.Locking{Strength: clause.LockingStrengthUpdate}).
+			Where("id = ? AND user_id = ?", orderID, userID).
+			First(&order).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errors.New("order not found")
+			}
+			return errors.New("failed to retrieve order: " + err.Error())
 		}
-		return errors.New("failed to retrieve order: " + err.Error())
-	}
 
-	if order.Status != models.OrderStatusPending {
-		return errors.New("order is not eligible for cancellation")
-	}
+		if err := order.Status.ValidateTransition(models.OrderStatusCancelled); err != nil {
+			return err
+		}
 
-	if err := s.db.Model(&order).Update("status", models.OrderStatusCancelled).Error; err != nil {
-		return errors.New("failed to cancel order: " + err.Error())
-	}
+		previous := order.Status
+		if err := tx.Model(&order).Update("status", models.OrderStatusCancelled).Error; err != nil {
+			return errors.New("failed to cancel order: " + err.Error())
+		}
 
-	return nil
-}
+		if reason == "" {
+			reason = "cancelled by customer"
+		}
+		if err := recordStatusEvent(tx, order.ID, previous, models.OrderStatusCancelled, userID, reason); err != nil {
+			return err
+		}
 
+		return releaseStock(tx, order.ID)
+	})
+}
 
-// UpdateOrderStatus updates the status of an order (admin only).
+// UpdateOrderStatus updates the status of an order (staff with the orders:status permission only).
 //
 // Parameters:
 // - orderID: The unique identifier of the order to be updated.
+// - actorID: The unique identifier of the staff member making the change, recorded in the order's status history.
 // - status: The new status to be set for the order.
+// - reason: An optional explanation recorded in the order's status history.
 //
 // Return:
 // - A pointer to the updated Order struct if the operation is successful.
@@ -155,25 +457,92 @@ func (s *OrderService) CancelOrder(orderID, userID uint) error {
 //   - Returns nil if the order was successfully updated.
 //   - Returns an error with the message "order not found" if the order could not be found.
 //   - Returns an error with the message "failed to retrieve order: <error details>" if there was an issue retrieving the order from the database.
+//   - Returns a *models.TransitionError if the order lifecycle does not allow moving from the current status to the new one.
 //   - Returns an error with the message "failed to update order status" if there was an issue updating the order status in the database.
 //   - Returns an error with the message "failed to retrieve updated order with products" if there was an issue retrieving the updated order with its associated products.
-func (s *OrderService) UpdateOrderStatus(orderID uint, status models.OrderStatus) (*models.Order, error) {
+//
+// Moving an order into the cancelled status returns its units to stock.
+func (s *OrderService) UpdateOrderStatus(orderID, actorID uint, status models.OrderStatus, reason string) (*models.Order, error) {
 	var order models.Order
-	if err := s.db.First(&order, orderID).Error; err != nil {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: clause.LockingStrengthUpdate}).First(&order, orderID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errors.New("order not found")
+			}
+			return errors.New("failed to retrieve order: " + err.Error())
+		}
+
+		if err := order.Status.ValidateTransition(status); err != nil {
+			return err
+		}
+
+		if status == models.OrderStatusCancelled {
+			if err := releaseStock(tx, order.ID); err != nil {
+				return err
+			}
+		}
+
+		previous := order.Status
+		order.Status = status
+		if err := tx.Save(&order).Error; err != nil {
+			return errors.New("failed to update order status")
+		}
+
+		return recordStatusEvent(tx, order.ID, previous, status, actorID, reason)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.db.Preload("Items").First(&order, orderID).Error; err != nil {
+		return nil, errors.New("failed to retrieve updated order with products")
+	}
+	return &order, nil
+}
+
+// OrderHistory returns the status history of an order, oldest event first.
+//
+// Parameters:
+// - orderID: The unique identifier of the order whose history is requested.
+// - userID: The unique identifier of the user requesting the history.
+// - canReadAll: Whether the requesting user may see the history of any order.
+//
+// Return:
+//   - The order's status events ordered by the time they were recorded.
+//   - An error with the message "order not found" if the order does not exist or belongs to another user
+//     and the requester may not read all orders, so the existence of other users' orders is not revealed.
+func (s *OrderService) OrderHistory(orderID, userID uint, canReadAll bool) ([]models.OrderStatusEvent, error) {
+	var order models.Order
+	if err := s.db.Select("id", "user_id").First(&order, orderID).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, errors.New("order not found")
 		}
 		return nil, errors.New("failed to retrieve order: " + err.Error())
 	}
 
-	order.Status = status
-	if err := s.db.Save(&order).Error; err != nil {
-		return nil, errors.New("failed to update order status")
+	if order.UserID != userID && !canReadAll {
+		return nil, errors.New("order not found")
 	}
 
-	if err := s.db.Preload("Products").First(&order, orderID).Error; err != nil {
-		return nil, errors.New("failed to retrieve updated order with products")
+	events := []models.OrderStatusEvent{}
+	if err := s.db.Where("order_id = ?", orderID).Order("created_at, id").Find(&events).Error; err != nil {
+		return nil, errors.New("failed to retrieve order history: " + err.Error())
 	}
-	return &order, nil
+	return events, nil
 }
 
+// recordStatusEvent appends a status change to an order's history. It must be called inside the
+// transaction that changes the status so the history cannot drift from the order.
+func recordStatusEvent(tx *gorm.DB, orderID uint, from, to models.OrderStatus, actorID uint, reason string) error {
+	event := models.OrderStatusEvent{
+		OrderID:    orderID,
+		FromStatus: from,
+		ToStatus:   to,
+		ActorID:    actorID,
+		Reason:     reason,
+	}
+	if err := tx.Create(&event).Error; err != nil {
+		return errors.New("failed to record order status history: " + err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package orders
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+
+	"ecommerce-api/internal/testdb"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func newMockOrderService(t *testing.T) (*OrderService, sqlmock.Sqlmock) {
+	gormDB, mock := testdb.New(t)
+	return NewOrderService(gormDB), mock
+}
+
+func TestMergeOrderLines(t *testing.T) {
+	lines := mergeOrderLines([]ProductOrder{
+		{ProductID: 2, Quantity: 1},
+		{ProductID: 1, Quantity: 3},
+		{ProductID: 2, Quantity: 4},
+	})
+
+	assert.Equal(t, []ProductOrder{
+		{ProductID: 2, Quantity: 5},
+		{ProductID: 1, Quantity: 3},
+	}, lines)
+}
+
+func TestPlaceOrderInsufficientStock(t *testing.T) {
+	service, mock := newMockOrderService(t)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "products" WHERE id IN ($1,$2) AND "products"."deleted_at" IS NULL ORDER BY id FOR UPDATE`)).
+		WithArgs(1, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "stock"}).AddRow(1, 10).AddRow(2, 1))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "product_variants" WHERE product_id IN ($1,$2) ORDER BY id FOR UPDATE`)).
+		WithArgs(1, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "product_id", "stock"}).AddRow(11, 1, 10).AddRow(21, 2, 1))
+	mock.ExpectRollback()
+
+	// The first and last lines are for the same variant, once implied and once explicit.
+	order, err := service.PlaceOrder(7, []ProductOrder{
+		{ProductID: 1, Quantity: 4},
+		{ProductID: 2, Quantity: 2},
+		{ProductID: 1, VariantID: 11, Quantity: 4},
+	})
+
+	assert.Nil(t, order)
+	var stockErr *InsufficientStockError
+	if assert.True(t, errors.As(err, &stockErr)) {
+		assert.Equal(t, []StockShortage{{ProductID: 2, VariantID: 21, Requested: 2, Available: 1}}, stockErr.Lines)
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPlaceOrderUnknownProduct(t *testing.T) {
+	service, mock := newMockOrderService(t)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "products" WHERE id IN ($1,$2) AND "products"."deleted_at" IS NULL ORDER BY id FOR UPDATE`)).
+		WithArgs(1, 99).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "stock"}).AddRow(1, 10))
+	mock.ExpectRollback()
+
+	order, err := service.PlaceOrder(7, []ProductOrder{
+		{ProductID: 1, Quantity: 1},
+		{ProductID: 99, Quantity: 1},
+	})
+
+	assert.Nil(t, order)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPlaceOrderMixedCurrency(t *testing.T) {
+	service, mock := newMockOrderService(t)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "products" WHERE id IN ($1,$2) AND "products"."deleted_at" IS NULL ORDER BY id FOR UPDATE`)).
+		WithArgs(1, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "price", "currency", "stock"}).
+			AddRow(1, 1000, "USD", 10).
+			AddRow(2, 5000, "NGN", 10))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "product_variants" WHERE product_id IN ($1,$2) ORDER BY id FOR UPDATE`)).
+		WithArgs(1, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "product_id", "stock"}).AddRow(11, 1, 10).AddRow(21, 2, 10))
+	for _, ids := range [][2]int{{11, 1}, {21, 2}} {
+		mock.ExpectExec(regexp.QuoteMeta(`UPDATE "product_variants" SET "stock"=stock - $1 WHERE id = $2`)).
+			WithArgs(1, ids[0]).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(regexp.QuoteMeta(`UPDATE "products" SET "stock"=stock - $1 WHERE id = $2`)).
+			WithArgs(1, ids[1]).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	mock.ExpectRollback()
+
+	order, err := service.PlaceOrder(7, []ProductOrder{
+		{ProductID: 1, Quantity: 1},
+		{ProductID: 2, Quantity: 1},
+	})
+
+	assert.Nil(t, order)
+	assert.ErrorIs(t, err, ErrMixedCurrency)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPlaceOrderRequiresVariantChoice(t *testing.T) {
+	service, mock := newMockOrderService(t)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "products" WHERE id IN ($1) AND "products"."deleted_at" IS NULL ORDER BY id FOR UPDATE`)).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "stock"}).AddRow(1, 20))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "product_variants" WHERE product_id IN ($1) ORDER BY id FOR UPDATE`)).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "product_id", "stock"}).AddRow(11, 1, 10).AddRow(12, 1, 10))
+	mock.ExpectRollback()
+
+	order, err := service.PlaceOrder(7, []ProductOrder{{ProductID: 1, Quantity: 1}})
+
+	assert.Nil(t, order)
+	assert.ErrorIs(t, err, ErrVariantRequired)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPlaceOrderRejectsVariantOfOtherProduct(t *testing.T) {
+	service, mock := newMockOrderService(t)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "products" WHERE id IN ($1) AND "products"."deleted_at" IS NULL ORDER BY id FOR UPDATE`)).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "stock"}).AddRow(1, 10))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "product_variants" WHERE product_id IN ($1) ORDER BY id FOR UPDATE`)).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "product_id", "stock"}).AddRow(11, 1, 10))
+	mock.ExpectRollback()
+
+	order, err := service.PlaceOrder(7, []ProductOrder{{ProductID: 1, VariantID: 21, Quantity: 1}})
+
+	assert.Nil(t, order)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPlaceOrderRequiresVerifiedEmail(t *testing.T) {
+	service, mock := newMockOrderService(t)
+	service.requireVerifiedEmail = true
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT "id","verified_at" FROM "users" WHERE "users"."id" = $1 AND "users"."deleted_at" IS NULL LIMIT $2`)).
+		WithArgs(7, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "verified_at"}).AddRow(7, nil))
+	mock.ExpectRollback()
+
+	order, err := service.PlaceOrder(7, []ProductOrder{{ProductID: 1, Quantity: 1}})
+
+	assert.Nil(t, order)
+	assert.ErrorIs(t, err, ErrEmailNotVerified)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
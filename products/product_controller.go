@@ -1,8 +1,13 @@
 package products
 
 import (
+	"ecommerce-api/middleware"
 	"ecommerce-api/models"
 	"ecommerce-api/utils"
+	"errors"
+	"fmt"
+	"io"
+	"log"
 	"net/http"
 	"strconv"
 
@@ -21,15 +26,17 @@ func NewProductController(productService *ProductService) *ProductController {
 
 // CreateProduct godoc
 // @Summary      Create a new product
-// @Description  Admin only: Creates a new product
+// @Description  Requires the products:write permission. Creates a new product with a single variant holding its stock and SKU
 // @Tags         products
 // @Accept       json
 // @Produce      json
 // @Param        product  body      CreateProduct   true  "Product details"
 // @Success      201      {object}  utils.APIResponse{data=models.Product}
 // @Failure      400      {object}  utils.APIResponse
+// @Failure      409      {object}  utils.APIResponse
 // @Failure      500      {object}  utils.APIResponse
 // @Security     BearerAuth
+// @Security     ApiKeyAuth
 // @Router       /products [post]
 func (c *ProductController) CreateProduct(ctx *gin.Context) {
 	var product CreateProduct
@@ -39,6 +46,10 @@ func (c *ProductController) CreateProduct(ctx *gin.Context) {
 	}
 
 	if err := c.productService.CreateProduct(&product); err != nil {
+		if errors.Is(err, ErrSKUTaken) {
+			utils.NewAPIResponse(http.StatusConflict, "Failed to create product", nil, err.Error()).Send(ctx)
+			return
+		}
 		utils.NewAPIResponse(http.StatusInternalServerError, "Failed to create product", nil, err.Error()).Send(ctx)
 		return
 	}
@@ -48,7 +59,7 @@ func (c *ProductController) CreateProduct(ctx *gin.Context) {
 
 // GetProduct godoc
 // @Summary      Get a product
-// @Description  Retrieve a product by ID
+// @Description  Retrieve a product by ID. Products in the trash are only returned, with deleted_at set, to users with the products:write permission.
 // @Tags         products
 // @Produce      json
 // @Param        id   path      string  true  "Product ID"
@@ -56,10 +67,18 @@ func (c *ProductController) CreateProduct(ctx *gin.Context) {
 // @Failure      404  {object}  utils.APIResponse
 // @Failure      500  {object}  utils.APIResponse
 // @Security     BearerAuth
+// @Security     ApiKeyAuth
 // @Router       /products/{id} [get]
 func (c *ProductController) GetProduct(ctx *gin.Context) {
 	id := ctx.Param("id")
-	product, err := c.productService.GetProduct(id)
+	// Staff can still look up deleted products, such as those of past orders.
+	includeDeleted, err := middleware.HasPermission(ctx, models.PermProductsWrite)
+	if err != nil {
+		utils.NewAPIResponse(http.StatusInternalServerError, "Failed to retrieve user", nil, err.Error()).Send(ctx)
+		return
+	}
+
+	product, err := c.productService.GetProduct(id, includeDeleted)
 	if err != nil {
 		if err.Error() == "product not found" {
 			utils.NewAPIResponse(http.StatusNotFound, "Product not found", nil, "").Send(ctx)
@@ -73,27 +92,89 @@ func (c *ProductController) GetProduct(ctx *gin.Context) {
 }
 
 // ListProducts godoc
-// @Summary      List all products
-// @Description  Retrieve all products
+// @Summary      List products
+// @Description  Retrieve a page of products. Results are cursor-paginated: pass the returned next_cursor to get the following page,
+// @Description  or use page and limit for offset pagination. Sort accepts created_at, price or name, prefixed with "-" for descending order.
 // @Tags         products
 // @Produce      json
-// @Success      200  {object}  utils.APIResponse{data=[]models.Product}
+// @Param        cursor         query     string  false  "Cursor returned by the previous page"
+// @Param        page           query     int     false  "Page number for offset pagination"
+// @Param        limit          query     int     false  "Page size (default 20, max 100)"
+// @Param        min_price      query     int     false  "Minimum price"
+// @Param        max_price      query     int     false  "Maximum price"
+// @Param        in_stock       query     bool    false  "Only products with stock"
+// @Param        name           query     string  false  "Case-insensitive name substring"
+// @Param        created_after  query     string  false  "Only products created after this RFC 3339 time"
+// @Param        category       query     string  false  "Only products in the category with this slug"
+// @Param        include_descendants  query  bool  false  "With category, also products in its subcategories"
+// @Param        sort           query     string  false  "Sort field"  Enums(created_at, -created_at, price, -price, name, -name)
+// @Param        include_total  query     bool    false  "Count all matching products"
+// @Success      200  {object}  utils.APIResponse{data=utils.Page{items=[]models.Product}}
+// @Failure      400  {object}  utils.APIResponse
 // @Failure      500  {object}  utils.APIResponse
 // @Security     BearerAuth
+// @Security     ApiKeyAuth
 // @Router       /products [get]
 func (c *ProductController) ListProducts(ctx *gin.Context) {
-	products, err := c.productService.ListProducts()
+	var query ListProductsQuery
+	if err := ctx.ShouldBindQuery(&query); err != nil {
+		utils.NewAPIResponse(http.StatusBadRequest, "Invalid query", nil, err.Error()).Send(ctx)
+		return
+	}
+
+	products, pagination, err := c.productService.ListProducts(query)
 	if err != nil {
+		if errors.Is(err, utils.ErrInvalidCursor) || errors.Is(err, ErrInvalidSort) {
+			utils.NewAPIResponse(http.StatusBadRequest, "Invalid query", nil, err.Error()).Send(ctx)
+			return
+		}
 		utils.NewAPIResponse(http.StatusInternalServerError, "Failed to retrieve products", nil, err.Error()).Send(ctx)
 		return
 	}
 
-	utils.NewAPIResponse(http.StatusOK, "Products retrieved successfully", products, "").Send(ctx)
+	utils.NewAPIResponse(http.StatusOK, "Products retrieved successfully", utils.Page{Items: products, Pagination: pagination}, "").Send(ctx)
+}
+
+// SearchProducts godoc
+// @Summary      Search products
+// @Description  Full-text search over product names and descriptions, most relevant first. Every word must match;
+// @Description  a word ending in "*" matches as a prefix and words in double quotes must appear as a phrase.
+// @Description  name_highlight and snippet are HTML: the product's text is escaped and matches are wrapped in <mark> tags.
+// @Tags         products
+// @Produce      json
+// @Param        q      query     string  true   "Search text"
+// @Param        page   query     int     false  "Page number"
+// @Param        limit  query     int     false  "Page size (default 20, max 100)"
+// @Success      200  {object}  utils.APIResponse{data=utils.Page{items=[]ProductSearchResult}}
+// @Failure      400  {object}  utils.APIResponse
+// @Failure      500  {object}  utils.APIResponse
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Router       /products/search [get]
+func (c *ProductController) SearchProducts(ctx *gin.Context) {
+	var query SearchProductsQuery
+	if err := ctx.ShouldBindQuery(&query); err != nil {
+		utils.NewAPIResponse(http.StatusBadRequest, "Invalid query", nil, err.Error()).Send(ctx)
+		return
+	}
+
+	results, pagination, err := c.productService.SearchProducts(query)
+	if err != nil {
+		if errors.Is(err, ErrEmptySearch) {
+			utils.NewAPIResponse(http.StatusBadRequest, "Invalid query", nil, err.Error()).Send(ctx)
+			return
+		}
+		utils.NewAPIResponse(http.StatusInternalServerError, "Failed to search products", nil, err.Error()).Send(ctx)
+		return
+	}
+
+	utils.NewAPIResponse(http.StatusOK, "Products retrieved successfully", utils.Page{Items: results, Pagination: pagination}, "").Send(ctx)
 }
 
 // UpdateProduct godoc
 // @Summary      Update a product
-// @Description  Admin only: Update a product by ID
+// @Description  Requires the products:write permission. Update a product by ID. Stock can only be set here for products without options;
+// @Description  otherwise it is set per variant.
 // @Tags         products
 // @Accept       json
 // @Produce      json
@@ -102,8 +183,10 @@ func (c *ProductController) ListProducts(ctx *gin.Context) {
 // @Success      200       {object}  utils.APIResponse{data=models.Product}
 // @Failure      400       {object}  utils.APIResponse
 // @Failure      404       {object}  utils.APIResponse
+// @Failure      409       {object}  utils.APIResponse
 // @Failure      500       {object}  utils.APIResponse
 // @Security     BearerAuth
+// @Security     ApiKeyAuth
 // @Router       /products/{id} [put]
 func (c *ProductController) UpdateProduct(ctx *gin.Context) {
 	idStr := ctx.Param("id")
@@ -131,6 +214,9 @@ func (c *ProductController) UpdateProduct(ctx *gin.Context) {
 	if product.Price != nil {
 		updatedProduct.Price = *product.Price
 	}
+	if product.Currency != nil {
+		updatedProduct.Currency = *product.Currency
+	}
 	if product.Stock != nil {
 		updatedProduct.Stock = *product.Stock
 	}
@@ -139,6 +225,8 @@ func (c *ProductController) UpdateProduct(ctx *gin.Context) {
 	if err != nil {
 		if err.Error() == "product not found" {
 			utils.NewAPIResponse(http.StatusNotFound, "Product not found", nil, "").Send(ctx)
+		} else if errors.Is(err, ErrStockManagedByVariants) {
+			utils.NewAPIResponse(http.StatusConflict, "Failed to update product", nil, err.Error()).Send(ctx)
 		} else {
 			utils.NewAPIResponse(http.StatusInternalServerError, "Failed to update product", nil, err.Error()).Send(ctx)
 		}
@@ -149,9 +237,58 @@ func (c *ProductController) UpdateProduct(ctx *gin.Context) {
 }
 
 
+// SetProductVariants godoc
+// @Summary      Set a product's options and variants
+// @Description  Requires the products:write permission. Replaces the product's options (such as size and colour) and its variants.
+// @Description  Each variant has one value per option, its own SKU and stock, and optionally a price overriding the product's price.
+// @Description  Variants with an id are updated, those without are created, and unlisted variants are deleted. A product without options has one variant.
+// @Tags         products
+// @Accept       json
+// @Produce      json
+// @Param        id        path      int                    true  "Product ID"
+// @Param        variants  body      SetProductVariantsDTO  true  "Options and variants"
+// @Success      200       {object}  utils.APIResponse{data=models.Product}
+// @Failure      400       {object}  utils.APIResponse
+// @Failure      404       {object}  utils.APIResponse
+// @Failure      409       {object}  utils.APIResponse
+// @Failure      500       {object}  utils.APIResponse
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Router       /products/{id}/variants [put]
+func (c *ProductController) SetProductVariants(ctx *gin.Context) {
+	productID, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
+	if err != nil {
+		utils.NewAPIResponse(http.StatusBadRequest, "Invalid ID", nil, err.Error()).Send(ctx)
+		return
+	}
+
+	var input SetProductVariantsDTO
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		utils.NewAPIResponse(http.StatusBadRequest, "Invalid input", nil, err.Error()).Send(ctx)
+		return
+	}
+
+	product, err := c.productService.SetProductVariants(uint(productID), input)
+	if err != nil {
+		switch {
+		case err.Error() == "product not found":
+			utils.NewAPIResponse(http.StatusNotFound, "Product not found", nil, "").Send(ctx)
+		case errors.Is(err, ErrInvalidVariants), errors.Is(err, ErrVariantNotFound):
+			utils.NewAPIResponse(http.StatusBadRequest, "Invalid input", nil, err.Error()).Send(ctx)
+		case errors.Is(err, ErrSKUTaken):
+			utils.NewAPIResponse(http.StatusConflict, "Failed to update variants", nil, err.Error()).Send(ctx)
+		default:
+			utils.NewAPIResponse(http.StatusInternalServerError, "Failed to update variants", nil, err.Error()).Send(ctx)
+		}
+		return
+	}
+
+	utils.NewAPIResponse(http.StatusOK, "Variants updated successfully", product, "").Send(ctx)
+}
+
 // DeleteProduct godoc
 // @Summary      Delete a product
-// @Description  Admin only: Delete a product by ID
+// @Description  Requires the products:write permission. Moves a product to the trash, hiding it from the catalog. Past orders keep referring to it, and it can be restored.
 // @Tags         products
 // @Produce      json
 // @Param        id   path      string  true  "Product ID"
@@ -159,6 +296,7 @@ func (c *ProductController) UpdateProduct(ctx *gin.Context) {
 // @Failure      404  {object}  utils.APIResponse
 // @Failure      500  {object}  utils.APIResponse
 // @Security     BearerAuth
+// @Security     ApiKeyAuth
 // @Router       /products/{id} [delete]
 func (c *ProductController) DeleteProduct(ctx *gin.Context) {
 	id := ctx.Param("id")
@@ -169,3 +307,513 @@ func (c *ProductController) DeleteProduct(ctx *gin.Context) {
 
 	utils.NewAPIResponse(http.StatusOK, "Product deleted successfully", nil, "").Send(ctx)
 }
+
+// ListTrash godoc
+// @Summary      List deleted products
+// @Description  Requires the products:write permission. Lists the products in the trash, most recently deleted first.
+// @Tags         products
+// @Produce      json
+// @Param        page   query     int  false  "Page number, starting at 1"
+// @Param        limit  query     int  false  "Products per page (default 20, max 100)"
+// @Success      200    {object}  utils.APIResponse{data=utils.Page{items=[]models.Product}}
+// @Failure      400    {object}  utils.APIResponse
+// @Failure      500    {object}  utils.APIResponse
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Router       /products/trash [get]
+func (c *ProductController) ListTrash(ctx *gin.Context) {
+	var query ListTrashQuery
+	if err := ctx.ShouldBindQuery(&query); err != nil {
+		utils.NewAPIResponse(http.StatusBadRequest, "Invalid query", nil, err.Error()).Send(ctx)
+		return
+	}
+
+	products, pagination, err := c.productService.ListTrash(query)
+	if err != nil {
+		utils.NewAPIResponse(http.StatusInternalServerError, "Failed to retrieve deleted products", nil, err.Error()).Send(ctx)
+		return
+	}
+
+	utils.NewAPIResponse(http.StatusOK, "Deleted products retrieved successfully", utils.Page{Items: products, Pagination: pagination}, "").Send(ctx)
+}
+
+// RestoreProduct godoc
+// @Summary      Restore a deleted product
+// @Description  Requires the products:write permission. Takes a product out of the trash, so it is listed and can be ordered again.
+// @Tags         products
+// @Produce      json
+// @Param        id   path      int  true  "Product ID"
+// @Success      200  {object}  utils.APIResponse{data=models.Product}
+// @Failure      400  {object}  utils.APIResponse
+// @Failure      404  {object}  utils.APIResponse
+// @Failure      409  {object}  utils.APIResponse
+// @Failure      500  {object}  utils.APIResponse
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Router       /products/{id}/restore [post]
+func (c *ProductController) RestoreProduct(ctx *gin.Context) {
+	id, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
+	if err != nil {
+		utils.NewAPIResponse(http.StatusBadRequest, "Invalid ID", nil, err.Error()).Send(ctx)
+		return
+	}
+
+	product, err := c.productService.RestoreProduct(uint(id))
+	if err != nil {
+		switch {
+		case err.Error() == "product not found":
+			utils.NewAPIResponse(http.StatusNotFound, "Product not found", nil, "").Send(ctx)
+		case errors.Is(err, ErrProductNotDeleted):
+			utils.NewAPIResponse(http.StatusConflict, "Failed to restore product", nil, err.Error()).Send(ctx)
+		default:
+			utils.NewAPIResponse(http.StatusInternalServerError, "Failed to restore product", nil, err.Error()).Send(ctx)
+		}
+		return
+	}
+
+	utils.NewAPIResponse(http.StatusOK, "Product restored successfully", product, "").Send(ctx)
+}
+
+// PurgeProduct godoc
+// @Summary      Permanently delete a product
+// @Description  Requires the products:purge permission, which only super admins hold. Permanently deletes a product from the trash with its variants and images.
+// @Description  Products that orders still reference cannot be purged.
+// @Tags         products
+// @Produce      json
+// @Param        id   path      int  true  "Product ID"
+// @Success      200  {object}  utils.APIResponse
+// @Failure      400  {object}  utils.APIResponse
+// @Failure      404  {object}  utils.APIResponse
+// @Failure      409  {object}  utils.APIResponse
+// @Failure      500  {object}  utils.APIResponse
+// @Security     BearerAuth
+// @Router       /products/{id}/purge [delete]
+func (c *ProductController) PurgeProduct(ctx *gin.Context) {
+	id, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
+	if err != nil {
+		utils.NewAPIResponse(http.StatusBadRequest, "Invalid ID", nil, err.Error()).Send(ctx)
+		return
+	}
+
+	if err := c.productService.PurgeProduct(uint(id)); err != nil {
+		switch {
+		case err.Error() == "product not found":
+			utils.NewAPIResponse(http.StatusNotFound, "Product not found", nil, "").Send(ctx)
+		case errors.Is(err, ErrProductNotDeleted), errors.Is(err, ErrProductHasOrders):
+			utils.NewAPIResponse(http.StatusConflict, "Failed to purge product", nil, err.Error()).Send(ctx)
+		default:
+			utils.NewAPIResponse(http.StatusInternalServerError, "Failed to purge product", nil, err.Error()).Send(ctx)
+		}
+		return
+	}
+
+	utils.NewAPIResponse(http.StatusOK, "Product purged successfully", nil, "").Send(ctx)
+}
+
+// UploadProductImage godoc
+// @Summary      Upload a product image
+// @Description  Requires the products:write permission. Uploads a JPEG, PNG or GIF image, sent as the "image" field of a multipart form, and creates its thumbnail.
+// @Description  The file's type is detected from its content. The image is added after the product's other images, and a product's first image becomes its primary image.
+// @Tags         products
+// @Accept       multipart/form-data
+// @Produce      json
+// @Param        id     path      int   true  "Product ID"
+// @Param        image  formData  file  true  "Image file"
+// @Success      201    {object}  utils.APIResponse{data=models.ProductImage}
+// @Failure      400    {object}  utils.APIResponse
+// @Failure      404    {object}  utils.APIResponse
+// @Failure      409    {object}  utils.APIResponse
+// @Failure      413    {object}  utils.APIResponse
+// @Failure      415    {object}  utils.APIResponse
+// @Failure      500    {object}  utils.APIResponse
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Router       /products/{id}/images [post]
+func (c *ProductController) UploadProductImage(ctx *gin.Context) {
+	productID, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
+	if err != nil {
+		utils.NewAPIResponse(http.StatusBadRequest, "Invalid ID", nil, err.Error()).Send(ctx)
+		return
+	}
+
+	// The body may be a little larger than the image because of the multipart framing.
+	maxSize := c.productService.MaxImageSize()
+	ctx.Request.Body = http.MaxBytesReader(ctx.Writer, ctx.Request.Body, maxSize+64<<10)
+	header, err := ctx.FormFile("image")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			utils.NewAPIResponse(http.StatusRequestEntityTooLarge, "Invalid input", nil, ErrImageTooLarge.Error()).Send(ctx)
+			return
+		}
+		utils.NewAPIResponse(http.StatusBadRequest, "Invalid input", nil, "an image file is required in the \"image\" field").Send(ctx)
+		return
+	}
+	if header.Size > maxSize {
+		utils.NewAPIResponse(http.StatusRequestEntityTooLarge, "Invalid input", nil, ErrImageTooLarge.Error()).Send(ctx)
+		return
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		utils.NewAPIResponse(http.StatusBadRequest, "Invalid input", nil, err.Error()).Send(ctx)
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, maxSize+1))
+	if err != nil {
+		utils.NewAPIResponse(http.StatusBadRequest, "Invalid input", nil, err.Error()).Send(ctx)
+		return
+	}
+
+	image, err := c.productService.AddProductImage(ctx.Request.Context(), uint(productID), data)
+	if err != nil {
+		sendImageError(ctx, "Failed to upload image", err)
+		return
+	}
+
+	utils.NewAPIResponse(http.StatusCreated, "Image uploaded successfully", image, "").Send(ctx)
+}
+
+// ReorderProductImages godoc
+// @Summary      Reorder a product's images
+// @Description  Requires the products:write permission. Sets the order in which the product's images are shown. Every image of the product must be listed once.
+// @Tags         products
+// @Accept       json
+// @Produce      json
+// @Param        id      path      int                      true  "Product ID"
+// @Param        images  body      ReorderProductImagesDTO  true  "Image IDs in their new order"
+// @Success      200     {object}  utils.APIResponse{data=[]models.ProductImage}
+// @Failure      400     {object}  utils.APIResponse
+// @Failure      404     {object}  utils.APIResponse
+// @Failure      500     {object}  utils.APIResponse
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Router       /products/{id}/images [put]
+func (c *ProductController) ReorderProductImages(ctx *gin.Context) {
+	productID, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
+	if err != nil {
+		utils.NewAPIResponse(http.StatusBadRequest, "Invalid ID", nil, err.Error()).Send(ctx)
+		return
+	}
+
+	var input ReorderProductImagesDTO
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		utils.NewAPIResponse(http.StatusBadRequest, "Invalid input", nil, err.Error()).Send(ctx)
+		return
+	}
+
+	images, err := c.productService.ReorderProductImages(uint(productID), input.ImageIDs)
+	if err != nil {
+		sendImageError(ctx, "Failed to reorder images", err)
+		return
+	}
+
+	utils.NewAPIResponse(http.StatusOK, "Images reordered successfully", images, "").Send(ctx)
+}
+
+// SetPrimaryProductImage godoc
+// @Summary      Set a product's primary image
+// @Description  Requires the products:write permission. Makes the image the product's primary image, which represents the product in listings.
+// @Tags         products
+// @Produce      json
+// @Param        id       path      int  true  "Product ID"
+// @Param        imageID  path      int  true  "Image ID"
+// @Success      200      {object}  utils.APIResponse{data=[]models.ProductImage}
+// @Failure      400      {object}  utils.APIResponse
+// @Failure      404      {object}  utils.APIResponse
+// @Failure      500      {object}  utils.APIResponse
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Router       /products/{id}/images/{imageID}/primary [put]
+func (c *ProductController) SetPrimaryProductImage(ctx *gin.Context) {
+	productID, imageID, ok := imagePathIDs(ctx)
+	if !ok {
+		return
+	}
+
+	images, err := c.productService.SetPrimaryProductImage(productID, imageID)
+	if err != nil {
+		sendImageError(ctx, "Failed to update images", err)
+		return
+	}
+
+	utils.NewAPIResponse(http.StatusOK, "Primary image updated successfully", images, "").Send(ctx)
+}
+
+// DeleteProductImage godoc
+// @Summary      Delete a product image
+// @Description  Requires the products:write permission. Deletes the image and its thumbnail. When the primary image is deleted, the next image becomes the primary image.
+// @Tags         products
+// @Produce      json
+// @Param        id       path      int  true  "Product ID"
+// @Param        imageID  path      int  true  "Image ID"
+// @Success      200      {object}  utils.APIResponse
+// @Failure      400      {object}  utils.APIResponse
+// @Failure      404      {object}  utils.APIResponse
+// @Failure      500      {object}  utils.APIResponse
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Router       /products/{id}/images/{imageID} [delete]
+func (c *ProductController) DeleteProductImage(ctx *gin.Context) {
+	productID, imageID, ok := imagePathIDs(ctx)
+	if !ok {
+		return
+	}
+
+	if err := c.productService.DeleteProductImage(productID, imageID); err != nil {
+		sendImageError(ctx, "Failed to delete image", err)
+		return
+	}
+
+	utils.NewAPIResponse(http.StatusOK, "Image deleted successfully", nil, "").Send(ctx)
+}
+
+// imagePathIDs parses the product and image IDs of an image route, answering 400 if either is malformed.
+func imagePathIDs(ctx *gin.Context) (uint, uint, bool) {
+	productID, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
+	if err != nil {
+		utils.NewAPIResponse(http.StatusBadRequest, "Invalid ID", nil, err.Error()).Send(ctx)
+		return 0, 0, false
+	}
+	imageID, err := strconv.ParseUint(ctx.Param("imageID"), 10, 32)
+	if err != nil {
+		utils.NewAPIResponse(http.StatusBadRequest, "Invalid image ID", nil, err.Error()).Send(ctx)
+		return 0, 0, false
+	}
+	return uint(productID), uint(imageID), true
+}
+
+// sendImageError maps the errors of the image operations to responses.
+func sendImageError(ctx *gin.Context, message string, err error) {
+	switch {
+	case err.Error() == "product not found":
+		utils.NewAPIResponse(http.StatusNotFound, "Product not found", nil, "").Send(ctx)
+	case errors.Is(err, ErrImageNotFound):
+		utils.NewAPIResponse(http.StatusNotFound, "Image not found", nil, "").Send(ctx)
+	case errors.Is(err, ErrInvalidImageOrder):
+		utils.NewAPIResponse(http.StatusBadRequest, "Invalid input", nil, err.Error()).Send(ctx)
+	case errors.Is(err, ErrImageTooLarge):
+		utils.NewAPIResponse(http.StatusRequestEntityTooLarge, message, nil, err.Error()).Send(ctx)
+	case errors.Is(err, ErrUnsupportedImage):
+		utils.NewAPIResponse(http.StatusUnsupportedMediaType, message, nil, err.Error()).Send(ctx)
+	case errors.Is(err, ErrTooManyImages):
+		utils.NewAPIResponse(http.StatusConflict, message, nil, err.Error()).Send(ctx)
+	default:
+		utils.NewAPIResponse(http.StatusInternalServerError, message, nil, err.Error()).Send(ctx)
+	}
+}
+
+// ImportProducts godoc
+// @Summary      Import products
+// @Description  Requires the products:write permission. Starts a background job that imports the products of a CSV or NDJSON file, sent as the "file" field of a multipart form.
+// @Description  Rows have the fields of a new product. A row whose SKU belongs to an existing product updates it, and may set its stock to 0; other rows create a product and are validated with the same rules.
+// @Description  Rows with a product_id, as in an export, only update existing variants, so a variant without a SKU is reported rather than created again.
+// @Description  A dry run only validates the rows and counts the products that would be created and updated. Poll the job for its progress and download its error report once it has finished.
+// @Tags         products
+// @Accept       multipart/form-data
+// @Produce      json
+// @Param        file     formData  file    true   "CSV file with a header line, or NDJSON file"
+// @Param        format   formData  string  false  "csv or ndjson, taken from the file's extension by default"
+// @Param        dry_run  formData  bool    false  "Only validate the file"
+// @Success      202      {object}  utils.APIResponse{data=models.ImportJob}
+// @Failure      400      {object}  utils.APIResponse
+// @Failure      413      {object}  utils.APIResponse
+// @Failure      500      {object}  utils.APIResponse
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Router       /products/import [post]
+func (c *ProductController) ImportProducts(ctx *gin.Context) {
+	userID, ok := userID(ctx)
+	if !ok {
+		return
+	}
+
+	// The body may be a little larger than the file because of the multipart framing.
+	ctx.Request.Body = http.MaxBytesReader(ctx.Writer, ctx.Request.Body, MaxImportSize+64<<10)
+	header, err := ctx.FormFile("file")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			utils.NewAPIResponse(http.StatusRequestEntityTooLarge, "Invalid input", nil, ErrImportTooLarge.Error()).Send(ctx)
+			return
+		}
+		utils.NewAPIResponse(http.StatusBadRequest, "Invalid input", nil, "a CSV or NDJSON file is required in the \"file\" field").Send(ctx)
+		return
+	}
+	if header.Size > MaxImportSize {
+		utils.NewAPIResponse(http.StatusRequestEntityTooLarge, "Invalid input", nil, ErrImportTooLarge.Error()).Send(ctx)
+		return
+	}
+
+	var input ImportProductsDTO
+	if err := ctx.ShouldBind(&input); err != nil {
+		utils.NewAPIResponse(http.StatusBadRequest, "Invalid input", nil, err.Error()).Send(ctx)
+		return
+	}
+	format, err := ImportFormat(input.Format, header.Filename)
+	if err != nil {
+		utils.NewAPIResponse(http.StatusBadRequest, "Invalid input", nil, err.Error()).Send(ctx)
+		return
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		utils.NewAPIResponse(http.StatusBadRequest, "Invalid input", nil, err.Error()).Send(ctx)
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, MaxImportSize+1))
+	if err != nil {
+		utils.NewAPIResponse(http.StatusBadRequest, "Invalid input", nil, err.Error()).Send(ctx)
+		return
+	}
+
+	job, err := c.productService.StartImport(userID, format, input.DryRun, data)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrImportTooLarge):
+			utils.NewAPIResponse(http.StatusRequestEntityTooLarge, "Invalid input", nil, err.Error()).Send(ctx)
+		case errors.Is(err, ErrInvalidImportFile), errors.Is(err, ErrUnsupportedImportFormat):
+			utils.NewAPIResponse(http.StatusBadRequest, "Invalid input", nil, err.Error()).Send(ctx)
+		default:
+			utils.NewAPIResponse(http.StatusInternalServerError, "Failed to start import", nil, err.Error()).Send(ctx)
+		}
+		return
+	}
+
+	utils.NewAPIResponse(http.StatusAccepted, "Import started", job, "").Send(ctx)
+}
+
+// GetImportJob godoc
+// @Summary      Get an import job
+// @Description  Requires the products:write permission. Retrieves the status and progress of a product import.
+// @Tags         products
+// @Produce      json
+// @Param        jobID  path      int  true  "Import job ID"
+// @Success      200    {object}  utils.APIResponse{data=models.ImportJob}
+// @Failure      400    {object}  utils.APIResponse
+// @Failure      404    {object}  utils.APIResponse
+// @Failure      500    {object}  utils.APIResponse
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Router       /products/import/{jobID} [get]
+func (c *ProductController) GetImportJob(ctx *gin.Context) {
+	job, ok := c.importJob(ctx)
+	if !ok {
+		return
+	}
+
+	utils.NewAPIResponse(http.StatusOK, "Import job retrieved successfully", job, "").Send(ctx)
+}
+
+// GetImportErrors godoc
+// @Summary      Download an import's error report
+// @Description  Requires the products:write permission. Downloads the rows of a product import that could not be imported, as CSV with the columns row, sku, field and message.
+// @Description  Row is the row's line in the imported file. A row can have several problems, each on its own line.
+// @Tags         products
+// @Produce      text/csv
+// @Produce      json
+// @Param        jobID  path      int  true  "Import job ID"
+// @Success      200    {file}    file
+// @Failure      400    {object}  utils.APIResponse
+// @Failure      404    {object}  utils.APIResponse
+// @Failure      500    {object}  utils.APIResponse
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Router       /products/import/{jobID}/errors [get]
+func (c *ProductController) GetImportErrors(ctx *gin.Context) {
+	job, ok := c.importJob(ctx)
+	if !ok {
+		return
+	}
+
+	ctx.Header("Content-Type", "text/csv; charset=utf-8")
+	ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"import-%d-errors.csv\"", job.ID))
+	ctx.Status(http.StatusOK)
+	if err := WriteImportErrorReport(ctx.Writer, job.Errors); err != nil {
+		log.Printf("failed to write error report of import job %d: %v", job.ID, err)
+	}
+}
+
+// ExportProducts godoc
+// @Summary      Export products
+// @Description  Requires the products:write permission. Streams the catalog as CSV or NDJSON, one line per variant, in the format read by the import.
+// @Description  The product_id column marks rows that only update existing variants on import. The variant column holds the title of a variant of a product with options and is ignored on import. Deleted products are left out.
+// @Tags         products
+// @Produce      text/csv
+// @Produce      application/x-ndjson
+// @Produce      json
+// @Param        format  query     string  false  "csv (default) or ndjson"
+// @Success      200     {file}    file
+// @Failure      400     {object}  utils.APIResponse
+// @Failure      500     {object}  utils.APIResponse
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Router       /products/export [get]
+func (c *ProductController) ExportProducts(ctx *gin.Context) {
+	var query ExportProductsQuery
+	if err := ctx.ShouldBindQuery(&query); err != nil {
+		utils.NewAPIResponse(http.StatusBadRequest, "Invalid query", nil, err.Error()).Send(ctx)
+		return
+	}
+	format := query.Format
+	if format == "" {
+		format = ImportFormatCSV
+	}
+
+	contentType := "text/csv; charset=utf-8"
+	if format == ImportFormatNDJSON {
+		contentType = "application/x-ndjson"
+	}
+	ctx.Header("Content-Type", contentType)
+	ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"products.%s\"", format))
+
+	if err := c.productService.ExportProducts(ctx.Writer, format); err != nil {
+		if !ctx.Writer.Written() {
+			ctx.Writer.Header().Del("Content-Type")
+			ctx.Writer.Header().Del("Content-Disposition")
+			utils.NewAPIResponse(http.StatusInternalServerError, "Failed to export products", nil, err.Error()).Send(ctx)
+			return
+		}
+		// The export has been partly sent, so the response can only be cut short.
+		log.Printf("failed to export products: %v", err)
+		ctx.Abort()
+	}
+}
+
+// importJob retrieves the import job of the route, answering with an error if it cannot.
+func (c *ProductController) importJob(ctx *gin.Context) (*models.ImportJob, bool) {
+	id, err := strconv.ParseUint(ctx.Param("jobID"), 10, 32)
+	if err != nil {
+		utils.NewAPIResponse(http.StatusBadRequest, "Invalid job ID", nil, err.Error()).Send(ctx)
+		return nil, false
+	}
+
+	job, err := c.productService.GetImportJob(uint(id))
+	if err != nil {
+		if errors.Is(err, ErrImportJobNotFound) {
+			utils.NewAPIResponse(http.StatusNotFound, "Import job not found", nil, "").Send(ctx)
+		} else {
+			utils.NewAPIResponse(http.StatusInternalServerError, "Failed to retrieve import job", nil, err.Error()).Send(ctx)
+		}
+		return nil, false
+	}
+	return job, true
+}
+
+// userID reads the authenticated user's ID from the context, sending an error response if it is missing or malformed.
+func userID(ctx *gin.Context) (uint, bool) {
+	userIDStr, exists := ctx.Get("userID")
+	if !exists {
+		utils.NewAPIResponse(http.StatusUnauthorized, "Unauthorized", nil, "User ID not found in context").Send(ctx)
+		return 0, false
+	}
+
+	id, err := strconv.ParseUint(userIDStr.(string), 10, 32)
+	if err != nil {
+		utils.NewAPIResponse(http.StatusBadRequest, "Invalid User ID", nil, "User ID conversion failed").Send(ctx)
+		return 0, false
+	}
+	return uint(id), true
+}
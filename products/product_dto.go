@@ -1,15 +1,93 @@
 package products
 
+import "time"
+
 type CreateProduct struct {
 	Name        string `json:"name" binding:"required,min=1"`         
 	Description string `json:"description" binding:"required,min=1"` 
 	Price       int64  `json:"price" binding:"required,gt=0"`         
+	Currency    string `json:"currency" binding:"omitempty,iso4217"`
 	Stock       int    `json:"stock" binding:"required,gt=0"`         
+	// SKU is the stock keeping unit of the product's variant.
+	SKU         string `json:"sku" binding:"omitempty,max=64"`
 }
 
 type UpdateProduct struct {
 	Name        *string `json:"name,omitempty"`
 	Description *string `json:"description,omitempty"`
 	Price       *int64  `json:"price,omitempty"`
+	Currency    *string `json:"currency,omitempty" binding:"omitempty,iso4217"`
 	Stock       *int    `json:"stock,omitempty"`
 }
+
+// ListProductsQuery holds the query string options of GET /products.
+// Cursor takes precedence over Page when both are given.
+type ListProductsQuery struct {
+	Cursor       string     `form:"cursor"`
+	Page         int        `form:"page" binding:"omitempty,gte=1"`
+	Limit        int        `form:"limit" binding:"omitempty,gte=1,lte=100"`
+	MinPrice     *int64     `form:"min_price" binding:"omitempty,gte=0"`
+	MaxPrice     *int64     `form:"max_price" binding:"omitempty,gte=0"`
+	InStock      bool       `form:"in_stock"`
+	Name         string     `form:"name"`
+	CreatedAfter *time.Time `form:"created_after" time_format:"2006-01-02T15:04:05Z07:00"`
+	Sort         string     `form:"sort" binding:"omitempty,oneof=created_at -created_at price -price name -name"`
+	IncludeTotal bool       `form:"include_total"`
+	// Category is a category slug. IncludeDescendants also matches products in its subcategories.
+	Category           string `form:"category" binding:"omitempty,max=120"`
+	IncludeDescendants bool   `form:"include_descendants"`
+}
+
+// SearchProductsQuery holds the query string options of GET /products/search.
+type SearchProductsQuery struct {
+	Q     string `form:"q" binding:"required,max=200"`
+	Page  int    `form:"page" binding:"omitempty,gte=1"`
+	Limit int    `form:"limit" binding:"omitempty,gte=1,lte=100"`
+}
+
+// ListTrashQuery holds the query string options of GET /products/trash.
+type ListTrashQuery struct {
+	Page  int `form:"page" binding:"omitempty,gte=1"`
+	Limit int `form:"limit" binding:"omitempty,gte=1,lte=100"`
+}
+
+// ProductOptionDTO is an option of a product, such as size or colour, and the values it can take.
+type ProductOptionDTO struct {
+	Name   string   `json:"name" binding:"required,max=50"`
+	Values []string `json:"values" binding:"required,min=1,max=50,dive,required,max=50"`
+}
+
+// ProductVariantDTO is a variant of a product. Options gives its value for each of the product's
+// options, and Price overrides the product's price when set. A variant with an ID updates that existing
+// variant of the product; one without is created.
+type ProductVariantDTO struct {
+	ID      uint              `json:"id"`
+	SKU     string            `json:"sku" binding:"omitempty,max=64"`
+	Options map[string]string `json:"options"`
+	Price   *int64            `json:"price" binding:"omitempty,gt=0"`
+	Stock   int               `json:"stock" binding:"gte=0"`
+}
+
+// SetProductVariantsDTO replaces the options and variants of a product. Existing variants that are not
+// listed are deleted. A product without options has exactly one variant.
+type SetProductVariantsDTO struct {
+	Options  []ProductOptionDTO  `json:"options" binding:"max=3,dive"`
+	Variants []ProductVariantDTO `json:"variants" binding:"required,min=1,max=100,dive"`
+}
+
+// ReorderProductImagesDTO sets the order of a product's images. It lists every image of the product.
+type ReorderProductImagesDTO struct {
+	ImageIDs []uint `json:"image_ids" binding:"required,min=1,max=20"`
+}
+
+// ImportProductsDTO holds the form fields of POST /products/import besides the file. The format is taken
+// from the file's extension when it is not given.
+type ImportProductsDTO struct {
+	Format string `form:"format" binding:"omitempty,oneof=csv ndjson jsonl"`
+	DryRun bool   `form:"dry_run"`
+}
+
+// ExportProductsQuery holds the query string options of GET /products/export.
+type ExportProductsQuery struct {
+	Format string `form:"format" binding:"omitempty,oneof=csv ndjson"`
+}
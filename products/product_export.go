@@ -0,0 +1,94 @@
+package products
+
+import (
+	"database/sql"
+	"ecommerce-api/models"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+)
+
+// exportedProduct is a line of an NDJSON export. Its fields are those of CreateProduct and the ID of
+// the product, so an export can be imported again.
+type exportedProduct struct {
+	ProductID   uint   `json:"product_id"`
+	SKU         string `json:"sku"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Price       int64  `json:"price"`
+	Currency    string `json:"currency"`
+	Stock       int    `json:"stock"`
+	Variant     string `json:"variant,omitempty"`
+}
+
+// ExportProducts writes the catalog to w as CSV or NDJSON, one line per variant, in the format read by
+// StartImport. Each line holds the variant's SKU, price and stock with its product's ID, name, description
+// and currency, and the variant's title for products with options. Deleted products are left out.
+//
+// The rows are streamed from the database, so the export is not held in memory.
+//
+// The function returns ErrUnsupportedImportFormat if the format is unknown, and an error with a
+// descriptive message if there is an error while interacting with the database or writing the export.
+func (s *ProductService) ExportProducts(w io.Writer, format string) error {
+	var write func(product exportedProduct) error
+	flush := func() error { return nil }
+	switch format {
+	case ImportFormatCSV:
+		writer := csv.NewWriter(w)
+		if err := writer.Write(productColumns); err != nil {
+			return errors.New("failed to write export: " + err.Error())
+		}
+		write = func(product exportedProduct) error {
+			return writer.Write([]string{
+				strconv.FormatUint(uint64(product.ProductID), 10),
+				product.SKU,
+				product.Name,
+				product.Description,
+				strconv.FormatInt(product.Price, 10),
+				product.Currency,
+				strconv.Itoa(product.Stock),
+				product.Variant,
+			})
+		}
+		flush = func() error {
+			writer.Flush()
+			return writer.Error()
+		}
+	case ImportFormatNDJSON:
+		encoder := json.NewEncoder(w)
+		write = func(product exportedProduct) error { return encoder.Encode(product) }
+	default:
+		return ErrUnsupportedImportFormat
+	}
+
+	rows, err := s.db.Model(&models.ProductVariant{}).
+		Select("products.id, product_variants.sku, products.name, products.description, COALESCE(product_variants.price, products.price), products.currency, product_variants.stock, COALESCE(product_variants.title, '')").
+		Joins("JOIN products ON products.id = product_variants.product_id AND products.deleted_at IS NULL").
+		Order("products.id, product_variants.position, product_variants.id").
+		Rows()
+	if err != nil {
+		return errors.New("failed to export products: " + err.Error())
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var product exportedProduct
+		var sku sql.NullString
+		if err := rows.Scan(&product.ProductID, &sku, &product.Name, &product.Description, &product.Price, &product.Currency, &product.Stock, &product.Variant); err != nil {
+			return errors.New("failed to export products: " + err.Error())
+		}
+		product.SKU = sku.String
+		if err := write(product); err != nil {
+			return errors.New("failed to write export: " + err.Error())
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return errors.New("failed to export products: " + err.Error())
+	}
+	if err := flush(); err != nil {
+		return errors.New("failed to write export: " + err.Error())
+	}
+	return nil
+}
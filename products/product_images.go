@@ -0,0 +1,405 @@
+package products
+
+import (
+	"bytes"
+	"context"
+	"ecommerce-api/config"
+	"ecommerce-api/models"
+	"ecommerce-api/storage"
+	"ecommerce-api/utils"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"log"
+	"net/http"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrImageTooLarge     = errors.New("image is too large")
+	ErrUnsupportedImage  = errors.New("unsupported image, expected a JPEG, PNG or GIF image")
+	ErrImageNotFound     = errors.New("image not found")
+	ErrTooManyImages     = errors.New("the product has the maximum number of images")
+	ErrInvalidImageOrder = errors.New("the image order must list every image of the product exactly once")
+)
+
+const (
+	// maxProductImages is the number of images a product can have.
+	maxProductImages = 20
+	// maxImagePixels bounds the decoded size of an upload, so a small file cannot expand into an
+	// image that exhausts memory.
+	maxImagePixels = 40_000_000
+	// thumbnailSize is the longer side of a thumbnail, in pixels.
+	thumbnailSize = 320
+)
+
+// imageExtensions maps the image types accepted for upload, as sniffed from their content, to the
+// file extension they are stored with.
+var imageExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+}
+
+// ImageSettings configures product image uploads.
+type ImageSettings struct {
+	// Store keeps the uploaded images and their thumbnails.
+	Store storage.BlobStore
+	// MaxSize is the largest image accepted, in bytes.
+	MaxSize int64
+}
+
+// ImageSettingsFromConfig reads the image upload settings from the application configuration
+func ImageSettingsFromConfig(appConfig *config.AppConfig) ImageSettings {
+	return ImageSettings{Store: storage.New(appConfig), MaxSize: int64(appConfig.IMAGE_MAX_SIZE)}
+}
+
+// MaxImageSize returns the largest image upload accepted, in bytes.
+func (s *ProductService) MaxImageSize() int64 {
+	return s.images.MaxSize
+}
+
+// AddProductImage stores an image of a product together with a thumbnail.
+//
+// The function takes three parameters:
+//   - ctx: The context of the request, which bounds the upload to the blob store.
+//   - productID: The product the image belongs to.
+//   - data: The uploaded file. Its type is sniffed from its content rather than taken from the client,
+//     and it must be a JPEG, PNG or GIF image of at most MaxImageSize bytes.
+//
+// The image is added after the product's other images. A product's first image becomes its primary image.
+//
+// The function returns the new image, or an error:
+// - "product not found" if the product does not exist.
+// - ErrImageTooLarge if the file is larger than the limit or decodes to too many pixels.
+// - ErrUnsupportedImage if the file is not an image of a supported type.
+// - ErrTooManyImages if the product already has the maximum number of images.
+// - An error with a descriptive message if the image cannot be stored or saved.
+func (s *ProductService) AddProductImage(ctx context.Context, productID uint, data []byte) (*models.ProductImage, error) {
+	if int64(len(data)) > s.images.MaxSize {
+		return nil, ErrImageTooLarge
+	}
+	if err := s.db.Select("id").Take(&models.Product{}, productID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("product not found")
+		}
+		return nil, errors.New("database error: " + err.Error())
+	}
+
+	contentType := http.DetectContentType(data)
+	extension, ok := imageExtensions[contentType]
+	if !ok {
+		return nil, ErrUnsupportedImage
+	}
+	thumb, thumbType, bounds, err := makeThumbnail(data, contentType)
+	if err != nil {
+		return nil, err
+	}
+
+	name, err := utils.GenerateRandomToken(16)
+	if err != nil {
+		return nil, errors.New("failed to name image: " + err.Error())
+	}
+	productImage := models.ProductImage{
+		ProductID:    productID,
+		Key:          fmt.Sprintf("products/%d/%s%s", productID, name, extension),
+		ThumbnailKey: fmt.Sprintf("products/%d/%s_thumb%s", productID, name, imageExtensions[thumbType]),
+		ContentType:  contentType,
+		Size:         int64(len(data)),
+		Width:        bounds.Dx(),
+		Height:       bounds.Dy(),
+	}
+	productImage.URL = s.images.Store.URL(productImage.Key)
+	productImage.ThumbnailURL = s.images.Store.URL(productImage.ThumbnailKey)
+
+	// The files are stored before the row is saved, so an image is never listed without its files.
+	if err := s.images.Store.Put(ctx, productImage.Key, data, contentType); err != nil {
+		return nil, err
+	}
+	if err := s.images.Store.Put(ctx, productImage.ThumbnailKey, thumb, thumbType); err != nil {
+		s.deleteBlobs(productImage.Key)
+		return nil, err
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := lockProduct(tx, productID); err != nil {
+			return err
+		}
+		var count int64
+		if err := tx.Model(&models.ProductImage{}).Where("product_id = ?", productID).Count(&count).Error; err != nil {
+			return errors.New("failed to count images: " + err.Error())
+		}
+		if count >= maxProductImages {
+			return ErrTooManyImages
+		}
+
+		var last struct{ Position *int }
+		if err := tx.Model(&models.ProductImage{}).Select("MAX(position) AS position").Where("product_id = ?", productID).Scan(&last).Error; err != nil {
+			return errors.New("failed to save image: " + err.Error())
+		}
+		if last.Position != nil {
+			productImage.Position = *last.Position + 1
+		}
+		productImage.IsPrimary = count == 0
+
+		if err := tx.Create(&productImage).Error; err != nil {
+			return errors.New("failed to save image: " + err.Error())
+		}
+		return nil
+	})
+	if err != nil {
+		s.deleteBlobs(productImage.Key, productImage.ThumbnailKey)
+		return nil, err
+	}
+	return &productImage, nil
+}
+
+// ReorderProductImages sets the order of a product's images.
+//
+// The function takes two parameters:
+// - productID: The product whose images are reordered.
+// - imageIDs: The IDs of all of the product's images, in their new order.
+//
+// The function returns the images in their new order, or an error:
+// - "product not found" if the product does not exist.
+// - ErrInvalidImageOrder if imageIDs is not a permutation of the product's images.
+// - An error with a descriptive message if there is an error while interacting with the database.
+func (s *ProductService) ReorderProductImages(productID uint, imageIDs []uint) ([]models.ProductImage, error) {
+	var images []models.ProductImage
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := lockProduct(tx, productID); err != nil {
+			return err
+		}
+		var existing []models.ProductImage
+		if err := tx.Where("product_id = ?", productID).Find(&existing).Error; err != nil {
+			return errors.New("failed to retrieve images: " + err.Error())
+		}
+
+		positions := make(map[uint]int, len(imageIDs))
+		for i, id := range imageIDs {
+			if _, seen := positions[id]; seen {
+				return ErrInvalidImageOrder
+			}
+			positions[id] = i
+		}
+		if len(positions) != len(existing) {
+			return ErrInvalidImageOrder
+		}
+		for _, image := range existing {
+			if _, ok := positions[image.ID]; !ok {
+				return ErrInvalidImageOrder
+			}
+		}
+
+		for _, image := range existing {
+			if image.Position == positions[image.ID] {
+				continue
+			}
+			if err := tx.Model(&image).Update("position", positions[image.ID]).Error; err != nil {
+				return errors.New("failed to reorder images: " + err.Error())
+			}
+		}
+
+		var err error
+		images, err = productImages(tx, productID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return images, nil
+}
+
+// SetPrimaryProductImage makes an image the primary image of its product, in place of the current one.
+//
+// The function returns the product's images, or an error:
+// - "product not found" if the product does not exist.
+// - ErrImageNotFound if the image does not belong to the product.
+// - An error with a descriptive message if there is an error while interacting with the database.
+func (s *ProductService) SetPrimaryProductImage(productID, imageID uint) ([]models.ProductImage, error) {
+	var images []models.ProductImage
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := lockProduct(tx, productID); err != nil {
+			return err
+		}
+		image, err := findProductImage(tx, productID, imageID)
+		if err != nil {
+			return err
+		}
+
+		if !image.IsPrimary {
+			if err := tx.Model(&models.ProductImage{}).Where("product_id = ? AND is_primary", productID).Update("is_primary", false).Error; err != nil {
+				return errors.New("failed to update images: " + err.Error())
+			}
+			if err := tx.Model(image).Update("is_primary", true).Error; err != nil {
+				return errors.New("failed to update images: " + err.Error())
+			}
+		}
+
+		images, err = productImages(tx, productID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return images, nil
+}
+
+// DeleteProductImage deletes an image of a product and its files. When the primary image is deleted,
+// the first of the remaining images becomes the primary image.
+//
+// The function returns an error:
+// - "product not found" if the product does not exist.
+// - ErrImageNotFound if the image does not belong to the product.
+// - An error with a descriptive message if there is an error while interacting with the database.
+// Files that cannot be deleted from the blob store are logged rather than failing the request.
+func (s *ProductService) DeleteProductImage(productID, imageID uint) error {
+	var deleted *models.ProductImage
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := lockProduct(tx, productID); err != nil {
+			return err
+		}
+		image, err := findProductImage(tx, productID, imageID)
+		if err != nil {
+			return err
+		}
+		if err := tx.Delete(image).Error; err != nil {
+			return errors.New("failed to delete image: " + err.Error())
+		}
+
+		if image.IsPrimary {
+			var next models.ProductImage
+			err := tx.Where("product_id = ?", productID).Order("position, id").Take(&next).Error
+			if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+				return errors.New("failed to update images: " + err.Error())
+			}
+			if err == nil {
+				if err := tx.Model(&next).Update("is_primary", true).Error; err != nil {
+					return errors.New("failed to update images: " + err.Error())
+				}
+			}
+		}
+
+		deleted = image
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	s.deleteBlobs(deleted.Key, deleted.ThumbnailKey)
+	return nil
+}
+
+// deleteBlobs removes files from the blob store once the rows that referenced them are gone.
+// Failures only leave unreferenced files behind, so they are logged.
+func (s *ProductService) deleteBlobs(keys ...string) {
+	for _, key := range keys {
+		if err := s.images.Store.Delete(context.Background(), key); err != nil {
+			log.Printf("failed to delete %s from storage: %v", key, err)
+		}
+	}
+}
+
+// lockProduct locks a product row for the rest of the transaction, or returns "product not found".
+func lockProduct(tx *gorm.DB, productID uint) error {
+	err := tx.Clauses(clause.Locking{Strength: clause.LockingStrengthUpdate}).Select("id").Take(&models.Product{}, productID).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errors.New("product not found")
+		}
+		return errors.New("database error: " + err.Error())
+	}
+	return nil
+}
+
+func findProductImage(tx *gorm.DB, productID, imageID uint) (*models.ProductImage, error) {
+	var image models.ProductImage
+	if err := tx.Where("id = ? AND product_id = ?", imageID, productID).Take(&image).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrImageNotFound
+		}
+		return nil, errors.New("failed to retrieve image: " + err.Error())
+	}
+	return &image, nil
+}
+
+// productImages returns a product's images in display order.
+func productImages(tx *gorm.DB, productID uint) ([]models.ProductImage, error) {
+	images := []models.ProductImage{}
+	if err := tx.Where("product_id = ?", productID).Order("position, id").Find(&images).Error; err != nil {
+		return nil, errors.New("failed to retrieve images: " + err.Error())
+	}
+	return images, nil
+}
+
+// makeThumbnail decodes an image and encodes a thumbnail of it, as a JPEG for JPEG images and as a PNG
+// otherwise, so transparency is kept. It returns the thumbnail, its type and the image's bounds.
+func makeThumbnail(data []byte, contentType string) ([]byte, string, image.Rectangle, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", image.Rectangle{}, ErrUnsupportedImage
+	}
+	if cfg.Width*cfg.Height > maxImagePixels {
+		return nil, "", image.Rectangle{}, ErrImageTooLarge
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", image.Rectangle{}, ErrUnsupportedImage
+	}
+
+	thumb := thumbnail(img, thumbnailSize)
+	var buf bytes.Buffer
+	thumbType := "image/png"
+	if contentType == "image/jpeg" {
+		thumbType = "image/jpeg"
+		err = jpeg.Encode(&buf, thumb, &jpeg.Options{Quality: 85})
+	} else {
+		err = png.Encode(&buf, thumb)
+	}
+	if err != nil {
+		return nil, "", image.Rectangle{}, errors.New("failed to create thumbnail: " + err.Error())
+	}
+	return buf.Bytes(), thumbType, img.Bounds(), nil
+}
+
+// thumbnail scales img down to fit within size pixels on its longer side. Each thumbnail pixel is the
+// average of the source pixels it covers. Images that already fit keep their size.
+func thumbnail(img image.Image, size int) *image.RGBA {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	thumbWidth, thumbHeight := width, height
+	if width > size || height > size {
+		if width >= height {
+			thumbWidth, thumbHeight = size, max(1, height*size/width)
+		} else {
+			thumbWidth, thumbHeight = max(1, width*size/height), size
+		}
+	}
+
+	thumb := image.NewRGBA(image.Rect(0, 0, thumbWidth, thumbHeight))
+	for y := 0; y < thumbHeight; y++ {
+		y0, y1 := bounds.Min.Y+y*height/thumbHeight, bounds.Min.Y+(y+1)*height/thumbHeight
+		for x := 0; x < thumbWidth; x++ {
+			x0, x1 := bounds.Min.X+x*width/thumbWidth, bounds.Min.X+(x+1)*width/thumbWidth
+
+			// RGBA returns alpha-premultiplied values, which average correctly across transparent pixels.
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					pr, pg, pb, pa := img.At(sx, sy).RGBA()
+					r, g, b, a = r+uint64(pr), g+uint64(pg), b+uint64(pb), a+uint64(pa)
+					n++
+				}
+			}
+			thumb.SetRGBA(x, y, color.RGBA{R: uint8(r / n >> 8), G: uint8(g / n >> 8), B: uint8(b / n >> 8), A: uint8(a / n >> 8)})
+		}
+	}
+	return thumb
+}
@@ -0,0 +1,161 @@
+package products
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/png"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+// memoryStore is a BlobStore that keeps files in a map.
+type memoryStore struct {
+	files map[string][]byte
+}
+
+func (s *memoryStore) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	s.files[key] = data
+	return nil
+}
+
+func (s *memoryStore) Delete(ctx context.Context, key string) error {
+	delete(s.files, key)
+	return nil
+}
+
+func (s *memoryStore) URL(key string) string {
+	return "https://cdn.example.com/" + key
+}
+
+func newMockImageService(t *testing.T) (*ProductService, *memoryStore, sqlmock.Sqlmock) {
+	service, mock := newMockProductService(t)
+	store := &memoryStore{files: map[string][]byte{}}
+	service.images = ImageSettings{Store: store, MaxSize: 1 << 20}
+	return service, store, mock
+}
+
+func encodePNG(t *testing.T, width, height int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 200, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("failed to encode test image: %s", err)
+	}
+	return buf.Bytes()
+}
+
+func TestThumbnail(t *testing.T) {
+	wide := image.NewRGBA(image.Rect(0, 0, 1000, 500))
+	assert.Equal(t, image.Rect(0, 0, 320, 160), thumbnail(wide, 320).Bounds())
+
+	tall := image.NewRGBA(image.Rect(0, 0, 90, 900))
+	assert.Equal(t, image.Rect(0, 0, 32, 320), thumbnail(tall, 320).Bounds())
+
+	small := image.NewRGBA(image.Rect(0, 0, 40, 30))
+	assert.Equal(t, image.Rect(0, 0, 40, 30), thumbnail(small, 320).Bounds())
+
+	// A half transparent image keeps its colour and transparency when scaled down.
+	faded := image.NewNRGBA(image.Rect(0, 0, 4, 4))
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 4; x++ {
+			faded.SetNRGBA(x, y, color.NRGBA{R: 255, A: 128})
+		}
+	}
+	r, g, b, a := thumbnail(faded, 2).At(1, 1).RGBA()
+	assert.Equal(t, [4]uint32{128, 0, 0, 128}, [4]uint32{r >> 8, g >> 8, b >> 8, a >> 8})
+}
+
+func TestAddProductImage(t *testing.T) {
+	service, store, mock := newMockImageService(t)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT "id" FROM "products" WHERE "products"."id" = $1 AND "products"."deleted_at" IS NULL LIMIT $2`)).
+		WithArgs(7, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT "id" FROM "products" WHERE "products"."id" = $1 AND "products"."deleted_at" IS NULL LIMIT $2 FOR UPDATE`)).
+		WithArgs(7, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM "product_images" WHERE product_id = $1`)).
+		WithArgs(7).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT MAX(position) AS position FROM "product_images" WHERE product_id = $1`)).
+		WithArgs(7).
+		WillReturnRows(sqlmock.NewRows([]string{"position"}).AddRow(4))
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "product_images"`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(31))
+	mock.ExpectCommit()
+
+	image, err := service.AddProductImage(context.Background(), 7, encodePNG(t, 640, 480))
+
+	assert.NoError(t, err)
+	assert.Equal(t, uint(31), image.ID)
+	assert.Equal(t, "image/png", image.ContentType)
+	assert.Equal(t, 640, image.Width)
+	assert.Equal(t, 480, image.Height)
+	assert.Equal(t, 5, image.Position)
+	assert.False(t, image.IsPrimary)
+	assert.Regexp(t, `^https://cdn\.example\.com/products/7/[A-Za-z0-9_-]+\.png$`, image.URL)
+	assert.Contains(t, store.files, image.Key)
+
+	thumb, err := png.DecodeConfig(bytes.NewReader(store.files[image.ThumbnailKey]))
+	assert.NoError(t, err)
+	assert.Equal(t, 320, thumb.Width)
+	assert.Equal(t, 240, thumb.Height)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAddProductImageRejectsOtherFiles(t *testing.T) {
+	service, store, mock := newMockImageService(t)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT "id" FROM "products" WHERE "products"."id" = $1 AND "products"."deleted_at" IS NULL LIMIT $2`)).
+		WithArgs(7, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+
+	// An HTML page is rejected even if the client claims it is an image.
+	_, err := service.AddProductImage(context.Background(), 7, []byte("<html><script>alert(1)</script></html>"))
+
+	assert.ErrorIs(t, err, ErrUnsupportedImage)
+	assert.Empty(t, store.files)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAddProductImageRejectsLargeFiles(t *testing.T) {
+	service, store, mock := newMockImageService(t)
+	service.images.MaxSize = 100
+
+	_, err := service.AddProductImage(context.Background(), 7, encodePNG(t, 64, 64))
+
+	assert.ErrorIs(t, err, ErrImageTooLarge)
+	assert.Empty(t, store.files)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestReorderProductImagesRequiresEveryImage(t *testing.T) {
+	service, _, mock := newMockImageService(t)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT "id" FROM "products" WHERE "products"."id" = $1 AND "products"."deleted_at" IS NULL LIMIT $2 FOR UPDATE`)).
+		WithArgs(7, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "product_images" WHERE product_id = $1`)).
+		WithArgs(7).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "product_id", "position"}).
+			AddRow(31, 7, 0).
+			AddRow(32, 7, 1).
+			AddRow(33, 7, 2))
+	mock.ExpectRollback()
+
+	_, err := service.ReorderProductImages(7, []uint{33, 31})
+
+	assert.ErrorIs(t, err, ErrInvalidImageOrder)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
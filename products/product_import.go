@@ -0,0 +1,550 @@
+package products
+
+import (
+	"bufio"
+	"bytes"
+	"ecommerce-api/models"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrUnsupportedImportFormat = errors.New("unsupported import format, expected csv or ndjson")
+	ErrInvalidImportFile       = errors.New("invalid import file")
+	ErrImportTooLarge          = errors.New("import file is too large")
+	ErrImportJobNotFound       = errors.New("import job not found")
+	errDuplicateImportSKU      = errors.New("the SKU appears on an earlier row of the file")
+	errImportWithoutSKU        = errors.New("the variant has no SKU, so it cannot be updated by import")
+)
+
+const (
+	ImportFormatCSV    = "csv"
+	ImportFormatNDJSON = "ndjson"
+
+	// MaxImportSize is the largest import file accepted, in bytes.
+	MaxImportSize = 20 << 20
+	// maxImportRows is the number of products an import file can hold.
+	maxImportRows = 50_000
+	// importProgressInterval is the number of rows processed between saves of a job's progress.
+	importProgressInterval = 100
+)
+
+// productColumns are the columns of the CSV format, in the order they are exported. The product_id
+// column marks the rows of an export, which only update existing variants. The variant column holds the
+// title of a variant of a product with options; it is informational and ignored on import.
+var productColumns = []string{"product_id", "sku", "name", "description", "price", "currency", "stock", "variant"}
+
+// requiredImportColumns are the columns a CSV import file must have.
+var requiredImportColumns = []string{"name", "description", "price", "stock"}
+
+var utf8BOM = []byte("\xef\xbb\xbf")
+
+// importRow is a product read from an import file, with the line it was read from and the problems
+// found while parsing it. productID is set for the rows of an export, and hasStock tells a stock of
+// zero from a missing one.
+type importRow struct {
+	line      int
+	product   CreateProduct
+	productID uint
+	hasStock  bool
+	errs      []models.ImportRowError
+}
+
+// importedVariantUpdate holds the binding rules of an import row that updates an existing variant by
+// its SKU. They are the rules of CreateProduct, except that the variant may be sold out.
+type importedVariantUpdate struct {
+	Name        string `json:"name" binding:"required,min=1"`
+	Description string `json:"description" binding:"required,min=1"`
+	Price       int64  `json:"price" binding:"required,gt=0"`
+	Currency    string `json:"currency" binding:"omitempty,iso4217"`
+	Stock       int    `json:"stock" binding:"gte=0"`
+	SKU         string `json:"sku" binding:"omitempty,max=64"`
+}
+
+// ImportFormat returns the format of an import file: the requested format if there is one, otherwise
+// the format given by the file's extension. "jsonl" is accepted as another name for NDJSON.
+//
+// The function returns ErrUnsupportedImportFormat if the format is unknown or cannot be told.
+func ImportFormat(format, filename string) (string, error) {
+	if format == "" {
+		format = strings.TrimPrefix(filepath.Ext(filename), ".")
+	}
+	switch strings.ToLower(format) {
+	case ImportFormatCSV:
+		return ImportFormatCSV, nil
+	case ImportFormatNDJSON, "jsonl":
+		return ImportFormatNDJSON, nil
+	}
+	return "", ErrUnsupportedImportFormat
+}
+
+// StartImport reads a CSV or NDJSON file of products and starts a background job that imports them.
+//
+// The function takes four parameters:
+//   - userID: The user who started the import.
+//   - format: ImportFormatCSV or ImportFormatNDJSON.
+//   - dryRun: Whether to only validate the rows and count the products that would be created and updated.
+//   - data: The file, of at most MaxImportSize bytes.
+//
+// Each row is a product with the fields of CreateProduct. A row whose SKU belongs to an existing product
+// updates that variant and its product: the name, description and currency of the product and the price
+// and stock of the variant, which may be zero. Other rows create a product as CreateProduct does and are
+// validated with the same rules. Rows of an export carry a product_id and only update: those whose
+// variant has no SKU are reported instead of creating a copy of the product. Rows are imported one by
+// one, so a row that fails does not stop the others and is recorded in the job's error report.
+//
+// The function returns the pending job, or an error:
+// - ErrUnsupportedImportFormat if the format is unknown.
+// - ErrImportTooLarge if the file is larger than the limit or has too many rows.
+// - ErrInvalidImportFile if the file cannot be read, such as a CSV file without a required column.
+// - An error with a descriptive message if there is an error while interacting with the database.
+func (s *ProductService) StartImport(userID uint, format string, dryRun bool, data []byte) (*models.ImportJob, error) {
+	if len(data) > MaxImportSize {
+		return nil, ErrImportTooLarge
+	}
+	rows, err := parseImport(format, data)
+	if err != nil {
+		return nil, err
+	}
+
+	job := models.ImportJob{
+		UserID:    userID,
+		Format:    format,
+		DryRun:    dryRun,
+		Status:    models.ImportJobStatusPending,
+		TotalRows: len(rows),
+	}
+	if err := s.db.Create(&job).Error; err != nil {
+		return nil, errors.New("failed to create import job: " + err.Error())
+	}
+
+	// The job runs on its own copy, so the caller can serialize the returned job while it runs.
+	running := job
+	go s.runImport(&running, rows)
+	return &job, nil
+}
+
+// GetImportJob retrieves an import job, including its error report.
+//
+// The function returns ErrImportJobNotFound if the job does not exist, and an error with a descriptive
+// message if there is an error while interacting with the database.
+func (s *ProductService) GetImportJob(id uint) (*models.ImportJob, error) {
+	var job models.ImportJob
+	if err := s.db.Take(&job, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrImportJobNotFound
+		}
+		return nil, errors.New("database error: " + err.Error())
+	}
+	return &job, nil
+}
+
+// WriteImportErrorReport writes the error report of an import job as CSV, one problem per line.
+func WriteImportErrorReport(w io.Writer, rowErrors []models.ImportRowError) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write([]string{"row", "sku", "field", "message"}); err != nil {
+		return err
+	}
+	for _, rowError := range rowErrors {
+		if err := writer.Write([]string{strconv.Itoa(rowError.Row), rowError.SKU, rowError.Field, rowError.Message}); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// FailInterruptedImports marks the import jobs that were still pending or running when the server
+// stopped as failed. Their files are not kept, so they cannot be resumed.
+func FailInterruptedImports(db *gorm.DB) error {
+	return db.Model(&models.ImportJob{}).
+		Where("status IN ?", []models.ImportJobStatus{models.ImportJobStatusPending, models.ImportJobStatusRunning}).
+		Updates(map[string]interface{}{
+			"status":      models.ImportJobStatusFailed,
+			"message":     "the server stopped before the import finished",
+			"finished_at": time.Now(),
+		}).Error
+}
+
+// runImport imports the rows of a job and records its progress and outcome.
+func (s *ProductService) runImport(job *models.ImportJob, rows []importRow) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("import job %d stopped: %v", job.ID, r)
+			s.finishImport(job, models.ImportJobStatusFailed, "the import stopped unexpectedly")
+		}
+	}()
+
+	startedAt := time.Now()
+	job.Status = models.ImportJobStatusRunning
+	job.StartedAt = &startedAt
+	if err := s.db.Save(job).Error; err != nil {
+		log.Printf("failed to start import job %d: %v", job.ID, err)
+		return
+	}
+
+	s.processImport(job, rows)
+	s.finishImport(job, models.ImportJobStatusCompleted, "")
+}
+
+// processImport imports or, for a dry run, checks each row, counting the products created and updated
+// and recording the rows that fail. The job's progress is saved every importProgressInterval rows.
+//
+// A row whose SKU belongs to a product in the catalog is validated with the rules of an update, which
+// allow a sold-out variant; other rows are validated with the rules of CreateProduct.
+func (s *ProductService) processImport(job *models.ImportJob, rows []importRow) {
+	seen := map[string]bool{}
+	for i, row := range rows {
+		rowErrors := row.errs
+		if len(rowErrors) == 0 && row.product.SKU != "" && seen[row.product.SKU] {
+			rowErrors = []models.ImportRowError{{Field: "sku", Message: errDuplicateImportSKU.Error()}}
+		}
+
+		var variant *models.ProductVariant
+		if len(rowErrors) == 0 {
+			var err error
+			if variant, err = s.findImportedVariant(row.product.SKU); err != nil {
+				rowErrors = []models.ImportRowError{{Message: err.Error()}}
+			} else {
+				rowErrors = checkImportRow(row, variant)
+			}
+		}
+
+		if len(rowErrors) == 0 {
+			seen[row.product.SKU] = true
+			var err error
+			switch {
+			case variant != nil:
+				if !job.DryRun {
+					err = s.updateImportedVariant(variant.ProductID, variant.ID, &row.product)
+				}
+			case job.DryRun:
+				// The SKU may still belong to a product in the trash.
+				if row.product.SKU != "" {
+					err = checkSKUsFree(s.db, []string{row.product.SKU}, 0)
+				}
+			default:
+				err = s.CreateProduct(&row.product)
+			}
+
+			switch {
+			case err != nil:
+				rowError := models.ImportRowError{Message: err.Error()}
+				if errors.Is(err, ErrSKUTaken) {
+					rowError.Field = "sku"
+				}
+				rowErrors = []models.ImportRowError{rowError}
+			case variant != nil:
+				job.Updated++
+			default:
+				job.Created++
+			}
+		}
+
+		if len(rowErrors) > 0 {
+			job.Failed++
+			for _, rowError := range rowErrors {
+				rowError.Row = row.line
+				rowError.SKU = row.product.SKU
+				job.Errors = append(job.Errors, rowError)
+			}
+		}
+
+		job.Processed = i + 1
+		if job.Processed%importProgressInterval == 0 {
+			if err := s.db.Save(job).Error; err != nil {
+				log.Printf("failed to save progress of import job %d: %v", job.ID, err)
+			}
+		}
+	}
+}
+
+// finishImport records the outcome of a job.
+func (s *ProductService) finishImport(job *models.ImportJob, status models.ImportJobStatus, message string) {
+	finishedAt := time.Now()
+	job.Status = status
+	job.Message = message
+	job.FinishedAt = &finishedAt
+	if err := s.db.Save(job).Error; err != nil {
+		log.Printf("failed to finish import job %d: %v", job.ID, err)
+	}
+}
+
+// findImportedVariant returns the variant of a product in the catalog with the SKU, or nil if there is
+// none or the SKU is empty.
+func (s *ProductService) findImportedVariant(sku string) (*models.ProductVariant, error) {
+	if sku == "" {
+		return nil, nil
+	}
+	var variant models.ProductVariant
+	err := s.db.Select("product_variants.id", "product_variants.product_id").
+		Joins("JOIN products ON products.id = product_variants.product_id AND products.deleted_at IS NULL").
+		Where("product_variants.sku = ?", sku).
+		Take(&variant).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, errors.New("failed to look up SKU: " + err.Error())
+	}
+	return &variant, nil
+}
+
+// updateImportedVariant applies an imported row to the variant with its SKU and to the variant's product.
+// The price of a product with a single variant is the product's price; the variant of a product with
+// several variants overrides the product's price unless the imported price is the same.
+func (s *ProductService) updateImportedVariant(productID, variantID uint, input *CreateProduct) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var product models.Product
+		if err := tx.Clauses(clause.Locking{Strength: clause.LockingStrengthUpdate}).Select("id", "price").Take(&product, productID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errors.New("product not found")
+			}
+			return errors.New("database error: " + err.Error())
+		}
+		var variants []models.ProductVariant
+		if err := tx.Select("id", "stock").Where("product_id = ?", productID).Find(&variants).Error; err != nil {
+			return errors.New("failed to retrieve variants: " + err.Error())
+		}
+
+		stock := 0
+		for _, variant := range variants {
+			if variant.ID == variantID {
+				stock += input.Stock
+			} else {
+				stock += variant.Stock
+			}
+		}
+
+		productUpdates := map[string]interface{}{"name": input.Name, "description": input.Description, "stock": stock}
+		if input.Currency != "" {
+			productUpdates["currency"] = input.Currency
+		}
+		variantUpdates := map[string]interface{}{"stock": input.Stock, "price": nil}
+		if len(variants) == 1 {
+			productUpdates["price"] = input.Price
+		} else if input.Price != product.Price {
+			variantUpdates["price"] = input.Price
+		}
+
+		if err := tx.Model(&models.ProductVariant{}).Where("id = ?", variantID).Updates(variantUpdates).Error; err != nil {
+			return errors.New("failed to update variant: " + err.Error())
+		}
+		if err := tx.Model(&product).Updates(productUpdates).Error; err != nil {
+			return errors.New("failed to update product: " + err.Error())
+		}
+		return nil
+	})
+}
+
+// checkImportRow validates a row that updates the variant, or creates a product when variant is nil.
+//
+// Rows of an export carry the ID of their product. Such a row can only update the variant with its SKU,
+// so that a variant without a SKU is reported rather than imported as a new product.
+func checkImportRow(row importRow, variant *models.ProductVariant) []models.ImportRowError {
+	switch {
+	case variant == nil && row.productID != 0 && row.product.SKU == "":
+		return []models.ImportRowError{{Field: "sku", Message: errImportWithoutSKU.Error()}}
+	case variant == nil && row.productID != 0:
+		return []models.ImportRowError{{Field: "sku", Message: fmt.Sprintf("no variant of product %d has the SKU", row.productID)}}
+	case variant == nil:
+		return validateImportRow(&row.product)
+	case row.productID != 0 && row.productID != variant.ProductID:
+		return []models.ImportRowError{{Field: "product_id", Message: fmt.Sprintf("the SKU belongs to product %d", variant.ProductID)}}
+	}
+
+	update := importedVariantUpdate(row.product)
+	rowErrors := validateImportRow(&update)
+	if !row.hasStock {
+		rowErrors = append(rowErrors, models.ImportRowError{Field: "stock", Message: "is required"})
+	}
+	return rowErrors
+}
+
+// validateImportRow checks a row with the binding rules of its struct, CreateProduct or
+// importedVariantUpdate.
+func validateImportRow(product interface{}) []models.ImportRowError {
+	err := binding.Validator.ValidateStruct(product)
+	if err == nil {
+		return nil
+	}
+	var fieldErrors validator.ValidationErrors
+	if !errors.As(err, &fieldErrors) {
+		return []models.ImportRowError{{Message: err.Error()}}
+	}
+
+	rowErrors := make([]models.ImportRowError, 0, len(fieldErrors))
+	for _, fieldError := range fieldErrors {
+		rowErrors = append(rowErrors, models.ImportRowError{
+			Field:   strings.ToLower(fieldError.Field()),
+			Message: ruleMessage(fieldError),
+		})
+	}
+	return rowErrors
+}
+
+// ruleMessage describes a failed binding rule of an import row.
+func ruleMessage(fieldError validator.FieldError) string {
+	switch fieldError.Tag() {
+	case "required":
+		return "is required"
+	case "min":
+		return "must not be empty"
+	case "max":
+		return "must be at most " + fieldError.Param() + " characters"
+	case "gt":
+		return "must be greater than " + fieldError.Param()
+	case "gte":
+		return "must be at least " + fieldError.Param()
+	case "iso4217":
+		return "must be an ISO 4217 currency code"
+	}
+	return fmt.Sprintf("failed the %q rule", fieldError.Tag())
+}
+
+// parseImport reads the products of an import file.
+func parseImport(format string, data []byte) ([]importRow, error) {
+	data = bytes.TrimPrefix(data, utf8BOM)
+	switch format {
+	case ImportFormatCSV:
+		return parseCSVImport(data)
+	case ImportFormatNDJSON:
+		return parseNDJSONImport(data)
+	}
+	return nil, ErrUnsupportedImportFormat
+}
+
+// parseCSVImport reads a CSV file with a header line naming its columns. Columns are matched by name,
+// in any order and case, and unknown columns are ignored.
+func parseCSVImport(data []byte) ([]importRow, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("%w: the file is empty", ErrInvalidImportFile)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidImportFile, err)
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range requiredImportColumns {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("%w: the %q column is missing", ErrInvalidImportFile, name)
+		}
+	}
+
+	rows := []importRow{}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidImportFile, err)
+		}
+		if len(rows) == maxImportRows {
+			return nil, fmt.Errorf("%w: more than %d rows", ErrImportTooLarge, maxImportRows)
+		}
+
+		value := func(column string) string {
+			i, ok := columns[column]
+			if !ok || i >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[i])
+		}
+		line, _ := reader.FieldPos(0)
+		row := importRow{
+			line: line,
+			product: CreateProduct{
+				Name:        value("name"),
+				Description: value("description"),
+				Currency:    value("currency"),
+				SKU:         value("sku"),
+			},
+		}
+		if price := value("price"); price != "" {
+			if row.product.Price, err = strconv.ParseInt(price, 10, 64); err != nil {
+				row.errs = append(row.errs, models.ImportRowError{Field: "price", Message: "must be a whole number of the currency's minor unit"})
+			}
+		}
+		if stock := value("stock"); stock != "" {
+			row.hasStock = true
+			if row.product.Stock, err = strconv.Atoi(stock); err != nil {
+				row.errs = append(row.errs, models.ImportRowError{Field: "stock", Message: "must be a whole number"})
+			}
+		}
+		if productID := value("product_id"); productID != "" {
+			id, err := strconv.ParseUint(productID, 10, 32)
+			if err != nil {
+				row.errs = append(row.errs, models.ImportRowError{Field: "product_id", Message: "must be a product ID"})
+			}
+			row.productID = uint(id)
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// parseNDJSONImport reads a file with one JSON object per line, with the fields of CreateProduct.
+// Blank lines are skipped and unknown fields are ignored.
+func parseNDJSONImport(data []byte) ([]importRow, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64<<10), MaxImportSize)
+
+	rows := []importRow{}
+	for line := 1; scanner.Scan(); line++ {
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+		if len(rows) == maxImportRows {
+			return nil, fmt.Errorf("%w: more than %d rows", ErrImportTooLarge, maxImportRows)
+		}
+
+		row := importRow{line: line}
+		var fields struct {
+			ProductID uint `json:"product_id"`
+			Stock     *int `json:"stock"`
+		}
+		err := json.Unmarshal(text, &row.product)
+		if err == nil {
+			err = json.Unmarshal(text, &fields)
+			row.productID, row.hasStock = fields.ProductID, fields.Stock != nil
+		}
+		if err != nil {
+			rowError := models.ImportRowError{Message: "invalid JSON: " + err.Error()}
+			var typeError *json.UnmarshalTypeError
+			if errors.As(err, &typeError) {
+				rowError = models.ImportRowError{Field: typeError.Field, Message: "must be a string"}
+				if typeError.Type.Kind() != reflect.String {
+					rowError.Message = "must be a whole number"
+				}
+			}
+			row.errs = []models.ImportRowError{rowError}
+		}
+		rows = append(rows, row)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidImportFile, err)
+	}
+	return rows, nil
+}
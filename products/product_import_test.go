@@ -0,0 +1,228 @@
+package products
+
+import (
+	"bytes"
+	"regexp"
+	"testing"
+
+	"ecommerce-api/models"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImportFormat(t *testing.T) {
+	tests := []struct {
+		format   string
+		filename string
+		want     string
+		wantErr  error
+	}{
+		{"", "catalog.csv", ImportFormatCSV, nil},
+		{"", "catalog.JSONL", ImportFormatNDJSON, nil},
+		{"ndjson", "catalog.txt", ImportFormatNDJSON, nil},
+		{"csv", "catalog.ndjson", ImportFormatCSV, nil},
+		{"", "catalog.xlsx", "", ErrUnsupportedImportFormat},
+	}
+
+	for _, tt := range tests {
+		format, err := ImportFormat(tt.format, tt.filename)
+		assert.Equal(t, tt.want, format, tt.filename)
+		assert.ErrorIs(t, err, tt.wantErr)
+	}
+}
+
+func TestParseCSVImport(t *testing.T) {
+	data := "\xef\xbb\xbfName,SKU,Price,Stock,Description,Variant\n" +
+		"Mug,MUG-1,1200,5,\"A mug,\nwith a handle\",\n" +
+		"Cap,,twelve,3,A cap,Blue\n"
+
+	rows, err := parseImport(ImportFormatCSV, []byte(data))
+
+	assert.NoError(t, err)
+	assert.Len(t, rows, 2)
+	assert.Equal(t, 2, rows[0].line)
+	assert.Equal(t, CreateProduct{Name: "Mug", Description: "A mug,\nwith a handle", Price: 1200, Stock: 5, SKU: "MUG-1"}, rows[0].product)
+	assert.Empty(t, rows[0].errs)
+	// The description of the first row spans two lines.
+	assert.Equal(t, 4, rows[1].line)
+	assert.Equal(t, []models.ImportRowError{{Field: "price", Message: "must be a whole number of the currency's minor unit"}}, rows[1].errs)
+}
+
+func TestParseCSVImportRequiresColumns(t *testing.T) {
+	_, err := parseImport(ImportFormatCSV, []byte("sku,name,description,stock\nMUG-1,Mug,A mug,5\n"))
+	assert.ErrorIs(t, err, ErrInvalidImportFile)
+	assert.ErrorContains(t, err, `"price"`)
+
+	_, err = parseImport(ImportFormatCSV, []byte(""))
+	assert.ErrorIs(t, err, ErrInvalidImportFile)
+}
+
+func TestParseNDJSONImport(t *testing.T) {
+	data := `{"sku":"MUG-1","name":"Mug","description":"A mug","price":1200,"currency":"EUR","stock":5,"variant":""}` + "\n\n" +
+		`{"name":"Cap","price":"12"}` + "\n" +
+		`{"name":` + "\n"
+
+	rows, err := parseImport(ImportFormatNDJSON, []byte(data))
+
+	assert.NoError(t, err)
+	assert.Len(t, rows, 3)
+	assert.Equal(t, CreateProduct{Name: "Mug", Description: "A mug", Price: 1200, Currency: "EUR", Stock: 5, SKU: "MUG-1"}, rows[0].product)
+	assert.Equal(t, 3, rows[1].line)
+	assert.Equal(t, []models.ImportRowError{{Field: "price", Message: "must be a whole number"}}, rows[1].errs)
+	assert.Equal(t, 4, rows[2].line)
+	assert.Len(t, rows[2].errs, 1)
+	assert.Contains(t, rows[2].errs[0].Message, "invalid JSON")
+}
+
+func TestValidateImportRow(t *testing.T) {
+	assert.Empty(t, validateImportRow(&CreateProduct{Name: "Mug", Description: "A mug", Price: 1200, Stock: 5}))
+
+	rowErrors := validateImportRow(&CreateProduct{Name: "Mug", Price: -1, Currency: "euro", Stock: 5})
+	assert.Equal(t, []models.ImportRowError{
+		{Field: "description", Message: "is required"},
+		{Field: "price", Message: "must be greater than 0"},
+		{Field: "currency", Message: "must be an ISO 4217 currency code"},
+	}, rowErrors)
+}
+
+func TestProcessImportDryRun(t *testing.T) {
+	service, mock := newMockProductService(t)
+	rows, err := parseImport(ImportFormatCSV, []byte("sku,name,description,price,stock\n"+
+		"MUG-1,Mug,A mug,1200,5\n"+
+		"CAP-1,Cap,A cap,900,3\n"+
+		"PEN-1,Pen,,100,10\n"+
+		"MUG-1,Mug,A mug,1100,5\n"+
+		",Hat,A hat,1500,2\n"))
+	assert.NoError(t, err)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT product_variants.id,product_variants.product_id FROM "product_variants" JOIN products ON products.id = product_variants.product_id AND products.deleted_at IS NULL WHERE product_variants.sku = $1 LIMIT $2`)).
+		WithArgs("MUG-1", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "product_id"}).AddRow(11, 7))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT product_variants.id,product_variants.product_id FROM "product_variants" JOIN products`)).
+		WithArgs("CAP-1", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "product_id"}))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM "product_variants" WHERE sku IN ($1) AND product_id <> $2`)).
+		WithArgs("CAP-1", 0).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT product_variants.id,product_variants.product_id FROM "product_variants" JOIN products`)).
+		WithArgs("PEN-1", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "product_id"}))
+
+	job := &models.ImportJob{DryRun: true}
+	service.processImport(job, rows)
+
+	assert.Equal(t, 5, job.Processed)
+	assert.Equal(t, 2, job.Created)
+	assert.Equal(t, 1, job.Updated)
+	assert.Equal(t, 2, job.Failed)
+	assert.Equal(t, []models.ImportRowError{
+		{Row: 4, SKU: "PEN-1", Field: "description", Message: "is required"},
+		{Row: 5, SKU: "MUG-1", Field: "sku", Message: errDuplicateImportSKU.Error()},
+	}, job.Errors)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestProcessImportUpdatesVariantBySKU(t *testing.T) {
+	service, mock := newMockProductService(t)
+	rows, err := parseImport(ImportFormatNDJSON, []byte(`{"sku":"MUG-1-RED","name":"Mug","description":"A mug","price":1400,"stock":8}`))
+	assert.NoError(t, err)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT product_variants.id,product_variants.product_id FROM "product_variants" JOIN products`)).
+		WithArgs("MUG-1-RED", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "product_id"}).AddRow(12, 7))
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT "id","price" FROM "products" WHERE "products"."id" = $1 AND "products"."deleted_at" IS NULL LIMIT $2 FOR UPDATE`)).
+		WithArgs(7, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "price"}).AddRow(7, 1200))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT "id","stock" FROM "product_variants" WHERE product_id = $1`)).
+		WithArgs(7).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "stock"}).AddRow(11, 4).AddRow(12, 2))
+	// The red variant costs more than the product, so it overrides the product's price.
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "product_variants" SET "price"=$1,"stock"=$2,"updated_at"=$3 WHERE id = $4`)).
+		WithArgs(int64(1400), 8, sqlmock.AnyArg(), 12).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "products" SET "description"=$1,"name"=$2,"stock"=$3,"updated_at"=$4 WHERE "products"."deleted_at" IS NULL AND "id" = $5`)).
+		WithArgs("A mug", "Mug", 12, sqlmock.AnyArg(), 7).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	job := &models.ImportJob{}
+	service.processImport(job, rows)
+
+	assert.Empty(t, job.Errors)
+	assert.Equal(t, 1, job.Updated)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func expectExport(mock sqlmock.Sqlmock) {
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT products.id, product_variants.sku, products.name, products.description, COALESCE(product_variants.price, products.price), products.currency, product_variants.stock, COALESCE(product_variants.title, '') FROM "product_variants" JOIN products ON products.id = product_variants.product_id AND products.deleted_at IS NULL ORDER BY products.id, product_variants.position, product_variants.id`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "sku", "name", "description", "price", "currency", "stock", "title"}).
+			AddRow(7, "MUG-1-S", "Mug", "A mug, with a handle", 1200, "EUR", 0, "S").
+			AddRow(8, nil, "Cap", "A cap", 900, "USD", 3, ""))
+}
+
+func TestExportProducts(t *testing.T) {
+	service, mock := newMockProductService(t)
+	expectExport(mock)
+
+	var buf bytes.Buffer
+	err := service.ExportProducts(&buf, ImportFormatCSV)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "product_id,sku,name,description,price,currency,stock,variant\n"+
+		"7,MUG-1-S,Mug,\"A mug, with a handle\",1200,EUR,0,S\n"+
+		"8,,Cap,A cap,900,USD,3,\n", buf.String())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestExportImportRoundTrip(t *testing.T) {
+	// The cap is on the third line of the CSV export, after the header, and the second line of the
+	// NDJSON export.
+	for format, capRow := range map[string]int{ImportFormatCSV: 3, ImportFormatNDJSON: 2} {
+		service, mock := newMockProductService(t)
+		expectExport(mock)
+		var buf bytes.Buffer
+		assert.NoError(t, service.ExportProducts(&buf, format), format)
+
+		rows, err := parseImport(format, buf.Bytes())
+		assert.NoError(t, err, format)
+
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT product_variants.id,product_variants.product_id FROM "product_variants" JOIN products`)).
+			WithArgs("MUG-1-S", 1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "product_id"}).AddRow(11, 7))
+
+		job := &models.ImportJob{DryRun: true}
+		service.processImport(job, rows)
+
+		// The sold-out variant is updated, and the variant without a SKU is reported rather than
+		// created again as a new product.
+		assert.Equal(t, 1, job.Updated, format)
+		assert.Equal(t, 0, job.Created, format)
+		assert.Equal(t, []models.ImportRowError{{Row: capRow, Field: "sku", Message: errImportWithoutSKU.Error()}}, job.Errors, format)
+		assert.NoError(t, mock.ExpectationsWereMet(), format)
+	}
+}
+
+func TestCheckImportRow(t *testing.T) {
+	product := CreateProduct{Name: "Mug", Description: "A mug", Price: 1200, SKU: "MUG-1"}
+	variant := &models.ProductVariant{ID: 11, ProductID: 7}
+
+	// A new product needs stock, but an update may sell a variant out.
+	assert.Equal(t, []models.ImportRowError{{Field: "stock", Message: "is required"}},
+		checkImportRow(importRow{product: product, hasStock: true}, nil))
+	assert.Empty(t, checkImportRow(importRow{product: product, hasStock: true}, variant))
+	assert.Equal(t, []models.ImportRowError{{Field: "stock", Message: "is required"}},
+		checkImportRow(importRow{product: product}, variant))
+
+	product.Stock = -1
+	assert.Equal(t, []models.ImportRowError{{Field: "stock", Message: "must be at least 0"}},
+		checkImportRow(importRow{product: product, hasStock: true}, variant))
+
+	// A row of an export only updates the variants of its product.
+	product.Stock = 5
+	assert.Equal(t, []models.ImportRowError{{Field: "product_id", Message: "the SKU belongs to product 7"}},
+		checkImportRow(importRow{product: product, productID: 8, hasStock: true}, variant))
+	assert.Equal(t, []models.ImportRowError{{Field: "sku", Message: "no variant of product 8 has the SKU"}},
+		checkImportRow(importRow{product: product, productID: 8, hasStock: true}, nil))
+}
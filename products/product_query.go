@@ -0,0 +1,118 @@
+package products
+
+import (
+	"ecommerce-api/models"
+	"ecommerce-api/utils"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// productSortColumns whitelists the fields GET /products can be sorted by.
+var productSortColumns = map[string]string{
+	"created_at": "created_at",
+	"price":      "price",
+	"name":       "name",
+}
+
+// productSort is a parsed sort option such as "-price".
+type productSort struct {
+	key        string
+	column     string
+	descending bool
+}
+
+// parseProductSort parses a sort option; a leading "-" sorts in descending order.
+// An empty option sorts newest first.
+func parseProductSort(option string) (productSort, error) {
+	if option == "" {
+		option = "-created_at"
+	}
+	column, ok := productSortColumns[strings.TrimPrefix(option, "-")]
+	if !ok {
+		return productSort{}, ErrInvalidSort
+	}
+	return productSort{key: option, column: column, descending: strings.HasPrefix(option, "-")}, nil
+}
+
+// order returns the ORDER BY clause. The primary key breaks ties so keyset pagination is stable.
+func (sort productSort) order() string {
+	if sort.descending {
+		return sort.column + " DESC, id DESC"
+	}
+	return sort.column + ", id"
+}
+
+// after returns the condition selecting the rows that come after a cursor. It expects the cursor's
+// sort value twice followed by its ID.
+func (sort productSort) after() string {
+	op := ">"
+	if sort.descending {
+		op = "<"
+	}
+	return sort.column + " " + op + " ? OR (" + sort.column + " = ? AND id " + op + " ?)"
+}
+
+// cursorValue formats the sort key of a product for a cursor.
+func (sort productSort) cursorValue(product models.Product) string {
+	switch sort.column {
+	case "price":
+		return strconv.FormatInt(product.Price, 10)
+	case "name":
+		return product.Name
+	}
+	return product.CreatedAt.UTC().Format(time.RFC3339Nano)
+}
+
+// parseCursorValue is the inverse of cursorValue.
+func (sort productSort) parseCursorValue(value string) (interface{}, error) {
+	switch sort.column {
+	case "price":
+		return strconv.ParseInt(value, 10, 64)
+	case "name":
+		return value, nil
+	}
+	return time.Parse(time.RFC3339Nano, value)
+}
+
+// categoryProducts selects the products assigned to the category with a slug.
+const categoryProducts = `id IN (SELECT pc.product_id FROM product_categories pc JOIN categories c ON c.id = pc.category_id WHERE c.slug = ?)`
+
+// subtreeProducts selects the products assigned to the category with a slug or to any of its descendants.
+const subtreeProducts = `id IN (SELECT product_id FROM product_categories WHERE category_id IN (
+	WITH RECURSIVE subtree AS (
+		SELECT id FROM categories WHERE slug = ?
+		UNION
+		SELECT c.id FROM categories c JOIN subtree s ON c.parent_id = s.id
+	) SELECT id FROM subtree))`
+
+// productFilters returns a scope applying the filter options of a listing query.
+func productFilters(query ListProductsQuery) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if query.MinPrice != nil {
+			db = db.Where("price >= ?", *query.MinPrice)
+		}
+		if query.MaxPrice != nil {
+			db = db.Where("price <= ?", *query.MaxPrice)
+		}
+		if query.InStock {
+			db = db.Where("stock > 0")
+		}
+		if query.Name != "" {
+			db = db.Where(`LOWER(name) LIKE ? ESCAPE '\'`, utils.ContainsPattern(strings.ToLower(query.Name)))
+		}
+		if query.CreatedAfter != nil {
+			db = db.Where("created_at > ?", *query.CreatedAfter)
+		}
+		if query.Category != "" {
+			if query.IncludeDescendants {
+				db = db.Where(subtreeProducts, query.Category)
+			} else {
+				db = db.Where(categoryProducts, query.Category)
+			}
+		}
+		return db
+	}
+}
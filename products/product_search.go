@@ -0,0 +1,272 @@
+package products
+
+import (
+	"ecommerce-api/models"
+	"ecommerce-api/utils"
+	"errors"
+	"html"
+	"strings"
+	"unicode"
+
+	"gorm.io/gorm"
+)
+
+// SearchMode selects how ProductService.SearchProducts matches products.
+type SearchMode string
+
+const (
+	// SearchModeFullText ranks products with PostgreSQL full-text search over the generated
+	// search_vector column. It requires MigrateSearch to have run.
+	SearchModeFullText SearchMode = "fulltext"
+	// SearchModeILike matches products with case-insensitive LIKE on name and description. It works on
+	// any SQL dialect, so it is used whenever the database is not PostgreSQL.
+	SearchModeILike SearchMode = "ilike"
+)
+
+const (
+	highlightStart = "<mark>"
+	highlightStop  = "</mark>"
+	// headlineStart and headlineStop delimit the matches in ts_headline's output. They are private use
+	// characters, removed from the product's text beforehand, so they can be told from the text once it
+	// has been HTML-escaped and replaced with highlightStart and highlightStop.
+	headlineStart = "\uE000"
+	headlineStop  = "\uE001"
+	// snippetRadius is how many characters of context the ILIKE mode keeps around the first match.
+	snippetRadius = 60
+)
+
+var ErrEmptySearch = errors.New("search query has no searchable words")
+
+// ProductSearchResult is a product matched by a search, with its relevance and highlighted snippets.
+// The snippets are HTML: the product's text is escaped and matches are wrapped in <mark> tags.
+type ProductSearchResult struct {
+	models.Product
+	Rank          float64 `json:"rank"`
+	NameHighlight string  `json:"name_highlight"`
+	Snippet       string  `json:"snippet"`
+}
+
+// MigrateSearch adds the generated search_vector column and its GIN index to the products table.
+// Names weigh more than descriptions when ranking. It does nothing on databases other than PostgreSQL.
+func MigrateSearch(db *gorm.DB) error {
+	if db.Dialector.Name() != "postgres" {
+		return nil
+	}
+
+	if err := db.Exec(`ALTER TABLE products ADD COLUMN IF NOT EXISTS search_vector tsvector
+		GENERATED ALWAYS AS (
+			setweight(to_tsvector('english', coalesce(name, '')), 'A') ||
+			setweight(to_tsvector('english', coalesce(description, '')), 'B')
+		) STORED`).Error; err != nil {
+		return err
+	}
+
+	return db.Exec(`CREATE INDEX IF NOT EXISTS idx_products_search_vector ON products USING GIN (search_vector)`).Error
+}
+
+// searchTerm is one element of a search query: a single word, a word prefix written as "shirt*",
+// or a quoted phrase whose words must appear next to each other.
+type searchTerm struct {
+	words  []string
+	prefix bool
+}
+
+// parseSearchQuery splits a search query into terms. Words are lowercased and stripped of anything
+// but letters and digits, so the terms are safe to embed in a tsquery.
+func parseSearchQuery(query string) []searchTerm {
+	var terms []searchTerm
+	for i, part := range strings.Split(query, `"`) {
+		// Odd parts sit between a pair of quotes.
+		if i%2 == 1 {
+			if words := searchWords(part); len(words) > 0 {
+				terms = append(terms, searchTerm{words: words})
+			}
+			continue
+		}
+		for _, field := range strings.Fields(part) {
+			words := searchWords(field)
+			if len(words) == 0 {
+				continue
+			}
+			// Punctuation inside a word, as in "t-shirt", splits it into adjacent words.
+			terms = append(terms, searchTerm{words: words, prefix: strings.HasSuffix(field, "*")})
+		}
+	}
+	return terms
+}
+
+func searchWords(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// tsQuery renders terms as a to_tsquery expression in which every term must match.
+func tsQuery(terms []searchTerm) string {
+	parts := make([]string, len(terms))
+	for i, term := range terms {
+		words := append([]string{}, term.words...)
+		if term.prefix {
+			words[len(words)-1] += ":*"
+		}
+		if len(words) == 1 {
+			parts[i] = words[0]
+		} else {
+			parts[i] = "(" + strings.Join(words, " <-> ") + ")"
+		}
+	}
+	return strings.Join(parts, " & ")
+}
+
+// text returns the term as it must appear in a product for the ILIKE mode.
+func (term searchTerm) text() string {
+	return strings.Join(term.words, " ")
+}
+
+// searchFullText ranks matching products with ts_rank and highlights matches with ts_headline.
+func (s *ProductService) searchFullText(terms []searchTerm, limit, offset int) ([]ProductSearchResult, error) {
+	headline := "StartSel=" + headlineStart + ", StopSel=" + headlineStop + ", MaxWords=35, MinWords=15, MaxFragments=2"
+	delimiters := headlineStart + headlineStop
+
+	results := []ProductSearchResult{}
+	err := s.db.Table("products, to_tsquery('english', ?) AS query", tsQuery(terms)).
+		Select(`products.id, products.name, products.description, products.price, products.currency, products.stock,
+			products.created_at, products.updated_at,
+			ts_rank(products.search_vector, query) AS rank,
+			ts_headline('english', translate(products.name, ?, ''), query, ?) AS name_highlight,
+			ts_headline('english', translate(products.description, ?, ''), query, ?) AS snippet`, delimiters, headline, delimiters, headline).
+		Where("products.search_vector @@ query AND products.deleted_at IS NULL").
+		Order("rank DESC, products.id").
+		Limit(limit).
+		Offset(offset).
+		Scan(&results).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range results {
+		results[i].NameHighlight = markHeadline(results[i].NameHighlight)
+		results[i].Snippet = markHeadline(results[i].Snippet)
+	}
+	return results, nil
+}
+
+// headlineMarks turns the delimiters of ts_headline's matches into <mark> tags.
+var headlineMarks = strings.NewReplacer(headlineStart, highlightStart, headlineStop, highlightStop)
+
+// markHeadline HTML-escapes a ts_headline result and wraps its matches in <mark> tags.
+func markHeadline(headline string) string {
+	return headlineMarks.Replace(html.EscapeString(headline))
+}
+
+// searchILike matches products whose name or description contains every term, in primary key order.
+// Each result is scored by where the terms matched, but only the caller can order a page by that score.
+func (s *ProductService) searchILike(terms []searchTerm, limit, offset int) ([]ProductSearchResult, error) {
+	query := s.db.Model(&models.Product{}).
+		Select("id", "name", "description", "price", "currency", "stock", "created_at", "updated_at")
+	for _, term := range terms {
+		pattern := utils.ContainsPattern(term.text())
+		query = query.Where(`LOWER(name) LIKE ? ESCAPE '\' OR LOWER(description) LIKE ? ESCAPE '\'`, pattern, pattern)
+	}
+
+	var products []models.Product
+	if err := query.Order("id").Limit(limit).Offset(offset).Find(&products).Error; err != nil {
+		return nil, err
+	}
+
+	needles := make([]string, len(terms))
+	for i, term := range terms {
+		needles[i] = term.text()
+	}
+
+	results := make([]ProductSearchResult, len(products))
+	for i, product := range products {
+		results[i] = ProductSearchResult{
+			Product:       product,
+			Rank:          ilikeRank(product, needles),
+			NameHighlight: highlight(product.Name, needles, 0),
+			Snippet:       highlight(product.Description, needles, snippetRadius),
+		}
+	}
+	return results, nil
+}
+
+// ilikeRank scores a product by how many needles appear in its name (weight 1) and description (weight 0.4),
+// mirroring the A and B weights of the full-text mode.
+func ilikeRank(product models.Product, needles []string) float64 {
+	name, description := strings.ToLower(product.Name), strings.ToLower(product.Description)
+	var rank float64
+	for _, needle := range needles {
+		if strings.Contains(name, needle) {
+			rank += 1
+		}
+		if strings.Contains(description, needle) {
+			rank += 0.4
+		}
+	}
+	return rank
+}
+
+// highlight HTML-escapes text and wraps every case-insensitive occurrence of the needles with <mark> tags.
+// When radius is positive the result is cut down to radius characters either side of the first match,
+// or to the first 2*radius characters if nothing matched.
+func highlight(text string, needles []string, radius int) string {
+	runes := []rune(text)
+	lower := []rune(strings.ToLower(text))
+	if len(lower) != len(runes) {
+		// Lowercasing changed the length of the text, so match positions would not line up.
+		return html.EscapeString(text)
+	}
+
+	marked := make([]bool, len(runes))
+	first, firstEnd := -1, -1
+	for _, needle := range needles {
+		n := []rune(needle)
+		if len(n) == 0 {
+			continue
+		}
+		for i := 0; i+len(n) <= len(lower); i++ {
+			if string(lower[i:i+len(n)]) != needle {
+				continue
+			}
+			for j := i; j < i+len(n); j++ {
+				marked[j] = true
+			}
+			if first == -1 || i < first {
+				first, firstEnd = i, i+len(n)
+			}
+		}
+	}
+
+	start, end := 0, len(runes)
+	if radius > 0 {
+		if first > radius {
+			start = first - radius
+		}
+		if first == -1 {
+			// Nothing matched, so show the beginning of the text.
+			firstEnd = radius
+		}
+		if firstEnd+radius < end {
+			end = firstEnd + radius
+		}
+	}
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("…")
+	}
+	for i := start; i < end; i++ {
+		if marked[i] && (i == start || !marked[i-1]) {
+			b.WriteString(highlightStart)
+		}
+		b.WriteString(html.EscapeString(string(runes[i])))
+		if marked[i] && (i == end-1 || !marked[i+1]) {
+			b.WriteString(highlightStop)
+		}
+	}
+	if end < len(runes) {
+		b.WriteString("…")
+	}
+	return b.String()
+}
@@ -0,0 +1,99 @@
+package products
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"gorm.io/gorm/utils/tests"
+)
+
+func TestParseSearchQuery(t *testing.T) {
+	tests := []struct {
+		query    string
+		expected string
+	}{
+		{`red shirt`, `red & shirt`},
+		{`Shirt*`, `shirt:*`},
+		{`"red cotton shirt" large`, `(red <-> cotton <-> shirt) & large`},
+		{`t-shirt`, `(t <-> shirt)`},
+		{`price: 'drop' | !x`, `price & drop & x`},
+		{`"unterminated phrase`, `(unterminated <-> phrase)`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			assert.Equal(t, tt.expected, tsQuery(parseSearchQuery(tt.query)))
+		})
+	}
+
+	assert.Empty(t, parseSearchQuery(`"" *`))
+}
+
+func TestHighlight(t *testing.T) {
+	assert.Equal(t, "<mark>Red</mark> cotton <mark>shirt</mark>", highlight("Red cotton shirt", []string{"red", "shirt"}, 0))
+	assert.Equal(t, "…ccc <mark>red</mark> ddd…", highlight("aaa bbb ccc red ddd eee", []string{"red"}, 4))
+	assert.Equal(t, "aaa bb…", highlight("aaa bbb ccc", []string{"zzz"}, 3))
+	// The text is escaped, so markup in a product cannot reach the page that shows the snippet.
+	assert.Equal(t, "&lt;script&gt;alert(1)&lt;/script&gt; <mark>red</mark> &amp; blue",
+		highlight("<script>alert(1)</script> red & blue", []string{"red"}, 0))
+}
+
+func TestSearchProductsFullTextEscapesHeadlines(t *testing.T) {
+	service, mock := newMockProductService(t)
+	assert.Equal(t, SearchModeFullText, service.searchMode)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`ts_headline('english', translate(products.name, $1, ''), query, $2) AS name_highlight`)).
+		WithArgs("\uE000\uE001", sqlmock.AnyArg(), "\uE000\uE001", sqlmock.AnyArg(), "red", 21).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "description", "name_highlight", "snippet"}).
+			AddRow(1, "Red mug", "<script>alert(1)</script> A red mug", "\uE000Red\uE001 mug", "<script>alert(1)</script> A \uE000red\uE001 mug"))
+
+	results, _, err := service.SearchProducts(SearchProductsQuery{Q: "red"})
+
+	assert.NoError(t, err)
+	if assert.Len(t, results, 1) {
+		assert.Equal(t, "<mark>Red</mark> mug", results[0].NameHighlight)
+		assert.Equal(t, "&lt;script&gt;alert(1)&lt;/script&gt; A <mark>red</mark> mug", results[0].Snippet)
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestSearchProductsILike runs the search against a non-Postgres dialect, which falls back to LIKE matching.
+func TestSearchProductsILike(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open sqlmock database: %s", err)
+	}
+	defer sqlDB.Close()
+
+	gormDB, err := gorm.Open(tests.DummyDialector{}, &gorm.Config{
+		ConnPool: sqlDB,
+		Logger:   logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("failed to initialize gorm with sqlmock: %s", err)
+	}
+
+	service := NewProductService(gormDB, ImageSettings{})
+	assert.Equal(t, SearchModeILike, service.searchMode)
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT `id`,`name`,`description`,`price`,`currency`,`stock`,`created_at`,`updated_at` FROM `products` WHERE (LOWER(name) LIKE ? ESCAPE '\\' OR LOWER(description) LIKE ? ESCAPE '\\') AND (LOWER(name) LIKE ? ESCAPE '\\' OR LOWER(description) LIKE ? ESCAPE '\\') AND `products`.`deleted_at` IS NULL ORDER BY id LIMIT ?")).
+		WithArgs("%cotton shirt%", "%cotton shirt%", "%red%", "%red%", 3).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "description"}).
+			AddRow(1, "Plain tee", "A red cotton shirt").
+			AddRow(2, "Red cotton shirt", "Soft and red"))
+
+	results, pagination, err := service.SearchProducts(SearchProductsQuery{Q: `"cotton shirt" red`, Limit: 2})
+
+	assert.NoError(t, err)
+	assert.False(t, pagination.HasMore)
+	if assert.Len(t, results, 2) {
+		assert.Equal(t, uint(2), results[0].ID)
+		assert.Equal(t, "<mark>Red</mark> <mark>cotton shirt</mark>", results[0].NameHighlight)
+		assert.Equal(t, "A <mark>red</mark> <mark>cotton shirt</mark>", results[1].Snippet)
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
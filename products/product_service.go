@@ -2,19 +2,31 @@ package products
 
 import (
 	"ecommerce-api/models"
+	"ecommerce-api/utils"
 	"errors"
+	"sort"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+var ErrInvalidSort = errors.New("invalid sort option")
+
 // ProductService struct manages product business logic
 type ProductService struct {
-	db *gorm.DB
+	db         *gorm.DB
+	searchMode SearchMode
+	images     ImageSettings
 }
 
-// NewProductService initializes ProductService with database connection
-func NewProductService(db *gorm.DB) *ProductService {
-	return &ProductService{db: db}
+// NewProductService initializes ProductService with database connection and image upload settings.
+// Product search uses PostgreSQL full-text search when the database is PostgreSQL and falls back to ILIKE matching otherwise.
+func NewProductService(db *gorm.DB, images ImageSettings) *ProductService {
+	searchMode := SearchModeILike
+	if db.Dialector.Name() == "postgres" {
+		searchMode = SearchModeFullText
+	}
+	return &ProductService{db: db, searchMode: searchMode, images: images}
 }
 
 // CreateProduct creates a new product in the database.
@@ -22,16 +34,31 @@ func NewProductService(db *gorm.DB) *ProductService {
 // The function takes a single parameter:
 // - productDTO: A pointer to a CreateProduct struct representing the product data to be created.
 //   The CreateProduct struct should contain the Name, Description, Price, and Stock fields.
+//   Currency is optional and defaults to USD. SKU is optional.
 //
-// The function creates a new Product struct using the provided data and inserts it into the database.
-// It returns an error if any issues occur during the creation process.
+// The function creates a new Product struct using the provided data and inserts it into the database
+// together with its single variant, which holds the stock and SKU. Options and further variants can be
+// added with SetProductVariants.
+// It returns ErrSKUTaken if another variant has the SKU, and an error if any issues occur during the creation process.
 // If the product is successfully created, the function returns nil.
 func (s *ProductService) CreateProduct(productDTO *CreateProduct) error {
 	product := models.Product{
 		Name:        productDTO.Name,
 		Description: productDTO.Description,
 		Price:       productDTO.Price,
+		Currency:    productDTO.Currency,
 		Stock:       productDTO.Stock,
+		Variants: []models.ProductVariant{{
+			SKU:     optionalSKU(productDTO.SKU),
+			Options: map[string]string{},
+			Stock:   productDTO.Stock,
+		}},
+	}
+
+	if productDTO.SKU != "" {
+		if err := checkSKUsFree(s.db, []string{productDTO.SKU}, 0); err != nil {
+			return err
+		}
 	}
 
 	return s.db.Create(&product).Error
@@ -40,18 +67,32 @@ func (s *ProductService) CreateProduct(productDTO *CreateProduct) error {
 
 // GetProduct retrieves a product by ID from the database.
 //
-// The function takes a single parameter:
+// The function takes two parameters:
 // - id: A string representing the unique identifier of the product to be retrieved.
+// - includeDeleted: Whether a product in the trash is returned too, with DeletedAt set, so that staff
+//   can still look up the products of past orders. The storefront never sees deleted products.
 //
 // The function returns two values:
-// - A pointer to a models.Product struct representing the retrieved product.
+// - A pointer to a models.Product struct representing the retrieved product, with its categories,
+//   options, variants and images.
 //   If the product is not found, the function returns nil.
 // - An error, which is nil if the product is successfully retrieved.
 //   If the product is not found, the error message will be "product not found".
 //   If there is an error while interacting with the database, the error message will start with "database error:".
-func (s *ProductService) GetProduct(id string) (*models.Product, error) {
+func (s *ProductService) GetProduct(id string, includeDeleted bool) (*models.Product, error) {
+	query := s.db
+	if includeDeleted {
+		query = query.Unscoped()
+	}
+
 	var product models.Product
-	if err := s.db.First(&product, id).Error; err != nil {
+	err := query.
+		Preload("Categories", func(db *gorm.DB) *gorm.DB { return db.Order("position, name, id") }).
+		Preload("Options", func(db *gorm.DB) *gorm.DB { return db.Order("position, id") }).
+		Preload("Variants", func(db *gorm.DB) *gorm.DB { return db.Order("position, id") }).
+		Preload("Images", func(db *gorm.DB) *gorm.DB { return db.Order("position, id") }).
+		First(&product, id).Error
+	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, errors.New("product not found")
 		}
@@ -61,22 +102,121 @@ func (s *ProductService) GetProduct(id string) (*models.Product, error) {
 }
 
 
-// ListProducts retrieves all products from the database.
+// ListProducts retrieves one page of products matching the query's filters.
+//
+// The function takes a single parameter:
+// - query: The filter, sort and pagination options. Products can be filtered by price range, by stock,
+//   by a case-insensitive name substring, by creation time and by category slug, optionally including the
+//   category's subcategories, and sorted by created_at, price or name (newest first by default).
+//
+// Pagination is keyset-based: each page ends with a cursor that the next request passes back to continue
+// after the last product it saw. Page and limit can be used instead for offset pagination.
+// The total number of matching products is only counted when query.IncludeTotal is set.
 //
-// The function selects only the id, name, price, description, and stock fields from the products table.
-// It returns a slice of Product structs and an error if any issues occur during the retrieval process.
+// Each product includes its primary image, if it has one.
 //
-// If the retrieval is successful, the function returns a slice of Product structs and nil as the error.
-// If there is an error while interacting with the database, the function returns nil as the slice of Product structs
-// and an error with a descriptive message.
-func (s *ProductService) ListProducts() ([]models.Product, error) {
-    var products []models.Product
-    if err := s.db.Select("id", "name", "price", "description", "stock").
-        Order("created_at DESC").
-        Find(&products).Error; err != nil {
-        return nil, errors.New("failed to retrieve products: " + err.Error())
-    }
-    return products, nil
+// The function returns the products of the page, the pagination metadata and an error.
+// ErrInvalidSort and utils.ErrInvalidCursor are returned for malformed options or cursors, and
+// an error with a descriptive message if there is an error while interacting with the database.
+func (s *ProductService) ListProducts(query ListProductsQuery) ([]models.Product, utils.Pagination, error) {
+	limit := utils.PageLimit(query.Limit)
+	pagination := utils.Pagination{Limit: limit}
+
+	sort, err := parseProductSort(query.Sort)
+	if err != nil {
+		return nil, pagination, err
+	}
+
+	if query.IncludeTotal {
+		var total int64
+		if err := s.db.Model(&models.Product{}).Scopes(productFilters(query)).Count(&total).Error; err != nil {
+			return nil, pagination, errors.New("failed to count products: " + err.Error())
+		}
+		pagination.Total = &total
+	}
+
+	page := s.db.Select("id", "name", "price", "currency", "description", "stock", "created_at", "updated_at").
+		Scopes(productFilters(query)).
+		Preload("Images", "is_primary").
+		Order(sort.order()).
+		Limit(limit + 1)
+
+	switch {
+	case query.Cursor != "":
+		cursor, err := utils.DecodeCursor(query.Cursor)
+		if err != nil || cursor.Sort != sort.key {
+			return nil, pagination, utils.ErrInvalidCursor
+		}
+		value, err := sort.parseCursorValue(cursor.Value)
+		if err != nil {
+			return nil, pagination, utils.ErrInvalidCursor
+		}
+		page = page.Where(sort.after(), value, value, cursor.ID)
+	case query.Page > 0:
+		pagination.Page = query.Page
+		page = page.Offset((query.Page - 1) * limit)
+	}
+
+	products := []models.Product{}
+	if err := page.Find(&products).Error; err != nil {
+		return nil, pagination, errors.New("failed to retrieve products: " + err.Error())
+	}
+
+	// One extra row was fetched to find out whether another page follows.
+	if len(products) > limit {
+		products = products[:limit]
+		last := products[limit-1]
+		pagination.HasMore = true
+		pagination.NextCursor = utils.EncodeCursor(utils.Cursor{Sort: sort.key, Value: sort.cursorValue(last), ID: last.ID})
+	}
+
+	return products, pagination, nil
+}
+
+
+// SearchProducts retrieves one page of products matching a search query, most relevant first.
+//
+// The function takes a single parameter:
+// - query: The search text and pagination options. The text is matched against product names and descriptions;
+//   every word must match, a word ending in "*" matches as a prefix, and words in double quotes must appear as a phrase.
+//
+// The function returns the matching products with their rank and highlighted snippets, the pagination metadata and an error.
+// ErrEmptySearch is returned if the query contains no searchable words, and an error with a descriptive message
+// if there is an error while interacting with the database.
+func (s *ProductService) SearchProducts(query SearchProductsQuery) ([]ProductSearchResult, utils.Pagination, error) {
+	limit := utils.PageLimit(query.Limit)
+	page := query.Page
+	if page < 1 {
+		page = 1
+	}
+	pagination := utils.Pagination{Limit: limit, Page: page}
+
+	terms := parseSearchQuery(query.Q)
+	if len(terms) == 0 {
+		return nil, pagination, ErrEmptySearch
+	}
+
+	// One extra row is fetched to find out whether another page follows.
+	var results []ProductSearchResult
+	var err error
+	if s.searchMode == SearchModeFullText {
+		results, err = s.searchFullText(terms, limit+1, (page-1)*limit)
+	} else {
+		results, err = s.searchILike(terms, limit+1, (page-1)*limit)
+	}
+	if err != nil {
+		return nil, pagination, errors.New("failed to search products: " + err.Error())
+	}
+
+	if len(results) > limit {
+		results = results[:limit]
+		pagination.HasMore = true
+	}
+	if s.searchMode == SearchModeILike {
+		sort.SliceStable(results, func(i, j int) bool { return results[i].Rank > results[j].Rank })
+	}
+
+	return results, pagination, nil
 }
 
 
@@ -88,33 +228,54 @@ func (s *ProductService) ListProducts() ([]models.Product, error) {
 // The function first checks if a product with the given ID exists in the database.
 // If the product is not found, it returns an error with the message "product not found".
 // If the product is found, it updates the existing product record with the data from the provided product struct.
+// A new stock is set on the product's single variant; products with options have their stock set per variant
+// with SetProductVariants, and ErrStockManagedByVariants is returned for them.
 //
 // The function returns an error if any issues occur during the update process.
 // If the product is successfully updated, the function returns nil.
 func (s *ProductService) UpdateProduct(product *models.Product) error {
-	var existingProduct models.Product
-	if err := s.db.First(&existingProduct, product.ID).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return errors.New("product not found")
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var existingProduct models.Product
+		if err := tx.Clauses(clause.Locking{Strength: clause.LockingStrengthUpdate}).First(&existingProduct, product.ID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errors.New("product not found")
+			}
+			return err
 		}
-		return err
-	}
 
-	return s.db.Model(&existingProduct).Updates(product).Error
+		if product.Stock != 0 {
+			var variants []models.ProductVariant
+			if err := tx.Where("product_id = ?", product.ID).Find(&variants).Error; err != nil {
+				return errors.New("failed to retrieve variants: " + err.Error())
+			}
+			if len(variants) != 1 || len(variants[0].Options) > 0 {
+				return ErrStockManagedByVariants
+			}
+			if err := tx.Model(&variants[0]).Update("stock", product.Stock).Error; err != nil {
+				return errors.New("failed to update variant stock: " + err.Error())
+			}
+		}
+
+		return tx.Model(&existingProduct).Updates(product).Error
+	})
 }
 
 
-// DeleteProduct deletes a product by ID from the database.
+// DeleteProduct moves a product to the trash.
 //
 // The function takes a single parameter:
 // - id: A string representing the unique identifier of the product to be deleted.
 //
+// The product is soft deleted: it disappears from listings, search, carts and new orders, but it is kept
+// with its variants and images for the orders that reference it, and can be restored with RestoreProduct.
+// PurgeProduct removes it for good.
+//
 // The function returns an error if any issues occur during the deletion process.
 // If the product is successfully deleted, the function returns nil.
-// If the product with the given ID does not exist, the function returns an error with the message "product not found".
+// If the product with the given ID does not exist or is already deleted, the function returns an error with the message "product not found".
 // If there is an error while interacting with the database, the function returns an error with a descriptive message.
 func (s *ProductService) DeleteProduct(id string) error {
-	result := s.db.Unscoped().Delete(&models.Product{}, "id = ?", id)
+	result := s.db.Delete(&models.Product{}, "id = ?", id)
 	if result.Error != nil {
 		return errors.New("failed to delete product: " + result.Error.Error())
 	}
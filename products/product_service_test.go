@@ -0,0 +1,72 @@
+package products
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"ecommerce-api/internal/testdb"
+	"ecommerce-api/utils"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func newMockProductService(t *testing.T) (*ProductService, sqlmock.Sqlmock) {
+	gormDB, mock := testdb.New(t)
+	return NewProductService(gormDB, ImageSettings{}), mock
+}
+
+func TestListProductsCursorPagination(t *testing.T) {
+	service, mock := newMockProductService(t)
+	created := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT "id","name","price","currency","description","stock","created_at","updated_at" FROM "products" WHERE (price < $1 OR (price = $2 AND id < $3)) AND stock > 0 AND "products"."deleted_at" IS NULL ORDER BY price DESC, id DESC LIMIT $4`)).
+		WithArgs(int64(900), int64(900), 7, 3).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "price", "created_at"}).
+			AddRow(5, "Mug", 800, created).
+			AddRow(4, "Cap", 700, created).
+			AddRow(3, "Pen", 100, created))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "product_images" WHERE "product_images"."product_id" IN ($1,$2,$3) AND is_primary`)).
+		WithArgs(5, 4, 3).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "product_id", "url", "is_primary"}).AddRow(31, 5, "https://cdn.example.com/mug.png", true))
+
+	cursor := utils.EncodeCursor(utils.Cursor{Sort: "-price", Value: "900", ID: 7})
+	products, pagination, err := service.ListProducts(ListProductsQuery{Cursor: cursor, Limit: 2, InStock: true, Sort: "-price"})
+
+	assert.NoError(t, err)
+	assert.Len(t, products, 2)
+	assert.Equal(t, "https://cdn.example.com/mug.png", products[0].Images[0].URL)
+	assert.Empty(t, products[1].Images)
+	assert.True(t, pagination.HasMore)
+	assert.Equal(t, utils.EncodeCursor(utils.Cursor{Sort: "-price", Value: "700", ID: 4}), pagination.NextCursor)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestListProductsRejectsCursorForOtherSort(t *testing.T) {
+	service, mock := newMockProductService(t)
+
+	cursor := utils.EncodeCursor(utils.Cursor{Sort: "name", Value: "Mug", ID: 7})
+	_, _, err := service.ListProducts(ListProductsQuery{Cursor: cursor, Sort: "-price"})
+
+	assert.ErrorIs(t, err, utils.ErrInvalidCursor)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestListProductsByCategoryIncludesDescendants(t *testing.T) {
+	service, mock := newMockProductService(t)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT "id","name","price","currency","description","stock","created_at","updated_at" FROM "products" WHERE id IN (SELECT product_id FROM product_categories WHERE category_id IN (`)+
+		`\s*WITH RECURSIVE subtree AS .* WHERE slug = \$1 .*\) `+regexp.QuoteMeta(`AND "products"."deleted_at" IS NULL ORDER BY created_at DESC, id DESC LIMIT $2`)).
+		WithArgs("kitchen", 21).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "created_at"}).AddRow(5, "Mug", time.Now()))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "product_images" WHERE "product_images"."product_id" = $1 AND is_primary`)).
+		WithArgs(5).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "product_id"}))
+
+	products, _, err := service.ListProducts(ListProductsQuery{Category: "kitchen", IncludeDescendants: true})
+
+	assert.NoError(t, err)
+	assert.Len(t, products, 1)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,128 @@
+package products
+
+import (
+	"ecommerce-api/models"
+	"ecommerce-api/utils"
+	"errors"
+	"strconv"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrProductNotDeleted = errors.New("product is not in the trash")
+	ErrProductHasOrders  = errors.New("product is referenced by orders and cannot be purged")
+)
+
+// ListTrash retrieves one page of deleted products, most recently deleted first.
+//
+// The function returns the products of the page, the pagination metadata and an error with a descriptive
+// message if there is an error while interacting with the database.
+func (s *ProductService) ListTrash(query ListTrashQuery) ([]models.Product, utils.Pagination, error) {
+	limit := utils.PageLimit(query.Limit)
+	page := query.Page
+	if page < 1 {
+		page = 1
+	}
+	pagination := utils.Pagination{Limit: limit, Page: page}
+
+	// One extra row is fetched to find out whether another page follows.
+	products := []models.Product{}
+	err := s.db.Unscoped().
+		Select("id", "name", "price", "currency", "description", "stock", "created_at", "updated_at", "deleted_at").
+		Where("deleted_at IS NOT NULL").
+		Order("deleted_at DESC, id DESC").
+		Limit(limit + 1).
+		Offset((page - 1) * limit).
+		Find(&products).Error
+	if err != nil {
+		return nil, pagination, errors.New("failed to retrieve deleted products: " + err.Error())
+	}
+
+	if len(products) > limit {
+		products = products[:limit]
+		pagination.HasMore = true
+	}
+	return products, pagination, nil
+}
+
+// RestoreProduct takes a product out of the trash, so it is listed and can be ordered again.
+//
+// The function returns the restored product, or an error:
+// - "product not found" if the product does not exist.
+// - ErrProductNotDeleted if the product is not in the trash.
+// - An error with a descriptive message if there is an error while interacting with the database.
+func (s *ProductService) RestoreProduct(id uint) (*models.Product, error) {
+	result := s.db.Unscoped().Model(&models.Product{}).Where("id = ? AND deleted_at IS NOT NULL", id).Update("deleted_at", nil)
+	if result.Error != nil {
+		return nil, errors.New("failed to restore product: " + result.Error.Error())
+	}
+	if result.RowsAffected == 0 {
+		var count int64
+		if err := s.db.Model(&models.Product{}).Where("id = ?", id).Count(&count).Error; err != nil {
+			return nil, errors.New("database error: " + err.Error())
+		}
+		if count == 0 {
+			return nil, errors.New("product not found")
+		}
+		return nil, ErrProductNotDeleted
+	}
+
+	return s.GetProduct(strconv.FormatUint(uint64(id), 10), false)
+}
+
+// PurgeProduct permanently deletes a product from the trash, together with its options, variants, images,
+// category assignments and the cart items that still hold it. Its image files are removed from the blob store.
+//
+// A product stays in the trash for as long as orders reference it, so that past orders keep pointing at it.
+//
+// The function returns an error:
+// - "product not found" if the product does not exist.
+// - ErrProductNotDeleted if the product has not been deleted first.
+// - ErrProductHasOrders if any order references the product.
+// - An error with a descriptive message if there is an error while interacting with the database.
+func (s *ProductService) PurgeProduct(id uint) error {
+	var images []models.ProductImage
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var product models.Product
+		if err := tx.Unscoped().Clauses(clause.Locking{Strength: clause.LockingStrengthUpdate}).
+			Select("id", "deleted_at").
+			Take(&product, id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errors.New("product not found")
+			}
+			return errors.New("database error: " + err.Error())
+		}
+		if !product.DeletedAt.Valid {
+			return ErrProductNotDeleted
+		}
+
+		var orders int64
+		if err := tx.Model(&models.OrderProduct{}).Where("product_id = ?", id).Count(&orders).Error; err != nil {
+			return errors.New("failed to check orders: " + err.Error())
+		}
+		if orders > 0 {
+			return ErrProductHasOrders
+		}
+
+		if err := tx.Select("key", "thumbnail_key").Where("product_id = ?", id).Find(&images).Error; err != nil {
+			return errors.New("failed to retrieve product images: " + err.Error())
+		}
+		if err := tx.Where("product_id = ?", id).Delete(&models.CartItem{}).Error; err != nil {
+			return errors.New("failed to remove product from carts: " + err.Error())
+		}
+		if err := tx.Unscoped().Delete(&product).Error; err != nil {
+			return errors.New("failed to purge product: " + err.Error())
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, image := range images {
+		s.deleteBlobs(image.Key, image.ThumbnailKey)
+	}
+	return nil
+}
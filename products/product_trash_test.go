@@ -0,0 +1,123 @@
+package products
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeleteProductMovesItToTheTrash(t *testing.T) {
+	service, mock := newMockProductService(t)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "products" SET "deleted_at"=$1 WHERE id = $2 AND "products"."deleted_at" IS NULL`)).
+		WithArgs(sqlmock.AnyArg(), "7").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	assert.NoError(t, service.DeleteProduct("7"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRestoreProductThatIsNotDeleted(t *testing.T) {
+	service, mock := newMockProductService(t)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "products" SET "deleted_at"=$1,"updated_at"=$2 WHERE id = $3 AND deleted_at IS NOT NULL`)).
+		WithArgs(nil, sqlmock.AnyArg(), 7).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM "products" WHERE id = $1 AND "products"."deleted_at" IS NULL`)).
+		WithArgs(7).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+	_, err := service.RestoreProduct(7)
+
+	assert.ErrorIs(t, err, ErrProductNotDeleted)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPurgeProductRequiresTrash(t *testing.T) {
+	service, mock := newMockProductService(t)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT "id","deleted_at" FROM "products" WHERE "products"."id" = $1 LIMIT $2 FOR UPDATE`)).
+		WithArgs(7, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "deleted_at"}).AddRow(7, nil))
+	mock.ExpectRollback()
+
+	assert.ErrorIs(t, service.PurgeProduct(7), ErrProductNotDeleted)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPurgeProductRefusesWhileOrdersReferenceIt(t *testing.T) {
+	service, mock := newMockProductService(t)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT "id","deleted_at" FROM "products" WHERE "products"."id" = $1 LIMIT $2 FOR UPDATE`)).
+		WithArgs(7, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "deleted_at"}).AddRow(7, time.Now()))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM "order_products" WHERE product_id = $1`)).
+		WithArgs(7).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+	mock.ExpectRollback()
+
+	assert.ErrorIs(t, service.PurgeProduct(7), ErrProductHasOrders)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPurgeProduct(t *testing.T) {
+	service, store, mock := newMockImageService(t)
+	store.files["products/7/a.png"] = []byte("png")
+	store.files["products/7/a_thumb.png"] = []byte("png")
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT "id","deleted_at" FROM "products" WHERE "products"."id" = $1 LIMIT $2 FOR UPDATE`)).
+		WithArgs(7, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "deleted_at"}).AddRow(7, time.Now()))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM "order_products" WHERE product_id = $1`)).
+		WithArgs(7).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT "key","thumbnail_key" FROM "product_images" WHERE product_id = $1`)).
+		WithArgs(7).
+		WillReturnRows(sqlmock.NewRows([]string{"key", "thumbnail_key"}).AddRow("products/7/a.png", "products/7/a_thumb.png"))
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM "cart_items" WHERE product_id = $1`)).
+		WithArgs(7).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM "products" WHERE "products"."id" = $1`)).
+		WithArgs(7).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	assert.NoError(t, service.PurgeProduct(7))
+	assert.Empty(t, store.files)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetProductHidesDeletedProducts(t *testing.T) {
+	service, mock := newMockProductService(t)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "products" WHERE "products"."id" = $1 AND "products"."deleted_at" IS NULL ORDER BY "products"."id" LIMIT $2`)).
+		WithArgs("7", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	_, err := service.GetProduct("7", false)
+	assert.EqualError(t, err, "product not found")
+
+	// Staff still see the product in the trash.
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "products" WHERE "products"."id" = $1 ORDER BY "products"."id" LIMIT $2`)).
+		WithArgs("7", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "deleted_at"}).AddRow(7, "Mug", time.Now()))
+	for _, table := range []string{"product_categories", "product_images", "product_options", "product_variants"} {
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "` + table + `"`)).
+			WillReturnRows(sqlmock.NewRows([]string{"product_id"}))
+	}
+
+	product, err := service.GetProduct("7", true)
+	assert.NoError(t, err)
+	assert.True(t, product.DeletedAt.Valid)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,242 @@
+package products
+
+import (
+	"ecommerce-api/models"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrInvalidVariants        = errors.New("invalid variants")
+	ErrVariantNotFound        = errors.New("variant not found")
+	ErrSKUTaken               = errors.New("SKU is already in use")
+	ErrStockManagedByVariants = errors.New("the stock of a product with options is set per variant")
+)
+
+// SetProductVariants replaces the options and variants of a product.
+//
+// The function takes two parameters:
+//   - productID: The product whose variants are replaced.
+//   - input: The product's options and its variants. Each variant must have exactly one value for every
+//     option, and no two variants may have the same values. A product without options has one variant.
+//
+// Variants with an ID are updated, variants without one are created, and existing variants that are not
+// listed are deleted. Orders keep a copy of the variants they were placed for, so deleting a variant
+// does not change them. The product's stock becomes the total stock of its variants.
+//
+// The function returns the product with its options and variants, or an error:
+// - "product not found" if the product does not exist.
+// - ErrInvalidVariants, wrapped with the reason, if the options or variants do not fit together.
+// - ErrVariantNotFound if a variant ID does not belong to the product.
+// - ErrSKUTaken if a SKU is used by a variant of another product.
+// - An error with a descriptive message if there is an error while interacting with the database.
+func (s *ProductService) SetProductVariants(productID uint, input SetProductVariantsDTO) (*models.Product, error) {
+	options, err := buildOptions(productID, input.Options)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateVariants(options, input.Variants); err != nil {
+		return nil, err
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		// The product row is locked first, in the same order as orders lock it, so the stock total
+		// cannot be changed underneath.
+		var product models.Product
+		if err := tx.Clauses(clause.Locking{Strength: clause.LockingStrengthUpdate}).Select("id").Take(&product, productID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errors.New("product not found")
+			}
+			return errors.New("database error: " + err.Error())
+		}
+
+		var existing []models.ProductVariant
+		if err := tx.Where("product_id = ?", productID).Find(&existing).Error; err != nil {
+			return errors.New("failed to retrieve variants: " + err.Error())
+		}
+		existingByID := make(map[uint]models.ProductVariant, len(existing))
+		for _, variant := range existing {
+			existingByID[variant.ID] = variant
+		}
+
+		kept := make(map[uint]bool, len(input.Variants))
+		var skus []string
+		for _, variant := range input.Variants {
+			if variant.ID != 0 {
+				if _, ok := existingByID[variant.ID]; !ok {
+					return ErrVariantNotFound
+				}
+				kept[variant.ID] = true
+			}
+			if variant.SKU != "" {
+				skus = append(skus, variant.SKU)
+			}
+		}
+		if err := checkSKUsFree(tx, skus, productID); err != nil {
+			return err
+		}
+
+		var removed []uint
+		for _, variant := range existing {
+			if !kept[variant.ID] {
+				removed = append(removed, variant.ID)
+			}
+		}
+		if len(removed) > 0 {
+			if err := tx.Delete(&models.ProductVariant{}, removed).Error; err != nil {
+				return errors.New("failed to delete variants: " + err.Error())
+			}
+		}
+		// SKUs may move between the variants of the product, so they are released before being reassigned.
+		if len(kept) > 0 {
+			if err := tx.Model(&models.ProductVariant{}).Where("product_id = ?", productID).Update("sku", nil).Error; err != nil {
+				return errors.New("failed to update variants: " + err.Error())
+			}
+		}
+
+		if err := tx.Where("product_id = ?", productID).Delete(&models.ProductOption{}).Error; err != nil {
+			return errors.New("failed to replace options: " + err.Error())
+		}
+		if len(options) > 0 {
+			if err := tx.Create(&options).Error; err != nil {
+				return errors.New("failed to replace options: " + err.Error())
+			}
+		}
+
+		stock := 0
+		for i, item := range input.Variants {
+			variant := models.ProductVariant{
+				ID:        item.ID,
+				ProductID: productID,
+				SKU:       optionalSKU(item.SKU),
+				Title:     models.VariantTitle(options, item.Options),
+				Options:   item.Options,
+				Price:     item.Price,
+				Stock:     item.Stock,
+				Position:  i,
+				CreatedAt: existingByID[item.ID].CreatedAt,
+			}
+			if variant.Options == nil {
+				variant.Options = map[string]string{}
+			}
+			if err := tx.Save(&variant).Error; err != nil {
+				return errors.New("failed to save variant: " + err.Error())
+			}
+			stock += item.Stock
+		}
+
+		if err := tx.Model(&models.Product{}).Where("id = ?", productID).UpdateColumn("stock", stock).Error; err != nil {
+			return errors.New("failed to update product stock: " + err.Error())
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetProduct(strconv.FormatUint(uint64(productID), 10), false)
+}
+
+// buildOptions validates the options of a product and returns them in the order given.
+func buildOptions(productID uint, inputs []ProductOptionDTO) ([]models.ProductOption, error) {
+	options := make([]models.ProductOption, len(inputs))
+	names := make(map[string]bool, len(inputs))
+	for i, input := range inputs {
+		name := strings.ToLower(input.Name)
+		if names[name] {
+			return nil, fmt.Errorf("%w: option %q is listed more than once", ErrInvalidVariants, input.Name)
+		}
+		names[name] = true
+
+		values := make(map[string]bool, len(input.Values))
+		for _, value := range input.Values {
+			if values[value] {
+				return nil, fmt.Errorf("%w: option %q lists the value %q more than once", ErrInvalidVariants, input.Name, value)
+			}
+			values[value] = true
+		}
+
+		options[i] = models.ProductOption{ProductID: productID, Name: input.Name, Values: input.Values, Position: i}
+	}
+	return options, nil
+}
+
+// validateVariants checks that every variant has exactly one valid value for each option, that no two
+// variants have the same values and that no SKU is used twice.
+func validateVariants(options []models.ProductOption, variants []ProductVariantDTO) error {
+	if len(options) == 0 && len(variants) != 1 {
+		return fmt.Errorf("%w: a product without options has exactly one variant", ErrInvalidVariants)
+	}
+
+	ids := make(map[uint]bool, len(variants))
+	skus := make(map[string]bool, len(variants))
+	combinations := make(map[string]bool, len(variants))
+	for _, variant := range variants {
+		if variant.ID != 0 {
+			if ids[variant.ID] {
+				return fmt.Errorf("%w: variant %d is listed more than once", ErrInvalidVariants, variant.ID)
+			}
+			ids[variant.ID] = true
+		}
+		if variant.SKU != "" {
+			if skus[variant.SKU] {
+				return fmt.Errorf("%w: SKU %q is used by more than one variant", ErrInvalidVariants, variant.SKU)
+			}
+			skus[variant.SKU] = true
+		}
+
+		if len(variant.Options) != len(options) {
+			return fmt.Errorf("%w: every variant needs exactly one value for each option", ErrInvalidVariants)
+		}
+		for _, option := range options {
+			value, ok := variant.Options[option.Name]
+			if !ok || !containsValue(option.Values, value) {
+				return fmt.Errorf("%w: variant values for option %q must be one of %s", ErrInvalidVariants, option.Name, strings.Join(option.Values, ", "))
+			}
+		}
+
+		title := models.VariantTitle(options, variant.Options)
+		if combinations[title] {
+			return fmt.Errorf("%w: more than one variant is %q", ErrInvalidVariants, title)
+		}
+		combinations[title] = true
+	}
+	return nil
+}
+
+// checkSKUsFree returns ErrSKUTaken if any of the SKUs belongs to a variant of another product.
+func checkSKUsFree(tx *gorm.DB, skus []string, productID uint) error {
+	if len(skus) == 0 {
+		return nil
+	}
+	var taken int64
+	if err := tx.Model(&models.ProductVariant{}).Where("sku IN ? AND product_id <> ?", skus, productID).Count(&taken).Error; err != nil {
+		return errors.New("failed to check SKUs: " + err.Error())
+	}
+	if taken > 0 {
+		return ErrSKUTaken
+	}
+	return nil
+}
+
+// optionalSKU stores an empty SKU as NULL, so variants without a SKU do not collide in the unique index.
+func optionalSKU(sku string) *string {
+	if sku == "" {
+		return nil
+	}
+	return &sku
+}
+
+func containsValue(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
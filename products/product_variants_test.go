@@ -0,0 +1,130 @@
+package products
+
+import (
+	"regexp"
+	"testing"
+
+	"ecommerce-api/models"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateVariants(t *testing.T) {
+	shirt := []ProductOptionDTO{
+		{Name: "Size", Values: []string{"S", "M", "L"}},
+		{Name: "Colour", Values: []string{"Red", "Blue"}},
+	}
+
+	tests := []struct {
+		name     string
+		options  []ProductOptionDTO
+		variants []ProductVariantDTO
+		valid    bool
+	}{
+		{
+			name:     "Single Variant",
+			variants: []ProductVariantDTO{{SKU: "MUG", Stock: 5}},
+			valid:    true,
+		},
+		{
+			name:     "Several Variants Without Options",
+			variants: []ProductVariantDTO{{SKU: "MUG-1"}, {SKU: "MUG-2"}},
+		},
+		{
+			name:    "Sizes And Colours",
+			options: shirt,
+			variants: []ProductVariantDTO{
+				{SKU: "TEE-S-RED", Options: map[string]string{"Size": "S", "Colour": "Red"}},
+				{SKU: "TEE-M-RED", Options: map[string]string{"Size": "M", "Colour": "Red"}},
+				{SKU: "TEE-M-BLUE", Options: map[string]string{"Size": "M", "Colour": "Blue"}},
+			},
+			valid: true,
+		},
+		{
+			name:     "Missing Option Value",
+			options:  shirt,
+			variants: []ProductVariantDTO{{Options: map[string]string{"Size": "S"}}},
+		},
+		{
+			name:     "Unknown Option Value",
+			options:  shirt,
+			variants: []ProductVariantDTO{{Options: map[string]string{"Size": "XL", "Colour": "Red"}}},
+		},
+		{
+			name:    "Duplicate Combination",
+			options: shirt,
+			variants: []ProductVariantDTO{
+				{SKU: "TEE-1", Options: map[string]string{"Size": "S", "Colour": "Red"}},
+				{SKU: "TEE-2", Options: map[string]string{"Size": "S", "Colour": "Red"}},
+			},
+		},
+		{
+			name:    "Duplicate SKU",
+			options: shirt,
+			variants: []ProductVariantDTO{
+				{SKU: "TEE", Options: map[string]string{"Size": "S", "Colour": "Red"}},
+				{SKU: "TEE", Options: map[string]string{"Size": "M", "Colour": "Red"}},
+			},
+		},
+		{
+			name:     "Duplicate Option",
+			options:  []ProductOptionDTO{{Name: "Size", Values: []string{"S"}}, {Name: "size", Values: []string{"M"}}},
+			variants: []ProductVariantDTO{{Options: map[string]string{"Size": "S", "size": "M"}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options, err := buildOptions(1, tt.options)
+			if err == nil {
+				err = validateVariants(options, tt.variants)
+			}
+			if tt.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, ErrInvalidVariants)
+			}
+		})
+	}
+}
+
+// TestSetProductVariantsRejectsForeignVariant verifies that a variant ID of another product cannot be
+// moved to this one.
+func TestSetProductVariantsRejectsForeignVariant(t *testing.T) {
+	service, mock := newMockProductService(t)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT "id" FROM "products" WHERE "products"."id" = $1 AND "products"."deleted_at" IS NULL LIMIT $2 FOR UPDATE`)).
+		WithArgs(1, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "product_variants" WHERE product_id = $1`)).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "product_id"}).AddRow(11, 1))
+	mock.ExpectRollback()
+
+	_, err := service.SetProductVariants(1, SetProductVariantsDTO{Variants: []ProductVariantDTO{{ID: 21, Stock: 3}}})
+
+	assert.ErrorIs(t, err, ErrVariantNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpdateProductStockOfProductWithOptions(t *testing.T) {
+	service, mock := newMockProductService(t)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "products" WHERE "products"."id" = $1 AND "products"."deleted_at" IS NULL ORDER BY "products"."id" LIMIT $2 FOR UPDATE`)).
+		WithArgs(1, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "T-shirt"))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "product_variants" WHERE product_id = $1`)).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "product_id", "options"}).
+			AddRow(11, 1, `{"Size":"S"}`).
+			AddRow(12, 1, `{"Size":"M"}`))
+	mock.ExpectRollback()
+
+	err := service.UpdateProduct(&models.Product{ID: 1, Stock: 10})
+
+	assert.ErrorIs(t, err, ErrStockManagedByVariants)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
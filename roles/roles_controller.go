@@ -0,0 +1,130 @@
+package roles
+
+import (
+	"ecommerce-api/models"
+	"ecommerce-api/utils"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RoleController handles HTTP requests for role assignment
+type RoleController struct {
+	roleService *RoleService
+}
+
+// NewRoleController initializes a new RoleController
+func NewRoleController(roleService *RoleService) *RoleController {
+	return &RoleController{roleService: roleService}
+}
+
+// ListRoles godoc
+// @Summary      List roles
+// @Description  Requires the roles:assign permission. Lists every role with the permissions it grants.
+// @Tags         roles
+// @Produce      json
+// @Success      200  {object}  utils.APIResponse{data=[]RoleDefinition}
+// @Failure      403  {object}  utils.APIResponse
+// @Security     BearerAuth
+// @Router       /admin/roles [get]
+func (c *RoleController) ListRoles(ctx *gin.Context) {
+	definitions := []RoleDefinition{}
+	for _, role := range models.Roles() {
+		definitions = append(definitions, RoleDefinition{Role: role, Permissions: role.Permissions()})
+	}
+
+	utils.NewAPIResponse(http.StatusOK, "Roles retrieved successfully", definitions, "").Send(ctx)
+}
+
+// GetUserRoles godoc
+// @Summary      Get a user's roles
+// @Description  Requires the roles:assign permission.
+// @Tags         roles
+// @Produce      json
+// @Param        id   path      string  true  "User ID"
+// @Success      200  {object}  utils.APIResponse{data=UserRolesView}
+// @Failure      400  {object}  utils.APIResponse
+// @Failure      403  {object}  utils.APIResponse
+// @Failure      404  {object}  utils.APIResponse
+// @Failure      500  {object}  utils.APIResponse
+// @Security     BearerAuth
+// @Router       /admin/users/{id}/roles [get]
+func (c *RoleController) GetUserRoles(ctx *gin.Context) {
+	userID, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
+	if err != nil {
+		utils.NewAPIResponse(http.StatusBadRequest, "Invalid user ID", nil, err.Error()).Send(ctx)
+		return
+	}
+
+	roles, err := c.roleService.UserRoles(uint(userID))
+	if err != nil {
+		if errors.Is(err, utils.ErrUserNotFound) {
+			utils.NewAPIResponse(http.StatusNotFound, "User not found", nil, "").Send(ctx)
+		} else {
+			utils.NewAPIResponse(http.StatusInternalServerError, "Failed to retrieve roles", nil, err.Error()).Send(ctx)
+		}
+		return
+	}
+
+	utils.NewAPIResponse(http.StatusOK, "Roles retrieved successfully", UserRolesView{UserID: uint(userID), Roles: roles}, "").Send(ctx)
+}
+
+// SetUserRoles godoc
+// @Summary      Set a user's roles
+// @Description  Requires the roles:assign permission, which only super admins hold. Replaces the user's roles with the given set;
+// @Description  the customer role is always kept. The last super admin cannot be demoted. Changes are recorded in the audit log.
+// @Tags         roles
+// @Accept       json
+// @Produce      json
+// @Param        id     path      string           true  "User ID"
+// @Param        roles  body      SetUserRolesDTO  true  "Roles: customer, support, catalog_manager, fulfilment, super_admin"
+// @Success      200    {object}  utils.APIResponse{data=UserRolesView}
+// @Failure      400    {object}  utils.APIResponse
+// @Failure      403    {object}  utils.APIResponse
+// @Failure      404    {object}  utils.APIResponse
+// @Failure      409    {object}  utils.APIResponse
+// @Failure      500    {object}  utils.APIResponse
+// @Security     BearerAuth
+// @Router       /admin/users/{id}/roles [put]
+func (c *RoleController) SetUserRoles(ctx *gin.Context) {
+	userID, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
+	if err != nil {
+		utils.NewAPIResponse(http.StatusBadRequest, "Invalid user ID", nil, err.Error()).Send(ctx)
+		return
+	}
+
+	var input SetUserRolesDTO
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		utils.NewAPIResponse(http.StatusBadRequest, "Invalid input", nil, err.Error()).Send(ctx)
+		return
+	}
+
+	actorIDStr, exists := ctx.Get("userID")
+	if !exists {
+		utils.NewAPIResponse(http.StatusUnauthorized, "Unauthorized", nil, "User ID not found in context").Send(ctx)
+		return
+	}
+
+	actorID, err := strconv.ParseUint(actorIDStr.(string), 10, 32)
+	if err != nil {
+		utils.NewAPIResponse(http.StatusBadRequest, "Invalid User ID", nil, "User ID conversion failed").Send(ctx)
+		return
+	}
+
+	roles, err := c.roleService.SetUserRoles(uint(userID), uint(actorID), ctx.ClientIP(), input.Roles)
+	if err != nil {
+		switch {
+		case errors.Is(err, utils.ErrUserNotFound):
+			utils.NewAPIResponse(http.StatusNotFound, "User not found", nil, "").Send(ctx)
+		case errors.Is(err, ErrLastSuperAdmin):
+			utils.NewAPIResponse(http.StatusConflict, "Cannot demote the last super admin", nil, err.Error()).Send(ctx)
+		default:
+			utils.NewAPIResponse(http.StatusInternalServerError, "Failed to update roles", nil, err.Error()).Send(ctx)
+		}
+		return
+	}
+
+	utils.NewAPIResponse(http.StatusOK, "Roles updated successfully", UserRolesView{UserID: uint(userID), Roles: roles}, "").Send(ctx)
+}
@@ -0,0 +1,19 @@
+package roles
+
+import "ecommerce-api/models"
+
+type SetUserRolesDTO struct {
+	Roles []models.Role `json:"roles" binding:"required,dive,role"`
+}
+
+// UserRolesView lists the roles held by a user.
+type UserRolesView struct {
+	UserID uint          `json:"user_id"`
+	Roles  []models.Role `json:"roles"`
+}
+
+// RoleDefinition describes a role and the permissions it grants.
+type RoleDefinition struct {
+	Role        models.Role         `json:"role"`
+	Permissions []models.Permission `json:"permissions"`
+}
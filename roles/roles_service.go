@@ -0,0 +1,214 @@
+package roles
+
+import (
+	"ecommerce-api/audit"
+	"ecommerce-api/models"
+	"ecommerce-api/utils"
+	"errors"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrLastSuperAdmin = errors.New("cannot remove the super_admin role from the last super admin")
+
+// ErrBootstrapUnverified is returned by Bootstrap when the user has not verified their email address,
+// so whoever registered it may not own it.
+var ErrBootstrapUnverified = errors.New("the user has not verified their email address")
+
+// RoleService manages the roles assigned to users
+type RoleService struct {
+	db *gorm.DB
+}
+
+// NewRoleService initializes RoleService with database connection
+func NewRoleService(db *gorm.DB) *RoleService {
+	return &RoleService{db: db}
+}
+
+// UserRoles returns the roles held by a user.
+//
+// Parameters:
+// - userID: The unique identifier of the user.
+//
+// Return:
+// - The user's roles, sorted by name.
+// - utils.ErrUserNotFound if the user does not exist.
+func (s *RoleService) UserRoles(userID uint) ([]models.Role, error) {
+	if err := s.db.Select("id").Take(&models.User{}, userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, utils.ErrUserNotFound
+		}
+		return nil, errors.New("failed to retrieve user: " + err.Error())
+	}
+
+	roles := []models.Role{}
+	if err := s.db.Model(&models.UserRole{}).Where("user_id = ?", userID).Order("role").Pluck("role", &roles).Error; err != nil {
+		return nil, errors.New("failed to retrieve roles: " + err.Error())
+	}
+	return roles, nil
+}
+
+// SetUserRoles replaces the roles of a user with the given set. The customer role is always kept, so
+// it does not need to be listed. Newly granted roles record the super admin who granted them.
+// If the roles change, the user's token version is bumped, so access tokens carrying the old roles
+// stop working and clients refresh them, and the change is recorded in the audit log.
+//
+// Parameters:
+// - userID: The unique identifier of the user whose roles are changed.
+// - actorID: The unique identifier of the super admin making the change.
+// - ip: The IP address the super admin made the change from, for the audit log.
+// - roles: The roles the user should hold afterwards.
+//
+// Return:
+// - The user's roles after the change, sorted by name.
+// - utils.ErrUserNotFound if the user does not exist.
+// - ErrLastSuperAdmin if the change would leave no super admin, so that nobody could assign roles any more.
+func (s *RoleService) SetUserRoles(userID, actorID uint, ip string, roles []models.Role) ([]models.Role, error) {
+	wanted := map[models.Role]bool{models.RoleCustomer: true}
+	for _, role := range roles {
+		wanted[role] = true
+	}
+
+	changed := false
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Select("id").Take(&models.User{}, userID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return utils.ErrUserNotFound
+			}
+			return errors.New("failed to retrieve user: " + err.Error())
+		}
+
+		if !wanted[models.RoleSuperAdmin] {
+			// Locking every super admin row serialises concurrent demotions, so two super admins
+			// cannot demote each other at the same time and leave none.
+			var superAdmins []uint
+			if err := tx.Model(&models.UserRole{}).Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("role = ?", models.RoleSuperAdmin).Pluck("user_id", &superAdmins).Error; err != nil {
+				return errors.New("failed to retrieve super admins: " + err.Error())
+			}
+			if len(superAdmins) == 1 && superAdmins[0] == userID {
+				return ErrLastSuperAdmin
+			}
+		}
+
+		keep := make([]models.Role, 0, len(wanted))
+		grants := make([]models.UserRole, 0, len(wanted))
+		for _, role := range models.Roles() {
+			if !wanted[role] {
+				continue
+			}
+			keep = append(keep, role)
+			grants = append(grants, models.UserRole{UserID: userID, Role: role, GrantedByID: &actorID})
+		}
+
+		revoked := tx.Where("user_id = ? AND role NOT IN ?", userID, keep).Delete(&models.UserRole{})
+		if revoked.Error != nil {
+			return errors.New("failed to revoke roles: " + revoked.Error.Error())
+		}
+		granted := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&grants)
+		if granted.Error != nil {
+			return errors.New("failed to grant roles: " + granted.Error.Error())
+		}
+
+		if revoked.RowsAffected+granted.RowsAffected == 0 {
+			return nil
+		}
+		changed = true
+		return bumpTokenVersion(tx, userID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := s.UserRoles(userID)
+	if err != nil {
+		return nil, err
+	}
+	if changed {
+		names := make([]string, len(current))
+		for i, role := range current {
+			names[i] = string(role)
+		}
+		audit.Record(s.db, models.AuditLog{
+			Event:   models.AuditRolesChanged,
+			UserID:  &userID,
+			ActorID: &actorID,
+			IP:      ip,
+			Details: "roles: " + strings.Join(names, ", "),
+		})
+	}
+	return current, nil
+}
+
+// Bootstrap makes the user with the given email the first super admin. It does nothing if a super
+// admin already exists, so it is safe to run on every start, and reports whether the role was granted.
+// It returns utils.ErrUserNotFound if no user has the email, and ErrBootstrapUnverified if the user
+// has not verified it, since anyone can register an address they do not own.
+func Bootstrap(db *gorm.DB, email string) (bool, error) {
+	var count int64
+	if err := db.Model(&models.UserRole{}).Where("role = ?", models.RoleSuperAdmin).Count(&count).Error; err != nil {
+		return false, err
+	}
+	if count > 0 {
+		return false, nil
+	}
+
+	var user models.User
+	if err := db.Select("id", "verified_at").Where("email = ?", email).Take(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, utils.ErrUserNotFound
+		}
+		return false, err
+	}
+	if user.VerifiedAt == nil {
+		return false, ErrBootstrapUnverified
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		grant := models.UserRole{UserID: user.ID, Role: models.RoleSuperAdmin}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&grant).Error; err != nil {
+			return err
+		}
+		return bumpTokenVersion(tx, user.ID)
+	})
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// bumpTokenVersion invalidates the access tokens of the user, which carry the user's roles.
+func bumpTokenVersion(tx *gorm.DB, userID uint) error {
+	if err := tx.Model(&models.User{}).Where("id = ?", userID).
+		Update("token_version", gorm.Expr("token_version + 1")).Error; err != nil {
+		return errors.New("failed to update token version: " + err.Error())
+	}
+	return nil
+}
+
+// MigrateAdminFlag replaces the users.is_admin column that preceded roles. Users flagged as admins
+// become super admins and every existing user gets the customer role. It does nothing once the column
+// has been dropped.
+func MigrateAdminFlag(db *gorm.DB) error {
+	if !db.Migrator().HasColumn(&models.User{}, "is_admin") {
+		return nil
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(`INSERT INTO user_roles (user_id, role, created_at)
+			SELECT id, ?, NOW() FROM users
+			ON CONFLICT DO NOTHING`, models.RoleCustomer).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Exec(`INSERT INTO user_roles (user_id, role, created_at)
+			SELECT id, ?, NOW() FROM users WHERE is_admin
+			ON CONFLICT DO NOTHING`, models.RoleSuperAdmin).Error; err != nil {
+			return err
+		}
+
+		return tx.Migrator().DropColumn(&models.User{}, "is_admin")
+	})
+}
@@ -0,0 +1,92 @@
+package roles
+
+import (
+	"ecommerce-api/internal/testdb"
+	"ecommerce-api/models"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func newMockRoleService(t *testing.T) (*RoleService, sqlmock.Sqlmock) {
+	gormDB, mock := testdb.New(t)
+	return NewRoleService(gormDB), mock
+}
+
+func TestSetUserRolesKeepsLastSuperAdmin(t *testing.T) {
+	service, mock := newMockRoleService(t)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT "id" FROM "users" WHERE "users"."id" = $1 AND "users"."deleted_at" IS NULL LIMIT $2`)).
+		WithArgs(1, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT "user_id" FROM "user_roles" WHERE role = $1 FOR UPDATE`)).
+		WithArgs(models.RoleSuperAdmin).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(1))
+	mock.ExpectRollback()
+
+	_, err := service.SetUserRoles(1, 1, "203.0.113.7", []models.Role{models.RoleSupport})
+
+	assert.ErrorIs(t, err, ErrLastSuperAdmin)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSetUserRoles(t *testing.T) {
+	service, mock := newMockRoleService(t)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT "id" FROM "users" WHERE "users"."id" = $1 AND "users"."deleted_at" IS NULL LIMIT $2`)).
+		WithArgs(2, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT "user_id" FROM "user_roles" WHERE role = $1 FOR UPDATE`)).
+		WithArgs(models.RoleSuperAdmin).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(1))
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM "user_roles" WHERE user_id = $1 AND role NOT IN ($2,$3)`)).
+		WithArgs(2, models.RoleCustomer, models.RoleCatalogManager).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO "user_roles" ("user_id","role","granted_by_id","created_at") VALUES ($1,$2,$3,$4),($5,$6,$7,$8) ON CONFLICT DO NOTHING`)).
+		WithArgs(2, models.RoleCustomer, 1, sqlmock.AnyArg(), 2, models.RoleCatalogManager, 1, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "users" SET "token_version"=token_version + 1,"updated_at"=$1 WHERE id = $2 AND "users"."deleted_at" IS NULL`)).
+		WithArgs(sqlmock.AnyArg(), 2).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT "id" FROM "users" WHERE "users"."id" = $1 AND "users"."deleted_at" IS NULL LIMIT $2`)).
+		WithArgs(2, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT "role" FROM "user_roles" WHERE user_id = $1 ORDER BY role`)).
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"role"}).AddRow("catalog_manager").AddRow("customer"))
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "audit_logs"`)).
+		WithArgs("roles_changed", 2, 1, "203.0.113.7", "roles: catalog_manager, customer", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectCommit()
+
+	roles, err := service.SetUserRoles(2, 1, "203.0.113.7", []models.Role{models.RoleCatalogManager})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []models.Role{models.RoleCatalogManager, models.RoleCustomer}, roles)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestBootstrapRequiresVerifiedEmail verifies that the configured email only grants super admin once
+// its owner verified it, so registering the address first is not enough to take over.
+func TestBootstrapRequiresVerifiedEmail(t *testing.T) {
+	db, mock := testdb.New(t)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM "user_roles" WHERE role = $1`)).
+		WithArgs("super_admin").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT "id","verified_at" FROM "users" WHERE email = $1 AND "users"."deleted_at" IS NULL LIMIT $2`)).
+		WithArgs("admin@example.com", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "verified_at"}).AddRow(7, nil))
+
+	granted, err := Bootstrap(db, "admin@example.com")
+
+	assert.False(t, granted)
+	assert.ErrorIs(t, err, ErrBootstrapUnverified)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,25 @@
+package routes
+
+import (
+	"ecommerce-api/middleware"
+	"ecommerce-api/models"
+	"ecommerce-api/users"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// AdminUserSetUpRoute sets up routes for staff managing user accounts
+func AdminUserSetUpRoute(router *gin.RouterGroup, db *gorm.DB) {
+	adminService := users.NewAdminService(db)
+	adminController := users.NewAdminController(adminService)
+
+	admin := router.Group("/admin/users")
+	admin.Use(middleware.AuthMiddleware())
+
+	admin.GET("", middleware.RequirePermission(models.PermUsersRead), adminController.ListUsers)
+	admin.GET("/:id", middleware.RequirePermission(models.PermUsersRead), adminController.GetUser)
+	admin.POST("/:id/suspend", middleware.RequirePermission(models.PermUsersManage), adminController.SuspendUser)
+	admin.POST("/:id/unsuspend", middleware.RequirePermission(models.PermUsersManage), adminController.UnsuspendUser)
+	admin.POST("/:id/logout", middleware.RequirePermission(models.PermUsersManage), adminController.ForceLogout)
+}
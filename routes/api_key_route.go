@@ -0,0 +1,23 @@
+package routes
+
+import (
+	"ecommerce-api/apikeys"
+	"ecommerce-api/middleware"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// APIKeySetUpRoute sets up routes for users managing their API keys
+func APIKeySetUpRoute(router *gin.RouterGroup, db *gorm.DB) {
+	apiKeyService := apikeys.NewAPIKeyService(db)
+	apiKeyController := apikeys.NewAPIKeyController(apiKeyService)
+
+	// API keys cannot be used to manage API keys, as these routes declare no scope.
+	keys := router.Group("/users/me/api-keys")
+	keys.Use(middleware.AuthMiddleware())
+
+	keys.GET("", apiKeyController.ListKeys)
+	keys.POST("", apiKeyController.CreateKey)
+	keys.DELETE("/:id", apiKeyController.RevokeKey)
+}
@@ -2,18 +2,35 @@ package routes
 
 import (
 	"ecommerce-api/auth"
+	"ecommerce-api/config"
+	"ecommerce-api/mailer"
+	"ecommerce-api/middleware"
+	"ecommerce-api/tokens"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 )
 
-// AuthSetUpRoute sets up authentication routes for registration and login
-func AuthSetUpRoute(router *gin.RouterGroup, jwtSecret string, db *gorm.DB) {
-	authService := auth.NewAuthService(jwtSecret, db)
+// AuthSetUpRoute sets up authentication routes for registration, login and token management
+func AuthSetUpRoute(router *gin.RouterGroup, db *gorm.DB) {
+	authService := auth.NewAuthService(tokens.Default(), mailer.New(config.CONFIG), auth.DefaultAttemptStore(), auth.SettingsFromConfig(config.CONFIG), db)
 	authController := auth.NewAuthController(authService)
 
 	auth := router.Group("/auth")
 
 	auth.POST("/register", authController.Register)
 	auth.POST("/login", authController.Login)
+	auth.POST("/refresh", authController.Refresh)
+	auth.POST("/logout", middleware.AuthMiddleware(), authController.Logout)
+	auth.POST("/password/forgot", authController.ForgotPassword)
+	auth.POST("/password/reset", authController.ResetPassword)
+	auth.GET("/verify", authController.VerifyEmail)
+	auth.POST("/verify/resend", middleware.AuthMiddleware(), authController.ResendVerification)
+	auth.POST("/mfa/enroll", middleware.AuthMiddleware(), authController.EnrollMFA)
+	auth.POST("/mfa/confirm", middleware.AuthMiddleware(), authController.ConfirmMFA)
+	auth.POST("/mfa/disable", middleware.AuthMiddleware(), authController.DisableMFA)
+	auth.POST("/mfa/verify", authController.VerifyMFA)
+	auth.GET("/oidc/providers", authController.OIDCProviders)
+	auth.POST("/oidc/:provider/start", authController.StartOIDCLogin)
+	auth.POST("/oidc/:provider/callback", authController.CompleteOIDCLogin)
 }
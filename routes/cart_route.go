@@ -0,0 +1,24 @@
+package routes
+
+import (
+	"ecommerce-api/cart"
+	"ecommerce-api/middleware"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// CartSetUpRoute sets up routes for the shopping cart
+func CartSetUpRoute(router *gin.RouterGroup, db *gorm.DB) {
+	cartService := cart.NewCartService(db)
+	cartController := cart.NewCartController(cartService)
+
+	cartGroup := router.Group("/cart")
+	cartGroup.Use(middleware.AuthMiddleware())
+
+	cartGroup.GET("", cartController.GetCart)
+	cartGroup.POST("/items", cartController.AddItem)
+	cartGroup.PATCH("/items/:productID", cartController.UpdateItem)
+	cartGroup.DELETE("/items/:productID", cartController.RemoveItem)
+	cartGroup.POST("/checkout", cartController.Checkout)
+}
@@ -0,0 +1,31 @@
+package routes
+
+import (
+	"ecommerce-api/categories"
+	"ecommerce-api/middleware"
+	"ecommerce-api/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// CategorySetUpRoute sets up routes for the category hierarchy and for assigning products to categories
+func CategorySetUpRoute(router *gin.RouterGroup, db *gorm.DB) {
+	categoryService := categories.NewCategoryService(db)
+	categoryController := categories.NewCategoryController(categoryService)
+
+	category := router.Group("/categories")
+	category.Use(middleware.AuthMiddleware())
+
+	// Catalog management routes
+	category.POST("", middleware.RequireScope(models.ScopeProductsWrite), middleware.RequirePermission(models.PermProductsWrite), categoryController.CreateCategory)
+	category.PUT("/:id", middleware.RequireScope(models.ScopeProductsWrite), middleware.RequirePermission(models.PermProductsWrite), categoryController.UpdateCategory)
+	category.DELETE("/:id", middleware.RequireScope(models.ScopeProductsWrite), middleware.RequirePermission(models.PermProductsWrite), categoryController.DeleteCategory)
+
+	// Routes accessible to any authenticated user, and to API keys with the products:read scope
+	category.GET("/tree", middleware.RequireScope(models.ScopeProductsRead), categoryController.GetCategoryTree)
+	category.GET("/:id", middleware.RequireScope(models.ScopeProductsRead), categoryController.GetCategory)
+	category.GET("", middleware.RequireScope(models.ScopeProductsRead), categoryController.ListCategories)
+
+	router.PUT("/products/:id/categories", middleware.AuthMiddleware(), middleware.RequireScope(models.ScopeProductsWrite), middleware.RequirePermission(models.PermProductsWrite), categoryController.SetProductCategories)
+}
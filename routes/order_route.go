@@ -2,6 +2,7 @@ package routes
 
 import (
 	"ecommerce-api/middleware"
+	"ecommerce-api/models"
 	"ecommerce-api/orders"
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
@@ -15,9 +16,14 @@ func OrderSetUpRoute(router *gin.RouterGroup, db *gorm.DB) {
 	order := router.Group("/orders")
 	order.Use(middleware.AuthMiddleware()) 
 
-	order.POST("", orderController.PlaceOrder)
-	order.GET("", orderController.ListOrders)
-	order.PUT("/:id/cancel", orderController.CancelOrder)
+	read := middleware.RequireScope(models.ScopeOrdersRead)
+	write := middleware.RequireScope(models.ScopeOrdersWrite)
 
-	order.PUT("/:id/status", middleware.AdminMiddleware(), orderController.UpdateOrderStatus)
+	order.POST("", write, orderController.PlaceOrder)
+	order.GET("", read, orderController.ListOrders)
+	order.GET("/:id", read, orderController.GetOrder)
+	order.PUT("/:id/cancel", write, orderController.CancelOrder)
+	order.GET("/:id/history", read, orderController.OrderHistory)
+
+	order.PUT("/:id/status", write, middleware.RequirePermission(models.PermOrdersStatus), orderController.UpdateOrderStatus)
 }
@@ -1,7 +1,9 @@
 package routes
 
 import (
+	"ecommerce-api/config"
 	"ecommerce-api/middleware"
+	"ecommerce-api/models"
 	"ecommerce-api/products"
      
 	"github.com/gin-gonic/gin"
@@ -10,19 +12,33 @@ import (
 
 // ProductSetUpRoute sets up routes for product management
 func ProductSetUpRoute(router *gin.RouterGroup, db *gorm.DB) {
-	productService := products.NewProductService(db)
+	productService := products.NewProductService(db, products.ImageSettingsFromConfig(config.CONFIG))
 	productController := products.NewProductController(productService)
 
 	// Product routes group with authentication middleware
 	product := router.Group("/products")
 	product.Use(middleware.AuthMiddleware()) 
 
-	// Admin-only routes
-	product.POST("", middleware.AdminMiddleware(), productController.CreateProduct) // Admin-only
-	product.PUT("/:id", middleware.AdminMiddleware(), productController.UpdateProduct) // Admin-only
-	product.DELETE("/:id", middleware.AdminMiddleware(), productController.DeleteProduct) // Admin-only
+	// Catalog management routes
+	product.POST("", middleware.RequireScope(models.ScopeProductsWrite), middleware.RequirePermission(models.PermProductsWrite), productController.CreateProduct)
+	product.PUT("/:id", middleware.RequireScope(models.ScopeProductsWrite), middleware.RequirePermission(models.PermProductsWrite), productController.UpdateProduct)
+	product.DELETE("/:id", middleware.RequireScope(models.ScopeProductsWrite), middleware.RequirePermission(models.PermProductsWrite), productController.DeleteProduct)
+	product.GET("/trash", middleware.RequireScope(models.ScopeProductsWrite), middleware.RequirePermission(models.PermProductsWrite), productController.ListTrash)
+	product.POST("/:id/restore", middleware.RequireScope(models.ScopeProductsWrite), middleware.RequirePermission(models.PermProductsWrite), productController.RestoreProduct)
+	// Purging is for super admins only and is not available to API keys.
+	product.DELETE("/:id/purge", middleware.RequirePermission(models.PermProductsPurge), productController.PurgeProduct)
+	product.POST("/import", middleware.RequireScope(models.ScopeProductsWrite), middleware.RequirePermission(models.PermProductsWrite), productController.ImportProducts)
+	product.GET("/import/:jobID", middleware.RequireScope(models.ScopeProductsWrite), middleware.RequirePermission(models.PermProductsWrite), productController.GetImportJob)
+	product.GET("/import/:jobID/errors", middleware.RequireScope(models.ScopeProductsWrite), middleware.RequirePermission(models.PermProductsWrite), productController.GetImportErrors)
+	product.GET("/export", middleware.RequireScope(models.ScopeProductsWrite), middleware.RequirePermission(models.PermProductsWrite), productController.ExportProducts)
+	product.PUT("/:id/variants", middleware.RequireScope(models.ScopeProductsWrite), middleware.RequirePermission(models.PermProductsWrite), productController.SetProductVariants)
+	product.POST("/:id/images", middleware.RequireScope(models.ScopeProductsWrite), middleware.RequirePermission(models.PermProductsWrite), productController.UploadProductImage)
+	product.PUT("/:id/images", middleware.RequireScope(models.ScopeProductsWrite), middleware.RequirePermission(models.PermProductsWrite), productController.ReorderProductImages)
+	product.PUT("/:id/images/:imageID/primary", middleware.RequireScope(models.ScopeProductsWrite), middleware.RequirePermission(models.PermProductsWrite), productController.SetPrimaryProductImage)
+	product.DELETE("/:id/images/:imageID", middleware.RequireScope(models.ScopeProductsWrite), middleware.RequirePermission(models.PermProductsWrite), productController.DeleteProductImage)
 
-	// Routes accessible to any authenticated user
-	product.GET("/:id", productController.GetProduct)
-	product.GET("", productController.ListProducts)
+	// Routes accessible to any authenticated user, and to API keys with the products:read scope
+	product.GET("/search", middleware.RequireScope(models.ScopeProductsRead), productController.SearchProducts)
+	product.GET("/:id", middleware.RequireScope(models.ScopeProductsRead), productController.GetProduct)
+	product.GET("", middleware.RequireScope(models.ScopeProductsRead), productController.ListProducts)
 }
@@ -0,0 +1,23 @@
+package routes
+
+import (
+	"ecommerce-api/middleware"
+	"ecommerce-api/models"
+	"ecommerce-api/roles"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// RoleSetUpRoute sets up routes for assigning roles to users
+func RoleSetUpRoute(router *gin.RouterGroup, db *gorm.DB) {
+	roleService := roles.NewRoleService(db)
+	roleController := roles.NewRoleController(roleService)
+
+	admin := router.Group("/admin")
+	admin.Use(middleware.AuthMiddleware(), middleware.RequirePermission(models.PermRolesAssign))
+
+	admin.GET("/roles", roleController.ListRoles)
+	admin.GET("/users/:id/roles", roleController.GetUserRoles)
+	admin.PUT("/users/:id/roles", roleController.SetUserRoles)
+}
@@ -0,0 +1,29 @@
+package routes
+
+import (
+	"ecommerce-api/auth"
+	"ecommerce-api/config"
+	"ecommerce-api/mailer"
+	"ecommerce-api/middleware"
+	"ecommerce-api/tokens"
+	"ecommerce-api/users"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// UserSetUpRoute sets up routes for users managing their own account
+func UserSetUpRoute(router *gin.RouterGroup, db *gorm.DB) {
+	// The auth service sends the verification email after an email change.
+	authService := auth.NewAuthService(tokens.Default(), mailer.New(config.CONFIG), auth.DefaultAttemptStore(), auth.SettingsFromConfig(config.CONFIG), db)
+	userService := users.NewUserService(db, authService)
+	userController := users.NewUserController(userService)
+
+	me := router.Group("/users/me")
+	me.Use(middleware.AuthMiddleware())
+
+	me.GET("", userController.GetProfile)
+	me.PATCH("", userController.UpdateProfile)
+	me.POST("/password", userController.ChangePassword)
+	me.DELETE("", userController.DeleteAccount)
+}
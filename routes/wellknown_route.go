@@ -0,0 +1,18 @@
+package routes
+
+import (
+	"net/http"
+
+	"ecommerce-api/tokens"
+
+	"github.com/gin-gonic/gin"
+)
+
+// WellKnownSetUpRoute sets up the discovery documents served at the root, outside the versioned API
+func WellKnownSetUpRoute(router *gin.RouterGroup) {
+	// Other services fetch the keys that verify access tokens from here, so they never need the signing key.
+	router.GET("/.well-known/jwks.json", func(ctx *gin.Context) {
+		ctx.Header("Cache-Control", "public, max-age=300")
+		ctx.JSON(http.StatusOK, tokens.Default().JWKS())
+	})
+}
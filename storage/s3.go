@@ -0,0 +1,205 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// S3Config configures an S3Store.
+type S3Config struct {
+	// Endpoint is the object store's base URL. It defaults to AWS S3 in the region, and points at the
+	// local stand-in, such as "http://localhost:9000" for MinIO, in development.
+	Endpoint        string
+	Region          string
+	Bucket          string
+	AccessKeyID     string
+	SecretAccessKey string
+	// PathStyle addresses the bucket as Endpoint/Bucket instead of as a subdomain of Endpoint. MinIO
+	// and most other stand-ins need it.
+	PathStyle bool
+	// PublicURL is the base URL files are linked under, such as a CDN in front of the bucket. It
+	// defaults to the bucket's own URL.
+	PublicURL string
+}
+
+// S3Store keeps files in a bucket of an S3-compatible object store. Requests are signed with AWS
+// Signature Version 4, and files are uploaded with a public-read ACL.
+type S3Store struct {
+	config S3Config
+	bucket *url.URL
+	client *http.Client
+	now    func() time.Time
+}
+
+// NewS3Store creates an S3Store for the bucket described by cfg.
+func NewS3Store(cfg S3Config) *S3Store {
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = "https://s3." + cfg.Region + ".amazonaws.com"
+	}
+
+	bucket, err := url.Parse(strings.TrimSuffix(cfg.Endpoint, "/"))
+	if err != nil {
+		bucket = &url.URL{}
+	}
+	if cfg.PathStyle {
+		bucket.Path += "/" + cfg.Bucket
+	} else {
+		bucket.Host = cfg.Bucket + "." + bucket.Host
+	}
+	if cfg.PublicURL == "" {
+		cfg.PublicURL = bucket.String()
+	}
+	cfg.PublicURL = strings.TrimSuffix(cfg.PublicURL, "/")
+
+	return &S3Store{config: cfg, bucket: bucket, client: &http.Client{Timeout: 30 * time.Second}, now: time.Now}
+}
+
+func (s *S3Store) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	if err := validateKey(key); err != nil {
+		return err
+	}
+	req, err := s.request(ctx, http.MethodPut, key, data)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("X-Amz-Acl", "public-read")
+	return s.do(req, "store file")
+}
+
+func (s *S3Store) Delete(ctx context.Context, key string) error {
+	if err := validateKey(key); err != nil {
+		return err
+	}
+	req, err := s.request(ctx, http.MethodDelete, key, nil)
+	if err != nil {
+		return err
+	}
+	// S3 answers 204 whether or not the object existed.
+	return s.do(req, "delete file")
+}
+
+func (s *S3Store) URL(key string) string {
+	return s.config.PublicURL + "/" + key
+}
+
+func (s *S3Store) request(ctx context.Context, method, key string, body []byte) (*http.Request, error) {
+	target := *s.bucket
+	target.Path += "/" + key
+	req, err := http.NewRequestWithContext(ctx, method, target.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build storage request: %w", err)
+	}
+	req.ContentLength = int64(len(body))
+	req.Header.Set("X-Amz-Content-Sha256", hashHex(body))
+	return req, nil
+}
+
+func (s *S3Store) do(req *http.Request, action string) error {
+	s.sign(req, s.now())
+	res, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to %s: %w", action, err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return fmt.Errorf("failed to %s: object store answered %s: %s", action, res.Status, strings.TrimSpace(string(message)))
+	}
+	return nil
+}
+
+// sign adds an AWS Signature Version 4 Authorization header to req, signing the host and all of the
+// request's headers. The X-Amz-Content-Sha256 header must already hold the hash of the body.
+func (s *S3Store) sign(req *http.Request, at time.Time) {
+	at = at.UTC()
+	amzDate := at.Format("20060102T150405Z")
+	date := at.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		req.Header.Get("X-Amz-Content-Sha256"),
+	}, "\n")
+
+	scope := date + "/" + s.config.Region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hashHex([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+s.config.SecretAccessKey), date)
+	key = hmacSHA256(key, s.config.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+s.config.AccessKeyID+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+// canonicalQuery sorts and encodes query parameters the way Signature Version 4 expects.
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, key := range keys {
+		values := query[key]
+		sort.Strings(values)
+		for _, value := range values {
+			parts = append(parts, escape(key)+"="+escape(value))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// escape percent-encodes everything except unreserved characters, as Signature Version 4 requires.
+func escape(value string) string {
+	return strings.ReplaceAll(url.QueryEscape(value), "+", "%20")
+}
+
+func hashHex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
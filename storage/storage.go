@@ -0,0 +1,134 @@
+// Package storage keeps uploaded files, such as product images, in a blob store: the local filesystem
+// or an S3-compatible object store.
+package storage
+
+import (
+	"context"
+	"ecommerce-api/config"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrInvalidKey is returned for keys that are empty or would escape the store, such as "../x".
+var ErrInvalidKey = errors.New("invalid blob key")
+
+// BlobStore stores files under keys such as "products/7/3f9c.jpg". Stored files are public and served
+// from URL(key). Implementations must be safe for concurrent use.
+type BlobStore interface {
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	// Delete removes a file. Deleting a file that does not exist is not an error.
+	Delete(ctx context.Context, key string) error
+	URL(key string) string
+}
+
+// New returns the BlobStore selected by STORAGE_DRIVER: "s3" or "local". Anything else, including an
+// empty value, stores files on the local filesystem, so a development setup needs no object store.
+func New(appConfig *config.AppConfig) BlobStore {
+	switch appConfig.STORAGE_DRIVER {
+	case "s3":
+		return NewS3Store(S3Config{
+			Endpoint:        appConfig.S3_ENDPOINT,
+			Region:          appConfig.S3_REGION,
+			Bucket:          appConfig.S3_BUCKET,
+			AccessKeyID:     appConfig.S3_ACCESS_KEY_ID,
+			SecretAccessKey: appConfig.S3_SECRET_ACCESS_KEY,
+			PathStyle:       appConfig.S3_PATH_STYLE,
+			PublicURL:       appConfig.STORAGE_PUBLIC_URL,
+		})
+	default:
+		publicURL := appConfig.STORAGE_PUBLIC_URL
+		if publicURL == "" {
+			publicURL = strings.TrimSuffix(appConfig.API_URL, "/") + "/uploads"
+		}
+		return NewLocalStore(appConfig.STORAGE_DIR, publicURL)
+	}
+}
+
+// LocalStore keeps files in a directory, which the API serves at its public URL.
+type LocalStore struct {
+	dir       string
+	publicURL string
+}
+
+// NewLocalStore creates a LocalStore that writes into dir, creating it if needed, and links files
+// under publicURL.
+func NewLocalStore(dir, publicURL string) *LocalStore {
+	return &LocalStore{dir: dir, publicURL: strings.TrimSuffix(publicURL, "/")}
+}
+
+func (s *LocalStore) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create storage directory: %w", err)
+	}
+
+	// The file is written under a temporary name and renamed, so a file is never served half written.
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return fmt.Errorf("failed to store file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to store file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to store file: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return fmt.Errorf("failed to store file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to store file: %w", err)
+	}
+	return nil
+}
+
+func (s *LocalStore) Delete(ctx context.Context, key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to delete file: %w", err)
+	}
+	return nil
+}
+
+func (s *LocalStore) URL(key string) string {
+	return s.publicURL + "/" + key
+}
+
+// path maps a key to a file inside the store's directory.
+func (s *LocalStore) path(key string) (string, error) {
+	if err := validateKey(key); err != nil {
+		return "", err
+	}
+	return filepath.Join(s.dir, filepath.FromSlash(key)), nil
+}
+
+// validateKey accepts slash-separated keys of letters, digits, "-", "_" and "." that stay inside the store.
+func validateKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") {
+		return ErrInvalidKey
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return ErrInvalidKey
+		}
+	}
+	for _, r := range key {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.', r == '/':
+		default:
+			return ErrInvalidKey
+		}
+	}
+	return nil
+}
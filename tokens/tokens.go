@@ -0,0 +1,245 @@
+package tokens
+
+import (
+	"ecommerce-api/config"
+	"ecommerce-api/models"
+	"ecommerce-api/utils"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// Authentication methods recorded in the amr claim, with the values registered by RFC 8176.
+const (
+	MethodPassword = "pwd"
+	MethodOTP      = "otp"
+)
+
+// Claims are the claims carried by access tokens. Besides identifying the user they carry what
+// authorization decisions need, so that requests can be authorized without loading the user.
+type Claims struct {
+	jwt.RegisteredClaims
+	// TokenVersion is the user's token version when the token was issued. Bumping the version
+	// stored on the user revokes every token issued before, which also makes clients pick up
+	// changed roles or verification status on their next refresh.
+	TokenVersion uint `json:"ver"`
+	// Roles are the user's roles when the token was issued. Tokens issued before roles were added
+	// to the claims have none.
+	Roles []models.Role `json:"roles,omitempty"`
+	// EmailVerified reports whether the user had verified their email when the token was issued.
+	EmailVerified bool `json:"email_verified"`
+	// AuthMethods lists how the user authenticated in the login that led to this token.
+	AuthMethods []string `json:"amr,omitempty"`
+}
+
+// Subject describes the user an access token is issued to.
+type Subject struct {
+	UserID        uint
+	TokenVersion  uint
+	Roles         []models.Role
+	EmailVerified bool
+}
+
+// HasMFA reports whether the user passed a second factor in the login that led to this token.
+func (c *Claims) HasMFA() bool {
+	for _, method := range c.AuthMethods {
+		if method == MethodOTP {
+			return true
+		}
+	}
+	return false
+}
+
+// UserID returns the ID of the user the token was issued to.
+func (c *Claims) UserID() (uint, error) {
+	id, err := strconv.ParseUint(c.Subject, 10, 32)
+	if err != nil {
+		return 0, err
+	}
+	return uint(id), nil
+}
+
+// Manager issues and verifies access tokens.
+//
+// Tokens are signed with a single signing key. Verification also accepts the previous keys passed
+// to New, so that tokens signed before a key rotation stay valid until they expire.
+type Manager struct {
+	signing  *Key
+	previous []*Key
+	keys     map[string]*Key
+	ttl      time.Duration
+	issuer   string
+	audience string
+}
+
+// New creates a Manager that signs access tokens valid for ttl with signing and verifies them with
+// signing or any of the previous keys. Issued tokens carry issuer and audience, and tokens with
+// another issuer or audience are rejected; empty values disable the claim.
+func New(signing *Key, previous []*Key, ttl time.Duration, issuer, audience string) *Manager {
+	keys := map[string]*Key{signing.ID: signing}
+	for _, key := range previous {
+		keys[key.ID] = key
+	}
+	return &Manager{signing: signing, previous: previous, keys: keys, ttl: ttl, issuer: issuer, audience: audience}
+}
+
+// NewManager creates a Manager that signs HS256 access tokens with secret, valid for ttl.
+func NewManager(secret string, ttl time.Duration) *Manager {
+	return New(NewHMACKey(secret), nil, ttl, "", "")
+}
+
+// FromConfig creates the Manager described by the application configuration. Tokens are signed with
+// the private key in JWT_PRIVATE_KEY_FILE and also verified with the public keys in
+// JWT_PUBLIC_KEY_FILES. Without a private key, tokens are signed with the shared JWT_SECRET.
+func FromConfig(appConfig *config.AppConfig) (*Manager, error) {
+	ttl := appConfig.ACCESS_TOKEN_TTL
+	if ttl <= 0 {
+		ttl = 15 * time.Minute
+	}
+
+	if appConfig.JWT_PRIVATE_KEY_FILE == "" {
+		if appConfig.JWT_SECRET == "" {
+			return nil, errors.New("either JWT_PRIVATE_KEY_FILE or JWT_SECRET must be set")
+		}
+		return New(NewHMACKey(appConfig.JWT_SECRET), nil, ttl, appConfig.JWT_ISSUER, appConfig.JWT_AUDIENCE), nil
+	}
+
+	signing, err := LoadPrivateKeyFile(appConfig.JWT_PRIVATE_KEY_FILE)
+	if err != nil {
+		return nil, err
+	}
+
+	var previous []*Key
+	for _, path := range strings.Split(appConfig.JWT_PUBLIC_KEY_FILES, ",") {
+		if path = strings.TrimSpace(path); path == "" {
+			continue
+		}
+		key, err := LoadPublicKeyFile(path)
+		if err != nil {
+			return nil, err
+		}
+		previous = append(previous, key)
+	}
+	return New(signing, previous, ttl, appConfig.JWT_ISSUER, appConfig.JWT_AUDIENCE), nil
+}
+
+var (
+	defaultManager *Manager
+	defaultMu      sync.Mutex
+)
+
+// Default returns the Manager built from config.CONFIG, creating it on first use. It panics if the
+// configured keys cannot be loaded, as no token could be issued or verified.
+func Default() *Manager {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+
+	if defaultManager == nil {
+		appConfig := config.CONFIG
+		if appConfig == nil {
+			appConfig = config.Config()
+		}
+		manager, err := FromConfig(appConfig)
+		if err != nil {
+			panic("failed to load access token keys: " + err.Error())
+		}
+		defaultManager = manager
+	}
+	return defaultManager
+}
+
+// TTL returns how long issued access tokens stay valid.
+func (m *Manager) TTL() time.Duration {
+	return m.ttl
+}
+
+// JWKS returns the public keys that verify access tokens, for publishing at /.well-known/jwks.json.
+// It is empty when tokens are signed with a shared secret.
+func (m *Manager) JWKS() JWKSet {
+	set := JWKSet{Keys: []JWK{}}
+	if jwk, ok := m.signing.JWK(); ok {
+		set.Keys = append(set.Keys, jwk)
+	}
+	for _, key := range m.previous {
+		if jwk, ok := key.JWK(); ok && key.ID != m.signing.ID {
+			set.Keys = append(set.Keys, jwk)
+		}
+	}
+	return set
+}
+
+// Issue signs a new access token for the subject, recording the authentication methods used to log in.
+// Every token gets a random ID (jti) so that it can be revoked on its own before it expires.
+func (m *Manager) Issue(subject Subject, methods []string) (string, *Claims, error) {
+	jti, err := utils.GenerateRandomToken(16)
+	if err != nil {
+		return "", nil, err
+	}
+
+	now := time.Now()
+	claims := &Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			Issuer:    m.issuer,
+			Subject:   strconv.FormatUint(uint64(subject.UserID), 10),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(m.ttl)),
+		},
+		TokenVersion:  subject.TokenVersion,
+		Roles:         subject.Roles,
+		EmailVerified: subject.EmailVerified,
+		AuthMethods:   methods,
+	}
+	if m.audience != "" {
+		claims.Audience = jwt.ClaimStrings{m.audience}
+	}
+
+	token := jwt.NewWithClaims(m.signing.Method, claims)
+	if m.signing.ID != "" {
+		token.Header["kid"] = m.signing.ID
+	}
+
+	signed, err := token.SignedString(m.signing.signKey)
+	if err != nil {
+		return "", nil, errors.New("failed to generate token")
+	}
+	return signed, claims, nil
+}
+
+// Parse verifies an access token's signature, expiry, issuer and audience and returns its claims.
+// A "Bearer " prefix is accepted and ignored. Tokens without a jti cannot be revoked and are rejected.
+func (m *Manager) Parse(tokenString string) (*Claims, error) {
+	tokenString = strings.TrimSpace(strings.TrimPrefix(tokenString, "Bearer "))
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := m.keys[kid]
+		if !ok {
+			return nil, errors.New("unknown signing key")
+		}
+		// The algorithm must match the key, or a public key could be used as an HMAC secret.
+		if token.Method.Alg() != key.Method.Alg() {
+			return nil, errors.New("unexpected signing method")
+		}
+		return key.verifyKey, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.Subject == "" || claims.ID == "" || claims.ExpiresAt == nil {
+		return nil, utils.ErrInvalidToken
+	}
+	if m.issuer != "" && !claims.VerifyIssuer(m.issuer, true) {
+		return nil, utils.ErrInvalidToken
+	}
+	if m.audience != "" && !claims.VerifyAudience(m.audience, true) {
+		return nil, utils.ErrInvalidToken
+	}
+	return claims, nil
+}
@@ -0,0 +1,155 @@
+package tokens
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"ecommerce-api/models"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIssueAndParse(t *testing.T) {
+	manager := NewManager("secret", time.Minute)
+
+	token, issued, err := manager.Issue(Subject{UserID: 42, TokenVersion: 3, Roles: []models.Role{models.RoleCustomer, models.RoleSupport}, EmailVerified: true}, []string{MethodPassword, MethodOTP})
+	assert.NoError(t, err)
+
+	claims, err := manager.Parse("Bearer " + token)
+	if assert.NoError(t, err) {
+		userID, _ := claims.UserID()
+		assert.Equal(t, uint(42), userID)
+		assert.Equal(t, uint(3), claims.TokenVersion)
+		assert.Equal(t, []models.Role{models.RoleCustomer, models.RoleSupport}, claims.Roles)
+		assert.True(t, claims.EmailVerified)
+		assert.True(t, claims.HasMFA())
+		assert.Equal(t, issued.ID, claims.ID)
+		assert.NotEmpty(t, claims.ID)
+	}
+
+	_, other, _ := manager.Issue(Subject{UserID: 42, TokenVersion: 3}, nil)
+	assert.NotEqual(t, issued.ID, other.ID)
+}
+
+func TestParseRejectsInvalidTokens(t *testing.T) {
+	manager := NewManager("secret", time.Minute)
+
+	token, _, _ := NewManager("other secret", time.Minute).Issue(Subject{UserID: 1}, nil)
+	_, err := manager.Parse(token)
+	assert.Error(t, err, "token signed with another secret")
+
+	token, _, _ = NewManager("secret", -time.Minute).Issue(Subject{UserID: 1}, nil)
+	_, err = manager.Parse(token)
+	assert.Error(t, err, "expired token")
+
+	// Tokens issued before jti claims were added cannot be revoked individually.
+	legacy, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		Subject:   "1",
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+	}).SignedString([]byte("secret"))
+	_, err = manager.Parse(legacy)
+	assert.Error(t, err, "token without jti")
+}
+
+func TestAsymmetricKeys(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+
+	for name, private := range map[string]crypto.Signer{"RS256": rsaKey, "EdDSA": edKey} {
+		t.Run(name, func(t *testing.T) {
+			key, err := NewPrivateKey(private)
+			assert.NoError(t, err)
+			assert.Equal(t, name, key.Method.Alg())
+
+			manager := New(key, nil, time.Minute, "https://api.example.com", "shop")
+			token, _, err := manager.Issue(Subject{UserID: 7, TokenVersion: 1}, nil)
+			assert.NoError(t, err)
+
+			claims, err := manager.Parse(token)
+			if assert.NoError(t, err) {
+				assert.Equal(t, "https://api.example.com", claims.Issuer)
+				assert.Equal(t, jwt.ClaimStrings{"shop"}, claims.Audience)
+			}
+
+			parsed, _, _ := new(jwt.Parser).ParseUnverified(token, &Claims{})
+			assert.Equal(t, key.ID, parsed.Header["kid"])
+
+			jwks := manager.JWKS()
+			if assert.Len(t, jwks.Keys, 1) {
+				assert.Equal(t, key.ID, jwks.Keys[0].KeyID)
+				assert.Equal(t, name, jwks.Keys[0].Algorithm)
+			}
+		})
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	dir := t.TempDir()
+	oldPath := writeKeyFile(t, dir, "old.pem")
+	newPath := writeKeyFile(t, dir, "new.pem")
+
+	oldKey, err := LoadPrivateKeyFile(oldPath)
+	assert.NoError(t, err)
+	newKey, err := LoadPrivateKeyFile(newPath)
+	assert.NoError(t, err)
+	oldPublic, err := LoadPublicKeyFile(oldPath)
+	assert.NoError(t, err)
+	assert.Equal(t, oldKey.ID, oldPublic.ID)
+
+	oldToken, _, _ := New(oldKey, nil, time.Minute, "", "").Issue(Subject{UserID: 1}, nil)
+
+	rotated := New(newKey, []*Key{oldPublic}, time.Minute, "", "")
+	_, err = rotated.Parse(oldToken)
+	assert.NoError(t, err, "tokens signed with a previous key stay valid")
+	assert.Len(t, rotated.JWKS().Keys, 2)
+
+	_, err = New(newKey, nil, time.Minute, "", "").Parse(oldToken)
+	assert.Error(t, err, "tokens signed with a retired key are rejected")
+}
+
+func TestParseRejectsWrongIssuerAudienceAndAlgorithm(t *testing.T) {
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	key, _ := NewPrivateKey(edKey)
+	manager := New(key, nil, time.Minute, "issuer", "audience")
+
+	token, _, _ := New(key, nil, time.Minute, "other issuer", "audience").Issue(Subject{UserID: 1}, nil)
+	_, err := manager.Parse(token)
+	assert.Error(t, err, "wrong issuer")
+
+	token, _, _ = New(key, nil, time.Minute, "issuer", "other audience").Issue(Subject{UserID: 1}, nil)
+	_, err = manager.Parse(token)
+	assert.Error(t, err, "wrong audience")
+
+	// An HS256 token using the public key as its secret must not verify against the public key.
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, &Claims{RegisteredClaims: jwt.RegisteredClaims{
+		ID: "jti", Subject: "1", Issuer: "issuer", Audience: jwt.ClaimStrings{"audience"},
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+	}})
+	forged.Header["kid"] = key.ID
+	signed, _ := forged.SignedString([]byte(edKey.Public().(ed25519.PublicKey)))
+	_, err = manager.Parse(signed)
+	assert.Error(t, err, "algorithm confusion")
+}
+
+func writeKeyFile(t *testing.T, dir, name string) string {
+	t.Helper()
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	assert.NoError(t, err)
+
+	path := filepath.Join(dir, name)
+	assert.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600))
+	return path
+}
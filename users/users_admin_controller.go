@@ -0,0 +1,207 @@
+package users
+
+import (
+	"ecommerce-api/utils"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminController handles HTTP requests for staff managing user accounts
+type AdminController struct {
+	adminService *AdminService
+}
+
+// NewAdminController initializes a new AdminController
+func NewAdminController(adminService *AdminService) *AdminController {
+	return &AdminController{adminService: adminService}
+}
+
+// targetID reads the ID of the user being managed from the path, sending an error response if it is malformed.
+func targetID(ctx *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
+	if err != nil {
+		utils.NewAPIResponse(http.StatusBadRequest, "Invalid user ID", nil, err.Error()).Send(ctx)
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// ListUsers godoc
+// @Summary      List users
+// @Description  Requires the users:read permission. Lists users newest first, optionally only those whose email or name contains q, or only suspended or active users.
+// @Tags         admin
+// @Produce      json
+// @Param        q          query     string  false  "Case-insensitive email or name substring"
+// @Param        suspended  query     bool    false  "Only suspended (true) or active (false) users"
+// @Param        page       query     int     false  "Page number, starting at 1"
+// @Param        limit      query     int     false  "Page size (max 100)"
+// @Success      200        {object}  utils.APIResponse{data=utils.Page{items=[]UserSummary}}
+// @Failure      400        {object}  utils.APIResponse
+// @Failure      403        {object}  utils.APIResponse
+// @Failure      500        {object}  utils.APIResponse
+// @Security     BearerAuth
+// @Router       /admin/users [get]
+func (c *AdminController) ListUsers(ctx *gin.Context) {
+	var query ListUsersQuery
+	if err := ctx.ShouldBindQuery(&query); err != nil {
+		utils.NewAPIResponse(http.StatusBadRequest, "Invalid query parameters", nil, err.Error()).Send(ctx)
+		return
+	}
+
+	users, pagination, err := c.adminService.ListUsers(query)
+	if err != nil {
+		utils.NewAPIResponse(http.StatusInternalServerError, "Failed to retrieve users", nil, err.Error()).Send(ctx)
+		return
+	}
+
+	utils.NewAPIResponse(http.StatusOK, "Users retrieved successfully", utils.Page{Items: users, Pagination: pagination}, "").Send(ctx)
+}
+
+// GetUser godoc
+// @Summary      Get a user
+// @Description  Requires the users:read permission. Returns the user's account, roles, suspension and order counts.
+// @Tags         admin
+// @Produce      json
+// @Param        id   path      string  true  "User ID"
+// @Success      200  {object}  utils.APIResponse{data=UserDetail}
+// @Failure      400  {object}  utils.APIResponse
+// @Failure      403  {object}  utils.APIResponse
+// @Failure      404  {object}  utils.APIResponse
+// @Failure      500  {object}  utils.APIResponse
+// @Security     BearerAuth
+// @Router       /admin/users/{id} [get]
+func (c *AdminController) GetUser(ctx *gin.Context) {
+	id, ok := targetID(ctx)
+	if !ok {
+		return
+	}
+
+	user, err := c.adminService.GetUser(id)
+	if err != nil {
+		sendAdminError(ctx, err, "Failed to retrieve user")
+		return
+	}
+
+	utils.NewAPIResponse(http.StatusOK, "User retrieved successfully", user, "").Send(ctx)
+}
+
+// SuspendUser godoc
+// @Summary      Suspend a user
+// @Description  Requires the users:manage permission. Ends every session of the user and blocks them from logging in until they are unsuspended. Recorded in the audit log.
+// @Tags         admin
+// @Accept       json
+// @Produce      json
+// @Param        id     path      string          true   "User ID"
+// @Param        input  body      SuspendUserDTO  false  "Reason for the suspension"
+// @Success      200    {object}  utils.APIResponse{data=UserDetail}
+// @Failure      400    {object}  utils.APIResponse
+// @Failure      403    {object}  utils.APIResponse
+// @Failure      404    {object}  utils.APIResponse
+// @Failure      409    {object}  utils.APIResponse
+// @Failure      500    {object}  utils.APIResponse
+// @Security     BearerAuth
+// @Router       /admin/users/{id}/suspend [post]
+func (c *AdminController) SuspendUser(ctx *gin.Context) {
+	id, ok := targetID(ctx)
+	if !ok {
+		return
+	}
+	actorID, ok := userID(ctx)
+	if !ok {
+		return
+	}
+
+	// The body is optional; a suspension without a reason is allowed.
+	var input SuspendUserDTO
+	if err := ctx.ShouldBindJSON(&input); err != nil && !errors.Is(err, io.EOF) {
+		utils.NewAPIResponse(http.StatusBadRequest, "Invalid input", nil, err.Error()).Send(ctx)
+		return
+	}
+
+	user, err := c.adminService.Suspend(id, actorID, ctx.ClientIP(), input.Reason)
+	if err != nil {
+		sendAdminError(ctx, err, "Failed to suspend user")
+		return
+	}
+
+	utils.NewAPIResponse(http.StatusOK, "User suspended successfully", user, "").Send(ctx)
+}
+
+// UnsuspendUser godoc
+// @Summary      Unsuspend a user
+// @Description  Requires the users:manage permission. Lets a suspended user log in again. Recorded in the audit log.
+// @Tags         admin
+// @Produce      json
+// @Param        id   path      string  true  "User ID"
+// @Success      200  {object}  utils.APIResponse{data=UserDetail}
+// @Failure      400  {object}  utils.APIResponse
+// @Failure      403  {object}  utils.APIResponse
+// @Failure      404  {object}  utils.APIResponse
+// @Failure      500  {object}  utils.APIResponse
+// @Security     BearerAuth
+// @Router       /admin/users/{id}/unsuspend [post]
+func (c *AdminController) UnsuspendUser(ctx *gin.Context) {
+	id, ok := targetID(ctx)
+	if !ok {
+		return
+	}
+	actorID, ok := userID(ctx)
+	if !ok {
+		return
+	}
+
+	user, err := c.adminService.Unsuspend(id, actorID, ctx.ClientIP())
+	if err != nil {
+		sendAdminError(ctx, err, "Failed to unsuspend user")
+		return
+	}
+
+	utils.NewAPIResponse(http.StatusOK, "User unsuspended successfully", user, "").Send(ctx)
+}
+
+// ForceLogout godoc
+// @Summary      Log a user out everywhere
+// @Description  Requires the users:manage permission. Revokes every refresh token, access token and API key of the user. Recorded in the audit log.
+// @Tags         admin
+// @Produce      json
+// @Param        id   path      string  true  "User ID"
+// @Success      200  {object}  utils.APIResponse
+// @Failure      400  {object}  utils.APIResponse
+// @Failure      403  {object}  utils.APIResponse
+// @Failure      404  {object}  utils.APIResponse
+// @Failure      500  {object}  utils.APIResponse
+// @Security     BearerAuth
+// @Router       /admin/users/{id}/logout [post]
+func (c *AdminController) ForceLogout(ctx *gin.Context) {
+	id, ok := targetID(ctx)
+	if !ok {
+		return
+	}
+	actorID, ok := userID(ctx)
+	if !ok {
+		return
+	}
+
+	if err := c.adminService.ForceLogout(id, actorID, ctx.ClientIP()); err != nil {
+		sendAdminError(ctx, err, "Failed to log user out")
+		return
+	}
+
+	utils.NewAPIResponse(http.StatusOK, "User logged out successfully", nil, "").Send(ctx)
+}
+
+// sendAdminError maps AdminService errors to responses, using message for unexpected errors.
+func sendAdminError(ctx *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, utils.ErrUserNotFound):
+		utils.NewAPIResponse(http.StatusNotFound, "User not found", nil, "").Send(ctx)
+	case errors.Is(err, ErrCannotSuspendSelf):
+		utils.NewAPIResponse(http.StatusConflict, "Cannot suspend yourself", nil, err.Error()).Send(ctx)
+	default:
+		utils.NewAPIResponse(http.StatusInternalServerError, message, nil, err.Error()).Send(ctx)
+	}
+}
@@ -0,0 +1,249 @@
+package users
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"ecommerce-api/audit"
+	"ecommerce-api/middleware"
+	"ecommerce-api/models"
+	"ecommerce-api/utils"
+
+	"gorm.io/gorm"
+)
+
+// ErrCannotSuspendSelf is returned when an admin tries to suspend their own account.
+var ErrCannotSuspendSelf = errors.New("admins cannot suspend their own account")
+
+// AdminService lets staff find and manage user accounts. Every change is recorded in the audit log.
+type AdminService struct {
+	db *gorm.DB
+}
+
+// NewAdminService initializes AdminService with database connection
+func NewAdminService(db *gorm.DB) *AdminService {
+	return &AdminService{db: db}
+}
+
+// ListUsers retrieves one page of users, newest first.
+//
+// The function takes a single parameter:
+// - query: Filters by a case-insensitive email or name substring and by suspension, and the page to return.
+//
+// The function returns the users of the page, the pagination metadata including the total number of
+// matching users, and an error if there is an error while interacting with the database.
+func (s *AdminService) ListUsers(query ListUsersQuery) ([]UserSummary, utils.Pagination, error) {
+	limit := utils.PageLimit(query.Limit)
+	page := query.Page
+	if page < 1 {
+		page = 1
+	}
+	pagination := utils.Pagination{Limit: limit, Page: page}
+
+	var total int64
+	if err := s.db.Model(&models.User{}).Scopes(userFilters(query)).Count(&total).Error; err != nil {
+		return nil, pagination, errors.New("failed to count users: " + err.Error())
+	}
+	pagination.Total = &total
+
+	// One extra row is fetched to find out whether another page follows.
+	var users []models.User
+	if err := s.db.Select("id", "email", "name", "verified_at", "suspended_at", "created_at").
+		Scopes(userFilters(query)).
+		Order("created_at DESC, id DESC").
+		Limit(limit + 1).
+		Offset((page - 1) * limit).
+		Find(&users).Error; err != nil {
+		return nil, pagination, errors.New("failed to retrieve users: " + err.Error())
+	}
+
+	if len(users) > limit {
+		users = users[:limit]
+		pagination.HasMore = true
+	}
+
+	summaries := make([]UserSummary, 0, len(users))
+	for _, user := range users {
+		summaries = append(summaries, UserSummary{
+			ID:            user.ID,
+			Email:         user.Email,
+			Name:          user.Name,
+			EmailVerified: user.VerifiedAt != nil,
+			SuspendedAt:   user.SuspendedAt,
+			CreatedAt:     user.CreatedAt,
+		})
+	}
+	return summaries, pagination, nil
+}
+
+// userFilters applies the filters of the user list query.
+func userFilters(query ListUsersQuery) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if q := strings.TrimSpace(query.Q); q != "" {
+			pattern := utils.ContainsPattern(strings.ToLower(q))
+			db = db.Where(`LOWER(email) LIKE ? ESCAPE '\' OR LOWER(name) LIKE ? ESCAPE '\'`, pattern, pattern)
+		}
+		if query.Suspended != nil {
+			if *query.Suspended {
+				db = db.Where("suspended_at IS NOT NULL")
+			} else {
+				db = db.Where("suspended_at IS NULL")
+			}
+		}
+		return db
+	}
+}
+
+// GetUser returns everything an admin can see about a user, including how many orders they placed.
+//
+// Returns:
+// - utils.ErrUserNotFound if the user does not exist or was deleted.
+// - An error if any database operation fails.
+func (s *AdminService) GetUser(userID uint) (*UserDetail, error) {
+	user, err := findUser(s.db, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	roles := []models.Role{}
+	if err := s.db.Model(&models.UserRole{}).Where("user_id = ?", userID).Order("role").Pluck("role", &roles).Error; err != nil {
+		return nil, errors.New("failed to retrieve user roles: " + err.Error())
+	}
+
+	var factors int64
+	if err := s.db.Model(&models.MFAFactor{}).Where("user_id = ? AND confirmed_at IS NOT NULL", userID).Count(&factors).Error; err != nil {
+		return nil, errors.New("failed to retrieve MFA status: " + err.Error())
+	}
+
+	var statuses []struct {
+		Status models.OrderStatus
+		Count  int64
+	}
+	if err := s.db.Model(&models.Order{}).Select("status, COUNT(*) AS count").
+		Where("user_id = ?", userID).Group("status").Scan(&statuses).Error; err != nil {
+		return nil, errors.New("failed to count orders: " + err.Error())
+	}
+	orders := OrderCounts{ByStatus: map[models.OrderStatus]int64{}}
+	for _, status := range statuses {
+		orders.Total += status.Count
+		orders.ByStatus[status.Status] = status.Count
+	}
+
+	return &UserDetail{
+		ID:               user.ID,
+		Email:            user.Email,
+		Name:             user.Name,
+		EmailVerified:    user.VerifiedAt != nil,
+		VerifiedAt:       user.VerifiedAt,
+		Roles:            roles,
+		MFAEnabled:       factors > 0,
+		SuspendedAt:      user.SuspendedAt,
+		SuspensionReason: user.SuspensionReason,
+		Orders:           orders,
+		CreatedAt:        user.CreatedAt,
+		UpdatedAt:        user.UpdatedAt,
+	}, nil
+}
+
+// Suspend blocks a user from logging in and ends every session, so the user is locked out until
+// an admin unsuspends them. Suspending a user who is already suspended changes nothing.
+//
+// Parameters:
+// - userID: The unique identifier of the user to suspend.
+// - actorID: The unique identifier of the admin suspending the user.
+// - ip: The IP address of the admin, for the audit log.
+// - reason: Why the user is suspended, shown to admins.
+//
+// Returns:
+// - The user after the change.
+// - ErrCannotSuspendSelf if the admin tries to suspend themselves.
+// - utils.ErrUserNotFound if the user does not exist or was deleted.
+// - An error if any database operation fails.
+func (s *AdminService) Suspend(userID, actorID uint, ip, reason string) (*UserDetail, error) {
+	if userID == actorID {
+		return nil, ErrCannotSuspendSelf
+	}
+
+	reason = strings.TrimSpace(reason)
+	changed := false
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		user, err := findUser(tx, userID)
+		if err != nil {
+			return err
+		}
+		if user.SuspendedAt != nil {
+			return nil
+		}
+
+		if err := tx.Model(user).Updates(map[string]interface{}{
+			"suspended_at":      time.Now(),
+			"suspension_reason": reason,
+			"token_version":     gorm.Expr("token_version + 1"),
+		}).Error; err != nil {
+			return errors.New("failed to suspend user: " + err.Error())
+		}
+		changed = true
+		return endSessions(tx, userID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if changed {
+		middleware.ForgetUser(userID)
+		audit.Record(s.db, models.AuditLog{Event: models.AuditUserSuspended, UserID: &userID, ActorID: &actorID, IP: ip, Details: reason})
+	}
+	return s.GetUser(userID)
+}
+
+// Unsuspend lets a suspended user log in again. Unsuspending a user who is not suspended changes nothing.
+//
+// Returns:
+// - The user after the change.
+// - utils.ErrUserNotFound if the user does not exist or was deleted.
+// - An error if any database operation fails.
+func (s *AdminService) Unsuspend(userID, actorID uint, ip string) (*UserDetail, error) {
+	user, err := findUser(s.db, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.SuspendedAt != nil {
+		if err := s.db.Model(user).Updates(map[string]interface{}{
+			"suspended_at":      nil,
+			"suspension_reason": "",
+		}).Error; err != nil {
+			return nil, errors.New("failed to unsuspend user: " + err.Error())
+		}
+		audit.Record(s.db, models.AuditLog{Event: models.AuditUserUnsuspended, UserID: &userID, ActorID: &actorID, IP: ip})
+	}
+	return s.GetUser(userID)
+}
+
+// ForceLogout ends every session of a user: their refresh tokens and API keys are revoked and their
+// token version is bumped, so their access tokens are rejected on their next use. Other processes that recently
+// checked one of the tokens reject it at the latest after ACCESS_TOKEN_CHECK_INTERVAL.
+//
+// Returns:
+// - utils.ErrUserNotFound if the user does not exist or was deleted.
+// - An error if any database operation fails.
+func (s *AdminService) ForceLogout(userID, actorID uint, ip string) error {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		user, err := findUser(tx, userID)
+		if err != nil {
+			return err
+		}
+		if err := tx.Model(user).Update("token_version", gorm.Expr("token_version + 1")).Error; err != nil {
+			return errors.New("failed to revoke access tokens: " + err.Error())
+		}
+		return endSessions(tx, userID)
+	})
+	if err != nil {
+		return err
+	}
+
+	middleware.ForgetUser(userID)
+	audit.Record(s.db, models.AuditLog{Event: models.AuditUserLoggedOut, UserID: &userID, ActorID: &actorID, IP: ip})
+	return nil
+}
@@ -0,0 +1,122 @@
+package users
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"ecommerce-api/models"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func newMockAdminService(t *testing.T) (*AdminService, sqlmock.Sqlmock) {
+	userService, _, mock := newMockUserService(t)
+	return NewAdminService(userService.db), mock
+}
+
+func TestListUsersSearchesEmailAndName(t *testing.T) {
+	service, mock := newMockAdminService(t)
+
+	filter := `(LOWER(email) LIKE $1 ESCAPE '\' OR LOWER(name) LIKE $2 ESCAPE '\') AND suspended_at IS NOT NULL AND "users"."deleted_at" IS NULL`
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM "users" WHERE `+filter)).
+		WithArgs("%jane\\_d%", "%jane\\_d%").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT "id","email","name","verified_at","suspended_at","created_at" FROM "users" WHERE `+filter+` ORDER BY created_at DESC, id DESC LIMIT $3 OFFSET $4`)).
+		WithArgs("%jane\\_d%", "%jane\\_d%", 3, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email", "name"}).
+			AddRow(9, "jane_d@example.com", "Jane").
+			AddRow(8, "jane_doe@example.com", "Jane Doe").
+			AddRow(7, "x@example.com", "Jane_D"))
+
+	suspended := true
+	users, pagination, err := service.ListUsers(ListUsersQuery{Q: " Jane_D ", Suspended: &suspended, Page: 2, Limit: 2})
+
+	assert.NoError(t, err)
+	assert.Len(t, users, 2)
+	assert.True(t, pagination.HasMore)
+	assert.Equal(t, int64(3), *pagination.Total)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestSuspendUser verifies that suspending a user ends their sessions and is audited.
+func TestSuspendUser(t *testing.T) {
+	service, mock := newMockAdminService(t)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(userQuery).WithArgs(7, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email"}).AddRow(7, "jane@example.com"))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "users" SET "suspended_at"=$1,"suspension_reason"=$2,"token_version"=token_version + 1,"updated_at"=$3 WHERE "users"."deleted_at" IS NULL AND "id" = $4`)).
+		WithArgs(sqlmock.AnyArg(), "chargebacks", sqlmock.AnyArg(), 7).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "refresh_tokens" SET "revoked_at"=$1 WHERE user_id = $2 AND revoked_at IS NULL`)).
+		WithArgs(sqlmock.AnyArg(), 7).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "api_keys" SET "revoked_at"=$1 WHERE user_id = $2 AND revoked_at IS NULL`)).
+		WithArgs(sqlmock.AnyArg(), 7).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "audit_logs"`)).
+		WithArgs("user_suspended", 7, 1, "203.0.113.7", "chargebacks", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectCommit()
+
+	mock.ExpectQuery(userQuery).WithArgs(7, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email", "suspended_at", "suspension_reason"}).AddRow(7, "jane@example.com", time.Now(), "chargebacks"))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT "role" FROM "user_roles" WHERE user_id = $1 ORDER BY role`)).
+		WithArgs(7).
+		WillReturnRows(sqlmock.NewRows([]string{"role"}).AddRow("customer"))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM "mfa_factors" WHERE user_id = $1 AND confirmed_at IS NOT NULL`)).
+		WithArgs(7).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT status, COUNT(*) AS count FROM "orders" WHERE user_id = $1 GROUP BY "status"`)).
+		WithArgs(7).
+		WillReturnRows(sqlmock.NewRows([]string{"status", "count"}).AddRow("delivered", 3).AddRow("cancelled", 1))
+
+	user, err := service.Suspend(7, 1, "203.0.113.7", " chargebacks ")
+
+	if assert.NoError(t, err) {
+		assert.NotNil(t, user.SuspendedAt)
+		assert.Equal(t, int64(4), user.Orders.Total)
+		assert.Equal(t, int64(3), user.Orders.ByStatus[models.OrderStatusDelivered])
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSuspendSelf(t *testing.T) {
+	service, mock := newMockAdminService(t)
+
+	_, err := service.Suspend(1, 1, "203.0.113.7", "")
+
+	assert.ErrorIs(t, err, ErrCannotSuspendSelf)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestForceLogoutRevokesAPIKeys verifies that logging a user out everywhere also stops their API keys.
+func TestForceLogoutRevokesAPIKeys(t *testing.T) {
+	service, mock := newMockAdminService(t)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(userQuery).WithArgs(7, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email"}).AddRow(7, "jane@example.com"))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "users" SET "token_version"=token_version + 1,"updated_at"=$1 WHERE "users"."deleted_at" IS NULL AND "id" = $2`)).
+		WithArgs(sqlmock.AnyArg(), 7).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "refresh_tokens" SET "revoked_at"=$1 WHERE user_id = $2 AND revoked_at IS NULL`)).
+		WithArgs(sqlmock.AnyArg(), 7).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "api_keys" SET "revoked_at"=$1 WHERE user_id = $2 AND revoked_at IS NULL`)).
+		WithArgs(sqlmock.AnyArg(), 7).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "audit_logs"`)).
+		WithArgs("user_logged_out", 7, 1, "203.0.113.7", "", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectCommit()
+
+	assert.NoError(t, service.ForceLogout(7, 1, "203.0.113.7"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,181 @@
+package users
+
+import (
+	"ecommerce-api/utils"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// UserController handles HTTP requests for the authenticated user's own account
+type UserController struct {
+	userService *UserService
+}
+
+// NewUserController initializes a new UserController
+func NewUserController(userService *UserService) *UserController {
+	return &UserController{userService: userService}
+}
+
+// userID reads the authenticated user's ID from the context, sending an error response if it is missing or malformed.
+func userID(ctx *gin.Context) (uint, bool) {
+	userIDStr, exists := ctx.Get("userID")
+	if !exists {
+		utils.NewAPIResponse(http.StatusUnauthorized, "Unauthorized", nil, "User ID not found in context").Send(ctx)
+		return 0, false
+	}
+
+	id, err := strconv.ParseUint(userIDStr.(string), 10, 32)
+	if err != nil {
+		utils.NewAPIResponse(http.StatusBadRequest, "Invalid User ID", nil, "User ID conversion failed").Send(ctx)
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// GetProfile godoc
+// @Summary      Get the current user
+// @Description  Returns the authenticated user's profile
+// @Tags         users
+// @Produce      json
+// @Success      200  {object}  utils.APIResponse{data=Profile}
+// @Failure      401  {object}  utils.APIResponse
+// @Failure      500  {object}  utils.APIResponse
+// @Security     BearerAuth
+// @Router       /users/me [get]
+func (c *UserController) GetProfile(ctx *gin.Context) {
+	userID, ok := userID(ctx)
+	if !ok {
+		return
+	}
+
+	profile, err := c.userService.GetProfile(userID)
+	if err != nil {
+		sendError(ctx, err, "Failed to retrieve profile")
+		return
+	}
+
+	utils.NewAPIResponse(http.StatusOK, "Profile retrieved successfully", profile, "").Send(ctx)
+}
+
+// UpdateProfile godoc
+// @Summary      Update the current user
+// @Description  Changes the authenticated user's name and email. Changing the email requires current_password, marks the address as unverified and sends a verification email.
+// @Tags         users
+// @Accept       json
+// @Produce      json
+// @Param        input  body      UpdateProfileDTO  true  "Fields to change"
+// @Success      200    {object}  utils.APIResponse{data=Profile}
+// @Failure      400    {object}  utils.APIResponse
+// @Failure      401    {object}  utils.APIResponse
+// @Failure      403    {object}  utils.APIResponse
+// @Failure      409    {object}  utils.APIResponse
+// @Failure      500    {object}  utils.APIResponse
+// @Security     BearerAuth
+// @Router       /users/me [patch]
+func (c *UserController) UpdateProfile(ctx *gin.Context) {
+	userID, ok := userID(ctx)
+	if !ok {
+		return
+	}
+
+	var input UpdateProfileDTO
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		utils.NewAPIResponse(http.StatusBadRequest, "Invalid input", nil, err.Error()).Send(ctx)
+		return
+	}
+
+	profile, err := c.userService.UpdateProfile(userID, input)
+	if err != nil {
+		sendError(ctx, err, "Failed to update profile")
+		return
+	}
+
+	utils.NewAPIResponse(http.StatusOK, "Profile updated successfully", profile, "").Send(ctx)
+}
+
+// ChangePassword godoc
+// @Summary      Change the current user's password
+// @Description  Sets a new password after checking the current one, which users who signed up through single sign-on and have no password leave out. Every session is ended and every API key revoked, so the user has to log in again.
+// @Tags         users
+// @Accept       json
+// @Produce      json
+// @Param        input  body      ChangePasswordDTO  true  "Current and new password"
+// @Success      200    {object}  utils.APIResponse
+// @Failure      400    {object}  utils.APIResponse
+// @Failure      401    {object}  utils.APIResponse
+// @Failure      403    {object}  utils.APIResponse
+// @Failure      500    {object}  utils.APIResponse
+// @Security     BearerAuth
+// @Router       /users/me/password [post]
+func (c *UserController) ChangePassword(ctx *gin.Context) {
+	userID, ok := userID(ctx)
+	if !ok {
+		return
+	}
+
+	var input ChangePasswordDTO
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		utils.NewAPIResponse(http.StatusBadRequest, "Invalid input", nil, err.Error()).Send(ctx)
+		return
+	}
+
+	if err := c.userService.ChangePassword(userID, input); err != nil {
+		sendError(ctx, err, "Failed to change password")
+		return
+	}
+
+	utils.NewAPIResponse(http.StatusOK, "Password changed successfully", nil, "").Send(ctx)
+}
+
+// DeleteAccount godoc
+// @Summary      Delete the current user
+// @Description  Deletes the authenticated user's account after checking their password, if they have one, and ends every session. Orders are kept.
+// @Tags         users
+// @Accept       json
+// @Produce      json
+// @Param        input  body      DeleteAccountDTO  true  "Current password"
+// @Success      200    {object}  utils.APIResponse
+// @Failure      400    {object}  utils.APIResponse
+// @Failure      401    {object}  utils.APIResponse
+// @Failure      403    {object}  utils.APIResponse
+// @Failure      500    {object}  utils.APIResponse
+// @Security     BearerAuth
+// @Router       /users/me [delete]
+func (c *UserController) DeleteAccount(ctx *gin.Context) {
+	userID, ok := userID(ctx)
+	if !ok {
+		return
+	}
+
+	var input DeleteAccountDTO
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		utils.NewAPIResponse(http.StatusBadRequest, "Invalid input", nil, err.Error()).Send(ctx)
+		return
+	}
+
+	if err := c.userService.DeleteAccount(userID, input.Password); err != nil {
+		sendError(ctx, err, "Failed to delete account")
+		return
+	}
+
+	utils.NewAPIResponse(http.StatusOK, "Account deleted successfully", nil, "").Send(ctx)
+}
+
+// sendError maps service errors to responses, using message for unexpected errors.
+func sendError(ctx *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, utils.ErrUserNotFound):
+		utils.NewAPIResponse(http.StatusUnauthorized, "Unauthorized", nil, err.Error()).Send(ctx)
+	case errors.Is(err, ErrIncorrectPassword):
+		utils.NewAPIResponse(http.StatusForbidden, "Incorrect password", nil, err.Error()).Send(ctx)
+	case errors.Is(err, ErrPasswordRequired):
+		utils.NewAPIResponse(http.StatusBadRequest, "Current password required", nil, err.Error()).Send(ctx)
+	case errors.Is(err, utils.ErrUserExists):
+		utils.NewAPIResponse(http.StatusConflict, "Email already in use", nil, err.Error()).Send(ctx)
+	default:
+		utils.NewAPIResponse(http.StatusInternalServerError, message, nil, err.Error()).Send(ctx)
+	}
+}
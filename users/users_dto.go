@@ -0,0 +1,84 @@
+package users
+
+import (
+	"time"
+
+	"ecommerce-api/models"
+)
+
+// Profile is the account information a user can see about themselves.
+type Profile struct {
+	ID            uint          `json:"id"`
+	Email         string        `json:"email"`
+	Name          string        `json:"name"`
+	EmailVerified bool          `json:"email_verified"`
+	VerifiedAt    *time.Time    `json:"verified_at,omitempty"`
+	Roles         []models.Role `json:"roles"`
+	CreatedAt     time.Time     `json:"created_at"`
+}
+
+// UpdateProfileDTO changes the fields that are set. Changing the email requires the current password,
+// unless the user has none because they signed up through an identity provider.
+type UpdateProfileDTO struct {
+	Name            *string `json:"name" binding:"omitempty,gt=0"`
+	Email           *string `json:"email" binding:"omitempty,email"`
+	CurrentPassword string  `json:"current_password"`
+}
+
+// ChangePasswordDTO sets a new password. CurrentPassword may be left out by users who have no
+// password yet because they signed up through an identity provider.
+type ChangePasswordDTO struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password" binding:"required,password"`
+}
+
+// DeleteAccountDTO confirms deleting the account. Password may be left out by users who have no
+// password because they signed up through an identity provider.
+type DeleteAccountDTO struct {
+	Password string `json:"password"`
+}
+
+// ListUsersQuery filters and paginates the admin user list.
+type ListUsersQuery struct {
+	// Q matches users whose email or name contains it, ignoring case.
+	Q         string `form:"q"`
+	Suspended *bool  `form:"suspended"`
+	Page      int    `form:"page" binding:"omitempty,gte=1"`
+	Limit     int    `form:"limit" binding:"omitempty,gte=1,lte=100"`
+}
+
+// UserSummary is a user as listed to admins.
+type UserSummary struct {
+	ID            uint       `json:"id"`
+	Email         string     `json:"email"`
+	Name          string     `json:"name"`
+	EmailVerified bool       `json:"email_verified"`
+	SuspendedAt   *time.Time `json:"suspended_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+// OrderCounts counts a user's orders, in total and by status.
+type OrderCounts struct {
+	Total    int64                        `json:"total"`
+	ByStatus map[models.OrderStatus]int64 `json:"by_status"`
+}
+
+// UserDetail is everything an admin can see about a user.
+type UserDetail struct {
+	ID               uint          `json:"id"`
+	Email            string        `json:"email"`
+	Name             string        `json:"name"`
+	EmailVerified    bool          `json:"email_verified"`
+	VerifiedAt       *time.Time    `json:"verified_at,omitempty"`
+	Roles            []models.Role `json:"roles"`
+	MFAEnabled       bool          `json:"mfa_enabled"`
+	SuspendedAt      *time.Time    `json:"suspended_at,omitempty"`
+	SuspensionReason string        `json:"suspension_reason,omitempty"`
+	Orders           OrderCounts   `json:"orders"`
+	CreatedAt        time.Time     `json:"created_at"`
+	UpdatedAt        time.Time     `json:"updated_at"`
+}
+
+type SuspendUserDTO struct {
+	Reason string `json:"reason" binding:"max=500"`
+}
@@ -0,0 +1,249 @@
+package users
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"ecommerce-api/apikeys"
+	"ecommerce-api/middleware"
+	"ecommerce-api/models"
+	"ecommerce-api/utils"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrIncorrectPassword is returned when the current password given to confirm a change is wrong.
+	ErrIncorrectPassword = errors.New("current password is incorrect")
+	// ErrPasswordRequired is returned when the email is changed without the current password.
+	ErrPasswordRequired = errors.New("current password is required to change the email address")
+)
+
+// Verifier sends the email that verifies a user's address. AuthService implements it.
+type Verifier interface {
+	ResendVerification(userID uint) error
+}
+
+// UserService lets users manage their own account
+type UserService struct {
+	db       *gorm.DB
+	verifier Verifier
+}
+
+// NewUserService initializes UserService with database connection and the verifier used after email changes
+func NewUserService(db *gorm.DB, verifier Verifier) *UserService {
+	return &UserService{db: db, verifier: verifier}
+}
+
+// GetProfile returns the profile of the user.
+//
+// Returns:
+// - utils.ErrUserNotFound if the user does not exist or was deleted.
+// - An error if any database operation fails.
+func (s *UserService) GetProfile(userID uint) (*Profile, error) {
+	user, err := findUser(s.db, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var roles []models.Role
+	if err := s.db.Model(&models.UserRole{}).Where("user_id = ?", userID).Order("role").Pluck("role", &roles).Error; err != nil {
+		return nil, errors.New("failed to retrieve user roles: " + err.Error())
+	}
+
+	return &Profile{
+		ID:            user.ID,
+		Email:         user.Email,
+		Name:          user.Name,
+		EmailVerified: user.VerifiedAt != nil,
+		VerifiedAt:    user.VerifiedAt,
+		Roles:         roles,
+		CreatedAt:     user.CreatedAt,
+	}, nil
+}
+
+// UpdateProfile changes the user's name and email.
+//
+// A new email address is unverified until the user opens the link emailed to it, so changing the
+// email requires the current password and sends a verification email. Users who signed up through
+// an identity provider have no password and are not asked for one. Failing to send the email does
+// not undo the change; the user can ask for another one.
+//
+// Returns:
+// - The updated profile.
+// - ErrPasswordRequired or ErrIncorrectPassword if the email changes without the right current password.
+// - utils.ErrUserExists if another account uses the new email.
+// - utils.ErrUserNotFound if the user does not exist or was deleted.
+// - An error if any database operation fails.
+func (s *UserService) UpdateProfile(userID uint, input UpdateProfileDTO) (*Profile, error) {
+	emailChanged := false
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		user, err := findUser(tx, userID)
+		if err != nil {
+			return err
+		}
+
+		updates := map[string]interface{}{}
+		if input.Name != nil {
+			updates["name"] = strings.TrimSpace(*input.Name)
+		}
+		if input.Email != nil && !strings.EqualFold(*input.Email, user.Email) {
+			if input.CurrentPassword == "" && user.Password != "" {
+				return ErrPasswordRequired
+			}
+			if err := checkPassword(user, input.CurrentPassword); err != nil {
+				return err
+			}
+
+			var count int64
+			if err := tx.Model(&models.User{}).Unscoped().Where("email = ? AND id <> ?", *input.Email, userID).Count(&count).Error; err != nil {
+				return errors.New("database error: " + err.Error())
+			}
+			if count > 0 {
+				return utils.ErrUserExists
+			}
+
+			updates["email"] = *input.Email
+			updates["verified_at"] = nil
+			emailChanged = true
+		}
+
+		if len(updates) == 0 {
+			return nil
+		}
+		if err := tx.Model(user).Updates(updates).Error; err != nil {
+			return errors.New("failed to update profile: " + err.Error())
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if emailChanged {
+		if err := s.verifier.ResendVerification(userID); err != nil {
+			log.Printf("failed to send verification email to user %d: %v", userID, err)
+		}
+	}
+	return s.GetProfile(userID)
+}
+
+// ChangePassword sets a new password after checking the current one. Users who signed up through an
+// identity provider have no password yet and set their first one without a current password. Every
+// session of the user is ended, including the current one, and their API keys are revoked, so a
+// stolen session does not survive the change.
+//
+// Returns:
+// - ErrIncorrectPassword if the current password is wrong.
+// - utils.ErrUserNotFound if the user does not exist or was deleted.
+// - An error if any database operation fails.
+func (s *UserService) ChangePassword(userID uint, input ChangePasswordDTO) error {
+	hashedPassword, err := utils.HashPassword(input.NewPassword)
+	if err != nil {
+		return err
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		user, err := findUser(tx, userID)
+		if err != nil {
+			return err
+		}
+		if err := checkPassword(user, input.CurrentPassword); err != nil {
+			return err
+		}
+
+		if err := tx.Model(user).Updates(map[string]interface{}{
+			"password":      hashedPassword,
+			"token_version": gorm.Expr("token_version + 1"),
+		}).Error; err != nil {
+			return errors.New("failed to update password: " + err.Error())
+		}
+		return endSessions(tx, userID)
+	})
+	if err != nil {
+		return err
+	}
+
+	middleware.ForgetUser(userID)
+	return nil
+}
+
+// DeleteAccount soft-deletes the user after checking their password, and ends every session. Users
+// without a password, who only log in through an identity provider, are not asked for one.
+//
+// The user's orders are kept, so order history and reporting are unaffected. The email address is
+// rewritten so that it can be used to register again, keeping the original for reference.
+//
+// Returns:
+// - ErrIncorrectPassword if the password is wrong.
+// - utils.ErrUserNotFound if the user does not exist or was already deleted.
+// - An error if any database operation fails.
+func (s *UserService) DeleteAccount(userID uint, password string) error {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		user, err := findUser(tx, userID)
+		if err != nil {
+			return err
+		}
+		if err := checkPassword(user, password); err != nil {
+			return err
+		}
+
+		if err := tx.Model(user).Updates(map[string]interface{}{
+			"email":         fmt.Sprintf("deleted-%d-%s", user.ID, user.Email),
+			"token_version": gorm.Expr("token_version + 1"),
+		}).Error; err != nil {
+			return errors.New("failed to release email: " + err.Error())
+		}
+		if err := tx.Delete(user).Error; err != nil {
+			return errors.New("failed to delete account: " + err.Error())
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&models.CartItem{}).Error; err != nil {
+			return errors.New("failed to clear cart: " + err.Error())
+		}
+		return endSessions(tx, userID)
+	})
+	if err != nil {
+		return err
+	}
+
+	middleware.ForgetUser(userID)
+	return nil
+}
+
+// findUser loads the user, returning utils.ErrUserNotFound if they do not exist or were deleted.
+func findUser(tx *gorm.DB, userID uint) (*models.User, error) {
+	var user models.User
+	if err := tx.Take(&user, userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, utils.ErrUserNotFound
+		}
+		return nil, errors.New("database error: " + err.Error())
+	}
+	return &user, nil
+}
+
+// checkPassword returns ErrIncorrectPassword unless password is the user's password. Users created
+// through an identity provider have no password; their session is the only proof of identity they
+// have, so any password is accepted for them.
+func checkPassword(user *models.User, password string) error {
+	if user.Password == "" {
+		return nil
+	}
+	if err := utils.ComparePasswords(password, user.Password); err != nil {
+		return ErrIncorrectPassword
+	}
+	return nil
+}
+
+// endSessions revokes every refresh token and API key of the user. Access tokens are revoked by
+// bumping the token version, which callers do together with their other changes.
+func endSessions(tx *gorm.DB, userID uint) error {
+	if err := tx.Model(&models.RefreshToken{}).Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now()).Error; err != nil {
+		return errors.New("failed to revoke refresh tokens: " + err.Error())
+	}
+	return apikeys.RevokeAll(tx, userID)
+}
@@ -0,0 +1,192 @@
+package users
+
+import (
+	"regexp"
+	"testing"
+
+	"ecommerce-api/internal/testdb"
+	"ecommerce-api/utils"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+// recordingVerifier records the users it was asked to send a verification email to.
+type recordingVerifier struct {
+	userIDs []uint
+}
+
+func (v *recordingVerifier) ResendVerification(userID uint) error {
+	v.userIDs = append(v.userIDs, userID)
+	return nil
+}
+
+func newMockUserService(t *testing.T) (*UserService, *recordingVerifier, sqlmock.Sqlmock) {
+	gormDB, mock := testdb.New(t)
+
+	verifier := &recordingVerifier{}
+	return NewUserService(gormDB, verifier), verifier, mock
+}
+
+var userQuery = regexp.QuoteMeta(`SELECT * FROM "users" WHERE "users"."id" = $1 AND "users"."deleted_at" IS NULL LIMIT $2`)
+
+func hashedPassword(t *testing.T, password string) string {
+	hash, err := utils.HashPassword(password)
+	if err != nil {
+		t.Fatalf("failed to hash password: %s", err)
+	}
+	return hash
+}
+
+func TestUpdateProfileEmailRequiresPassword(t *testing.T) {
+	service, verifier, mock := newMockUserService(t)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(userQuery).WithArgs(7, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email", "password"}).AddRow(7, "jane@example.com", hashedPassword(t, "Secret-123")))
+	mock.ExpectRollback()
+
+	email := "jane@example.org"
+	_, err := service.UpdateProfile(7, UpdateProfileDTO{Email: &email})
+
+	assert.ErrorIs(t, err, ErrPasswordRequired)
+	assert.Empty(t, verifier.userIDs)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpdateProfileEmailWithoutPassword(t *testing.T) {
+	service, verifier, mock := newMockUserService(t)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(userQuery).WithArgs(7, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email", "password"}).AddRow(7, "jane@example.com", ""))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM "users" WHERE email = $1 AND id <> $2`)).
+		WithArgs("jane@example.org", 7).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "users" SET "email"=$1,"verified_at"=$2,"updated_at"=$3 WHERE "users"."deleted_at" IS NULL AND "id" = $4`)).
+		WithArgs("jane@example.org", nil, sqlmock.AnyArg(), 7).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectQuery(userQuery).WithArgs(7, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email"}).AddRow(7, "jane@example.org"))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT "role" FROM "user_roles" WHERE user_id = $1 ORDER BY role`)).
+		WithArgs(7).
+		WillReturnRows(sqlmock.NewRows([]string{"role"}).AddRow("customer"))
+
+	email := "jane@example.org"
+	_, err := service.UpdateProfile(7, UpdateProfileDTO{Email: &email})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []uint{7}, verifier.userIDs)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpdateProfileEmailRequiresReverification(t *testing.T) {
+	service, verifier, mock := newMockUserService(t)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(userQuery).WithArgs(7, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email", "name", "password"}).AddRow(7, "jane@example.com", "Jane", hashedPassword(t, "Secret-123")))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM "users" WHERE email = $1 AND id <> $2`)).
+		WithArgs("jane@example.org", 7).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "users" SET "email"=$1,"verified_at"=$2,"updated_at"=$3 WHERE "users"."deleted_at" IS NULL AND "id" = $4`)).
+		WithArgs("jane@example.org", nil, sqlmock.AnyArg(), 7).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectQuery(userQuery).WithArgs(7, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email", "name"}).AddRow(7, "jane@example.org", "Jane"))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT "role" FROM "user_roles" WHERE user_id = $1 ORDER BY role`)).
+		WithArgs(7).
+		WillReturnRows(sqlmock.NewRows([]string{"role"}).AddRow("customer"))
+
+	email := "jane@example.org"
+	profile, err := service.UpdateProfile(7, UpdateProfileDTO{Email: &email, CurrentPassword: "Secret-123"})
+
+	if assert.NoError(t, err) {
+		assert.Equal(t, "jane@example.org", profile.Email)
+		assert.False(t, profile.EmailVerified)
+	}
+	assert.Equal(t, []uint{7}, verifier.userIDs)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestChangePasswordRejectsWrongPassword(t *testing.T) {
+	service, _, mock := newMockUserService(t)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(userQuery).WithArgs(7, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "password"}).AddRow(7, hashedPassword(t, "Secret-123")))
+	mock.ExpectRollback()
+
+	err := service.ChangePassword(7, ChangePasswordDTO{CurrentPassword: "wrong", NewPassword: "N3w-password!"})
+
+	assert.ErrorIs(t, err, ErrIncorrectPassword)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestChangePasswordWithoutPassword verifies that users who signed up through an identity provider,
+// and so have no password, can set one without a current password.
+func TestChangePasswordWithoutPassword(t *testing.T) {
+	service, _, mock := newMockUserService(t)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(userQuery).WithArgs(7, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "password"}).AddRow(7, ""))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "users" SET "password"=$1,"token_version"=token_version + 1,"updated_at"=$2 WHERE "users"."deleted_at" IS NULL AND "id" = $3`)).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), 7).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "refresh_tokens" SET "revoked_at"=$1 WHERE user_id = $2 AND revoked_at IS NULL`)).
+		WithArgs(sqlmock.AnyArg(), 7).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "api_keys" SET "revoked_at"=$1 WHERE user_id = $2 AND revoked_at IS NULL`)).
+		WithArgs(sqlmock.AnyArg(), 7).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	assert.NoError(t, service.ChangePassword(7, ChangePasswordDTO{NewPassword: "N3w-password!"}))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestChangePasswordRequiresCurrentPassword(t *testing.T) {
+	service, _, mock := newMockUserService(t)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(userQuery).WithArgs(7, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "password"}).AddRow(7, hashedPassword(t, "Secret-123")))
+	mock.ExpectRollback()
+
+	err := service.ChangePassword(7, ChangePasswordDTO{NewPassword: "N3w-password!"})
+
+	assert.ErrorIs(t, err, ErrIncorrectPassword)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestDeleteAccount verifies that the account is soft-deleted, its email released and its sessions
+// ended, while orders are left alone.
+func TestDeleteAccount(t *testing.T) {
+	service, _, mock := newMockUserService(t)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(userQuery).WithArgs(7, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email", "password"}).AddRow(7, "jane@example.com", hashedPassword(t, "Secret-123")))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "users" SET "email"=$1,"token_version"=token_version + 1,"updated_at"=$2 WHERE "users"."deleted_at" IS NULL AND "id" = $3`)).
+		WithArgs("deleted-7-jane@example.com", sqlmock.AnyArg(), 7).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "users" SET "deleted_at"=$1 WHERE "users"."id" = $2 AND "users"."deleted_at" IS NULL`)).
+		WithArgs(sqlmock.AnyArg(), 7).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM "cart_items" WHERE user_id = $1`)).
+		WithArgs(7).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "refresh_tokens" SET "revoked_at"=$1 WHERE user_id = $2 AND revoked_at IS NULL`)).
+		WithArgs(sqlmock.AnyArg(), 7).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "api_keys" SET "revoked_at"=$1 WHERE user_id = $2 AND revoked_at IS NULL`)).
+		WithArgs(sqlmock.AnyArg(), 7).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	assert.NoError(t, service.DeleteAccount(7, "Secret-123"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
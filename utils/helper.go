@@ -1,6 +1,12 @@
 package utils
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -18,3 +24,27 @@ func HashPassword(plaintext string) (string, error) {
 func ComparePasswords(plain, hashed string) error {
 	return bcrypt.CompareHashAndPassword([]byte(hashed), []byte(plain))
 }
+
+// GenerateRandomToken returns a URL-safe random token made from the given number of random bytes
+func GenerateRandomToken(size int) (string, error) {
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// HashToken hashes a random token for storage. Random tokens carry enough entropy that a fast
+// hash is sufficient, and unlike bcrypt it lets the token be looked up by its hash.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// ContainsPattern builds a LIKE pattern that matches values containing the given text.
+// LIKE wildcards in the text are escaped, so the pattern must be used with ESCAPE '\'.
+func ContainsPattern(text string) string {
+	return "%" + likeEscaper.Replace(text) + "%"
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
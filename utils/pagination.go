@@ -0,0 +1,72 @@
+package utils
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+)
+
+const (
+	// DefaultPageLimit is the page size used when a listing request does not set one.
+	DefaultPageLimit = 20
+	// MaxPageLimit is the largest page size a listing request may ask for.
+	MaxPageLimit = 100
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Pagination is the metadata returned alongside a page of results.
+// Total is only set when the client asked for it, because counting large tables is expensive.
+type Pagination struct {
+	Limit      int    `json:"limit"`
+	Page       int    `json:"page,omitempty"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	HasMore    bool   `json:"has_more"`
+	Total      *int64 `json:"total,omitempty"`
+}
+
+// Page wraps a page of items with its pagination metadata and is meant to be used as APIResponse data.
+type Page struct {
+	Items      interface{} `json:"items"`
+	Pagination Pagination  `json:"pagination"`
+}
+
+// Cursor is the position of the last item of a page in a keyset-paginated listing.
+// Sort records the ordering the cursor was issued for, Value the sort key of the last item
+// and ID its primary key, which breaks ties between items with the same sort key.
+type Cursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	ID    uint   `json:"id"`
+}
+
+// EncodeCursor serialises a cursor into the opaque string handed to clients.
+func EncodeCursor(cursor Cursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeCursor parses a cursor produced by EncodeCursor. It returns ErrInvalidCursor if the
+// string was not produced by EncodeCursor.
+func DecodeCursor(encoded string) (Cursor, error) {
+	var cursor Cursor
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return cursor, ErrInvalidCursor
+	}
+	if err := json.Unmarshal(data, &cursor); err != nil || cursor.ID == 0 {
+		return cursor, ErrInvalidCursor
+	}
+	return cursor, nil
+}
+
+// PageLimit clamps a requested page size to the range [1, MaxPageLimit], using DefaultPageLimit when unset.
+func PageLimit(limit int) int {
+	switch {
+	case limit <= 0:
+		return DefaultPageLimit
+	case limit > MaxPageLimit:
+		return MaxPageLimit
+	}
+	return limit
+}
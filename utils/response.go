@@ -11,6 +11,8 @@ var (
 	ErrUserNotFound       = errors.New("user not found")
 	ErrUserExists         = errors.New("user with email already exists")
 	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrInvalidToken       = errors.New("invalid or expired token")
+	ErrAccountSuspended   = errors.New("account is suspended")
 )
 
 type Map = map[string]interface{}
@@ -38,3 +38,58 @@ func TestComparePasswords(t *testing.T) {
 		t.Error("expected an error for incorrect password comparison, got nil")
 	}
 }
+
+// TestCursorRoundTrip verifies that an encoded cursor decodes to the same position.
+func TestCursorRoundTrip(t *testing.T) {
+	cursor := Cursor{Sort: "-price", Value: "1500", ID: 42}
+
+	decoded, err := DecodeCursor(EncodeCursor(cursor))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if decoded != cursor {
+		t.Errorf("expected %+v, got %+v", cursor, decoded)
+	}
+}
+
+// TestDecodeCursorInvalid verifies that strings not produced by EncodeCursor are rejected.
+func TestDecodeCursorInvalid(t *testing.T) {
+	for _, encoded := range []string{"not base64!", "bm90IGpzb24", EncodeCursor(Cursor{Sort: "name"})} {
+		if _, err := DecodeCursor(encoded); err != ErrInvalidCursor {
+			t.Errorf("DecodeCursor(%q): expected ErrInvalidCursor, got %v", encoded, err)
+		}
+	}
+}
+
+// TestPageLimit verifies that page sizes are defaulted and capped.
+func TestPageLimit(t *testing.T) {
+	tests := map[int]int{0: DefaultPageLimit, -5: DefaultPageLimit, 10: 10, MaxPageLimit + 1: MaxPageLimit}
+	for requested, expected := range tests {
+		if got := PageLimit(requested); got != expected {
+			t.Errorf("PageLimit(%d): expected %d, got %d", requested, expected, got)
+		}
+	}
+}
+
+// TestContainsPattern verifies that LIKE wildcards in user input are escaped.
+func TestContainsPattern(t *testing.T) {
+	if got := ContainsPattern(`50%_off\`); got != `%50\%\_off\\%` {
+		t.Errorf("unexpected pattern %q", got)
+	}
+}
+
+// TestGenerateRandomToken verifies that tokens are unique and hash deterministically.
+func TestGenerateRandomToken(t *testing.T) {
+	first, err := GenerateRandomToken(32)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	second, _ := GenerateRandomToken(32)
+
+	if first == second {
+		t.Error("expected two random tokens to differ")
+	}
+	if HashToken(first) != HashToken(first) || HashToken(first) == HashToken(second) {
+		t.Error("expected HashToken to be deterministic and distinguish tokens")
+	}
+}